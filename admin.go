@@ -0,0 +1,204 @@
+package main
+
+// adminTemplate renders admin_service.go, an implementation of the
+// admin.LayerAdmin gRPC service over the generated repositories of messages
+// with the full profile. It is only emitted with the admin=true plugin option,
+// and only compiled with the fdbadmin build tag under build_tags=true.
+const adminTemplate = `{{define "admin"}}// Code generated by fdb-go-layer-plugin {{pluginVersion}}. DO NOT EDIT.
+{{with buildTag "admin"}}
+//go:build {{.}}
+{{end}}
+package repositories
+
+import (
+    "context"
+    "errors"
+
+    "github.com/apple/foundationdb/bindings/go/src/fdb"
+    "github.com/romannikov/fdb-go-layer-plugin/fdb-layer/admin"
+    "google.golang.org/grpc"
+    "google.golang.org/grpc/codes"
+    "google.golang.org/grpc/status"
+    "google.golang.org/protobuf/proto"
+    "google.golang.org/protobuf/types/known/anypb"
+)
+
+// AdminAuthFunc authorizes a call to the admin service. method is the full
+// gRPC method name, e.g. admin.LayerAdmin_Purge_FullMethodName. Returning an
+// error, preferably a gRPC status error, rejects the call.
+type AdminAuthFunc func(ctx context.Context, method string) error
+
+// AdminServer implements admin.LayerAdminServer on top of the generated
+// repositories, so that maintenance can be triggered remotely.
+type AdminServer struct {
+    admin.UnimplementedLayerAdminServer
+    db     fdb.Transactor
+    auth   AdminAuthFunc
+    prefix []string
+}
+
+// NewAdminServer returns an admin service for the repositories stored in db
+// under prefix. auth is called before every RPC; a nil auth allows all calls.
+func NewAdminServer(db fdb.Transactor, auth AdminAuthFunc, prefix ...string) *AdminServer {
+    return &AdminServer{db: db, auth: auth, prefix: prefix}
+}
+
+// adminRepository is the part of a generated repository used by AdminServer.
+type adminRepository interface {
+    RebuildIndexes(ctx context.Context, progress ProgressReporter) (Plan, error)
+    Purge(ctx context.Context, progress ProgressReporter) (Plan, error)
+    EstimatedSizeBytes(ctx context.Context) (int64, error)
+    GetJobStatus(ctx context.Context, tr fdb.ReadTransaction, name string) (*JobStatus, error)
+    listRecords(ctx context.Context, fn func(records []proto.Message) error) (int, error)
+}
+
+func (s *AdminServer) authorize(ctx context.Context, method string) error {
+    if s.auth == nil {
+        return nil
+    }
+    return s.auth(ctx, method)
+}
+
+func (s *AdminServer) repository(messageType string, dryRun bool) (adminRepository, error) {
+    switch messageType {
+    {{range .}}{{if and (.Generates "maintenance") (.Generates "export")}}case "{{.Name}}":
+        repo, err := New{{.Name}}Repository(s.db, s.prefix...)
+        if err != nil {
+            return nil, status.Error(codes.Internal, err.Error())
+        }
+        if dryRun {
+            return repo.DryRun(), nil
+        }
+        return repo, nil
+    {{end}}{{end}}
+    }
+    return nil, status.Errorf(codes.NotFound, "unknown message type %q", messageType)
+}
+
+func (s *AdminServer) RebuildIndexes(ctx context.Context, req *admin.MaintenanceRequest) (*admin.PlanResponse, error) {
+    if err := s.authorize(ctx, admin.LayerAdmin_RebuildIndexes_FullMethodName); err != nil {
+        return nil, err
+    }
+    repo, err := s.repository(req.MessageType, req.DryRun)
+    if err != nil {
+        return nil, err
+    }
+    return planResponse(repo.RebuildIndexes(ctx, nil))
+}
+
+func (s *AdminServer) Purge(ctx context.Context, req *admin.MaintenanceRequest) (*admin.PlanResponse, error) {
+    if err := s.authorize(ctx, admin.LayerAdmin_Purge_FullMethodName); err != nil {
+        return nil, err
+    }
+    repo, err := s.repository(req.MessageType, req.DryRun)
+    if err != nil {
+        return nil, err
+    }
+    return planResponse(repo.Purge(ctx, nil))
+}
+
+// CheckConsistency runs RebuildIndexes in dry-run mode regardless of
+// req.DryRun.
+func (s *AdminServer) CheckConsistency(ctx context.Context, req *admin.MaintenanceRequest) (*admin.PlanResponse, error) {
+    if err := s.authorize(ctx, admin.LayerAdmin_CheckConsistency_FullMethodName); err != nil {
+        return nil, err
+    }
+    repo, err := s.repository(req.MessageType, true)
+    if err != nil {
+        return nil, err
+    }
+    return planResponse(repo.RebuildIndexes(ctx, nil))
+}
+
+func (s *AdminServer) GetStats(ctx context.Context, req *admin.StatsRequest) (*admin.StatsResponse, error) {
+    if err := s.authorize(ctx, admin.LayerAdmin_GetStats_FullMethodName); err != nil {
+        return nil, err
+    }
+    repo, err := s.repository(req.MessageType, false)
+    if err != nil {
+        return nil, err
+    }
+    size, err := repo.EstimatedSizeBytes(ctx)
+    if err != nil {
+        return nil, status.Error(codes.Internal, err.Error())
+    }
+    resp := &admin.StatsResponse{MessageType: req.MessageType, EstimatedBytes: size}
+    for _, name := range []string{JobRebuildIndexes} {
+        job, err := readTransactContext(ctx, s.db, func(tr fdb.ReadTransaction) (interface{}, error) {
+            return repo.GetJobStatus(ctx, tr, name)
+        })
+        if err != nil {
+            return nil, status.Error(codes.Internal, err.Error())
+        }
+        if job := job.(*JobStatus); job != nil {
+            resp.Jobs = append(resp.Jobs, &admin.JobStatus{
+                Name:               job.Name,
+                Done:               job.Done,
+                Records:            int64(job.Records),
+                StartedAtUnixNanos: job.StartedAt.UnixNano(),
+                UpdatedAtUnixNanos: job.UpdatedAt.UnixNano(),
+            })
+        }
+    }
+    return resp, nil
+}
+
+// errListLimit stops a List stream once its limit is reached.
+var errListLimit = errors.New("list limit reached")
+
+// List streams the records of req.MessageType, reading them in batches
+// across transactions so that streams are not bound by the transaction time
+// limit.
+func (s *AdminServer) List(req *admin.ListRequest, stream grpc.ServerStreamingServer[admin.ListResponse]) error {
+    ctx := stream.Context()
+    if err := s.authorize(ctx, admin.LayerAdmin_List_FullMethodName); err != nil {
+        return err
+    }
+    repo, err := s.repository(req.MessageType, false)
+    if err != nil {
+        return err
+    }
+    remaining := req.Limit
+    _, err = repo.listRecords(ctx, func(records []proto.Message) error {
+        if req.Limit > 0 && int64(len(records)) > remaining {
+            records = records[:remaining]
+        }
+        resp := &admin.ListResponse{Records: make([]*anypb.Any, len(records))}
+        for i, record := range records {
+            var err error
+            if resp.Records[i], err = anypb.New(record); err != nil {
+                return err
+            }
+        }
+        if err := stream.Send(resp); err != nil {
+            return err
+        }
+        remaining -= int64(len(records))
+        if req.Limit > 0 && remaining == 0 {
+            return errListLimit
+        }
+        return nil
+    })
+    if err != nil && !errors.Is(err, errListLimit) {
+        if _, ok := status.FromError(err); ok {
+            return err
+        }
+        return status.Error(codes.Internal, err.Error())
+    }
+    return nil
+}
+
+func planResponse(plan Plan, err error) (*admin.PlanResponse, error) {
+    if err != nil {
+        return nil, status.Error(codes.Internal, err.Error())
+    }
+    return &admin.PlanResponse{
+        Operation:      plan.Operation,
+        DryRun:         plan.DryRun,
+        Records:        int64(plan.Records),
+        KeysWritten:    int64(plan.KeysWritten),
+        KeysCleared:    int64(plan.KeysCleared),
+        EstimatedBytes: plan.EstimatedBytes,
+    }, nil
+}
+{{end}}`
@@ -0,0 +1,134 @@
+package main
+
+// archiveTemplate generates the archive tier of messages with the archive
+// option: Archive moves old records to a blob store, leaving a stub holding
+// the blob key, and GetWithArchive reads them back.
+const archiveTemplate = `{{define "archive"}}{{if .Archive}}
+// WithBlobStore returns a copy of the repository that archives records to
+// store.
+func (repo *{{.Name}}Repository) WithBlobStore(store BlobStore) *{{.Name}}Repository {
+    withStore := *repo
+    withStore.blobs = store
+    return &withStore
+}
+
+// blobKey returns the blob store key of the archived record with primary key
+// pk.
+func (repo *{{.Name}}Repository) blobKey(pk tuple.Tuple) string {
+    return fmt.Sprintf("%s/%x", {{printf "%q" (join .DirectoryPath "/")}}, pk.Pack())
+}
+
+// Archive moves the records whose {{.Archive.Name}} is older than olderThan to the
+// blob store, one batch of records per transaction. Archived records and
+// their index entries are removed, so they are only returned by
+// GetWithArchive. Records changed after they were read are skipped. Their
+// blob is left in the store and overwritten when they are archived again.
+// It returns the number of records archived.
+func (repo *{{.Name}}Repository) Archive(ctx context.Context, olderThan time.Time) (int, error) {
+    if repo.blobs == nil {
+        return 0, errors.New("{{.Name}}: Archive requires a blob store, see WithBlobStore")
+    }
+    archived := 0
+    _, err := repo.scanRecords(ctx, func(entities []*pb.{{.Name}}) error {
+        var old []*pb.{{.Name}}
+        var blobKeys []string
+        for _, entity := range entities {
+            {{if .Archive.Timestamp}}if entity.{{.Archive.Name}} == nil || !entity.{{.Archive.Name}}.AsTime().Before(olderThan) {
+                continue
+            }{{else}}if !time.Unix(entity.{{.Archive.Name}}, 0).Before(olderThan) {
+                continue
+            }{{end}}
+            data, err := repo.marshal(entity)
+            if err != nil {
+                return err
+            }
+            blobKey := repo.blobKey(tuple.Tuple{ {{range .PrimaryKeyFields}} {{toTuple (printf "entity.%s" .Path) .}}, {{end}} })
+            if err := repo.blobs.Put(ctx, blobKey, data); err != nil {
+                return err
+            }
+            old = append(old, entity)
+            blobKeys = append(blobKeys, blobKey)
+        }
+        if len(old) == 0 {
+            return nil
+        }
+
+        moved := 0
+        err := transactOnce(ctx, repo.db, MetaSubspace(repo.dir, MarkersSubspace), func(tr fdb.Transaction) error {
+            moved = 0
+            for i, entity := range old {
+                pk := tuple.Tuple{ {{range .PrimaryKeyFields}} {{toTuple (printf "entity.%s" .Path) .}}, {{end}} }
+                value, err := tr.Get(repo.recordKey(pk)).Get()
+                if err != nil {
+                    return err
+                }
+                if value == nil {
+                    continue
+                }
+                stored := &pb.{{.Name}}{}
+                if err := repo.unmarshal(value, stored); err != nil {
+                    return err
+                }
+                {{if .CRDTFields}}if err := repo.loadCRDTFields(tr, stored); err != nil {
+                    return err
+                }
+                {{end}}
+                if !proto.Equal(stored, entity) {
+                    continue
+                }
+                for _, indexKey := range repo.indexKeys(stored) {
+                    tr.Clear(indexKey)
+                }
+                {{if .ElementIndexes}}for _, elementKey := range repo.elementKeys(stored) {
+                    tr.Clear(elementKey)
+                }
+                {{end}}
+                tr.Clear(repo.recordKey(pk))
+                {{if .ETag}}tr.Clear(MetaSubspace(repo.dir, VersionsSubspace).Pack(pk))
+                {{end}}tr.Set(MetaSubspace(repo.dir, ArchiveSubspace).Pack(pk), []byte(blobKeys[i]))
+                moved++
+            }
+            return nil
+        })
+        if err != nil {
+            return err
+        }
+        archived += moved
+        return nil
+    })
+    return archived, err
+}
+
+// GetWithArchive is like Get, but fetches the record from the blob store if
+// it was archived.
+func (repo *{{.Name}}Repository) GetWithArchive(ctx context.Context, tr fdb.ReadTransaction, {{range $index, $element := .PrimaryKeyFields}}{{if $index}}, {{end}}{{.Name}} {{.Type}}{{end}}) (*pb.{{.Name}}, error) {
+    entity, err := repo.getIfExists(tr, {{range $index, $element := .PrimaryKeyFields}}{{if $index}}, {{end}}{{.Name}}{{end}})
+    if err != nil || entity != nil {
+        return entity, err
+    }
+    stub, err := tr.Get(MetaSubspace(repo.dir, ArchiveSubspace).Pack(tuple.Tuple{ {{range .PrimaryKeyFields}} {{toTuple .Name .}}, {{end}} })).Get()
+    if err != nil {
+        return nil, err
+    }
+    if stub == nil {
+        return nil, Err{{.Name}}NotFound
+    }
+    if repo.blobs == nil {
+        return nil, errors.New("{{.Name}}: record is archived, see WithBlobStore")
+    }
+    data, err := repo.blobs.Get(ctx, string(stub))
+    if err != nil {
+        return nil, err
+    }
+    entity = &pb.{{.Name}}{}
+    if err := repo.unmarshal(data, entity); err != nil {
+        return nil, err
+    }
+    {{if .CRDTFields}}// Counters and element sets are kept in FoundationDB
+    if err := repo.loadCRDTFields(tr, entity); err != nil {
+        return nil, err
+    }
+    {{end}}
+    return entity, nil
+}
+{{end}}{{end}}`
@@ -0,0 +1,217 @@
+package main
+
+const batchTemplate = `{{define "batch"}}
+// err{{.Name}}BatchTooSlow aborts a transaction of ApplyBatch that takes longer
+// than the MaxDuration of the batch limits, so that its operations are split.
+var err{{.Name}}BatchTooSlow = errors.New("{{.Name}} batch transaction too slow")
+
+// WithBatchLimits returns a copy of the repository grouping the operations of
+// ApplyBatch, the Batch methods{{if .Generates "writer"}}, writers{{end}}{{if .Generates "import"}} and Import{{end}} into transactions
+// within limits. Zero fields keep their defaults.
+func (repo *{{.Name}}Repository) WithBatchLimits(limits BatchLimits) *{{.Name}}Repository {
+    withLimits := *repo
+    withLimits.batchLimits = limits
+    return &withLimits
+}
+
+// {{.Name}}Op is a single operation for ApplyBatch. Exactly one of Set,
+// Create and Delete must be non-nil. Create is like Set, but fails with
+// ErrAlreadyExists if the record exists.
+type {{.Name}}Op struct {
+    Set    *pb.{{.Name}}
+    Create *pb.{{.Name}}
+    Delete *{{.Name}}Key
+}
+
+func (op {{.Name}}Op) validate() error {
+    count := 0
+    for _, set := range []bool{op.Set != nil, op.Create != nil, op.Delete != nil} {
+        if set {
+            count++
+        }
+    }
+    if count != 1 {
+        return errors.New("{{.Name}}Op must have exactly one of Set, Create and Delete")
+    }
+    return nil
+}
+
+// entity returns the record written by op, nil for a Delete.
+func (op {{.Name}}Op) entity() *pb.{{.Name}} {
+    if op.Set != nil {
+        return op.Set
+    }
+    return op.Create
+}
+
+func (op {{.Name}}Op) key() {{.Name}}Key {
+    if entity := op.entity(); entity != nil {
+        return {{.Name}}Key{ {{range .PrimaryKeyFields}}{{.Name}}: entity.{{.Path}}, {{end}} }
+    }
+    return *op.Delete
+}
+
+func (op {{.Name}}Op) size() int {
+    if entity := op.entity(); entity != nil {
+        return proto.Size(entity)
+    }
+    return 0
+}
+
+// {{.Name}}OpError reports an operation that ApplyBatch could not apply.
+type {{.Name}}OpError struct {
+    Index int // position of the operation in the ops slice
+    Op    {{.Name}}Op
+    Err   error
+}
+
+func (e {{.Name}}OpError) Error() string {
+    return fmt.Sprintf("{{.Name}} operation %d: %v", e.Index, e.Err)
+}
+
+func (e {{.Name}}OpError) Unwrap() error {
+    return e.Err
+}
+
+// ApplyBatch applies ops in order, grouping them into as few transactions as
+// the batch limits allow. Each transaction is retried by the FoundationDB
+// retry loop; when one still fails, its operations are applied one by one to
+// find the culprits. Once an operation fails, later operations on the same
+// key are not applied either, so per-key ordering is preserved. It returns
+// the operations that were not applied, or nil if all of them succeeded.
+func (repo *{{.Name}}Repository) ApplyBatch(ctx context.Context, ops []{{.Name}}Op) []{{.Name}}OpError {
+    var failed []{{.Name}}OpError
+    failedKeys := map[string]bool{}
+
+    // Validate up front so that bad operations never reach a transaction
+    pending := make([]int, 0, len(ops))
+    for i, op := range ops {
+        if err := op.validate(); err != nil {
+            failed = append(failed, {{.Name}}OpError{Index: i, Op: op, Err: err})
+            continue
+        }
+        pending = append(pending, i)
+    }
+
+    limits := repo.batchLimits.withDefaults()
+    for len(pending) > 0 {
+        n := next{{.Name}}Chunk(limits, len(pending), func(i int) int { return ops[pending[i]].size() })
+        var err error
+        if len(failedKeys) == 0 {
+            // A chunk rejected as too large or too slow is halved and
+            // retried, down to a single operation
+            for {
+                chunk := make([]{{.Name}}Op, 0, n)
+                for _, i := range pending[:n] {
+                    chunk = append(chunk, ops[i])
+                }
+                err = repo.applyOps(ctx, chunk)
+                var fdbErr fdb.Error
+                tooLarge := errors.As(err, &fdbErr) && fdbErr.Code == 2101
+                if (tooLarge || errors.Is(err, err{{.Name}}BatchTooSlow)) && n > 1 {
+                    n /= 2
+                    continue
+                }
+                break
+            }
+            if err == nil {
+                pending = pending[n:]
+                continue
+            }
+        }
+        // Isolate failures by applying the chunk one operation at a time. A
+        // single operation that failed above is not applied again.
+        for _, i := range pending[:n] {
+            op := ops[i]
+            key := string(op.key().toTuple().Pack())
+            if failedKeys[key] {
+                failed = append(failed, {{.Name}}OpError{Index: i, Op: op, Err: errors.New("skipped after an earlier operation on the same key failed")})
+                continue
+            }
+            if n > 1 || err == nil {
+                err = repo.applyOps(ctx, []{{.Name}}Op{op})
+            }
+            if err != nil {
+                failedKeys[key] = true
+                failed = append(failed, {{.Name}}OpError{Index: i, Op: op, Err: err})
+            }
+        }
+        pending = pending[n:]
+    }
+
+    sort.Slice(failed, func(i, j int) bool { return failed[i].Index < failed[j].Index })
+    return failed
+}
+
+// next{{.Name}}Chunk returns how many of the next count operations fit in
+// one transaction within limits. It always returns at least one.
+func next{{.Name}}Chunk(limits BatchLimits, count int, size func(i int) int) int {
+    n, bytes := 0, 0
+    for n < count && n < limits.MaxOps && (n == 0 || bytes+size(n) <= limits.MaxBytes) {
+        bytes += size(n)
+        n++
+    }
+    return n
+}
+
+// applyOps applies ops in a single transaction, committed at most once. It
+// fails with err{{.Name}}BatchTooSlow if several operations take longer than
+// the MaxDuration of the batch limits.
+func (repo *{{.Name}}Repository) applyOps(ctx context.Context, ops []{{.Name}}Op) error {
+    maxDuration := repo.batchLimits.withDefaults().MaxDuration
+    return transactOnce(ctx, repo.db, MetaSubspace(repo.dir, MarkersSubspace), func(tr fdb.Transaction) error {
+        start := time.Now()
+        for i, op := range ops {
+            if i > 0 && time.Since(start) > maxDuration {
+                return err{{.Name}}BatchTooSlow
+            }
+            var err error
+            switch {
+            case op.Set != nil:
+                err = repo.Set(ctx, tr, op.Set)
+            case op.Create != nil:
+                {{if .AutoUUIDField}}_, {{end}}err = repo.Create(ctx, tr, op.Create)
+            default:
+                err = repo.Delete(ctx, tr, {{range $index, $element := .PrimaryKeyFields}}{{if $index}}, {{end}}op.Delete.{{.Name}}{{end}})
+            }
+            if err != nil {
+                return err
+            }
+        }
+        return nil
+    })
+}
+
+// BatchSet writes entities like Set, in as many transactions as the batch
+// limits require. It returns the entities that could not be
+// written, as reported by ApplyBatch, whose Index is their position in
+// entities.
+func (repo *{{.Name}}Repository) BatchSet(ctx context.Context, entities []*pb.{{.Name}}) []{{.Name}}OpError {
+    ops := make([]{{.Name}}Op, len(entities))
+    for i, entity := range entities {
+        ops[i] = {{.Name}}Op{Set: entity}
+    }
+    return repo.ApplyBatch(ctx, ops)
+}
+
+// BatchCreate is like BatchSet, but fails with ErrAlreadyExists for the
+// entities whose record exists, leaving it unchanged.
+func (repo *{{.Name}}Repository) BatchCreate(ctx context.Context, entities []*pb.{{.Name}}) []{{.Name}}OpError {
+    ops := make([]{{.Name}}Op, len(entities))
+    for i, entity := range entities {
+        ops[i] = {{.Name}}Op{Create: entity}
+    }
+    return repo.ApplyBatch(ctx, ops)
+}
+
+// BatchDelete deletes the records with the given primary keys like Delete,
+// in as many transactions as the batch limits require. It returns the deletions
+// that failed, as reported by ApplyBatch.
+func (repo *{{.Name}}Repository) BatchDelete(ctx context.Context, keys []{{.Name}}Key) []{{.Name}}OpError {
+    ops := make([]{{.Name}}Op, len(keys))
+    for i := range keys {
+        ops[i] = {{.Name}}Op{Delete: &keys[i]}
+    }
+    return repo.ApplyBatch(ctx, ops)
+}
+{{end}}`
@@ -0,0 +1,69 @@
+package main
+
+// blobRefTemplate generates the handling of blob reference fields: Set
+// validates them against their pattern, and objects referenced by deleted
+// records are queued in the same transaction for CleanupBlobs, so that an
+// object is only removed once the deletion of its record has committed.
+const blobRefTemplate = `{{define "blobRef"}}{{if .HasBlobRefPatterns}}
+var (
+    {{range .BlobRefs}}{{if .Pattern}}{{lowerFirst $.Name}}{{.Field.Name}}Pattern = regexp.MustCompile({{printf "%q" .Pattern}})
+    {{end}}{{end}}
+)
+
+// validate{{.Name}}BlobRefs checks that the non-empty blob references of
+// entity match their pattern.
+func validate{{.Name}}BlobRefs(entity *pb.{{.Name}}) error {
+    {{range .BlobRefs}}{{if .Pattern}}if entity.{{.Field.Name}} != "" && !{{lowerFirst $.Name}}{{.Field.Name}}Pattern.MatchString(entity.{{.Field.Name}}) {
+        return fmt.Errorf("{{$.Name}}: invalid blob reference %q in {{.Field.Name}}", entity.{{.Field.Name}})
+    }
+    {{end}}{{end}}
+    return nil
+}
+{{end}}{{if .HasBlobCleanup}}
+// CleanupBlobs calls cleanup for the objects referenced by deleted records,
+// in batches of {{lowerFirst .Name}}ScanBatch, and forgets the references it
+// succeeded for. cleanup must tolerate objects that were already removed,
+// since a reference is only forgotten after cleanup returns. Run it
+// periodically, for example as a WorkerJob. It returns the number of objects
+// cleaned up.
+func (repo *{{.Name}}Repository) CleanupBlobs(ctx context.Context, cleanup func(ctx context.Context, ref string) error) (int, error) {
+    pending := MetaSubspace(repo.dir, BlobCleanupSubspace)
+    cleaned := 0
+    for {
+        result, err := readTransactContext(ctx, repo.db, func(tr fdb.ReadTransaction) (interface{}, error) {
+            return tr.GetRange(pending, fdb.RangeOptions{Limit: {{lowerFirst .Name}}ScanBatch}).GetSliceWithError()
+        })
+        if err != nil {
+            return cleaned, err
+        }
+        kvs := result.([]fdb.KeyValue)
+        if len(kvs) == 0 {
+            return cleaned, nil
+        }
+        for _, kv := range kvs {
+            if err := ctx.Err(); err != nil {
+                return cleaned, err
+            }
+            tpl, err := pending.Unpack(kv.Key)
+            if err != nil {
+                return cleaned, err
+            }
+            ref, ok := tpl[0].(string)
+            if !ok {
+                return cleaned, fmt.Errorf("{{.Name}}: malformed blob reference %v", tpl)
+            }
+            if err := cleanup(ctx, ref); err != nil {
+                return cleaned, err
+            }
+            _, err = transactContext(ctx, repo.db, func(tr fdb.Transaction) (interface{}, error) {
+                tr.Clear(kv.Key)
+                return nil, nil
+            })
+            if err != nil {
+                return cleaned, err
+            }
+            cleaned++
+        }
+    }
+}
+{{end}}{{end}}`
@@ -0,0 +1,157 @@
+package main
+
+// cacheTemplate generates the optional cache layer of a repository: GetCached
+// serves records from a Cache and counts their reads, FlushAccessStats
+// persists the counts, and WarmCache fills the cache with the records read
+// most at startup.
+const cacheTemplate = `{{define "cache"}}
+// WithCache returns a copy of the repository that serves GetCached from
+// cache and counts the records it reads.
+func (repo *{{.Name}}Repository) WithCache(cache Cache) *{{.Name}}Repository {
+    withCache := *repo
+    withCache.cache = cache
+    withCache.accesses = &accessCounter{}
+    return &withCache
+}
+
+// GetCached is like Get, but serves the record from the cache, under its
+// FoundationDB key, reading it in its own transaction on a miss. Set and
+// Delete evict the records they change before they commit, so a GetCached
+// running concurrently may cache the old version again: use a cache with a
+// TTL bounding how stale records can get.
+func (repo *{{.Name}}Repository) GetCached(ctx context.Context, {{range $index, $element := .PrimaryKeyFields}}{{if $index}}, {{end}}{{.Name}} {{.Type}}{{end}}) (*pb.{{.Name}}, error) {
+    if repo.cache == nil {
+        return nil, errors.New("{{.Name}}: GetCached requires a cache, see WithCache")
+    }
+    pk := tuple.Tuple{ {{range .PrimaryKeyFields}} {{toTuple .Name .}}, {{end}} }
+    repo.accesses.add(pk.Pack())
+    key := string(repo.recordKey(pk))
+    value, ok := repo.cache.Get(key)
+    if !ok {
+        result, err := readTransactContext(ctx, repo.db, func(tr fdb.ReadTransaction) (interface{}, error) {
+            return repo.getIfExists(tr, {{range $index, $element := .PrimaryKeyFields}}{{if $index}}, {{end}}{{.Name}}{{end}})
+        })
+        if err != nil {
+            return nil, err
+        }
+        if result.(*pb.{{.Name}}) == nil {
+            return nil, Err{{.Name}}NotFound
+        }
+        if value, err = repo.marshal(result.(*pb.{{.Name}})); err != nil {
+            return nil, err
+        }
+        repo.cache.Set(key, value)
+    }
+    entity := &pb.{{.Name}}{}
+    if err := repo.unmarshal(value, entity); err != nil {
+        return nil, err
+    }
+    return entity, nil
+}
+
+// FlushAccessStats adds the reads counted by GetCached since the last flush
+// to the access stats in FoundationDB, which WarmCache uses to find the
+// records read most. Call it periodically, for example as a WorkerJob.
+func (repo *{{.Name}}Repository) FlushAccessStats(ctx context.Context) error {
+    if repo.accesses == nil {
+        return nil
+    }
+    counts := repo.accesses.take()
+    if len(counts) == 0 {
+        return nil
+    }
+    stats := MetaSubspace(repo.dir, AccessStatsSubspace).Bytes()
+    _, err := transactContext(ctx, repo.db, func(tr fdb.Transaction) (interface{}, error) {
+        for pk, count := range counts {
+            delta := make([]byte, 8)
+            binary.LittleEndian.PutUint64(delta, uint64(count))
+            tr.Add(fdb.Key(append(append([]byte{}, stats...), pk...)), delta)
+        }
+        return nil, nil
+    })
+    return err
+}
+
+// WarmCache reads the access stats and loads the limit records read most
+// into the cache, so that a service starts with a warm cache. It returns the
+// number of records cached.
+func (repo *{{.Name}}Repository) WarmCache(ctx context.Context, limit int) (int, error) {
+    if repo.cache == nil {
+        return 0, errors.New("{{.Name}}: WarmCache requires a cache, see WithCache")
+    }
+    type hotKey struct {
+        key   {{.Name}}Key
+        pk    tuple.Tuple
+        count int64
+    }
+    var hot []hotKey
+    stats := MetaSubspace(repo.dir, AccessStatsSubspace)
+    begin, end := stats.FDBRangeKeys()
+    for {
+        if err := ctx.Err(); err != nil {
+            return 0, err
+        }
+        result, err := readTransactContext(ctx, repo.db, func(tr fdb.ReadTransaction) (interface{}, error) {
+            return tr.GetRange(fdb.KeyRange{Begin: begin, End: end}, fdb.RangeOptions{Limit: {{lowerFirst .Name}}ScanBatch}).GetSliceWithError()
+        })
+        if err != nil {
+            return 0, err
+        }
+        kvs := result.([]fdb.KeyValue)
+        for _, kv := range kvs {
+            tpl, err := stats.Unpack(kv.Key)
+            if err != nil {
+                return 0, err
+            }
+            key, ok := {{lowerFirst .Name}}KeyFromTuple(tpl)
+            if !ok || len(kv.Value) != 8 {
+                return 0, fmt.Errorf("{{.Name}}: malformed access stats %v", tpl)
+            }
+            hot = append(hot, hotKey{key: key, pk: tpl, count: int64(binary.LittleEndian.Uint64(kv.Value))})
+        }
+        if len(kvs) < {{lowerFirst .Name}}ScanBatch {
+            break
+        }
+        begin = append(kvs[len(kvs)-1].Key, 0x00)
+    }
+    sort.Slice(hot, func(i, j int) bool { return hot[i].count > hot[j].count })
+    if len(hot) > limit {
+        hot = hot[:limit]
+    }
+
+    cached := 0
+    for len(hot) > 0 {
+        batch := hot
+        if len(batch) > {{lowerFirst .Name}}ScanBatch {
+            batch = batch[:{{lowerFirst .Name}}ScanBatch]
+        }
+        hot = hot[len(batch):]
+        result, err := readTransactContext(ctx, repo.db, func(tr fdb.ReadTransaction) (interface{}, error) {
+            entities := make([]*pb.{{.Name}}, len(batch))
+            for i, h := range batch {
+                entity, err := repo.getIfExists(tr, {{range $index, $element := .PrimaryKeyFields}}{{if $index}}, {{end}}h.key.{{.Name}}{{end}})
+                if err != nil {
+                    return nil, err
+                }
+                entities[i] = entity
+            }
+            return entities, nil
+        })
+        if err != nil {
+            return cached, err
+        }
+        for i, entity := range result.([]*pb.{{.Name}}) {
+            if entity == nil {
+                continue
+            }
+            value, err := repo.marshal(entity)
+            if err != nil {
+                return cached, err
+            }
+            repo.cache.Set(string(repo.recordKey(batch[i].pk)), value)
+            cached++
+        }
+    }
+    return cached, nil
+}
+{{end}}`
@@ -0,0 +1,168 @@
+package main
+
+// changesTemplate generates the change log of messages with the change_log
+// option. Set and Delete append an entry keyed by the commit versionstamp,
+// so that consumers such as replicas read changes in commit order.
+const changesTemplate = `{{define "changes"}}{{if .ChangeLog}}
+// {{lowerFirst .Name}}SubscribePoll is how often SubscribeByPrefix reads the change log
+// when no watch fired.
+const {{lowerFirst .Name}}SubscribePoll = time.Second
+
+// {{.Name}}Change is an entry of the {{.Name}} change log.
+type {{.Name}}Change struct {
+    // Cursor identifies the entry. ReadChanges returns the entries after it.
+    Cursor fdb.Key
+    // Version is the commit version of the change. Changes made by the same
+    // transaction share it.
+    Version tuple.Versionstamp
+    Key     {{.Name}}Key
+    // Record is the new version of the record, or nil if it was deleted.
+    Record *pb.{{.Name}}
+}
+
+// logChange appends the change of the record with primary key pk to the
+// change log. record is the serialized new version, or nil for a delete.
+// Several changes of a record in one transaction leave its last one.
+func (repo *{{.Name}}Repository) logChange(tr fdb.Transaction, pk tuple.Tuple, record []byte) error {
+    key, err := append(tuple.Tuple{tuple.IncompleteVersionstamp(0)}, pk...).PackWithVersionstamp(MetaSubspace(repo.dir, ChangesSubspace).Bytes())
+    if err != nil {
+        return err
+    }
+    var value tuple.TupleElement
+    if record != nil {
+        value = record
+    }
+    tr.SetVersionstampedKey(fdb.Key(key), tuple.Tuple{value}.Pack())
+    // Changing the head fires the watches of subscribers
+    tr.Add(repo.changesHeadKey(), []byte{1, 0, 0, 0, 0, 0, 0, 0})
+    return nil
+}
+
+// changesHeadKey returns the key counting the changes logged, which
+// subscribers watch to learn about new entries.
+func (repo *{{.Name}}Repository) changesHeadKey() fdb.Key {
+    return MetaSubspace(repo.dir, CursorsSubspace).Pack(tuple.Tuple{"changes", "head"})
+}
+
+// ReadChanges returns up to limit change log entries committed after the
+// entry identified by after, oldest first. A nil after reads from the start
+// of the log. A limit of 0 means no limit.
+func (repo *{{.Name}}Repository) ReadChanges(ctx context.Context, tr fdb.ReadTransaction, after fdb.Key, limit int) ([]{{.Name}}Change, error) {
+    changes := MetaSubspace(repo.dir, ChangesSubspace)
+    begin, end := changes.FDBRangeKeys()
+    if after != nil {
+        begin = append(append(fdb.Key{}, after...), 0x00)
+    }
+    kvs, err := tr.GetRange(fdb.KeyRange{Begin: begin, End: end}, fdb.RangeOptions{Limit: limit}).GetSliceWithError()
+    if err != nil {
+        return nil, err
+    }
+    result := make([]{{.Name}}Change, 0, len(kvs))
+    for _, kv := range kvs {
+        tpl, err := changes.Unpack(kv.Key)
+        if err != nil {
+            return nil, err
+        }
+        version, ok := tpl[0].(tuple.Versionstamp)
+        if !ok {
+            return nil, fmt.Errorf("{{.Name}}: malformed change log entry %v", tpl)
+        }
+        key, ok := {{lowerFirst .Name}}KeyFromTuple(tpl[1:])
+        if !ok {
+            return nil, fmt.Errorf("{{.Name}}: malformed change log entry %v", tpl)
+        }
+        change := {{.Name}}Change{Cursor: kv.Key, Version: version, Key: key}
+        value, err := tuple.Unpack(kv.Value)
+        if err != nil {
+            return nil, err
+        }
+        if record, ok := value[0].([]byte); ok {
+            change.Record = &pb.{{.Name}}{}
+            if err := repo.unmarshal(record, change.Record); err != nil {
+                return nil, err
+            }
+        }
+        result = append(result, change)
+    }
+    return result, nil
+}
+
+// SubscribeByPrefix sends the change log entries committed after the entry
+// identified by after whose primary key starts with prefix, oldest first,
+// until ctx is done, when the channel is closed. prefix holds leading primary
+// key fields, with integers as int64. A nil after starts from the beginning of
+// the log; pass the Cursor of the last event received to resume. As
+// FoundationDB has no range watches, new entries are found by watching the
+// head of the change log, and by polling every {{lowerFirst .Name}}SubscribePoll in case a
+// watch is late.
+func (repo *{{.Name}}Repository) SubscribeByPrefix(ctx context.Context, after fdb.Key, prefix ...tuple.TupleElement) <-chan {{.Name}}WatchEvent {
+    events := make(chan {{.Name}}WatchEvent)
+    packedPrefix := tuple.Tuple(prefix).Pack()
+    go func() {
+        defer close(events)
+        send := func(event {{.Name}}WatchEvent) bool {
+            select {
+            case events <- event:
+                return true
+            case <-ctx.Done():
+                return false
+            }
+        }
+
+        cursor := after
+        for ctx.Err() == nil {
+            var watch fdb.FutureNil
+            result, err := transactContext(ctx, repo.db, func(tr fdb.Transaction) (interface{}, error) {
+                if watch != nil {
+                    watch.Cancel()
+                    watch = nil
+                }
+                changes, err := repo.ReadChanges(ctx, tr, cursor, {{lowerFirst .Name}}ScanBatch)
+                if err != nil {
+                    return nil, err
+                }
+                if len(changes) < {{lowerFirst .Name}}ScanBatch {
+                    watch = tr.Watch(repo.changesHeadKey())
+                }
+                return changes, nil
+            })
+            if err != nil {
+                if ctx.Err() == nil {
+                    send({{.Name}}WatchEvent{Err: err})
+                }
+                return
+            }
+
+            for _, change := range result.([]{{.Name}}Change) {
+                cursor = change.Cursor
+                if !bytes.HasPrefix(change.Key.toTuple().Pack(), packedPrefix) {
+                    continue
+                }
+                if !send({{.Name}}WatchEvent{Key: change.Key, Record: change.Record, Cursor: change.Cursor}) {
+                    if watch != nil {
+                        watch.Cancel()
+                    }
+                    return
+                }
+            }
+            if watch != nil {
+                pollCtx, cancel := context.WithTimeout(ctx, {{lowerFirst .Name}}SubscribePoll)
+                err := waitWatches(pollCtx, []fdb.FutureNil{watch})
+                cancel()
+                if err != nil {
+                    send({{.Name}}WatchEvent{Err: err})
+                    return
+                }
+            }
+        }
+    }()
+    return events
+}
+
+// TrimChanges removes the change log entries up to and including the entry
+// identified by upTo, once every consumer has read them.
+func (repo *{{.Name}}Repository) TrimChanges(ctx context.Context, tr fdb.Transaction, upTo fdb.Key) {
+    begin, _ := MetaSubspace(repo.dir, ChangesSubspace).FDBRangeKeys()
+    tr.ClearRange(fdb.KeyRange{Begin: begin, End: append(append(fdb.Key{}, upTo...), 0x00)})
+}
+{{end}}{{end}}`
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/cmd/protoc-gen-go/internal_gengo"
+	"google.golang.org/protobuf/compiler/protogen"
+	"google.golang.org/protobuf/types/pluginpb"
+)
+
+// fixtureModule is the module path of testdata/module, which holds the code
+// generated for the fixtures.
+const fixtureModule = "example.com/fixtures"
+
+// TestGeneratedCodeCompiles type-checks the code generated for the fixtures,
+// with its protoc-gen-go messages and the tests of testdata/integration,
+// under the plugin options changing which files and declarations are
+// generated. The code is type-checked from source rather than built, so that
+// it does not need the FoundationDB client library.
+func TestGeneratedCodeCompiles(t *testing.T) {
+	if testing.Short() {
+		t.Skip("type-checks the generated code and its dependencies from source")
+	}
+	for _, tc := range []struct {
+		name, parameter, tags string
+		// protos are the protos of testdata/proto generated instead of the
+		// fixtures, without the integration tests
+		protos []string
+	}{
+		{"default", goldenParameter, "", nil},
+		{"split_files", goldenParameter + ",split_files=true", "", nil},
+		{"build_tags", goldenParameter + ",build_tags=true,cache=false", "fdbadmin,fdbtestharness", nil},
+		{"faults", goldenParameter, "fdbfaults", nil},
+		// The fixtures use the change log, which cdc=false rejects
+		{"no_cdc", goldenParameter + ",cdc=false", "", []string{"nocdc.proto"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			typeCheck(t, writeModule(t, tc.parameter, tc.protos), tc.tags)
+		})
+	}
+}
+
+// TestGeneratedCodeIntegration runs the tests of testdata/integration on the
+// code generated for the fixtures, against the cluster of FDB_CLUSTER_FILE.
+// It needs the FoundationDB client library and is skipped without a
+// cluster. Its benchmarks run once, to check that they still work. The tests
+// of retries run again with the fdbfaults build tag, which injects faults.
+func TestGeneratedCodeIntegration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds the generated code and runs its tests")
+	}
+	if os.Getenv("FDB_CLUSTER_FILE") == "" {
+		t.Skip("FDB_CLUSTER_FILE is not set")
+	}
+	dir := writeModule(t, goldenParameter, nil)
+	for _, args := range [][]string{
+		{"-bench=.", "-benchtime=1x"},
+		{"-tags=fdbfaults", "-run=Fault"},
+	} {
+		cmd := exec.Command("go", append(append([]string{"test", "-count=1"}, args...), "./...")...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "GOFLAGS=-mod=mod")
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("go test %s: %v\n%s", strings.Join(args, " "), err, out)
+		}
+		t.Logf("%s", out)
+	}
+}
+
+// writeModule writes the module of the code generated for the fixtures with
+// parameter to a temporary directory and returns it: testdata/module, using
+// this checkout of the plugin, the messages in pb and the repositories in
+// repositories, with the tests of testdata/integration. If protos is not nil,
+// the code is generated for these protos of testdata/proto instead, without
+// the tests, which use the fixtures.
+func writeModule(t *testing.T, parameter string, protos []string) string {
+	t.Helper()
+	dir := t.TempDir()
+	root, err := filepath.Abs(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	goMod, err := os.ReadFile(filepath.Join("testdata", "module", "go.mod"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	goMod = fmt.Appendf(goMod, "\nreplace github.com/romannikov/fdb-go-layer-plugin => %s\n", root)
+	goSum, err := os.ReadFile(filepath.Join("testdata", "module", "go.sum"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "go.mod"), string(goMod))
+	writeFile(t, filepath.Join(dir, "go.sum"), string(goSum))
+
+	request := func(parameter string) *pluginpb.CodeGeneratorRequest {
+		if protos == nil {
+			return fixtureRequest(t, parameter)
+		}
+		return protoRequest(t, filepath.Join("testdata", "proto"), protos, parameter)
+	}
+	gen, err := protogen.Options{}.New(request("module=" + fixtureModule))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range gen.Files {
+		if file.Generate {
+			internal_gengo.GenerateFile(gen, file)
+		}
+	}
+	resp := gen.Response()
+	if resp.Error != nil {
+		t.Fatal(resp.GetError())
+	}
+	for _, f := range resp.File {
+		writeFile(t, filepath.Join(dir, f.GetName()), f.GetContent())
+	}
+
+	for name, content := range runPlugin(t, request(parameter)) {
+		writeFile(t, filepath.Join(dir, "repositories", name), content)
+	}
+	if protos != nil {
+		return dir
+	}
+	tests, err := filepath.Glob(filepath.Join("testdata", "integration", "*_test.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range tests {
+		content, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		writeFile(t, filepath.Join(dir, "repositories", filepath.Base(name)), string(content))
+	}
+	return dir
+}
+
+func writeFile(t *testing.T, name, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// listedPackage is the part of the output of go list -json typeCheck reads.
+type listedPackage struct {
+	ImportPath string
+	Dir        string
+	GoFiles    []string
+	CgoFiles   []string
+	ImportMap  map[string]string
+	Standard   bool
+	Module     *struct{ GoVersion string }
+	Error      *struct{ Err string }
+}
+
+// checkedDependencies holds the packages outside fixtureModule checked by
+// typeCheck, which are the same for every module it checks.
+var checkedDependencies = map[string]*types.Package{}
+
+// importerFunc is a types.Importer calling itself.
+type importerFunc func(path string) (*types.Package, error)
+
+func (f importerFunc) Import(path string) (*types.Package, error) {
+	return f(path)
+}
+
+// typeCheck type-checks the packages of the module in dir built with tags,
+// with their tests, reporting their errors. Their dependencies are checked
+// too, ignoring errors, with cgo files checked against a fake "C" package.
+func typeCheck(t *testing.T, dir, tags string) {
+	t.Helper()
+	args := []string{"list", "-e", "-deps", "-test", "-json"}
+	if tags != "" {
+		args = append(args, "-tags", tags)
+	}
+	cmd := exec.Command("go", append(args, "./...")...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "CGO_ENABLED=1", "GOFLAGS=-mod=mod")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("go list: %v\n%s", err, stderr.Bytes())
+	}
+
+	fset := token.NewFileSet()
+	checked := map[string]*types.Package{}
+	dec := json.NewDecoder(bytes.NewReader(out))
+	for {
+		var p listedPackage
+		if err := dec.Decode(&p); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if strings.HasSuffix(p.ImportPath, ".test") {
+			// The generated main package of a test binary
+			continue
+		}
+		local := p.ImportPath == fixtureModule || strings.HasPrefix(p.ImportPath, fixtureModule+"/")
+		if pkg, ok := checkedDependencies[p.ImportPath]; ok && !local {
+			checked[p.ImportPath] = pkg
+			continue
+		}
+		if p.Error != nil && local {
+			t.Errorf("%s: %s", p.ImportPath, p.Error.Err)
+		}
+
+		var files []*ast.File
+		for _, name := range append(append([]string{}, p.GoFiles...), p.CgoFiles...) {
+			file, err := parser.ParseFile(fset, filepath.Join(p.Dir, name), nil, parser.SkipObjectResolution)
+			if err != nil {
+				if local {
+					t.Error(err)
+				}
+				continue
+			}
+			files = append(files, file)
+		}
+		importMap := p.ImportMap
+		conf := types.Config{
+			FakeImportC: true,
+			Importer: importerFunc(func(path string) (*types.Package, error) {
+				if mapped, ok := importMap[path]; ok {
+					path = mapped
+				}
+				if path == "unsafe" {
+					return types.Unsafe, nil
+				}
+				if pkg, ok := checked[path]; ok {
+					return pkg, nil
+				}
+				return nil, fmt.Errorf("package %s is not checked", path)
+			}),
+			Error: func(err error) {
+				if local {
+					t.Error(err)
+				}
+			},
+		}
+		if p.Module != nil && p.Module.GoVersion != "" && !p.Standard {
+			conf.GoVersion = "go" + p.Module.GoVersion
+		}
+		pkg, _ := conf.Check(p.ImportPath, fset, files, nil)
+		checked[p.ImportPath] = pkg
+		if !local {
+			checkedDependencies[p.ImportPath] = pkg
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+// crdtTemplate generates the mutators of counter, element_set, touch and
+// side_stored fields.
+// These fields are stored outside the record, one key per counter, time or
+// value and one key per set element, and their mutators are blind writes:
+// concurrent transactions changing them never conflict.
+const crdtTemplate = `{{define "crdt"}}{{if .CRDTFields}}{{$msg := .}}
+// crdtKey returns the subspace holding the counters and element sets of the
+// record with primary key pk.
+func (repo *{{.Name}}Repository) crdtKey(pk tuple.Tuple) subspace.Subspace {
+    return MetaSubspace(repo.dir, CRDTSubspace).Sub(pk...)
+}
+
+// loadCRDTFields reads the counters and element sets of entity.
+func (repo *{{.Name}}Repository) loadCRDTFields(tr fdb.ReadTransaction, entity *pb.{{.Name}}) error {
+    crdt := repo.crdtKey(tuple.Tuple{ {{range .PrimaryKeyFields}} {{toTuple (printf "entity.%s" .Path) .}}, {{end}} })
+    {{range .CRDTFields}}{{if .Set}}{{lowerFirst .Field.Name}}Future := tr.GetRange(crdt.Sub({{.Field.Number}}), fdb.RangeOptions{}).Iterator()
+    {{else}}{{lowerFirst .Field.Name}}Future := tr.Get(crdt.Pack(tuple.Tuple{ {{.Field.Number}} }))
+    {{end}}{{end}}
+    {{range .CRDTFields}}{{if .Set}}entity.{{.Field.Name}} = nil
+    for {{lowerFirst .Field.Name}}Future.Advance() {
+        kv, err := {{lowerFirst .Field.Name}}Future.Get()
+        if err != nil {
+            return err
+        }
+        tpl, err := crdt.Unpack(kv.Key)
+        if err != nil {
+            return err
+        }
+        element, ok := {{assertTuple "tpl[len(tpl)-1]" .Field}}
+        if !ok {
+            return fmt.Errorf("{{$msg.Name}}: malformed {{.Field.ProtoName}} element %v", tpl)
+        }
+        entity.{{.Field.Name}} = append(entity.{{.Field.Name}}, {{fromTuple "element" .Field}})
+    }
+    {{else if .Side}}if value, err := {{lowerFirst .Field.Name}}Future.Get(); err != nil {
+        return err
+    } else if value != nil {
+        tpl, err := tuple.Unpack(value)
+        if err != nil {
+            return err
+        }
+        v, ok := {{assertTuple "tpl[0]" .Field}}
+        if len(tpl) != 1 || !ok {
+            return fmt.Errorf("{{$msg.Name}}: malformed {{.Field.ProtoName}} value %v", tpl)
+        }
+        entity.{{.Field.Name}} = {{fromTuple "v" .Field}}
+    } else {
+        entity.{{.Field.Name}} = {{.Field.Zero}}
+    }
+    {{else}}if value, err := {{lowerFirst .Field.Name}}Future.Get(); err != nil {
+        return err
+    } else if len(value) == 8 {
+        entity.{{.Field.Name}} = {{.Field.Type}}(binary.LittleEndian.Uint64(value))
+    } else {
+        entity.{{.Field.Name}} = 0
+    }
+    {{end}}{{end}}
+    return nil
+}
+
+// setCRDTFields writes the fields of entity stored outside the record.{{if .HasCountersOrSets}}
+// Counters and element sets are only initialized if created, for a new
+// record: those of a stored record are left alone, so that its blind
+// mutators in concurrent transactions are not undone.{{end}} Touch times
+// only move forward.
+func (repo *{{.Name}}Repository) setCRDTFields(tr fdb.Transaction, entity *pb.{{.Name}}{{if .HasCountersOrSets}}, created bool{{end}}) {
+    crdt := repo.crdtKey(tuple.Tuple{ {{range .PrimaryKeyFields}} {{toTuple (printf "entity.%s" .Path) .}}, {{end}} })
+    {{range .CRDTFields}}{{if .Set}}if created {
+        // Clear the elements added before the record was created
+        tr.ClearRange(crdt.Sub({{.Field.Number}}))
+        for _, element := range entity.{{.Field.Name}} {
+            tr.Set(crdt.Pack(tuple.Tuple{ {{.Field.Number}}, {{toTuple "element" .Field}} }), []byte{})
+        }
+    }
+    {{else if .Touch}}tr.Max(crdt.Pack(tuple.Tuple{ {{.Field.Number}} }), {{lowerFirst $msg.Name}}CounterValue(entity.{{.Field.Name}}))
+    {{else if .Side}}tr.Set(crdt.Pack(tuple.Tuple{ {{.Field.Number}} }), tuple.Tuple{ {{toTuple (printf "entity.%s" .Field.Name) .Field}} }.Pack())
+    {{else}}if created {
+        tr.Set(crdt.Pack(tuple.Tuple{ {{.Field.Number}} }), {{lowerFirst $msg.Name}}CounterValue(int64(entity.{{.Field.Name}})))
+    }
+    {{end}}{{end}}
+}
+
+// {{lowerFirst .Name}}CounterValue encodes a counter delta as the operand of an
+// atomic add.
+func {{lowerFirst .Name}}CounterValue(delta int64) []byte {
+    value := make([]byte, 8)
+    binary.LittleEndian.PutUint64(value, uint64(delta))
+    return value
+}
+{{range .CRDTFields}}{{if .Set}}
+// Add{{.Field.Name}} adds elements to the {{.Field.ProtoName}} set of the record with the
+// given primary key. It does not read anything, so it never conflicts with
+// other transactions. An element added and removed by concurrent
+// transactions ends up in the state of the one committed last.
+func (repo *{{$msg.Name}}Repository) Add{{.Field.Name}}(ctx context.Context, tr fdb.Transaction, {{range $msg.PrimaryKeyFields}}{{.Name}} {{.Type}}, {{end}}elements ...{{.Field.Type}}) {
+    crdt := repo.crdtKey(tuple.Tuple{ {{range $msg.PrimaryKeyFields}} {{toTuple .Name .}}, {{end}} })
+    for _, element := range elements {
+        tr.Set(crdt.Pack(tuple.Tuple{ {{.Field.Number}}, {{toTuple "element" .Field}} }), []byte{})
+    }
+}
+
+// Remove{{.Field.Name}} removes elements from the {{.Field.ProtoName}} set of the record with
+// the given primary key. Like Add{{.Field.Name}}, it never conflicts.
+func (repo *{{$msg.Name}}Repository) Remove{{.Field.Name}}(ctx context.Context, tr fdb.Transaction, {{range $msg.PrimaryKeyFields}}{{.Name}} {{.Type}}, {{end}}elements ...{{.Field.Type}}) {
+    crdt := repo.crdtKey(tuple.Tuple{ {{range $msg.PrimaryKeyFields}} {{toTuple .Name .}}, {{end}} })
+    for _, element := range elements {
+        tr.Clear(crdt.Pack(tuple.Tuple{ {{.Field.Number}}, {{toTuple "element" .Field}} }))
+    }
+}
+{{else if .Touch}}
+// Touch{{.Field.Name}} moves the {{.Field.ProtoName}} time of the record with the given
+// primary key forward to at, in Unix seconds, leaving it unchanged if it is
+// already later. It is an atomic maximum that reads nothing, so heartbeats
+// never conflict with each other or with writes of the record.
+func (repo *{{$msg.Name}}Repository) Touch{{.Field.Name}}(ctx context.Context, tr fdb.Transaction, {{range $msg.PrimaryKeyFields}}{{.Name}} {{.Type}}, {{end}}at time.Time) {
+    crdt := repo.crdtKey(tuple.Tuple{ {{range $msg.PrimaryKeyFields}} {{toTuple .Name .}}, {{end}} })
+    tr.Max(crdt.Pack(tuple.Tuple{ {{.Field.Number}} }), {{lowerFirst $msg.Name}}CounterValue(at.Unix()))
+}
+{{else if .Side}}
+// Set{{.Field.Name}} sets the {{.Field.ProtoName}} field of the record with the given primary
+// key to value. It overwrites the key holding the field without reading it or
+// rewriting the record, so it never conflicts with other transactions; of
+// concurrent calls, the one committed last wins.
+func (repo *{{$msg.Name}}Repository) Set{{.Field.Name}}(ctx context.Context, tr fdb.Transaction, {{range $msg.PrimaryKeyFields}}{{.Name}} {{.Type}}, {{end}}value {{.Field.Type}}) {
+    crdt := repo.crdtKey(tuple.Tuple{ {{range $msg.PrimaryKeyFields}} {{toTuple .Name .}}, {{end}} })
+    tr.Set(crdt.Pack(tuple.Tuple{ {{.Field.Number}} }), tuple.Tuple{ {{toTuple "value" .Field}} }.Pack())
+}
+{{else}}
+// Add{{.Field.Name}} adds delta, which may be negative, to the {{.Field.ProtoName}} counter of
+// the record with the given primary key. It is an atomic add, so it never
+// conflicts with other transactions.
+func (repo *{{$msg.Name}}Repository) Add{{.Field.Name}}(ctx context.Context, tr fdb.Transaction, {{range $msg.PrimaryKeyFields}}{{.Name}} {{.Type}}, {{end}}delta int64) {
+    crdt := repo.crdtKey(tuple.Tuple{ {{range $msg.PrimaryKeyFields}} {{toTuple .Name .}}, {{end}} })
+    tr.Add(crdt.Pack(tuple.Tuple{ {{.Field.Number}} }), {{lowerFirst $msg.Name}}CounterValue(delta))
+}
+{{end}}{{end}}{{end}}{{end}}`
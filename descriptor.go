@@ -0,0 +1,53 @@
+package main
+
+// descriptorTemplate generates the MessageDescriptor of a message, which
+// describes its storage layout to code outside the generated package.
+const descriptorTemplate = `{{define "descriptor"}}
+// {{.Name}}Descriptor describes how {{.Name}} records are stored.
+var {{.Name}}Descriptor = MessageDescriptor{
+    Name:          "{{.Name}}",
+    DirectoryPath: {{stringSlice .DirectoryPath}},
+    PrimaryKey: []FieldDescriptor{
+        {{range .PrimaryKeyFields}}{Name: "{{.Name}}", Type: "{{.Type}}"},
+        {{end}}
+    },
+    Indexes: []IndexDescriptor{
+        {{range $idx := .SecondaryIndexes}}{
+            Subspace: "{{$idx.Name}}_index",
+            Fields: []FieldDescriptor{
+                {{range $idx.Fields}}{Name: "{{.Name}}", Type: "{{.Type}}"},
+                {{end}}
+            },
+            Unique: {{$idx.Unique}},
+            Covering: {{$idx.Covering}},
+            Global: {{$idx.Global}},
+        },
+        {{end}}{{range $ei := .ElementIndexes}}{
+            Subspace: "{{$ei.Name}}_index",
+            Fields: []FieldDescriptor{
+                {Name: "{{$ei.Field.Name}}", Type: "{{$ei.Element.Type}}"},
+            },
+            {{if $ei.Keys}}Keys: true,{{else}}Elements: true,{{end}}
+        },
+        {{end}}
+    },
+    ChangeLog: {{.ChangeLog}},
+    Buckets: {{.Buckets}},
+    RecordLayer: {{if .RecordLayer}}true{{else}}false{{end}},
+    SchemaFingerprint: {{.Name}}SchemaFingerprint,
+}
+
+// {{.Name}}SchemaFingerprint identifies the storage layout of {{.Name}} records.
+const {{.Name}}SchemaFingerprint = "{{.Fingerprint}}"
+
+// Descriptor returns the storage layout of the repository's records.
+func (repo *{{.Name}}Repository) Descriptor() MessageDescriptor {
+    return {{.Name}}Descriptor
+}
+
+// Directory returns the directory holding the repository's records, index
+// entries and metadata, laid out as described by Descriptor.
+func (repo *{{.Name}}Repository) Directory() directory.DirectorySubspace {
+    return repo.dir
+}
+{{end}}`
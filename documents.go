@@ -0,0 +1,266 @@
+package main
+
+// documentsTemplate renders documents.go, readers for the export formats of
+// other document databases, used with ImportDocuments to migrate data.
+const documentsTemplate = `{{define "documents"}}// Code generated by fdb-go-layer-plugin {{pluginVersion}}. DO NOT EDIT.
+
+package repositories
+
+import (
+    "bufio"
+    "encoding/json"
+    "fmt"
+    "io"
+    "strconv"
+    "time"
+)
+
+// Document is a document read from another database's export. Attribute
+// values are converted to string, int64, float64, bool, []byte, time.Time,
+// nil, []interface{} or Document.
+type Document map[string]interface{}
+
+// DocumentReader reads the documents of an export one at a time. Next
+// returns io.EOF after the last document.
+type DocumentReader interface {
+    Next() (Document, error)
+}
+
+// jsonLinesReader reads one JSON value per line and converts it with decode.
+type jsonLinesReader struct {
+    scanner *bufio.Scanner
+    decode  func(line []byte) (Document, error)
+}
+
+func newJSONLinesReader(r io.Reader, decode func(line []byte) (Document, error)) *jsonLinesReader {
+    scanner := bufio.NewScanner(r)
+    scanner.Buffer(nil, 64<<20)
+    return &jsonLinesReader{scanner: scanner, decode: decode}
+}
+
+func (r *jsonLinesReader) Next() (Document, error) {
+    for r.scanner.Scan() {
+        if len(r.scanner.Bytes()) == 0 {
+            continue
+        }
+        return r.decode(r.scanner.Bytes())
+    }
+    if err := r.scanner.Err(); err != nil {
+        return nil, err
+    }
+    return nil, io.EOF
+}
+
+// NewDynamoDBReader reads a DynamoDB JSON export: one {"Item": {...}} object
+// per line, with attributes in the typed DynamoDB JSON format.
+func NewDynamoDBReader(r io.Reader) DocumentReader {
+    return newJSONLinesReader(r, func(line []byte) (Document, error) {
+        var item struct {
+            Item map[string]json.RawMessage
+        }
+        if err := json.Unmarshal(line, &item); err != nil {
+            return nil, fmt.Errorf("dynamodb export: %w", err)
+        }
+        return dynamoDBMap(item.Item)
+    })
+}
+
+func dynamoDBMap(attrs map[string]json.RawMessage) (Document, error) {
+    doc := make(Document, len(attrs))
+    for name, raw := range attrs {
+        value, err := dynamoDBValue(raw)
+        if err != nil {
+            return nil, fmt.Errorf("dynamodb export: attribute %s: %w", name, err)
+        }
+        doc[name] = value
+    }
+    return doc, nil
+}
+
+func dynamoDBValue(raw json.RawMessage) (interface{}, error) {
+    var attr struct {
+        S    *string
+        N    *string
+        B    []byte
+        BOOL *bool
+        NULL *bool
+        SS   []string
+        NS   []string
+        BS   [][]byte
+        L    []json.RawMessage
+        M    map[string]json.RawMessage
+    }
+    if err := json.Unmarshal(raw, &attr); err != nil {
+        return nil, err
+    }
+    switch {
+    case attr.S != nil:
+        return *attr.S, nil
+    case attr.N != nil:
+        return parseNumber(*attr.N)
+    case attr.B != nil:
+        return attr.B, nil
+    case attr.BOOL != nil:
+        return *attr.BOOL, nil
+    case attr.NULL != nil:
+        return nil, nil
+    case attr.SS != nil:
+        values := make([]interface{}, len(attr.SS))
+        for i, s := range attr.SS {
+            values[i] = s
+        }
+        return values, nil
+    case attr.NS != nil:
+        values := make([]interface{}, len(attr.NS))
+        for i, n := range attr.NS {
+            value, err := parseNumber(n)
+            if err != nil {
+                return nil, err
+            }
+            values[i] = value
+        }
+        return values, nil
+    case attr.BS != nil:
+        values := make([]interface{}, len(attr.BS))
+        for i, b := range attr.BS {
+            values[i] = b
+        }
+        return values, nil
+    case attr.L != nil:
+        values := make([]interface{}, len(attr.L))
+        for i, raw := range attr.L {
+            value, err := dynamoDBValue(raw)
+            if err != nil {
+                return nil, err
+            }
+            values[i] = value
+        }
+        return values, nil
+    case attr.M != nil:
+        return dynamoDBMap(attr.M)
+    default:
+        return nil, fmt.Errorf("unsupported attribute %s", raw)
+    }
+}
+
+// parseNumber returns n as an int64 if it is an integer, else as a float64.
+func parseNumber(n string) (interface{}, error) {
+    if i, err := strconv.ParseInt(n, 10, 64); err == nil {
+        return i, nil
+    }
+    return strconv.ParseFloat(n, 64)
+}
+
+// NewFirestoreReader reads Firestore documents in the JSON format of the
+// Firestore REST API, one {"name": ..., "fields": {...}} object per line, as
+// produced by exporting a collection with the REST API or gcloud. The
+// document's resource name is available as "__name__".
+func NewFirestoreReader(r io.Reader) DocumentReader {
+    return newJSONLinesReader(r, func(line []byte) (Document, error) {
+        var document struct {
+            Name   string
+            Fields map[string]json.RawMessage
+        }
+        if err := json.Unmarshal(line, &document); err != nil {
+            return nil, fmt.Errorf("firestore export: %w", err)
+        }
+        doc, err := firestoreMap(document.Fields)
+        if err != nil {
+            return nil, err
+        }
+        doc["__name__"] = document.Name
+        return doc, nil
+    })
+}
+
+func firestoreMap(fields map[string]json.RawMessage) (Document, error) {
+    doc := make(Document, len(fields))
+    for name, raw := range fields {
+        value, err := firestoreValue(raw)
+        if err != nil {
+            return nil, fmt.Errorf("firestore export: field %s: %w", name, err)
+        }
+        doc[name] = value
+    }
+    return doc, nil
+}
+
+func firestoreValue(raw json.RawMessage) (interface{}, error) {
+    // A value is an object with a single member named after its type
+    var value map[string]json.RawMessage
+    if err := json.Unmarshal(raw, &value); err != nil {
+        return nil, err
+    }
+    if len(value) != 1 {
+        return nil, fmt.Errorf("malformed value %s", raw)
+    }
+    for typ, raw := range value {
+        switch typ {
+        case "nullValue":
+            return nil, nil
+        case "booleanValue":
+            var b bool
+            err := json.Unmarshal(raw, &b)
+            return b, err
+        case "integerValue":
+            var n string
+            if err := json.Unmarshal(raw, &n); err != nil {
+                return nil, err
+            }
+            return strconv.ParseInt(n, 10, 64)
+        case "doubleValue":
+            var f float64
+            err := json.Unmarshal(raw, &f)
+            return f, err
+        case "timestampValue":
+            var t time.Time
+            err := json.Unmarshal(raw, &t)
+            return t, err
+        case "stringValue", "referenceValue":
+            var s string
+            err := json.Unmarshal(raw, &s)
+            return s, err
+        case "bytesValue":
+            var b []byte
+            err := json.Unmarshal(raw, &b)
+            return b, err
+        case "geoPointValue":
+            var point struct {
+                Latitude  float64 ` + "`" + `json:"latitude"` + "`" + `
+                Longitude float64 ` + "`" + `json:"longitude"` + "`" + `
+            }
+            if err := json.Unmarshal(raw, &point); err != nil {
+                return nil, err
+            }
+            return Document{"latitude": point.Latitude, "longitude": point.Longitude}, nil
+        case "arrayValue":
+            var array struct {
+                Values []json.RawMessage ` + "`" + `json:"values"` + "`" + `
+            }
+            if err := json.Unmarshal(raw, &array); err != nil {
+                return nil, err
+            }
+            values := make([]interface{}, len(array.Values))
+            for i, raw := range array.Values {
+                v, err := firestoreValue(raw)
+                if err != nil {
+                    return nil, err
+                }
+                values[i] = v
+            }
+            return values, nil
+        case "mapValue":
+            var m struct {
+                Fields map[string]json.RawMessage ` + "`" + `json:"fields"` + "`" + `
+            }
+            if err := json.Unmarshal(raw, &m); err != nil {
+                return nil, err
+            }
+            return firestoreMap(m.Fields)
+        default:
+            return nil, fmt.Errorf("unsupported value type %s", typ)
+        }
+    }
+    panic("unreachable")
+}
+{{end}}`
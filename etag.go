@@ -0,0 +1,82 @@
+package main
+
+// etagTemplate generates the ETag variants of Get, Set and Delete, which give
+// callers HTTP conditional request semantics: GetWithETag returns the entity
+// tag of the stored record, and SetIfMatch and DeleteIfMatch only write if it
+// has not changed since.
+const etagTemplate = `{{define "etag"}}
+// GetWithETag is like Get, but also returns the ETag of the stored record,
+// which changes with every write of the record{{with .CRDTFields}}. The
+// {{range $i, $f := .}}{{if $i}}, {{end}}{{$f.Field.Name}}{{end}} {{if eq (len .) 1}}field, stored outside the record, is{{else}}fields, stored outside the record, are{{end}} not part of it{{end}}.
+func (repo *{{.Name}}Repository) GetWithETag(ctx context.Context, tr fdb.ReadTransaction, {{range $index, $element := .PrimaryKeyFields}}{{if $index}}, {{end}}{{.Name}} {{.Type}}{{end}}) (*pb.{{.Name}}, string, error) {
+    entity, err := repo.Get(ctx, tr, {{range $index, $element := .PrimaryKeyFields}}{{if $index}}, {{end}}{{.Name}}{{end}})
+    if err != nil {
+        return nil, "", err
+    }
+    // Read your writes serves the value read by Get
+    etag, err := repo.storedETag(tr, tuple.Tuple{ {{range .PrimaryKeyFields}} {{toTuple .Name .}}, {{end}} })
+    if err != nil {
+        return nil, "", err
+    }
+    return entity, etag, nil
+}
+
+// storedETag returns the ETag of the record stored under pk, "" if there is
+// none.
+func (repo *{{.Name}}Repository) storedETag(tr fdb.ReadTransaction, pk tuple.Tuple) (string, error) {
+    versionFuture := tr.Get(MetaSubspace(repo.dir, VersionsSubspace).Pack(pk))
+    value, err := tr.Get(repo.recordKey(pk)).Get()
+    if err != nil || value == nil {
+        return "", err
+    }
+    version, err := versionFuture.Get()
+    if err != nil {
+        return "", err
+    }
+    return recordETag(version, value), nil
+}
+
+// setRecordVersion stores the read version of tr beside the record at key,
+// whose primary key is pk, so that its ETag changes with every write. The
+// record key is added to the read conflicts of tr: concurrent writers of the
+// record conflict, so each one committed has a later read version than the
+// last.
+func (repo *{{.Name}}Repository) setRecordVersion(tr fdb.Transaction, key fdb.Key, pk tuple.Tuple) error {
+    if err := tr.AddReadConflictKey(key); err != nil {
+        return err
+    }
+    version, err := tr.GetReadVersion().Get()
+    if err != nil {
+        return err
+    }
+    tr.Set(MetaSubspace(repo.dir, VersionsSubspace).Pack(pk), tuple.Tuple{version}.Pack())
+    return nil
+}
+
+// SetIfMatch is like Set, but returns ErrPreconditionFailed unless a record
+// with the primary key of entity is stored and matches etag, an ETag returned
+// by GetWithETag or ETagAny.
+func (repo *{{.Name}}Repository) SetIfMatch(ctx context.Context, tr fdb.Transaction, entity *pb.{{.Name}}, etag string) error {
+    current, err := repo.storedETag(tr, tuple.Tuple{ {{range .PrimaryKeyFields}} {{toTuple (printf "entity.%s" .Path) .}}, {{end}} })
+    if err != nil {
+        return err
+    }
+    if err := matchETag(current, etag); err != nil {
+        return err
+    }
+    return repo.Set(ctx, tr, entity)
+}
+
+// DeleteIfMatch is like Delete, but returns ErrPreconditionFailed unless the
+// stored record matches etag, an ETag returned by GetWithETag or ETagAny.
+func (repo *{{.Name}}Repository) DeleteIfMatch(ctx context.Context, tr fdb.Transaction, {{range .PrimaryKeyFields}}{{.Name}} {{.Type}}, {{end}}etag string) error {
+    current, err := repo.storedETag(tr, tuple.Tuple{ {{range .PrimaryKeyFields}} {{toTuple .Name .}}, {{end}} })
+    if err != nil {
+        return err
+    }
+    if err := matchETag(current, etag); err != nil {
+        return err
+    }
+    return repo.Delete(ctx, tr, {{range $index, $element := .PrimaryKeyFields}}{{if $index}}, {{end}}{{.Name}}{{end}})
+}
+{{end}}`
@@ -0,0 +1,104 @@
+package main
+
+// exportTemplate generates the exports of a message's records to analytics
+// formats. The generated code does not depend on the format libraries: it
+// produces rows and writes them through small interfaces that those
+// libraries implement.
+const exportTemplate = `{{define "export"}}
+// listRecords is scanRecords for callers that handle any message type.
+func (repo *{{.Name}}Repository) listRecords(ctx context.Context, fn func(records []proto.Message) error) (int, error) {
+    return repo.scanRecords(ctx, func(entities []*pb.{{.Name}}) error {
+        records := make([]proto.Message, len(entities))
+        for i, entity := range entities {
+            records[i] = entity
+        }
+        return fn(records)
+    })
+}
+
+// {{.Name}}ParquetRow is the Parquet row of a {{.Name}}: its scalar and map
+// fields, with columns named after the .proto fields.{{if .HasOneofFields}} Oneof members and
+// optional fields are flattened, holding their zero value when unset.{{end}}
+type {{.Name}}ParquetRow struct {
+    {{range .Fields}}{{if or .Scalar .Map}}{{.Name}} {{.Type}} ` + "`" + `parquet:"{{.ProtoName}}"` + "`" + `
+    {{end}}{{end}}
+}
+
+// New{{.Name}}ParquetRow copies the scalar and map fields of entity.
+func New{{.Name}}ParquetRow(entity *pb.{{.Name}}) {{.Name}}ParquetRow {
+    return {{.Name}}ParquetRow{
+        {{range .Fields}}{{if or .Scalar .Map}}{{.Name}}: entity.{{.Path}},
+        {{end}}{{end}}
+    }
+}
+
+// {{.Name}}ParquetWriter writes {{.Name}} rows to a Parquet file. It is
+// implemented by *parquet.GenericWriter[{{.Name}}ParquetRow] from
+// github.com/parquet-go/parquet-go.
+type {{.Name}}ParquetWriter interface {
+    Write(rows []{{.Name}}ParquetRow) (int, error)
+    // Flush writes the buffered rows as a row group.
+    Flush() error
+}
+
+// ExportParquet streams all records to w, one row group per batch read. The
+// export runs across many transactions, so it is not a point-in-time
+// snapshot. The caller closes w. It returns the number of records exported.
+func (repo *{{.Name}}Repository) ExportParquet(ctx context.Context, w {{.Name}}ParquetWriter) (int, error) {
+    return repo.scanRecords(ctx, func(entities []*pb.{{.Name}}) error {
+        rows := make([]{{.Name}}ParquetRow, len(entities))
+        for i, entity := range entities {
+            rows[i] = New{{.Name}}ParquetRow(entity)
+        }
+        if _, err := w.Write(rows); err != nil {
+            return err
+        }
+        return w.Flush()
+    })
+}
+// ExportSQLite writes all records to the "{{.Name}}" table of db, a SQLite
+// database opened by the caller with the driver of its choice. The table and
+// indexes are created if needed, with a column per scalar field plus the
+// record as JSON (_json) and protobuf (_record), so that the export can be
+// queried with SQL.{{if .HasOneofFields}} Unset optional fields are NULL, unset oneof members
+// their zero value.{{end}} Existing rows are replaced. The export runs across many
+// transactions, so it is not a point-in-time snapshot. It returns the number
+// of records exported.
+func (repo *{{.Name}}Repository) ExportSQLite(ctx context.Context, db *sql.DB) (int, error) {
+    for _, stmt := range []string{
+        {{range sqliteSchema .}}{{printf "%q" .}},
+        {{end}}
+    } {
+        if _, err := db.ExecContext(ctx, stmt); err != nil {
+            return 0, err
+        }
+    }
+    return repo.scanRecords(ctx, func(entities []*pb.{{.Name}}) error {
+        tx, err := db.BeginTx(ctx, nil)
+        if err != nil {
+            return err
+        }
+        defer tx.Rollback()
+        insert, err := tx.PrepareContext(ctx, {{printf "%q" (sqliteInsert .)}})
+        if err != nil {
+            return err
+        }
+        defer insert.Close()
+        for _, entity := range entities {
+            json, err := Marshal{{.Name}}JSON(entity)
+            if err != nil {
+                return err
+            }
+            record, err := proto.Marshal(entity)
+            if err != nil {
+                return err
+            }
+            _, err = insert.ExecContext(ctx, {{range .ScalarFields}}entity.{{if .Optional}}{{.GoName}}{{else}}{{.Path}}{{end}}, {{end}}string(json), record)
+            if err != nil {
+                return err
+            }
+        }
+        return tx.Commit()
+    })
+}
+{{end}}`
@@ -0,0 +1,128 @@
+package main
+
+// faultsTemplate renders faults.go, a fault injection layer wrapping every
+// transaction run by the generated code. It is only compiled with the
+// fdbfaults build tag, so that tests can exercise retry paths while
+// production builds keep a no-op (see noFaultsTemplate).
+const faultsTemplate = `{{define "faults"}}// Code generated by fdb-go-layer-plugin {{pluginVersion}}. DO NOT EDIT.
+
+//go:build fdbfaults
+
+package repositories
+
+import (
+    "math/rand"
+    "sync"
+    "time"
+
+    "github.com/apple/foundationdb/bindings/go/src/fdb"
+)
+
+// FaultConfig describes the faults injected into the transactions run by the
+// generated code. Probabilities are in [0, 1]. Faults are drawn from a
+// generator seeded with Seed, so a single-threaded test sees the same faults
+// on every run.
+type FaultConfig struct {
+    Seed int64
+    // CommitUnknownResult is the probability that a transaction commits and
+    // then reports commit_unknown_result, so that it is retried even though
+    // its writes are durable.
+    CommitUnknownResult float64
+    // Reset is the probability that a transaction fails with not_committed
+    // before running, as if it had conflicted.
+    Reset float64
+    // MaxDelay bounds a random delay added before each attempt.
+    MaxDelay time.Duration
+}
+
+var faults struct {
+    sync.Mutex
+    config *FaultConfig
+    rand   *rand.Rand
+}
+
+// SetFaults enables fault injection with config until ClearFaults is called.
+func SetFaults(config FaultConfig) {
+    faults.Lock()
+    defer faults.Unlock()
+    faults.config = &config
+    faults.rand = rand.New(rand.NewSource(config.Seed))
+}
+
+// ClearFaults disables fault injection.
+func ClearFaults() {
+    faults.Lock()
+    defer faults.Unlock()
+    faults.config = nil
+    faults.rand = nil
+}
+
+// drawFaults returns the faults of one transaction attempt.
+func drawFaults() (delay time.Duration, reset, unknownResult bool) {
+    faults.Lock()
+    defer faults.Unlock()
+    c := faults.config
+    if c == nil {
+        return 0, false, false
+    }
+    if c.MaxDelay > 0 {
+        delay = time.Duration(faults.rand.Int63n(int64(c.MaxDelay)))
+    }
+    reset = faults.rand.Float64() < c.Reset
+    unknownResult = faults.rand.Float64() < c.CommitUnknownResult
+    return delay, reset, unknownResult
+}
+
+func transact(db fdb.Transactor, fn func(fdb.Transaction) (interface{}, error)) (interface{}, error) {
+    return db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+        delay, reset, unknownResult := drawFaults()
+        time.Sleep(delay)
+        if reset {
+            return nil, fdb.Error{Code: 1020}
+        }
+        result, err := fn(tr)
+        if err != nil || !unknownResult {
+            return result, err
+        }
+        if err := tr.Commit().Get(); err != nil {
+            return nil, err
+        }
+        return nil, fdb.Error{Code: 1021}
+    })
+}
+
+func readTransact(db fdb.Transactor, fn func(fdb.ReadTransaction) (interface{}, error)) (interface{}, error) {
+    return db.ReadTransact(func(tr fdb.ReadTransaction) (interface{}, error) {
+        delay, reset, _ := drawFaults()
+        time.Sleep(delay)
+        if reset {
+            return nil, fdb.Error{Code: 1020}
+        }
+        return fn(tr)
+    })
+}
+{{end}}`
+
+// noFaultsTemplate renders nofaults.go, the default build of the transaction
+// helpers, which run transactions unchanged.
+const noFaultsTemplate = `{{define "nofaults"}}// Code generated by fdb-go-layer-plugin {{pluginVersion}}. DO NOT EDIT.
+
+//go:build !fdbfaults
+
+package repositories
+
+import (
+    "github.com/apple/foundationdb/bindings/go/src/fdb"
+)
+
+// transact runs fn in a retried transaction. Builds with the fdbfaults tag
+// inject faults configured with SetFaults here.
+func transact(db fdb.Transactor, fn func(fdb.Transaction) (interface{}, error)) (interface{}, error) {
+    return db.Transact(fn)
+}
+
+// readTransact is the read-only counterpart of transact.
+func readTransact(db fdb.Transactor, fn func(fdb.ReadTransaction) (interface{}, error)) (interface{}, error) {
+    return db.ReadTransact(fn)
+}
+{{end}}`
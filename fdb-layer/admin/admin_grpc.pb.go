@@ -0,0 +1,299 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v3.20.3
+// source: fdb-layer/admin/admin.proto
+
+package admin
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	LayerAdmin_RebuildIndexes_FullMethodName   = "/admin.LayerAdmin/RebuildIndexes"
+	LayerAdmin_Purge_FullMethodName            = "/admin.LayerAdmin/Purge"
+	LayerAdmin_CheckConsistency_FullMethodName = "/admin.LayerAdmin/CheckConsistency"
+	LayerAdmin_GetStats_FullMethodName         = "/admin.LayerAdmin/GetStats"
+	LayerAdmin_List_FullMethodName             = "/admin.LayerAdmin/List"
+)
+
+// LayerAdminClient is the client API for LayerAdmin service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Maintenance operations on the repositories generated with the admin=true
+// plugin option.
+type LayerAdminClient interface {
+	// Backfills missing and clears stale secondary index entries
+	RebuildIndexes(ctx context.Context, in *MaintenanceRequest, opts ...grpc.CallOption) (*PlanResponse, error)
+	// Deletes every record and index entry of a message type
+	Purge(ctx context.Context, in *MaintenanceRequest, opts ...grpc.CallOption) (*PlanResponse, error)
+	// Reports missing (keys_written) and stale (keys_cleared) index entries
+	// without changing anything
+	CheckConsistency(ctx context.Context, in *MaintenanceRequest, opts ...grpc.CallOption) (*PlanResponse, error)
+	// Returns size estimates and job checkpoints of a message type
+	GetStats(ctx context.Context, in *StatsRequest, opts ...grpc.CallOption) (*StatsResponse, error)
+	// Streams the records of a message type, one response per batch read.
+	// Records are read across many transactions, so the stream is not a
+	// point-in-time snapshot.
+	List(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ListResponse], error)
+}
+
+type layerAdminClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewLayerAdminClient(cc grpc.ClientConnInterface) LayerAdminClient {
+	return &layerAdminClient{cc}
+}
+
+func (c *layerAdminClient) RebuildIndexes(ctx context.Context, in *MaintenanceRequest, opts ...grpc.CallOption) (*PlanResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(PlanResponse)
+	err := c.cc.Invoke(ctx, LayerAdmin_RebuildIndexes_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *layerAdminClient) Purge(ctx context.Context, in *MaintenanceRequest, opts ...grpc.CallOption) (*PlanResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(PlanResponse)
+	err := c.cc.Invoke(ctx, LayerAdmin_Purge_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *layerAdminClient) CheckConsistency(ctx context.Context, in *MaintenanceRequest, opts ...grpc.CallOption) (*PlanResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(PlanResponse)
+	err := c.cc.Invoke(ctx, LayerAdmin_CheckConsistency_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *layerAdminClient) GetStats(ctx context.Context, in *StatsRequest, opts ...grpc.CallOption) (*StatsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(StatsResponse)
+	err := c.cc.Invoke(ctx, LayerAdmin_GetStats_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *layerAdminClient) List(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ListResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &LayerAdmin_ServiceDesc.Streams[0], LayerAdmin_List_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ListRequest, ListResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type LayerAdmin_ListClient = grpc.ServerStreamingClient[ListResponse]
+
+// LayerAdminServer is the server API for LayerAdmin service.
+// All implementations must embed UnimplementedLayerAdminServer
+// for forward compatibility.
+//
+// Maintenance operations on the repositories generated with the admin=true
+// plugin option.
+type LayerAdminServer interface {
+	// Backfills missing and clears stale secondary index entries
+	RebuildIndexes(context.Context, *MaintenanceRequest) (*PlanResponse, error)
+	// Deletes every record and index entry of a message type
+	Purge(context.Context, *MaintenanceRequest) (*PlanResponse, error)
+	// Reports missing (keys_written) and stale (keys_cleared) index entries
+	// without changing anything
+	CheckConsistency(context.Context, *MaintenanceRequest) (*PlanResponse, error)
+	// Returns size estimates and job checkpoints of a message type
+	GetStats(context.Context, *StatsRequest) (*StatsResponse, error)
+	// Streams the records of a message type, one response per batch read.
+	// Records are read across many transactions, so the stream is not a
+	// point-in-time snapshot.
+	List(*ListRequest, grpc.ServerStreamingServer[ListResponse]) error
+	mustEmbedUnimplementedLayerAdminServer()
+}
+
+// UnimplementedLayerAdminServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedLayerAdminServer struct{}
+
+func (UnimplementedLayerAdminServer) RebuildIndexes(context.Context, *MaintenanceRequest) (*PlanResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RebuildIndexes not implemented")
+}
+func (UnimplementedLayerAdminServer) Purge(context.Context, *MaintenanceRequest) (*PlanResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Purge not implemented")
+}
+func (UnimplementedLayerAdminServer) CheckConsistency(context.Context, *MaintenanceRequest) (*PlanResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CheckConsistency not implemented")
+}
+func (UnimplementedLayerAdminServer) GetStats(context.Context, *StatsRequest) (*StatsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetStats not implemented")
+}
+func (UnimplementedLayerAdminServer) List(*ListRequest, grpc.ServerStreamingServer[ListResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method List not implemented")
+}
+func (UnimplementedLayerAdminServer) mustEmbedUnimplementedLayerAdminServer() {}
+func (UnimplementedLayerAdminServer) testEmbeddedByValue()                    {}
+
+// UnsafeLayerAdminServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to LayerAdminServer will
+// result in compilation errors.
+type UnsafeLayerAdminServer interface {
+	mustEmbedUnimplementedLayerAdminServer()
+}
+
+func RegisterLayerAdminServer(s grpc.ServiceRegistrar, srv LayerAdminServer) {
+	// If the following call pancis, it indicates UnimplementedLayerAdminServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&LayerAdmin_ServiceDesc, srv)
+}
+
+func _LayerAdmin_RebuildIndexes_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MaintenanceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LayerAdminServer).RebuildIndexes(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LayerAdmin_RebuildIndexes_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LayerAdminServer).RebuildIndexes(ctx, req.(*MaintenanceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LayerAdmin_Purge_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MaintenanceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LayerAdminServer).Purge(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LayerAdmin_Purge_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LayerAdminServer).Purge(ctx, req.(*MaintenanceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LayerAdmin_CheckConsistency_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MaintenanceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LayerAdminServer).CheckConsistency(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LayerAdmin_CheckConsistency_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LayerAdminServer).CheckConsistency(ctx, req.(*MaintenanceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LayerAdmin_GetStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LayerAdminServer).GetStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LayerAdmin_GetStats_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LayerAdminServer).GetStats(ctx, req.(*StatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LayerAdmin_List_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ListRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(LayerAdminServer).List(m, &grpc.GenericServerStream[ListRequest, ListResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type LayerAdmin_ListServer = grpc.ServerStreamingServer[ListResponse]
+
+// LayerAdmin_ServiceDesc is the grpc.ServiceDesc for LayerAdmin service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var LayerAdmin_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "admin.LayerAdmin",
+	HandlerType: (*LayerAdminServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "RebuildIndexes",
+			Handler:    _LayerAdmin_RebuildIndexes_Handler,
+		},
+		{
+			MethodName: "Purge",
+			Handler:    _LayerAdmin_Purge_Handler,
+		},
+		{
+			MethodName: "CheckConsistency",
+			Handler:    _LayerAdmin_CheckConsistency_Handler,
+		},
+		{
+			MethodName: "GetStats",
+			Handler:    _LayerAdmin_GetStats_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "List",
+			Handler:       _LayerAdmin_List_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "fdb-layer/admin/admin.proto",
+}
@@ -1,6 +1,6 @@
 // Code generated by protoc-gen-go. DO NOT EDIT.
 // versions:
-// 	protoc-gen-go v1.28.1
+// 	protoc-gen-go v1.35.1
 // 	protoc        v3.20.3
 // source: fdb-layer/annotations.proto
 
@@ -27,15 +27,28 @@ type SecondaryIndex struct {
 	unknownFields protoimpl.UnknownFields
 
 	Fields []string `protobuf:"bytes,1,rep,name=fields,proto3" json:"fields,omitempty"`
+	// Reject writes giving the values of fields to a second record
+	Unique bool `protobuf:"varint,2,opt,name=unique,proto3" json:"unique,omitempty"`
+	// Name of the index, used in the name of its GetBy method and subspace,
+	// e.g. "Contact" yields GetByContact. Defaults to the field names joined
+	// with "And", so it must be set to tell apart indexes of the same fields.
+	Name string `protobuf:"bytes,3,opt,name=name,proto3" json:"name,omitempty"`
+	// Store a copy of the record as the value of every entry, so that GetBy
+	// reads records from the index without a lookup per entry, at the cost of
+	// the space and write bandwidth of the copies
+	Covering bool `protobuf:"varint,4,opt,name=covering,proto3" json:"covering,omitempty"`
+	// Also write the entries of the index into a directory shared by every
+	// prefix the repositories are opened with, such as tenants, with the prefix
+	// in each entry, so that GlobalGetBy finds records across all of them,
+	// e.g. a user by email in every tenant. Meant for admin tools.
+	Global bool `protobuf:"varint,5,opt,name=global,proto3" json:"global,omitempty"`
 }
 
 func (x *SecondaryIndex) Reset() {
 	*x = SecondaryIndex{}
-	if protoimpl.UnsafeEnabled {
-		mi := &file_fdb_layer_annotations_proto_msgTypes[0]
-		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
-		ms.StoreMessageInfo(mi)
-	}
+	mi := &file_fdb_layer_annotations_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
 }
 
 func (x *SecondaryIndex) String() string {
@@ -46,7 +59,7 @@ func (*SecondaryIndex) ProtoMessage() {}
 
 func (x *SecondaryIndex) ProtoReflect() protoreflect.Message {
 	mi := &file_fdb_layer_annotations_proto_msgTypes[0]
-	if protoimpl.UnsafeEnabled && x != nil {
+	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
 			ms.StoreMessageInfo(mi)
@@ -68,6 +81,315 @@ func (x *SecondaryIndex) GetFields() []string {
 	return nil
 }
 
+func (x *SecondaryIndex) GetUnique() bool {
+	if x != nil {
+		return x.Unique
+	}
+	return false
+}
+
+func (x *SecondaryIndex) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *SecondaryIndex) GetCovering() bool {
+	if x != nil {
+		return x.Covering
+	}
+	return false
+}
+
+func (x *SecondaryIndex) GetGlobal() bool {
+	if x != nil {
+		return x.Global
+	}
+	return false
+}
+
+type Projection struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Name appended to the message name, e.g. "Summary" yields UserSummary
+	Name   string   `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Fields []string `protobuf:"bytes,2,rep,name=fields,proto3" json:"fields,omitempty"`
+}
+
+func (x *Projection) Reset() {
+	*x = Projection{}
+	mi := &file_fdb_layer_annotations_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Projection) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Projection) ProtoMessage() {}
+
+func (x *Projection) ProtoReflect() protoreflect.Message {
+	mi := &file_fdb_layer_annotations_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Projection.ProtoReflect.Descriptor instead.
+func (*Projection) Descriptor() ([]byte, []int) {
+	return file_fdb_layer_annotations_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Projection) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Projection) GetFields() []string {
+	if x != nil {
+		return x.Fields
+	}
+	return nil
+}
+
+type Archive struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Field holding the age of a record: an int64 of Unix seconds or a
+	// google.protobuf.Timestamp
+	TimeField string `protobuf:"bytes,1,opt,name=time_field,json=timeField,proto3" json:"time_field,omitempty"`
+}
+
+func (x *Archive) Reset() {
+	*x = Archive{}
+	mi := &file_fdb_layer_annotations_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Archive) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Archive) ProtoMessage() {}
+
+func (x *Archive) ProtoReflect() protoreflect.Message {
+	mi := &file_fdb_layer_annotations_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Archive.ProtoReflect.Descriptor instead.
+func (*Archive) Descriptor() ([]byte, []int) {
+	return file_fdb_layer_annotations_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Archive) GetTimeField() string {
+	if x != nil {
+		return x.TimeField
+	}
+	return ""
+}
+
+type RecordLayer struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Number of the field holding the message in the RecordTypeUnion message
+	// of the Record Layer metadata, which wraps every stored record
+	UnionField uint32 `protobuf:"varint,1,opt,name=union_field,json=unionField,proto3" json:"union_field,omitempty"`
+	// Version of the Record Layer metadata declaring the message and its
+	// indexes. Repositories refuse to open stores whose header holds another
+	// version, whose indexes could differ.
+	MetaDataVersion uint32 `protobuf:"varint,2,opt,name=meta_data_version,json=metaDataVersion,proto3" json:"meta_data_version,omitempty"`
+}
+
+func (x *RecordLayer) Reset() {
+	*x = RecordLayer{}
+	mi := &file_fdb_layer_annotations_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RecordLayer) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RecordLayer) ProtoMessage() {}
+
+func (x *RecordLayer) ProtoReflect() protoreflect.Message {
+	mi := &file_fdb_layer_annotations_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RecordLayer.ProtoReflect.Descriptor instead.
+func (*RecordLayer) Descriptor() ([]byte, []int) {
+	return file_fdb_layer_annotations_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *RecordLayer) GetUnionField() uint32 {
+	if x != nil {
+		return x.UnionField
+	}
+	return 0
+}
+
+func (x *RecordLayer) GetMetaDataVersion() uint32 {
+	if x != nil {
+		return x.MetaDataVersion
+	}
+	return 0
+}
+
+type BlobRef struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Regular expression that non-empty references must match, checked by Set
+	Pattern string `protobuf:"bytes,1,opt,name=pattern,proto3" json:"pattern,omitempty"`
+	// Queue the referenced object for CleanupBlobs when the record is deleted
+	Cleanup bool `protobuf:"varint,2,opt,name=cleanup,proto3" json:"cleanup,omitempty"`
+}
+
+func (x *BlobRef) Reset() {
+	*x = BlobRef{}
+	mi := &file_fdb_layer_annotations_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BlobRef) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BlobRef) ProtoMessage() {}
+
+func (x *BlobRef) ProtoReflect() protoreflect.Message {
+	mi := &file_fdb_layer_annotations_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BlobRef.ProtoReflect.Descriptor instead.
+func (*BlobRef) Descriptor() ([]byte, []int) {
+	return file_fdb_layer_annotations_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *BlobRef) GetPattern() string {
+	if x != nil {
+		return x.Pattern
+	}
+	return ""
+}
+
+func (x *BlobRef) GetCleanup() bool {
+	if x != nil {
+		return x.Cleanup
+	}
+	return false
+}
+
+type StringKey struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Maximum length of the field in keys, in bytes. Set rejects longer
+	// values with ErrInvalidKey, unless hash is set. 0 means no limit.
+	MaxBytes uint32 `protobuf:"varint,1,opt,name=max_bytes,json=maxBytes,proto3" json:"max_bytes,omitempty"`
+	// Reject values holding null bytes
+	RejectNull bool `protobuf:"varint,2,opt,name=reject_null,json=rejectNull,proto3" json:"reject_null,omitempty"`
+	// Pack values longer than max_bytes as their first max_bytes-64 bytes
+	// followed by the hex SHA-256 of the whole value, instead of rejecting
+	// them. max_bytes must then be more than 64.
+	Hash bool `protobuf:"varint,3,opt,name=hash,proto3" json:"hash,omitempty"`
+}
+
+func (x *StringKey) Reset() {
+	*x = StringKey{}
+	mi := &file_fdb_layer_annotations_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StringKey) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StringKey) ProtoMessage() {}
+
+func (x *StringKey) ProtoReflect() protoreflect.Message {
+	mi := &file_fdb_layer_annotations_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StringKey.ProtoReflect.Descriptor instead.
+func (*StringKey) Descriptor() ([]byte, []int) {
+	return file_fdb_layer_annotations_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *StringKey) GetMaxBytes() uint32 {
+	if x != nil {
+		return x.MaxBytes
+	}
+	return 0
+}
+
+func (x *StringKey) GetRejectNull() bool {
+	if x != nil {
+		return x.RejectNull
+	}
+	return false
+}
+
+func (x *StringKey) GetHash() bool {
+	if x != nil {
+		return x.Hash
+	}
+	return false
+}
+
 var file_fdb_layer_annotations_proto_extTypes = []protoimpl.ExtensionInfo{
 	{
 		ExtendedType:  (*descriptorpb.MessageOptions)(nil),
@@ -85,6 +407,182 @@ var file_fdb_layer_annotations_proto_extTypes = []protoimpl.ExtensionInfo{
 		Tag:           "bytes,50002,rep,name=secondary_index",
 		Filename:      "fdb-layer/annotations.proto",
 	},
+	{
+		ExtendedType:  (*descriptorpb.MessageOptions)(nil),
+		ExtensionType: ([]*Projection)(nil),
+		Field:         50003,
+		Name:          "annotations.projection",
+		Tag:           "bytes,50003,rep,name=projection",
+		Filename:      "fdb-layer/annotations.proto",
+	},
+	{
+		ExtendedType:  (*descriptorpb.MessageOptions)(nil),
+		ExtensionType: ([]string)(nil),
+		Field:         50004,
+		Name:          "annotations.directory",
+		Tag:           "bytes,50004,rep,name=directory",
+		Filename:      "fdb-layer/annotations.proto",
+	},
+	{
+		ExtendedType:  (*descriptorpb.MessageOptions)(nil),
+		ExtensionType: (*bool)(nil),
+		Field:         50005,
+		Name:          "annotations.change_log",
+		Tag:           "varint,50005,opt,name=change_log",
+		Filename:      "fdb-layer/annotations.proto",
+	},
+	{
+		ExtendedType:  (*descriptorpb.MessageOptions)(nil),
+		ExtensionType: (*bool)(nil),
+		Field:         50006,
+		Name:          "annotations.search_sync",
+		Tag:           "varint,50006,opt,name=search_sync",
+		Filename:      "fdb-layer/annotations.proto",
+	},
+	{
+		ExtendedType:  (*descriptorpb.MessageOptions)(nil),
+		ExtensionType: (*Archive)(nil),
+		Field:         50007,
+		Name:          "annotations.archive",
+		Tag:           "bytes,50007,opt,name=archive",
+		Filename:      "fdb-layer/annotations.proto",
+	},
+	{
+		ExtendedType:  (*descriptorpb.MessageOptions)(nil),
+		ExtensionType: ([]string)(nil),
+		Field:         50008,
+		Name:          "annotations.webhook",
+		Tag:           "bytes,50008,rep,name=webhook",
+		Filename:      "fdb-layer/annotations.proto",
+	},
+	{
+		ExtendedType:  (*descriptorpb.MessageOptions)(nil),
+		ExtensionType: (*bool)(nil),
+		Field:         50009,
+		Name:          "annotations.field_merge",
+		Tag:           "varint,50009,opt,name=field_merge",
+		Filename:      "fdb-layer/annotations.proto",
+	},
+	{
+		ExtendedType:  (*descriptorpb.MessageOptions)(nil),
+		ExtensionType: (*string)(nil),
+		Field:         50010,
+		Name:          "annotations.serializer",
+		Tag:           "bytes,50010,opt,name=serializer",
+		Filename:      "fdb-layer/annotations.proto",
+	},
+	{
+		ExtendedType:  (*descriptorpb.MessageOptions)(nil),
+		ExtensionType: (*bool)(nil),
+		Field:         50011,
+		Name:          "annotations.skip_unchanged_writes",
+		Tag:           "varint,50011,opt,name=skip_unchanged_writes",
+		Filename:      "fdb-layer/annotations.proto",
+	},
+	{
+		ExtendedType:  (*descriptorpb.MessageOptions)(nil),
+		ExtensionType: (*string)(nil),
+		Field:         50012,
+		Name:          "annotations.profile",
+		Tag:           "bytes,50012,opt,name=profile",
+		Filename:      "fdb-layer/annotations.proto",
+	},
+	{
+		ExtendedType:  (*descriptorpb.MessageOptions)(nil),
+		ExtensionType: ([]string)(nil),
+		Field:         50013,
+		Name:          "annotations.previous_version",
+		Tag:           "bytes,50013,rep,name=previous_version",
+		Filename:      "fdb-layer/annotations.proto",
+	},
+	{
+		ExtendedType:  (*descriptorpb.MessageOptions)(nil),
+		ExtensionType: (*uint32)(nil),
+		Field:         50014,
+		Name:          "annotations.buckets",
+		Tag:           "varint,50014,opt,name=buckets",
+		Filename:      "fdb-layer/annotations.proto",
+	},
+	{
+		ExtendedType:  (*descriptorpb.MessageOptions)(nil),
+		ExtensionType: (*RecordLayer)(nil),
+		Field:         50015,
+		Name:          "annotations.record_layer",
+		Tag:           "bytes,50015,opt,name=record_layer",
+		Filename:      "fdb-layer/annotations.proto",
+	},
+	{
+		ExtendedType:  (*descriptorpb.MessageOptions)(nil),
+		ExtensionType: (*bool)(nil),
+		Field:         50016,
+		Name:          "annotations.etag",
+		Tag:           "varint,50016,opt,name=etag",
+		Filename:      "fdb-layer/annotations.proto",
+	},
+	{
+		ExtendedType:  (*descriptorpb.FieldOptions)(nil),
+		ExtensionType: (*BlobRef)(nil),
+		Field:         50101,
+		Name:          "annotations.blob_ref",
+		Tag:           "bytes,50101,opt,name=blob_ref",
+		Filename:      "fdb-layer/annotations.proto",
+	},
+	{
+		ExtendedType:  (*descriptorpb.FieldOptions)(nil),
+		ExtensionType: (*bool)(nil),
+		Field:         50102,
+		Name:          "annotations.counter",
+		Tag:           "varint,50102,opt,name=counter",
+		Filename:      "fdb-layer/annotations.proto",
+	},
+	{
+		ExtendedType:  (*descriptorpb.FieldOptions)(nil),
+		ExtensionType: (*bool)(nil),
+		Field:         50103,
+		Name:          "annotations.element_set",
+		Tag:           "varint,50103,opt,name=element_set",
+		Filename:      "fdb-layer/annotations.proto",
+	},
+	{
+		ExtendedType:  (*descriptorpb.FieldOptions)(nil),
+		ExtensionType: (*bool)(nil),
+		Field:         50104,
+		Name:          "annotations.touch",
+		Tag:           "varint,50104,opt,name=touch",
+		Filename:      "fdb-layer/annotations.proto",
+	},
+	{
+		ExtendedType:  (*descriptorpb.FieldOptions)(nil),
+		ExtensionType: (*bool)(nil),
+		Field:         50105,
+		Name:          "annotations.index_keys",
+		Tag:           "varint,50105,opt,name=index_keys",
+		Filename:      "fdb-layer/annotations.proto",
+	},
+	{
+		ExtendedType:  (*descriptorpb.FieldOptions)(nil),
+		ExtensionType: (*bool)(nil),
+		Field:         50106,
+		Name:          "annotations.side_stored",
+		Tag:           "varint,50106,opt,name=side_stored",
+		Filename:      "fdb-layer/annotations.proto",
+	},
+	{
+		ExtendedType:  (*descriptorpb.FieldOptions)(nil),
+		ExtensionType: (*StringKey)(nil),
+		Field:         50107,
+		Name:          "annotations.string_key",
+		Tag:           "bytes,50107,opt,name=string_key",
+		Filename:      "fdb-layer/annotations.proto",
+	},
+	{
+		ExtendedType:  (*descriptorpb.FieldOptions)(nil),
+		ExtensionType: (*bool)(nil),
+		Field:         50108,
+		Name:          "annotations.auto_uuid",
+		Tag:           "varint,50108,opt,name=auto_uuid",
+		Filename:      "fdb-layer/annotations.proto",
+	},
 }
 
 // Extension fields to descriptorpb.MessageOptions.
@@ -97,6 +595,126 @@ var (
 	//
 	// repeated annotations.SecondaryIndex secondary_index = 50002;
 	E_SecondaryIndex = &file_fdb_layer_annotations_proto_extTypes[1]
+	// Named subsets of fields generated as lightweight summary structs
+	//
+	// repeated annotations.Projection projection = 50003;
+	E_Projection = &file_fdb_layer_annotations_proto_extTypes[2]
+	// Directory path of the message's records, defaults to the message name
+	//
+	// repeated string directory = 50004;
+	E_Directory = &file_fdb_layer_annotations_proto_extTypes[3]
+	// Record every change of the message in a change log read by replicas
+	//
+	// optional bool change_log = 50005;
+	E_ChangeLog = &file_fdb_layer_annotations_proto_extTypes[4]
+	// Generate SyncSearch, which pushes the change log to a search index.
+	// Implies change_log.
+	//
+	// optional bool search_sync = 50006;
+	E_SearchSync = &file_fdb_layer_annotations_proto_extTypes[5]
+	// Generate Archive, which moves old records to a blob store
+	//
+	// optional annotations.Archive archive = 50007;
+	E_Archive = &file_fdb_layer_annotations_proto_extTypes[6]
+	// URL templates of webhooks called for every change by DispatchWebhooks,
+	// e.g. "https://example.com/users/{id}". Implies change_log.
+	//
+	// repeated string webhook = 50008;
+	E_Webhook = &file_fdb_layer_annotations_proto_extTypes[7]
+	// Generate MergeSet, which keeps the most recent value of every field
+	// instead of replacing the whole record
+	//
+	// optional bool field_merge = 50009;
+	E_FieldMerge = &file_fdb_layer_annotations_proto_extTypes[8]
+	// Name of the Serializer encoding records, registered with
+	// RegisterSerializer: "proto" (the default), "protojson" or a custom one
+	//
+	// optional string serializer = 50010;
+	E_Serializer = &file_fdb_layer_annotations_proto_extTypes[9]
+	// Skip writes of Set whose deterministically encoded record equals the
+	// stored one, leaving indexes, the change log and conflicts untouched
+	//
+	// optional bool skip_unchanged_writes = 50011;
+	E_SkipUnchangedWrites = &file_fdb_layer_annotations_proto_extTypes[10]
+	// Functions generated for the message: "minimal" for the core repository
+	// and the features enabled by annotations, "standard" adding batches,
+	// writers, queries, watches, caching and intents, or "full", the default,
+	// adding imports, exports and maintenance operations
+	//
+	// optional string profile = 50012;
+	E_Profile = &file_fdb_layer_annotations_proto_extTypes[11]
+	// Earlier message types of the records, oldest first, e.g. "UserV1".
+	// Records are stored with their version, the position of their type in
+	// this list counting from 1, or the length of the list plus one for the
+	// message itself. Records of an earlier type are converted on reads by the
+	// converter registered with Register<Message>From<Type>
+	//
+	// repeated string previous_version = 50013;
+	E_PreviousVersion = &file_fdb_layer_annotations_proto_extTypes[12]
+	// Spread the records over this many buckets, prefixing their keys with a
+	// hash of their primary key modulo buckets, so that writes of increasing
+	// primary keys, such as timestamps or sequence numbers, do not all go to
+	// the end of the directory. Scans in primary key order read every bucket
+	// and merge them. 0 or 1 keeps records in primary key order.
+	//
+	// optional uint32 buckets = 50014;
+	E_Buckets = &file_fdb_layer_annotations_proto_extTypes[13]
+	// Lay out the records and index entries of the message like a record store
+	// of the Java FDB Record Layer opened at the message directory, so that
+	// Record Layer services and the generated repository can share its
+	// records
+	//
+	// optional annotations.RecordLayer record_layer = 50015;
+	E_RecordLayer = &file_fdb_layer_annotations_proto_extTypes[14]
+	// Generate GetWithETag, SetIfMatch and DeleteIfMatch. Every write of a
+	// record then also stores its version, the read version of the writing
+	// transaction, and conflicts with concurrent writes of the record
+	//
+	// optional bool etag = 50016;
+	E_Etag = &file_fdb_layer_annotations_proto_extTypes[15]
+)
+
+// Extension fields to descriptorpb.FieldOptions.
+var (
+	// Marks a string field as a reference to an object in external storage
+	//
+	// optional annotations.BlobRef blob_ref = 50101;
+	E_BlobRef = &file_fdb_layer_annotations_proto_extTypes[16]
+	// Stores an integer field as a counter changed with atomic additions
+	//
+	// optional bool counter = 50102;
+	E_Counter = &file_fdb_layer_annotations_proto_extTypes[17]
+	// Stores a repeated scalar field as a set of elements added and removed
+	// individually
+	//
+	// optional bool element_set = 50103;
+	E_ElementSet = &file_fdb_layer_annotations_proto_extTypes[18]
+	// Stores an int64 field holding Unix seconds, such as last_seen, as a
+	// heartbeat time moved forward with atomic maximums by Touch<Field>
+	//
+	// optional bool touch = 50104;
+	E_Touch = &file_fdb_layer_annotations_proto_extTypes[19]
+	// Indexes the keys of a map field, with one entry per key, queried with
+	// GetBy<Field>Key
+	//
+	// optional bool index_keys = 50105;
+	E_IndexKeys = &file_fdb_layer_annotations_proto_extTypes[20]
+	// Stores a singular scalar field, such as last_login_ip, in a key of its
+	// own, overwritten by Set<Field> without reading or rewriting the record
+	//
+	// optional bool side_stored = 50106;
+	E_SideStored = &file_fdb_layer_annotations_proto_extTypes[21]
+	// Constrains the values of a string primary key or index field, checked
+	// by Set, so that input cannot make unreadably long or malformed keys
+	//
+	// optional annotations.StringKey string_key = 50107;
+	E_StringKey = &file_fdb_layer_annotations_proto_extTypes[22]
+	// Packs a string or bytes primary key field as a tuple UUID, and sets it
+	// to a new random UUID when Create writes a record without it. String
+	// values must be UUIDs in canonical form, bytes values 16 bytes long.
+	//
+	// optional bool auto_uuid = 50108;
+	E_AutoUuid = &file_fdb_layer_annotations_proto_extTypes[23]
 )
 
 var File_fdb_layer_annotations_proto protoreflect.FileDescriptor
@@ -106,25 +724,150 @@ var file_fdb_layer_annotations_proto_rawDesc = []byte{
 	0x74, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x0b, 0x61,
 	0x6e, 0x6e, 0x6f, 0x74, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x1a, 0x20, 0x67, 0x6f, 0x6f, 0x67,
 	0x6c, 0x65, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2f, 0x64, 0x65, 0x73, 0x63,
-	0x72, 0x69, 0x70, 0x74, 0x6f, 0x72, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0x28, 0x0a, 0x0e,
-	0x53, 0x65, 0x63, 0x6f, 0x6e, 0x64, 0x61, 0x72, 0x79, 0x49, 0x6e, 0x64, 0x65, 0x78, 0x12, 0x16,
-	0x0a, 0x06, 0x66, 0x69, 0x65, 0x6c, 0x64, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x09, 0x52, 0x06,
-	0x66, 0x69, 0x65, 0x6c, 0x64, 0x73, 0x3a, 0x42, 0x0a, 0x0b, 0x70, 0x72, 0x69, 0x6d, 0x61, 0x72,
-	0x79, 0x5f, 0x6b, 0x65, 0x79, 0x12, 0x1f, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70,
-	0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x4f,
-	0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x18, 0xd1, 0x86, 0x03, 0x20, 0x03, 0x28, 0x09, 0x52, 0x0a,
-	0x70, 0x72, 0x69, 0x6d, 0x61, 0x72, 0x79, 0x4b, 0x65, 0x79, 0x3a, 0x67, 0x0a, 0x0f, 0x73, 0x65,
-	0x63, 0x6f, 0x6e, 0x64, 0x61, 0x72, 0x79, 0x5f, 0x69, 0x6e, 0x64, 0x65, 0x78, 0x12, 0x1f, 0x2e,
+	0x72, 0x69, 0x70, 0x74, 0x6f, 0x72, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0x88, 0x01, 0x0a,
+	0x0e, 0x53, 0x65, 0x63, 0x6f, 0x6e, 0x64, 0x61, 0x72, 0x79, 0x49, 0x6e, 0x64, 0x65, 0x78, 0x12,
+	0x16, 0x0a, 0x06, 0x66, 0x69, 0x65, 0x6c, 0x64, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x09, 0x52,
+	0x06, 0x66, 0x69, 0x65, 0x6c, 0x64, 0x73, 0x12, 0x16, 0x0a, 0x06, 0x75, 0x6e, 0x69, 0x71, 0x75,
+	0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x08, 0x52, 0x06, 0x75, 0x6e, 0x69, 0x71, 0x75, 0x65, 0x12,
+	0x12, 0x0a, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x6e,
+	0x61, 0x6d, 0x65, 0x12, 0x1a, 0x0a, 0x08, 0x63, 0x6f, 0x76, 0x65, 0x72, 0x69, 0x6e, 0x67, 0x18,
+	0x04, 0x20, 0x01, 0x28, 0x08, 0x52, 0x08, 0x63, 0x6f, 0x76, 0x65, 0x72, 0x69, 0x6e, 0x67, 0x12,
+	0x16, 0x0a, 0x06, 0x67, 0x6c, 0x6f, 0x62, 0x61, 0x6c, 0x18, 0x05, 0x20, 0x01, 0x28, 0x08, 0x52,
+	0x06, 0x67, 0x6c, 0x6f, 0x62, 0x61, 0x6c, 0x22, 0x38, 0x0a, 0x0a, 0x50, 0x72, 0x6f, 0x6a, 0x65,
+	0x63, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x12, 0x0a, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x66, 0x69, 0x65,
+	0x6c, 0x64, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x09, 0x52, 0x06, 0x66, 0x69, 0x65, 0x6c, 0x64,
+	0x73, 0x22, 0x28, 0x0a, 0x07, 0x41, 0x72, 0x63, 0x68, 0x69, 0x76, 0x65, 0x12, 0x1d, 0x0a, 0x0a,
+	0x74, 0x69, 0x6d, 0x65, 0x5f, 0x66, 0x69, 0x65, 0x6c, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x09, 0x74, 0x69, 0x6d, 0x65, 0x46, 0x69, 0x65, 0x6c, 0x64, 0x22, 0x5a, 0x0a, 0x0b, 0x52,
+	0x65, 0x63, 0x6f, 0x72, 0x64, 0x4c, 0x61, 0x79, 0x65, 0x72, 0x12, 0x1f, 0x0a, 0x0b, 0x75, 0x6e,
+	0x69, 0x6f, 0x6e, 0x5f, 0x66, 0x69, 0x65, 0x6c, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0d, 0x52,
+	0x0a, 0x75, 0x6e, 0x69, 0x6f, 0x6e, 0x46, 0x69, 0x65, 0x6c, 0x64, 0x12, 0x2a, 0x0a, 0x11, 0x6d,
+	0x65, 0x74, 0x61, 0x5f, 0x64, 0x61, 0x74, 0x61, 0x5f, 0x76, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e,
+	0x18, 0x02, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0f, 0x6d, 0x65, 0x74, 0x61, 0x44, 0x61, 0x74, 0x61,
+	0x56, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x22, 0x3d, 0x0a, 0x07, 0x42, 0x6c, 0x6f, 0x62, 0x52,
+	0x65, 0x66, 0x12, 0x18, 0x0a, 0x07, 0x70, 0x61, 0x74, 0x74, 0x65, 0x72, 0x6e, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x07, 0x70, 0x61, 0x74, 0x74, 0x65, 0x72, 0x6e, 0x12, 0x18, 0x0a, 0x07,
+	0x63, 0x6c, 0x65, 0x61, 0x6e, 0x75, 0x70, 0x18, 0x02, 0x20, 0x01, 0x28, 0x08, 0x52, 0x07, 0x63,
+	0x6c, 0x65, 0x61, 0x6e, 0x75, 0x70, 0x22, 0x5d, 0x0a, 0x09, 0x53, 0x74, 0x72, 0x69, 0x6e, 0x67,
+	0x4b, 0x65, 0x79, 0x12, 0x1b, 0x0a, 0x09, 0x6d, 0x61, 0x78, 0x5f, 0x62, 0x79, 0x74, 0x65, 0x73,
+	0x18, 0x01, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x08, 0x6d, 0x61, 0x78, 0x42, 0x79, 0x74, 0x65, 0x73,
+	0x12, 0x1f, 0x0a, 0x0b, 0x72, 0x65, 0x6a, 0x65, 0x63, 0x74, 0x5f, 0x6e, 0x75, 0x6c, 0x6c, 0x18,
+	0x02, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0a, 0x72, 0x65, 0x6a, 0x65, 0x63, 0x74, 0x4e, 0x75, 0x6c,
+	0x6c, 0x12, 0x12, 0x0a, 0x04, 0x68, 0x61, 0x73, 0x68, 0x18, 0x03, 0x20, 0x01, 0x28, 0x08, 0x52,
+	0x04, 0x68, 0x61, 0x73, 0x68, 0x3a, 0x42, 0x0a, 0x0b, 0x70, 0x72, 0x69, 0x6d, 0x61, 0x72, 0x79,
+	0x5f, 0x6b, 0x65, 0x79, 0x12, 0x1f, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72,
+	0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x4f, 0x70,
+	0x74, 0x69, 0x6f, 0x6e, 0x73, 0x18, 0xd1, 0x86, 0x03, 0x20, 0x03, 0x28, 0x09, 0x52, 0x0a, 0x70,
+	0x72, 0x69, 0x6d, 0x61, 0x72, 0x79, 0x4b, 0x65, 0x79, 0x3a, 0x67, 0x0a, 0x0f, 0x73, 0x65, 0x63,
+	0x6f, 0x6e, 0x64, 0x61, 0x72, 0x79, 0x5f, 0x69, 0x6e, 0x64, 0x65, 0x78, 0x12, 0x1f, 0x2e, 0x67,
+	0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x4d,
+	0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x4f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x18, 0xd2, 0x86,
+	0x03, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x1b, 0x2e, 0x61, 0x6e, 0x6e, 0x6f, 0x74, 0x61, 0x74, 0x69,
+	0x6f, 0x6e, 0x73, 0x2e, 0x53, 0x65, 0x63, 0x6f, 0x6e, 0x64, 0x61, 0x72, 0x79, 0x49, 0x6e, 0x64,
+	0x65, 0x78, 0x52, 0x0e, 0x73, 0x65, 0x63, 0x6f, 0x6e, 0x64, 0x61, 0x72, 0x79, 0x49, 0x6e, 0x64,
+	0x65, 0x78, 0x3a, 0x5a, 0x0a, 0x0a, 0x70, 0x72, 0x6f, 0x6a, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e,
+	0x12, 0x1f, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62,
+	0x75, 0x66, 0x2e, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x4f, 0x70, 0x74, 0x69, 0x6f, 0x6e,
+	0x73, 0x18, 0xd3, 0x86, 0x03, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x17, 0x2e, 0x61, 0x6e, 0x6e, 0x6f,
+	0x74, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x2e, 0x50, 0x72, 0x6f, 0x6a, 0x65, 0x63, 0x74, 0x69,
+	0x6f, 0x6e, 0x52, 0x0a, 0x70, 0x72, 0x6f, 0x6a, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x3a, 0x3f,
+	0x0a, 0x09, 0x64, 0x69, 0x72, 0x65, 0x63, 0x74, 0x6f, 0x72, 0x79, 0x12, 0x1f, 0x2e, 0x67, 0x6f,
+	0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x4d, 0x65,
+	0x73, 0x73, 0x61, 0x67, 0x65, 0x4f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x18, 0xd4, 0x86, 0x03,
+	0x20, 0x03, 0x28, 0x09, 0x52, 0x09, 0x64, 0x69, 0x72, 0x65, 0x63, 0x74, 0x6f, 0x72, 0x79, 0x3a,
+	0x40, 0x0a, 0x0a, 0x63, 0x68, 0x61, 0x6e, 0x67, 0x65, 0x5f, 0x6c, 0x6f, 0x67, 0x12, 0x1f, 0x2e,
 	0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e,
-	0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x4f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x18, 0xd2,
-	0x86, 0x03, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x1b, 0x2e, 0x61, 0x6e, 0x6e, 0x6f, 0x74, 0x61, 0x74,
-	0x69, 0x6f, 0x6e, 0x73, 0x2e, 0x53, 0x65, 0x63, 0x6f, 0x6e, 0x64, 0x61, 0x72, 0x79, 0x49, 0x6e,
-	0x64, 0x65, 0x78, 0x52, 0x0e, 0x73, 0x65, 0x63, 0x6f, 0x6e, 0x64, 0x61, 0x72, 0x79, 0x49, 0x6e,
-	0x64, 0x65, 0x78, 0x42, 0x43, 0x5a, 0x41, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f,
-	0x6d, 0x2f, 0x72, 0x6f, 0x6d, 0x61, 0x6e, 0x6e, 0x69, 0x6b, 0x6f, 0x76, 0x2f, 0x66, 0x64, 0x62,
-	0x2d, 0x67, 0x6f, 0x2d, 0x6c, 0x61, 0x79, 0x65, 0x72, 0x2d, 0x70, 0x6c, 0x75, 0x67, 0x69, 0x6e,
-	0x2f, 0x61, 0x6e, 0x6e, 0x6f, 0x74, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x3b, 0x61, 0x6e, 0x6e,
-	0x6f, 0x74, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+	0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x4f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x18, 0xd5,
+	0x86, 0x03, 0x20, 0x01, 0x28, 0x08, 0x52, 0x09, 0x63, 0x68, 0x61, 0x6e, 0x67, 0x65, 0x4c, 0x6f,
+	0x67, 0x3a, 0x42, 0x0a, 0x0b, 0x73, 0x65, 0x61, 0x72, 0x63, 0x68, 0x5f, 0x73, 0x79, 0x6e, 0x63,
+	0x12, 0x1f, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62,
+	0x75, 0x66, 0x2e, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x4f, 0x70, 0x74, 0x69, 0x6f, 0x6e,
+	0x73, 0x18, 0xd6, 0x86, 0x03, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0a, 0x73, 0x65, 0x61, 0x72, 0x63,
+	0x68, 0x53, 0x79, 0x6e, 0x63, 0x3a, 0x51, 0x0a, 0x07, 0x61, 0x72, 0x63, 0x68, 0x69, 0x76, 0x65,
+	0x12, 0x1f, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62,
+	0x75, 0x66, 0x2e, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x4f, 0x70, 0x74, 0x69, 0x6f, 0x6e,
+	0x73, 0x18, 0xd7, 0x86, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x14, 0x2e, 0x61, 0x6e, 0x6e, 0x6f,
+	0x74, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x2e, 0x41, 0x72, 0x63, 0x68, 0x69, 0x76, 0x65, 0x52,
+	0x07, 0x61, 0x72, 0x63, 0x68, 0x69, 0x76, 0x65, 0x3a, 0x3b, 0x0a, 0x07, 0x77, 0x65, 0x62, 0x68,
+	0x6f, 0x6f, 0x6b, 0x12, 0x1f, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f,
+	0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x4f, 0x70, 0x74,
+	0x69, 0x6f, 0x6e, 0x73, 0x18, 0xd8, 0x86, 0x03, 0x20, 0x03, 0x28, 0x09, 0x52, 0x07, 0x77, 0x65,
+	0x62, 0x68, 0x6f, 0x6f, 0x6b, 0x3a, 0x42, 0x0a, 0x0b, 0x66, 0x69, 0x65, 0x6c, 0x64, 0x5f, 0x6d,
+	0x65, 0x72, 0x67, 0x65, 0x12, 0x1f, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72,
+	0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x4f, 0x70,
+	0x74, 0x69, 0x6f, 0x6e, 0x73, 0x18, 0xd9, 0x86, 0x03, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0a, 0x66,
+	0x69, 0x65, 0x6c, 0x64, 0x4d, 0x65, 0x72, 0x67, 0x65, 0x3a, 0x41, 0x0a, 0x0a, 0x73, 0x65, 0x72,
+	0x69, 0x61, 0x6c, 0x69, 0x7a, 0x65, 0x72, 0x12, 0x1f, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65,
+	0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67,
+	0x65, 0x4f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x18, 0xda, 0x86, 0x03, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x0a, 0x73, 0x65, 0x72, 0x69, 0x61, 0x6c, 0x69, 0x7a, 0x65, 0x72, 0x3a, 0x55, 0x0a, 0x15,
+	0x73, 0x6b, 0x69, 0x70, 0x5f, 0x75, 0x6e, 0x63, 0x68, 0x61, 0x6e, 0x67, 0x65, 0x64, 0x5f, 0x77,
+	0x72, 0x69, 0x74, 0x65, 0x73, 0x12, 0x1f, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70,
+	0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x4f,
+	0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x18, 0xdb, 0x86, 0x03, 0x20, 0x01, 0x28, 0x08, 0x52, 0x13,
+	0x73, 0x6b, 0x69, 0x70, 0x55, 0x6e, 0x63, 0x68, 0x61, 0x6e, 0x67, 0x65, 0x64, 0x57, 0x72, 0x69,
+	0x74, 0x65, 0x73, 0x3a, 0x3b, 0x0a, 0x07, 0x70, 0x72, 0x6f, 0x66, 0x69, 0x6c, 0x65, 0x12, 0x1f,
+	0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66,
+	0x2e, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x4f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x18,
+	0xdc, 0x86, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x70, 0x72, 0x6f, 0x66, 0x69, 0x6c, 0x65,
+	0x3a, 0x4c, 0x0a, 0x10, 0x70, 0x72, 0x65, 0x76, 0x69, 0x6f, 0x75, 0x73, 0x5f, 0x76, 0x65, 0x72,
+	0x73, 0x69, 0x6f, 0x6e, 0x12, 0x1f, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72,
+	0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x4f, 0x70,
+	0x74, 0x69, 0x6f, 0x6e, 0x73, 0x18, 0xdd, 0x86, 0x03, 0x20, 0x03, 0x28, 0x09, 0x52, 0x0f, 0x70,
+	0x72, 0x65, 0x76, 0x69, 0x6f, 0x75, 0x73, 0x56, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x3a, 0x3b,
+	0x0a, 0x07, 0x62, 0x75, 0x63, 0x6b, 0x65, 0x74, 0x73, 0x12, 0x1f, 0x2e, 0x67, 0x6f, 0x6f, 0x67,
+	0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x4d, 0x65, 0x73, 0x73,
+	0x61, 0x67, 0x65, 0x4f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x18, 0xde, 0x86, 0x03, 0x20, 0x01,
+	0x28, 0x0d, 0x52, 0x07, 0x62, 0x75, 0x63, 0x6b, 0x65, 0x74, 0x73, 0x3a, 0x5e, 0x0a, 0x0c, 0x72,
+	0x65, 0x63, 0x6f, 0x72, 0x64, 0x5f, 0x6c, 0x61, 0x79, 0x65, 0x72, 0x12, 0x1f, 0x2e, 0x67, 0x6f,
+	0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x4d, 0x65,
+	0x73, 0x73, 0x61, 0x67, 0x65, 0x4f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x18, 0xdf, 0x86, 0x03,
+	0x20, 0x01, 0x28, 0x0b, 0x32, 0x18, 0x2e, 0x61, 0x6e, 0x6e, 0x6f, 0x74, 0x61, 0x74, 0x69, 0x6f,
+	0x6e, 0x73, 0x2e, 0x52, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x4c, 0x61, 0x79, 0x65, 0x72, 0x52, 0x0b,
+	0x72, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x4c, 0x61, 0x79, 0x65, 0x72, 0x3a, 0x35, 0x0a, 0x04, 0x65,
+	0x74, 0x61, 0x67, 0x12, 0x1f, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f,
+	0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x4f, 0x70, 0x74,
+	0x69, 0x6f, 0x6e, 0x73, 0x18, 0xe0, 0x86, 0x03, 0x20, 0x01, 0x28, 0x08, 0x52, 0x04, 0x65, 0x74,
+	0x61, 0x67, 0x3a, 0x50, 0x0a, 0x08, 0x62, 0x6c, 0x6f, 0x62, 0x5f, 0x72, 0x65, 0x66, 0x12, 0x1d,
+	0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66,
+	0x2e, 0x46, 0x69, 0x65, 0x6c, 0x64, 0x4f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x18, 0xb5, 0x87,
+	0x03, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x14, 0x2e, 0x61, 0x6e, 0x6e, 0x6f, 0x74, 0x61, 0x74, 0x69,
+	0x6f, 0x6e, 0x73, 0x2e, 0x42, 0x6c, 0x6f, 0x62, 0x52, 0x65, 0x66, 0x52, 0x07, 0x62, 0x6c, 0x6f,
+	0x62, 0x52, 0x65, 0x66, 0x3a, 0x39, 0x0a, 0x07, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x65, 0x72, 0x12,
+	0x1d, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75,
+	0x66, 0x2e, 0x46, 0x69, 0x65, 0x6c, 0x64, 0x4f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x18, 0xb6,
+	0x87, 0x03, 0x20, 0x01, 0x28, 0x08, 0x52, 0x07, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x65, 0x72, 0x3a,
+	0x40, 0x0a, 0x0b, 0x65, 0x6c, 0x65, 0x6d, 0x65, 0x6e, 0x74, 0x5f, 0x73, 0x65, 0x74, 0x12, 0x1d,
+	0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66,
+	0x2e, 0x46, 0x69, 0x65, 0x6c, 0x64, 0x4f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x18, 0xb7, 0x87,
+	0x03, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0a, 0x65, 0x6c, 0x65, 0x6d, 0x65, 0x6e, 0x74, 0x53, 0x65,
+	0x74, 0x3a, 0x35, 0x0a, 0x05, 0x74, 0x6f, 0x75, 0x63, 0x68, 0x12, 0x1d, 0x2e, 0x67, 0x6f, 0x6f,
+	0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x46, 0x69, 0x65,
+	0x6c, 0x64, 0x4f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x18, 0xb8, 0x87, 0x03, 0x20, 0x01, 0x28,
+	0x08, 0x52, 0x05, 0x74, 0x6f, 0x75, 0x63, 0x68, 0x3a, 0x3e, 0x0a, 0x0a, 0x69, 0x6e, 0x64, 0x65,
+	0x78, 0x5f, 0x6b, 0x65, 0x79, 0x73, 0x12, 0x1d, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e,
+	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x46, 0x69, 0x65, 0x6c, 0x64, 0x4f, 0x70,
+	0x74, 0x69, 0x6f, 0x6e, 0x73, 0x18, 0xb9, 0x87, 0x03, 0x20, 0x01, 0x28, 0x08, 0x52, 0x09, 0x69,
+	0x6e, 0x64, 0x65, 0x78, 0x4b, 0x65, 0x79, 0x73, 0x3a, 0x40, 0x0a, 0x0b, 0x73, 0x69, 0x64, 0x65,
+	0x5f, 0x73, 0x74, 0x6f, 0x72, 0x65, 0x64, 0x12, 0x1d, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65,
+	0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x46, 0x69, 0x65, 0x6c, 0x64, 0x4f,
+	0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x18, 0xba, 0x87, 0x03, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0a,
+	0x73, 0x69, 0x64, 0x65, 0x53, 0x74, 0x6f, 0x72, 0x65, 0x64, 0x3a, 0x56, 0x0a, 0x0a, 0x73, 0x74,
+	0x72, 0x69, 0x6e, 0x67, 0x5f, 0x6b, 0x65, 0x79, 0x12, 0x1d, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c,
+	0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x46, 0x69, 0x65, 0x6c, 0x64,
+	0x4f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x18, 0xbb, 0x87, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32,
+	0x16, 0x2e, 0x61, 0x6e, 0x6e, 0x6f, 0x74, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x2e, 0x53, 0x74,
+	0x72, 0x69, 0x6e, 0x67, 0x4b, 0x65, 0x79, 0x52, 0x09, 0x73, 0x74, 0x72, 0x69, 0x6e, 0x67, 0x4b,
+	0x65, 0x79, 0x3a, 0x3c, 0x0a, 0x09, 0x61, 0x75, 0x74, 0x6f, 0x5f, 0x75, 0x75, 0x69, 0x64, 0x12,
+	0x1d, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75,
+	0x66, 0x2e, 0x46, 0x69, 0x65, 0x6c, 0x64, 0x4f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x18, 0xbc,
+	0x87, 0x03, 0x20, 0x01, 0x28, 0x08, 0x52, 0x08, 0x61, 0x75, 0x74, 0x6f, 0x55, 0x75, 0x69, 0x64,
+	0x42, 0x41, 0x5a, 0x3f, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x72,
+	0x6f, 0x6d, 0x61, 0x6e, 0x6e, 0x69, 0x6b, 0x6f, 0x76, 0x2f, 0x66, 0x64, 0x62, 0x2d, 0x67, 0x6f,
+	0x2d, 0x6c, 0x61, 0x79, 0x65, 0x72, 0x2d, 0x70, 0x6c, 0x75, 0x67, 0x69, 0x6e, 0x2f, 0x66, 0x64,
+	0x62, 0x2d, 0x6c, 0x61, 0x79, 0x65, 0x72, 0x3b, 0x61, 0x6e, 0x6e, 0x6f, 0x74, 0x61, 0x74, 0x69,
+	0x6f, 0x6e, 0x73, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
 }
 
 var (
@@ -139,20 +882,53 @@ func file_fdb_layer_annotations_proto_rawDescGZIP() []byte {
 	return file_fdb_layer_annotations_proto_rawDescData
 }
 
-var file_fdb_layer_annotations_proto_msgTypes = make([]protoimpl.MessageInfo, 1)
-var file_fdb_layer_annotations_proto_goTypes = []interface{}{
+var file_fdb_layer_annotations_proto_msgTypes = make([]protoimpl.MessageInfo, 6)
+var file_fdb_layer_annotations_proto_goTypes = []any{
 	(*SecondaryIndex)(nil),              // 0: annotations.SecondaryIndex
-	(*descriptorpb.MessageOptions)(nil), // 1: google.protobuf.MessageOptions
+	(*Projection)(nil),                  // 1: annotations.Projection
+	(*Archive)(nil),                     // 2: annotations.Archive
+	(*RecordLayer)(nil),                 // 3: annotations.RecordLayer
+	(*BlobRef)(nil),                     // 4: annotations.BlobRef
+	(*StringKey)(nil),                   // 5: annotations.StringKey
+	(*descriptorpb.MessageOptions)(nil), // 6: google.protobuf.MessageOptions
+	(*descriptorpb.FieldOptions)(nil),   // 7: google.protobuf.FieldOptions
 }
 var file_fdb_layer_annotations_proto_depIdxs = []int32{
-	1, // 0: annotations.primary_key:extendee -> google.protobuf.MessageOptions
-	1, // 1: annotations.secondary_index:extendee -> google.protobuf.MessageOptions
-	0, // 2: annotations.secondary_index:type_name -> annotations.SecondaryIndex
-	3, // [3:3] is the sub-list for method output_type
-	3, // [3:3] is the sub-list for method input_type
-	2, // [2:3] is the sub-list for extension type_name
-	0, // [0:2] is the sub-list for extension extendee
-	0, // [0:0] is the sub-list for field type_name
+	6,  // 0: annotations.primary_key:extendee -> google.protobuf.MessageOptions
+	6,  // 1: annotations.secondary_index:extendee -> google.protobuf.MessageOptions
+	6,  // 2: annotations.projection:extendee -> google.protobuf.MessageOptions
+	6,  // 3: annotations.directory:extendee -> google.protobuf.MessageOptions
+	6,  // 4: annotations.change_log:extendee -> google.protobuf.MessageOptions
+	6,  // 5: annotations.search_sync:extendee -> google.protobuf.MessageOptions
+	6,  // 6: annotations.archive:extendee -> google.protobuf.MessageOptions
+	6,  // 7: annotations.webhook:extendee -> google.protobuf.MessageOptions
+	6,  // 8: annotations.field_merge:extendee -> google.protobuf.MessageOptions
+	6,  // 9: annotations.serializer:extendee -> google.protobuf.MessageOptions
+	6,  // 10: annotations.skip_unchanged_writes:extendee -> google.protobuf.MessageOptions
+	6,  // 11: annotations.profile:extendee -> google.protobuf.MessageOptions
+	6,  // 12: annotations.previous_version:extendee -> google.protobuf.MessageOptions
+	6,  // 13: annotations.buckets:extendee -> google.protobuf.MessageOptions
+	6,  // 14: annotations.record_layer:extendee -> google.protobuf.MessageOptions
+	6,  // 15: annotations.etag:extendee -> google.protobuf.MessageOptions
+	7,  // 16: annotations.blob_ref:extendee -> google.protobuf.FieldOptions
+	7,  // 17: annotations.counter:extendee -> google.protobuf.FieldOptions
+	7,  // 18: annotations.element_set:extendee -> google.protobuf.FieldOptions
+	7,  // 19: annotations.touch:extendee -> google.protobuf.FieldOptions
+	7,  // 20: annotations.index_keys:extendee -> google.protobuf.FieldOptions
+	7,  // 21: annotations.side_stored:extendee -> google.protobuf.FieldOptions
+	7,  // 22: annotations.string_key:extendee -> google.protobuf.FieldOptions
+	7,  // 23: annotations.auto_uuid:extendee -> google.protobuf.FieldOptions
+	0,  // 24: annotations.secondary_index:type_name -> annotations.SecondaryIndex
+	1,  // 25: annotations.projection:type_name -> annotations.Projection
+	2,  // 26: annotations.archive:type_name -> annotations.Archive
+	3,  // 27: annotations.record_layer:type_name -> annotations.RecordLayer
+	4,  // 28: annotations.blob_ref:type_name -> annotations.BlobRef
+	5,  // 29: annotations.string_key:type_name -> annotations.StringKey
+	30, // [30:30] is the sub-list for method output_type
+	30, // [30:30] is the sub-list for method input_type
+	24, // [24:30] is the sub-list for extension type_name
+	0,  // [0:24] is the sub-list for extension extendee
+	0,  // [0:0] is the sub-list for field type_name
 }
 
 func init() { file_fdb_layer_annotations_proto_init() }
@@ -160,28 +936,14 @@ func file_fdb_layer_annotations_proto_init() {
 	if File_fdb_layer_annotations_proto != nil {
 		return
 	}
-	if !protoimpl.UnsafeEnabled {
-		file_fdb_layer_annotations_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*SecondaryIndex); i {
-			case 0:
-				return &v.state
-			case 1:
-				return &v.sizeCache
-			case 2:
-				return &v.unknownFields
-			default:
-				return nil
-			}
-		}
-	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_fdb_layer_annotations_proto_rawDesc,
 			NumEnums:      0,
-			NumMessages:   1,
-			NumExtensions: 2,
+			NumMessages:   6,
+			NumExtensions: 24,
 			NumServices:   0,
 		},
 		GoTypes:           file_fdb_layer_annotations_proto_goTypes,
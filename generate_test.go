@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/bufbuild/protocompile"
+	"google.golang.org/protobuf/compiler/protogen"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/pluginpb"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files with the generated code")
+
+// fixtureFiles are the fixture protos in testdata/proto.
+var fixtureFiles = []string{"fixtures.proto"}
+
+// goldenParameter is the plugin parameter of the golden files.
+const goldenParameter = "admin=true,testharness=true"
+
+// fixtureRequest compiles the fixture protos and returns the request protoc
+// would send a plugin run with parameter.
+func fixtureRequest(t *testing.T, parameter string) *pluginpb.CodeGeneratorRequest {
+	t.Helper()
+	return protoRequest(t, filepath.Join("testdata", "proto"), fixtureFiles, parameter)
+}
+
+// protoRequest compiles protos, found in dir, or in the module root for the
+// annotations, and returns the request protoc would send a plugin run with
+// parameter generating them.
+func protoRequest(t *testing.T, dir string, protos []string, parameter string) *pluginpb.CodeGeneratorRequest {
+	t.Helper()
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{
+			ImportPaths: []string{dir, "."},
+		}),
+	}
+	files, err := compiler.Compile(context.Background(), protos...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := &pluginpb.CodeGeneratorRequest{FileToGenerate: protos, Parameter: proto.String(parameter)}
+	seen := map[string]bool{}
+	var add func(protoreflect.FileDescriptor)
+	add = func(file protoreflect.FileDescriptor) {
+		if seen[file.Path()] {
+			return
+		}
+		seen[file.Path()] = true
+		imports := file.Imports()
+		for i := 0; i < imports.Len(); i++ {
+			add(imports.Get(i).FileDescriptor)
+		}
+		req.ProtoFile = append(req.ProtoFile, protodesc.ToFileDescriptorProto(file))
+	}
+	for _, file := range files {
+		add(file)
+	}
+
+	// Round-trip the request like protoc does, so that the options are
+	// decoded with the generated annotation types
+	b, err := proto.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := &pluginpb.CodeGeneratorRequest{}
+	if err := proto.Unmarshal(b, decoded); err != nil {
+		t.Fatal(err)
+	}
+	return decoded
+}
+
+// runPlugin runs the plugin on req and returns the content of the generated
+// files by name.
+func runPlugin(t *testing.T, req *pluginpb.CodeGeneratorRequest) map[string]string {
+	t.Helper()
+	flags, generate := newGenerator()
+	plugin, err := protogen.Options{ParamFunc: flags.Set}.New(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := generate(plugin); err != nil {
+		t.Fatal(err)
+	}
+	resp := plugin.Response()
+	if resp.Error != nil {
+		t.Fatal(resp.GetError())
+	}
+	files := map[string]string{}
+	for _, f := range resp.File {
+		files[f.GetName()] = f.GetContent()
+	}
+	return files
+}
+
+// TestGolden compares the code generated for the fixtures with the golden
+// files in testdata/golden. Run go test -run TestGolden -update to rewrite
+// them after reviewing a change of the generated code.
+func TestGolden(t *testing.T) {
+	files := runPlugin(t, fixtureRequest(t, goldenParameter))
+	dir := filepath.Join("testdata", "golden")
+
+	if *update {
+		if err := os.RemoveAll(dir); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		for name, content := range files {
+			if err := os.WriteFile(filepath.Join(dir, name+".golden"), []byte(content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden := map[string]bool{}
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), ".golden")
+		golden[name] = true
+		if _, ok := files[name]; !ok {
+			t.Errorf("%s is no longer generated", name)
+		}
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !golden[name] {
+			t.Errorf("%s is generated but has no golden file", name)
+			continue
+		}
+		want, err := os.ReadFile(filepath.Join(dir, name+".golden"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if line, ok := firstDifference(files[name], string(want)); !ok {
+			t.Errorf("%s differs from its golden file at line %d", name, line)
+		}
+	}
+}
+
+// firstDifference reports whether got and want are equal and otherwise the
+// first line at which they differ.
+func firstDifference(got, want string) (int, bool) {
+	if got == want {
+		return 0, true
+	}
+	gotLines := bytes.Split([]byte(got), []byte("\n"))
+	wantLines := bytes.Split([]byte(want), []byte("\n"))
+	for i := range gotLines {
+		if i >= len(wantLines) || !bytes.Equal(gotLines[i], wantLines[i]) {
+			return i + 1, false
+		}
+	}
+	return len(gotLines) + 1, false
+}
@@ -0,0 +1,95 @@
+package main
+
+// globalIndexTemplate generates the lookups of global secondary indexes,
+// whose entries are also written to a directory shared by every prefix, so
+// that admin tools can find records without knowing their prefix.
+const globalIndexTemplate = `{{define "globalIndex"}}{{if .HasGlobalIndexes}}
+// {{.Name}}GlobalHit is a record found through a global index, with the
+// prefix of the repository it is stored in.
+type {{.Name}}GlobalHit struct {
+    Prefix []string
+    Record *pb.{{.Name}}
+}
+{{range $idx := .SecondaryIndexes}}{{if $idx.Global}}
+// GlobalGetBy{{$idx.Name}} returns the records of every prefix whose {{range $i, $f := $idx.Fields}}{{if $i}}, {{end}}{{$f.Name}}{{end}}
+// match the given values, reading the global entries of the index. It is
+// meant for admin tools: the result is not limited to the prefix of repo.
+// Entries whose record was deleted or changed without updating them, such
+// as those of a removed prefix, are skipped.
+func (repo *{{$.Name}}Repository) GlobalGetBy{{$idx.Name}}(ctx context.Context, tr fdb.ReadTransaction, {{range $i, $f := $idx.Fields}}{{if $i}}, {{end}}{{$f.Name}} {{$f.Type}}{{end}}) ([]{{$.Name}}GlobalHit, error) {
+    indexRange, err := fdb.PrefixRange(repo.global.Pack(tuple.Tuple{"{{$idx.Name}}_index", {{range $i, $f := $idx.Fields}} {{toTuple $f.Name $f}}, {{end}} }))
+    if err != nil {
+        return nil, err
+    }
+    kvs, err := tr.GetRange(indexRange, fdb.RangeOptions{}).GetSliceWithError()
+    if err != nil {
+        return nil, err
+    }
+    stats := txStatsFrom(ctx)
+    tenants := map[string]*{{$.Name}}Repository{}
+    hits := []{{$.Name}}GlobalHit{}
+    for _, kv := range kvs {
+        stats.read(len(kv.Key))
+        entry, err := repo.global.Unpack(kv.Key)
+        if err != nil {
+            return nil, err
+        }
+        if len(entry) < {{len $idx.Fields}}+2 {
+            return nil, fmt.Errorf("{{$.Name}}: malformed global index entry %v", entry)
+        }
+        tenant, ok := entry[{{len $idx.Fields}}+1].(tuple.Tuple)
+        if !ok {
+            return nil, fmt.Errorf("{{$.Name}}: malformed global index entry %v", entry)
+        }
+        prefix := make([]string, len(tenant))
+        for i, element := range tenant {
+            if prefix[i], ok = element.(string); !ok {
+                return nil, fmt.Errorf("{{$.Name}}: malformed global index entry %v", entry)
+            }
+        }
+        tenantRepo, ok := tenants[string(tenant.Pack())]
+        if !ok {
+            path := append(append([]string{}, prefix...), {{stringSlice $.DirectoryPath}}...)
+            exists, err := directory.Exists(tr, path)
+            if err != nil {
+                return nil, err
+            }
+            if !exists {
+                tenants[string(tenant.Pack())] = nil
+                continue
+            }
+            dir, err := directory.Open(tr, path, nil)
+            if err != nil {
+                return nil, err
+            }
+            copied := *repo
+            copied.dir, copied.tenant = dir, tenant
+            tenantRepo = &copied
+            tenants[string(tenant.Pack())] = tenantRepo
+        }
+        if tenantRepo == nil {
+            continue
+        }
+        value, err := tr.Get(tenantRepo.recordKey(entry[{{len $idx.Fields}}+2:])).Get()
+        if err != nil {
+            return nil, err
+        }
+        if value == nil {
+            continue
+        }
+        stats.read(len(value))
+        entity := &pb.{{$.Name}}{}
+        if err := tenantRepo.unmarshal(value, entity); err != nil {
+            return nil, err
+        }
+        if !bytes.Equal(tenantRepo.indexKeys(entity)[{{$idx.GlobalPosition}}], kv.Key) {
+            continue
+        }
+        {{if $.CRDTFields}}if err := tenantRepo.loadCRDTFields(tr, entity); err != nil {
+            return nil, err
+        }
+        {{end}}hits = append(hits, {{$.Name}}GlobalHit{Prefix: prefix, Record: entity})
+    }
+    return hits, nil
+}
+{{end}}{{end}}{{end}}{{end}}`
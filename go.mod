@@ -2,4 +2,16 @@ module github.com/romannikov/fdb-go-layer-plugin
 
 go 1.23
 
-require google.golang.org/protobuf v1.35.1
+require (
+	github.com/bufbuild/protocompile v0.14.1
+	google.golang.org/grpc v1.68.1
+	google.golang.org/protobuf v1.35.1
+)
+
+require (
+	golang.org/x/net v0.29.0 // indirect
+	golang.org/x/sync v0.8.0 // indirect
+	golang.org/x/sys v0.25.0 // indirect
+	golang.org/x/text v0.18.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240903143218-8af14fe29dc1 // indirect
+)
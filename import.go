@@ -0,0 +1,93 @@
+package main
+
+const importTemplate = `{{define "import"}}
+// Import loads records returned by next until it returns io.EOF, resolving
+// records that already exist according to strategy. merge is only used, and
+// then required, with ImportMerge. Records are written in chunks, one
+// transaction per chunk, with index entries maintained by Set; chunks
+// committed before an error are not rolled back. Each chunk is committed at
+// most once, so a retry after commit_unknown_result does not report its
+// records as conflicts or merge them twice.
+func (repo *{{.Name}}Repository) Import(ctx context.Context, next func() (*pb.{{.Name}}, error), strategy ImportStrategy, merge func(existing, incoming *pb.{{.Name}}) (*pb.{{.Name}}, error)) (ImportStats, error) {
+    var stats ImportStats
+    if strategy == ImportMerge && merge == nil {
+        return stats, errors.New("{{.Name}} import: ImportMerge requires a merge function")
+    }
+
+    limits := repo.batchLimits.withDefaults()
+    done := false
+    for !done {
+        var chunk []*pb.{{.Name}}
+        bytes := 0
+        for len(chunk) < limits.MaxOps && bytes < limits.MaxBytes {
+            entity, err := next()
+            if err == io.EOF {
+                done = true
+                break
+            }
+            if err != nil {
+                return stats, err
+            }
+            chunk = append(chunk, entity)
+            bytes += proto.Size(entity)
+        }
+        if len(chunk) == 0 {
+            break
+        }
+
+        // chunkStats is reset by every attempt, so after a retry that
+        // found the chunk committed it holds the stats of that attempt.
+        var chunkStats ImportStats
+        err := transactOnce(ctx, repo.db, MetaSubspace(repo.dir, MarkersSubspace), func(tr fdb.Transaction) error {
+            chunkStats = ImportStats{}
+            for _, entity := range chunk {
+                if strategy != ImportOverwrite {
+                    existing, err := repo.getIfExists(tr, {{range .PrimaryKeyFields}}entity.{{.Path}}, {{end}})
+                    if err != nil {
+                        return err
+                    }
+                    if existing != nil {
+                        switch strategy {
+                        case ImportSkipExisting:
+                            chunkStats.Skipped++
+                            continue
+                        case ImportFailOnConflict:
+                            return fmt.Errorf("%w: {{.Name}} {{range $i, $f := .PrimaryKeyFields}}{{if $i}} {{end}}{{$f.Name}}=%v{{end}}", ErrImportConflict, {{range .PrimaryKeyFields}}entity.{{.Path}}, {{end}})
+                        case ImportMerge:
+                            merged, err := merge(existing, entity)
+                            if err != nil {
+                                return err
+                            }
+                            entity = merged
+                        }
+                    }
+                }
+                if err := repo.Set(ctx, tr, entity); err != nil {
+                    return err
+                }
+                chunkStats.Written++
+            }
+            return nil
+        })
+        if err != nil {
+            return stats, err
+        }
+        stats.Written += chunkStats.Written
+        stats.Skipped += chunkStats.Skipped
+    }
+    return stats, nil
+}
+
+// ImportDocuments imports the documents of another database's export, such as
+// one read with NewDynamoDBReader or NewFirestoreReader. toRecord maps every
+// document to a record; strategy and merge are used as in Import.
+func (repo *{{.Name}}Repository) ImportDocuments(ctx context.Context, r DocumentReader, toRecord func(doc Document) (*pb.{{.Name}}, error), strategy ImportStrategy, merge func(existing, incoming *pb.{{.Name}}) (*pb.{{.Name}}, error)) (ImportStats, error) {
+    return repo.Import(ctx, func() (*pb.{{.Name}}, error) {
+        doc, err := r.Next()
+        if err != nil {
+            return nil, err
+        }
+        return toRecord(doc)
+    }, strategy, merge)
+}
+{{end}}`
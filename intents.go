@@ -0,0 +1,347 @@
+package main
+
+// intentsTemplate renders intents.go, a write-ahead log making operations
+// that span many transactions crash safe: an operation is recorded before it
+// starts, every chunk of work commits together with its checkpoint, and
+// RecoverIntents finishes, or rolls back, operations whose caller died.
+const intentsTemplate = `{{define "intents"}}// Code generated by fdb-go-layer-plugin {{pluginVersion}}. DO NOT EDIT.
+
+package repositories
+
+import (
+    "context"
+    "crypto/rand"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "time"
+
+    "github.com/apple/foundationdb/bindings/go/src/fdb"
+    "github.com/apple/foundationdb/bindings/go/src/fdb/subspace"
+    "github.com/apple/foundationdb/bindings/go/src/fdb/tuple"
+)
+
+// IntentStep performs the next chunk of an operation in tr, starting from
+// checkpoint (nil at first), and returns the checkpoint to resume from, or
+// nil once the operation is complete. A chunk must fit in one transaction.
+type IntentStep func(ctx context.Context, tr fdb.Transaction, args, checkpoint []byte) ([]byte, error)
+
+// IntentHandler executes the operations of one kind.
+type IntentHandler struct {
+    Step IntentStep
+    // Rollback, if set, undoes an operation whose Step failed, chunk by
+    // chunk like Step, starting from the checkpoint Step reached. Without
+    // it, failed operations are left to RecoverIntents to retry.
+    Rollback IntentStep
+}
+
+// Intent is a recorded operation.
+type Intent struct {
+    ID         string
+    Operation  string
+    Args       []byte
+    Checkpoint []byte
+    // RollingBack is set once Step failed and Rollback runs.
+    RollingBack bool
+    UpdatedAt   time.Time
+}
+
+func (i Intent) pack() []byte {
+    return tuple.Tuple{i.Operation, i.Args, i.Checkpoint, i.RollingBack, i.UpdatedAt.UnixNano()}.Pack()
+}
+
+func unpackIntent(id string, b []byte) (Intent, error) {
+    tpl, err := tuple.Unpack(b)
+    if err != nil {
+        return Intent{}, err
+    }
+    if len(tpl) != 5 {
+        return Intent{}, fmt.Errorf("malformed intent %v", tpl)
+    }
+    operation, ok1 := tpl[0].(string)
+    args, ok2 := tpl[1].([]byte)
+    checkpoint, ok3 := tpl[2].([]byte)
+    rollingBack, ok4 := tpl[3].(bool)
+    updatedAt, ok5 := tpl[4].(int64)
+    if !ok1 || (!ok2 && tpl[1] != nil) || (!ok3 && tpl[2] != nil) || !ok4 || !ok5 {
+        return Intent{}, fmt.Errorf("malformed intent %v", tpl)
+    }
+    return Intent{ID: id, Operation: operation, Args: args, Checkpoint: checkpoint, RollingBack: rollingBack, UpdatedAt: time.Unix(0, updatedAt)}, nil
+}
+
+// IntentLog runs operations spanning many transactions, such as deleting or
+// moving large sets of records, recording them first so that they are
+// completed or rolled back after a crash. Each chunk of work commits in the
+// same transaction as the checkpoint following it, so chunks are applied
+// exactly once even if several processes recover the same intent.
+type IntentLog struct {
+    db       fdb.Transactor
+    intents  subspace.Subspace
+    handlers map[string]IntentHandler
+}
+
+// NewIntentLog returns an IntentLog storing its intents in intents.
+func NewIntentLog(db fdb.Transactor, intents subspace.Subspace) *IntentLog {
+    return &IntentLog{db: db, intents: intents, handlers: map[string]IntentHandler{}}
+}
+
+// Register sets the handler of an operation. Every process that may recover
+// intents must register the same handlers.
+func (l *IntentLog) Register(operation string, handler IntentHandler) {
+    l.handlers[operation] = handler
+}
+
+// Run records an operation, then executes it to completion. If it returns an
+// error other than the operation being rolled back, the intent stays
+// recorded for RecoverIntents.
+func (l *IntentLog) Run(ctx context.Context, operation string, args []byte) error {
+    if _, ok := l.handlers[operation]; !ok {
+        return fmt.Errorf("intent log: no handler for %q", operation)
+    }
+    id := make([]byte, 16)
+    if _, err := rand.Read(id); err != nil {
+        return err
+    }
+    intent := Intent{ID: hex.EncodeToString(id), Operation: operation, Args: args, UpdatedAt: time.Now()}
+    _, err := transactContext(ctx, l.db, func(tr fdb.Transaction) (interface{}, error) {
+        tr.Set(l.intents.Pack(tuple.Tuple{intent.ID}), intent.pack())
+        return nil, nil
+    })
+    if err != nil {
+        return err
+    }
+    return l.execute(ctx, intent.ID)
+}
+
+// execute runs the chunks of the intent with the given ID until it is
+// complete or rolled back.
+func (l *IntentLog) execute(ctx context.Context, id string) error {
+    key := l.intents.Pack(tuple.Tuple{id})
+    var rollbackErr error
+    for {
+        if err := ctx.Err(); err != nil {
+            return err
+        }
+        done := false
+        var intent Intent
+        _, err := transactContext(ctx, l.db, func(tr fdb.Transaction) (interface{}, error) {
+            done = false
+            value, err := tr.Get(key).Get()
+            if err != nil || value == nil {
+                // Completed by another process
+                done = true
+                return nil, err
+            }
+            if intent, err = unpackIntent(id, value); err != nil {
+                return nil, err
+            }
+            handler, ok := l.handlers[intent.Operation]
+            if !ok {
+                return nil, fmt.Errorf("intent log: no handler for %q", intent.Operation)
+            }
+            step := handler.Step
+            if intent.RollingBack {
+                if handler.Rollback == nil {
+                    // Left in place until a handler that can roll it back
+                    // is registered
+                    return nil, fmt.Errorf("intent log: %s %s is rolling back but its handler has no Rollback", intent.Operation, id)
+                }
+                step = handler.Rollback
+            }
+            next, err := step(ctx, tr, intent.Args, intent.Checkpoint)
+            if err != nil {
+                return nil, err
+            }
+            if next == nil {
+                tr.Clear(key)
+                done = true
+                return nil, nil
+            }
+            intent.Checkpoint, intent.UpdatedAt = next, time.Now()
+            tr.Set(key, intent.pack())
+            return nil, nil
+        })
+        if done && err == nil {
+            if intent.RollingBack {
+                if rollbackErr == nil {
+                    // Rolled back after another process failed
+                    return fmt.Errorf("intent log: %s rolled back", intent.Operation)
+                }
+                return fmt.Errorf("intent log: %s rolled back: %w", intent.Operation, rollbackErr)
+            }
+            return nil
+        }
+        if err == nil {
+            continue
+        }
+        if intent.RollingBack || l.handlers[intent.Operation].Rollback == nil || ctx.Err() != nil {
+            return err
+        }
+        // Switch to rolling back from the last committed checkpoint
+        rollbackErr = err
+        _, err = transactContext(ctx, l.db, func(tr fdb.Transaction) (interface{}, error) {
+            value, err := tr.Get(key).Get()
+            if err != nil || value == nil {
+                return nil, err
+            }
+            current, err := unpackIntent(id, value)
+            if err != nil {
+                return nil, err
+            }
+            current.RollingBack, current.UpdatedAt = true, time.Now()
+            tr.Set(key, current.pack())
+            return nil, nil
+        })
+        if err != nil {
+            return err
+        }
+    }
+}
+
+// Intents returns the recorded intents, in ID order.
+func (l *IntentLog) Intents(ctx context.Context) ([]Intent, error) {
+    result, err := readTransactContext(ctx, l.db, func(tr fdb.ReadTransaction) (interface{}, error) {
+        return tr.GetRange(l.intents, fdb.RangeOptions{}).GetSliceWithError()
+    })
+    if err != nil {
+        return nil, err
+    }
+    intents := []Intent{}
+    for _, kv := range result.([]fdb.KeyValue) {
+        tpl, err := l.intents.Unpack(kv.Key)
+        if err != nil {
+            return nil, err
+        }
+        id, ok := tpl[0].(string)
+        if !ok {
+            return nil, fmt.Errorf("malformed intent key %v", tpl)
+        }
+        intent, err := unpackIntent(id, kv.Value)
+        if err != nil {
+            return nil, err
+        }
+        intents = append(intents, intent)
+    }
+    return intents, nil
+}
+
+// RecoverIntents completes, or keeps rolling back, the intents not updated
+// for staleAfter, whose process presumably died. staleAfter must be much
+// larger than the time a chunk takes. Run it at startup or periodically, for
+// example as a WorkerJob. It returns the number of intents finished; the
+// errors of operations rolled back are joined into its error.
+func (l *IntentLog) RecoverIntents(ctx context.Context, staleAfter time.Duration) (int, error) {
+    intents, err := l.Intents(ctx)
+    if err != nil {
+        return 0, err
+    }
+    recovered := 0
+    var errs []error
+    for _, intent := range intents {
+        if time.Since(intent.UpdatedAt) < staleAfter {
+            continue
+        }
+        if err := l.execute(ctx, intent.ID); err != nil {
+            if ctx.Err() != nil {
+                return recovered, ctx.Err()
+            }
+            errs = append(errs, err)
+            continue
+        }
+        recovered++
+    }
+    return recovered, errors.Join(errs...)
+}
+{{end}}`
+
+// intentTemplate generates the operations of a message run through an
+// IntentLog.
+const intentTemplate = `{{define "intent"}}
+// {{.Name}}DeleteByPrefixIntent is the IntentLog operation of DeleteByPrefix.
+const {{.Name}}DeleteByPrefixIntent = "{{.Name}}.DeleteByPrefix"
+
+// {{lowerFirst .Name}}DeleteChunk is the number of records DeleteByPrefix deletes per
+// transaction.
+const {{lowerFirst .Name}}DeleteChunk = 100
+
+// RegisterIntents registers the IntentLog operations of the repository.
+func (repo *{{.Name}}Repository) RegisterIntents(log *IntentLog) {
+    log.Register({{.Name}}DeleteByPrefixIntent, IntentHandler{Step: repo.deleteByPrefixStep})
+}
+
+// DeleteByPrefix deletes the records whose primary key starts with prefix,
+// leading primary key fields with integers as int64, like Delete but
+// {{lowerFirst .Name}}DeleteChunk records per transaction. It runs through log, on which
+// RegisterIntents must have been called, so that RecoverIntents finishes it
+// if it is interrupted.
+func (repo *{{.Name}}Repository) DeleteByPrefix(ctx context.Context, log *IntentLog, prefix ...tuple.TupleElement) error {
+    return log.Run(ctx, {{.Name}}DeleteByPrefixIntent, tuple.Tuple(prefix).Pack())
+}
+
+func (repo *{{.Name}}Repository) deleteByPrefixStep(ctx context.Context, tr fdb.Transaction, args, checkpoint []byte) ([]byte, error) {
+    prefix, err := tuple.Unpack(args)
+    if err != nil {
+        return nil, err
+    }
+    {{if .Buckets}}// Records are deleted in primary key order across buckets, the checkpoint
+    // holding the last primary key deleted
+    var after tuple.Tuple
+    if checkpoint != nil {
+        if after, err = tuple.Unpack(checkpoint); err != nil {
+            return nil, err
+        }
+    }
+    it := repo.iterateRecords(tr, prefix, after, fdb.RangeOptions{})
+    deleted := 0
+    var last {{.Name}}Key
+    for deleted < {{lowerFirst .Name}}DeleteChunk && it.Advance() {
+        kv, err := it.Get()
+        if err != nil {
+            return nil, err
+        }
+        key, ok, err := repo.unpackKey(kv.Key)
+        if err != nil {
+            return nil, err
+        }
+        if !ok {
+            continue
+        }
+        if err := repo.Delete(ctx, tr, {{range $index, $element := .PrimaryKeyFields}}{{if $index}}, {{end}}key.{{.Name}}{{end}}); err != nil {
+            return nil, err
+        }
+        deleted++
+        last = key
+    }
+    if deleted < {{lowerFirst .Name}}DeleteChunk {
+        return nil, nil
+    }
+    return last.toTuple().Pack(), nil
+    {{else}}r, err := fdb.PrefixRange(repo.recordSubspace().Pack(prefix))
+    if err != nil {
+        return nil, err
+    }
+    if checkpoint != nil {
+        r.Begin = fdb.Key(checkpoint)
+    }
+    kvs, err := tr.GetRange(r, fdb.RangeOptions{Limit: {{lowerFirst .Name}}DeleteChunk}).GetSliceWithError()
+    if err != nil {
+        return nil, err
+    }
+    for _, kv := range kvs {
+        key, ok, err := repo.unpackKey(kv.Key)
+        if err != nil {
+            return nil, err
+        }
+        if !ok {
+            continue
+        }
+        if err := repo.Delete(ctx, tr, {{range $index, $element := .PrimaryKeyFields}}{{if $index}}, {{end}}key.{{.Name}}{{end}}); err != nil {
+            return nil, err
+        }
+    }
+    if len(kvs) < {{lowerFirst .Name}}DeleteChunk {
+        return nil, nil
+    }
+    return append(append([]byte{}, kvs[len(kvs)-1].Key...), 0x00), nil{{end}}
+}
+{{end}}`
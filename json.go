@@ -0,0 +1,46 @@
+package main
+
+// jsonTemplate renders json.go, which holds the protojson options shared by
+// the generated JSON helpers. They are configured with the json_names and
+// json_emit_defaults plugin options.
+const jsonTemplate = `{{define "json"}}// Code generated by fdb-go-layer-plugin {{pluginVersion}}. DO NOT EDIT.
+
+package repositories
+
+import (
+    "google.golang.org/protobuf/encoding/protojson"
+)
+
+// JSONMarshalOptions are the options used by the generated Marshal<Message>JSON
+// functions, so that every tool built on the package produces the same JSON
+// shapes.
+var JSONMarshalOptions = protojson.MarshalOptions{
+    UseProtoNames:   {{.UseProtoNames}},
+    EmitUnpopulated: {{.EmitDefaults}},
+}
+
+// JSONUnmarshalOptions are the options used by the generated
+// Unmarshal<Message>JSON functions. Unknown fields are discarded so that
+// documents written by a newer schema can still be read.
+var JSONUnmarshalOptions = protojson.UnmarshalOptions{
+    DiscardUnknown: true,
+}
+{{end}}`
+
+// jsonMessageTemplate generates the JSON helpers of a message.
+const jsonMessageTemplate = `{{define "jsonMessage"}}
+// Marshal{{.Name}}JSON encodes entity with JSONMarshalOptions.
+func Marshal{{.Name}}JSON(entity *pb.{{.Name}}) ([]byte, error) {
+    return JSONMarshalOptions.Marshal(entity)
+}
+
+// Unmarshal{{.Name}}JSON decodes a {{.Name}} encoded as JSON with
+// JSONUnmarshalOptions.
+func Unmarshal{{.Name}}JSON(data []byte) (*pb.{{.Name}}, error) {
+    entity := &pb.{{.Name}}{}
+    if err := JSONUnmarshalOptions.Unmarshal(data, entity); err != nil {
+        return nil, err
+    }
+    return entity, nil
+}
+{{end}}`
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// keyspaceTemplate generates the Keyspace constant, documenting the keys and
+// values the generated package stores for each message type.
+const keyspaceTemplate = `{{define "keyspace"}}// Code generated by fdb-go-layer-plugin {{pluginVersion}}. DO NOT EDIT.
+
+package repositories
+
+// Keyspace documents, in Markdown, every key the package writes for each
+// message type: its tuple shape and the format of its value. It is generated
+// from the same options as the code, so it describes the layout of this
+// build. The keyspace_md=true plugin option also writes it to keyspace.md.
+const Keyspace = ` + "`" + `{{keyspaceDoc .}}` + "`" + `
+{{end}}`
+
+// keyspaceRow is a key of the keyspace documentation and its value.
+type keyspaceRow struct {
+	key, value string
+}
+
+// keyspaceDoc returns the keyspace documentation of messages, as Markdown
+// without backquotes so that it can be a raw string literal. cache tells
+// whether the cache layer, which stores access stats, is generated.
+func keyspaceDoc(messages []Message, cache bool) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Keyspace\n\nGenerated by fdb-go-layer-plugin %s, key layout version %d.\n\n", pluginVersion(), keyLayoutVersion)
+	fmt.Fprintf(&b, "Each message type is stored in its own directory, opened under the prefix passed to Init. ")
+	fmt.Fprintf(&b, "Keys are tuples packed in that directory: records at their primary key, everything else under the prefix (nil, %d, subspace), written (subspace, ...) below. ", keyLayoutVersion)
+	fmt.Fprintf(&b, "Integers and enums are packed as tuple integers, float fields as tuple floats and double fields as tuple doubles. ")
+	fmt.Fprintf(&b, "Values written by atomic adds are 8-byte little-endian integers.")
+	for _, m := range messages {
+		if m.RecordLayer != nil {
+			fmt.Fprintf(&b, " Keys written store: (...) are packed in the directory itself, which holds a record store of the Java FDB Record Layer.")
+			break
+		}
+	}
+	fmt.Fprintln(&b)
+	for _, m := range messages {
+		fmt.Fprintf(&b, "\n## %s\n\nDirectory: %s. Schema fingerprint: %s.\n\n", m.Name, strings.Join(m.DirectoryPath, "/"), m.Fingerprint())
+		rows := keyspaceRows(m, cache)
+		width := 0
+		for _, row := range rows {
+			width = max(width, len(row.key))
+		}
+		for _, row := range rows {
+			fmt.Fprintf(&b, "    %-*s  %s\n", width, row.key, row.value)
+		}
+	}
+	// Names from the .proto files could hold a backquote, which would end
+	// the raw string literal
+	return strings.ReplaceAll(b.String(), "`", "'")
+}
+
+// keyspaceRows returns the keys stored for m.
+func keyspaceRows(m Message, cache bool) []keyspaceRow {
+	pk := keyspaceFields(m.PrimaryKeyFields)
+	record := "the record, encoded with proto.Marshal"
+	if m.Serializer != "" {
+		record = fmt.Sprintf("the record, encoded with the %q Serializer", m.Serializer)
+	}
+	if len(m.PreviousVersions) > 0 {
+		types := []string{}
+		for _, v := range m.PreviousVersions {
+			types = append(types, fmt.Sprintf("%d for %s", v.Version, v.Type))
+		}
+		record = fmt.Sprintf("0xff and the version of the record as a uvarint, %d, or %s, then %s; values without the 0xff prefix are version 1", m.Version(), strings.Join(types, ", "), record)
+	}
+	rows := []keyspaceRow{{"(" + pk + ")", record}}
+	// indexKey returns the key of the entries of the named index, with
+	// fields after its subspace
+	indexKey := func(name, fields string) string {
+		return fmt.Sprintf("(%q, %s)", name+"_index", fields)
+	}
+	if m.RecordLayer != nil {
+		rows = []keyspaceRow{
+			{"store: (0)", fmt.Sprintf("store header, a DataStoreInfo message of format version %d and metadata version %d", recordLayerFormatVersion, m.RecordLayer.MetaDataVersion)},
+			{fmt.Sprintf("store: (1, %s, 0)", pk), fmt.Sprintf("a RecordTypeUnion message holding the record, encoded with proto.Marshal, in field %d", m.RecordLayer.UnionField)},
+		}
+		indexKey = func(name, fields string) string {
+			return fmt.Sprintf("store: (2, %q, %s)", name+"_index", fields)
+		}
+	}
+	if m.Buckets > 0 {
+		rows[0].key = fmt.Sprintf("(bucket:int, %s)", pk)
+		rows[0].value += fmt.Sprintf("; bucket is the FNV-1a hash of the packed primary key modulo %d", m.Buckets)
+	}
+
+	for _, idx := range m.SecondaryIndexes {
+		value := "empty"
+		if idx.Covering {
+			value = "a copy of the record"
+		}
+		if idx.Unique {
+			value += "; at most one entry per value"
+		}
+		rows = append(rows, keyspaceRow{indexKey(idx.Name, keyspaceFields(idx.Fields)+", "+pk), value})
+		if idx.Global {
+			rows = append(rows, keyspaceRow{fmt.Sprintf("global: (%q, %s, prefix:tuple, %s)", idx.Name+"_index", keyspaceFields(idx.Fields), pk), fmt.Sprintf("empty; in the directory %s/%s shared by every prefix", globalDirectory, strings.Join(m.DirectoryPath, "/"))})
+		}
+	}
+	for _, idx := range m.ElementIndexes {
+		value := "empty; one entry per distinct element of " + idx.Field.ProtoName
+		if idx.Keys {
+			value = "empty; one entry per key of " + idx.Field.ProtoName
+		}
+		element := idx.Param() + ":" + keyspaceType(idx.Element)
+		rows = append(rows, keyspaceRow{indexKey(idx.Name, element+", "+pk), value})
+	}
+	if m.RecordLayer != nil && len(m.SecondaryIndexes)+len(m.ElementIndexes) > 0 {
+		rows = append(rows, keyspaceRow{"store: (5, index:string)", "tuple of the state of an index being built or disabled, 1 for write-only or 2 for disabled; index reads fail with ErrIndexNotReadable"})
+	}
+
+	for _, f := range m.CRDTFields {
+		switch {
+		case f.Set:
+			rows = append(rows, keyspaceRow{fmt.Sprintf("(\"_crdt\", %s, %d, element:%s)", pk, f.Field.Number, keyspaceType(f.Field)), "empty; one key per element of the set " + f.Field.ProtoName})
+		case f.Side:
+			rows = append(rows, keyspaceRow{fmt.Sprintf("(\"_crdt\", %s, %d)", pk, f.Field.Number), "tuple of the side-stored field " + f.Field.ProtoName})
+		case f.Touch:
+			rows = append(rows, keyspaceRow{fmt.Sprintf("(\"_crdt\", %s, %d)", pk, f.Field.Number), "the touch time " + f.Field.ProtoName + ", raised with atomic max"})
+		default:
+			rows = append(rows, keyspaceRow{fmt.Sprintf("(\"_crdt\", %s, %d)", pk, f.Field.Number), "the counter " + f.Field.ProtoName + ", changed with atomic adds"})
+		}
+	}
+	if m.FieldMerge {
+		rows = append(rows, keyspaceRow{fmt.Sprintf("(\"_clocks\", %s)", pk), "tuple of (field number, Unix nanoseconds) pairs"})
+	}
+	if m.ChangeLog {
+		rows = append(rows,
+			keyspaceRow{fmt.Sprintf("(\"_cdc\", versionstamp, %s)", pk), "tuple of the serialized record, or of nil for a delete"},
+			keyspaceRow{"(\"_cursors\", \"changes\", \"head\")", "number of changes logged, changed with atomic adds"})
+	}
+	if m.SearchSync {
+		rows = append(rows, keyspaceRow{"(\"_cursors\", \"search\", index:string)", "change log key of the last change pushed to the index"})
+	}
+	for _, w := range m.Webhooks {
+		rows = append(rows, keyspaceRow{fmt.Sprintf("(\"_cursors\", \"webhook\", %q)", w), "delivery state of the webhook"})
+	}
+	if m.Archive != nil {
+		rows = append(rows, keyspaceRow{fmt.Sprintf("(\"_archive\", %s)", pk), "key of the record in the blob store"})
+	}
+	if m.ETag {
+		rows = append(rows, keyspaceRow{fmt.Sprintf("(\"_versions\", %s)", pk), "tuple of the read version of the transaction that last wrote the record, part of its ETag"})
+	}
+	for _, ref := range m.BlobRefs {
+		if ref.Cleanup {
+			rows = append(rows, keyspaceRow{"(\"_blobgc\", url:string)", "empty; an object referenced by a deleted record"})
+			break
+		}
+	}
+	rows = append(rows, keyspaceRow{fmt.Sprintf("(\"_staged\", %s)", pk), "tuple of 0 and the index keys still to clear after SetStaged"})
+	if cache && m.Generates("cache") {
+		rows = append(rows, keyspaceRow{"(\"_hot\") + packed primary key", "number of cached reads, changed with atomic adds"})
+	}
+	rows = append(rows, keyspaceRow{"(\"_txn\", token:bytes)", "tuple of the Unix nanoseconds of a transaction committed at most once"})
+	if m.Generates("maintenance") {
+		rows = append(rows, keyspaceRow{"(\"_jobs\", job:string)", "checkpoint of a resumable maintenance job"})
+	}
+	return append(rows,
+		keyspaceRow{"(\"_meta\", \"fingerprint\")", "tuple of the schema fingerprint and plugin version recorded by RecordSchema"},
+		keyspaceRow{"(\"_meta\", \"health\")", "probe written by HealthCheck"})
+}
+
+// keyspaceFields returns fields as tuple elements of the keyspace
+// documentation, named after their .proto paths.
+func keyspaceFields(fields []Field) string {
+	elements := make([]string, len(fields))
+	for i, f := range fields {
+		elements[i] = f.ProtoName + ":" + keyspaceType(f)
+	}
+	return strings.Join(elements, ", ")
+}
+
+// keyspaceType returns the tuple type a field of f's type is packed as.
+func keyspaceType(f Field) string {
+	switch {
+	case f.AutoUUID:
+		return "uuid"
+	case isEnumType(f.Type):
+		return "int"
+	case f.Type == "int32" || f.Type == "int64" || f.Type == "uint32" || f.Type == "uint64":
+		return "int"
+	case f.Type == "float32":
+		return "float"
+	case f.Type == "float64":
+		return "double"
+	case f.Bytes():
+		return "bytes"
+	case f.Timestamp():
+		return "tuple (Unix seconds:int, nanoseconds:int)"
+	case f.Hashed():
+		return fmt.Sprintf("string (hashed beyond %d bytes)", f.StringKey.MaxBytes)
+	default:
+		return f.Type
+	}
+}
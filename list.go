@@ -0,0 +1,123 @@
+package main
+
+// listTemplate generates List, which pages through the records of a message
+// in primary key order.
+const listTemplate = `{{define "list"}}
+// {{lowerFirst .Name}}ScanBatch is the number of keys scans read
+// per transaction, keeping each transaction well under the 5 second limit.
+const {{lowerFirst .Name}}ScanBatch = 1000
+
+// scanRecords reads all stored records in batches of
+// {{lowerFirst .Name}}ScanBatch keys, one read transaction per batch, and
+// passes every non-empty batch to fn once its transaction has completed. The
+// batches do not form a consistent snapshot: records written during the scan
+// may or may not be seen. It returns the number of records read.
+func (repo *{{.Name}}Repository) scanRecords(ctx context.Context, fn func(entities []*pb.{{.Name}}) error) (int, error) {
+    count := 0
+    op := repo.slowOps.start("{{.Name}}", "scan")
+    defer op.finish()
+    records := RecordRange(repo.recordSubspace())
+    begin, end := records.Begin, records.End
+    for {
+        if err := ctx.Err(); err != nil {
+            return count, err
+        }
+        var kvs []fdb.KeyValue
+        var entities []*pb.{{.Name}}
+        attempted := false
+        _, err := readTransactContext(ctx, repo.db, func(tr fdb.ReadTransaction) (interface{}, error) {
+            if attempted {
+                op.retry()
+            }
+            attempted = true
+            var err error
+            if kvs, err = tr.GetRange(fdb.KeyRange{Begin: begin, End: end}, fdb.RangeOptions{Limit: {{lowerFirst .Name}}ScanBatch}).GetSliceWithError(); err != nil {
+                return nil, err
+            }
+            entities = make([]*pb.{{.Name}}, 0, len(kvs))
+            for _, kv := range kvs {
+                if _, ok, err := repo.unpackKey(kv.Key); err != nil {
+                    return nil, err
+                } else if !ok {
+                    continue
+                }
+                entity := &pb.{{.Name}}{}
+                if err := repo.unmarshal(kv.Value, entity); err != nil {
+                    return nil, err
+                }
+                {{if .CRDTFields}}if err := repo.loadCRDTFields(tr, entity); err != nil {
+                    return nil, err
+                }
+                {{end}}
+                entities = append(entities, entity)
+                op.add(1, len(kv.Value))
+            }
+            return nil, nil
+        })
+        if err != nil {
+            return count, err
+        }
+        if len(entities) > 0 {
+            if err := fn(entities); err != nil {
+                return count, err
+            }
+            count += len(entities)
+        }
+        if len(kvs) < {{lowerFirst .Name}}ScanBatch {
+            return count, nil
+        }
+        begin = append(append(fdb.Key{}, kvs[len(kvs)-1].Key...), 0x00)
+    }
+}
+
+// List returns a page of records in primary key order, and the cursor to
+// pass as opts.After to get the next page, nil after the last page. Pages
+// can be read in different transactions, in which case records written in
+// between may or may not be listed.
+func (repo *{{.Name}}Repository) List(ctx context.Context, tr fdb.ReadTransaction, opts ListOptions) ([]*pb.{{.Name}}, Cursor, error) {
+    var after tuple.Tuple
+    if opts.After != nil {
+        pk, err := tuple.Unpack(opts.After)
+        if err != nil {
+            return nil, nil, fmt.Errorf("{{.Name}}: invalid cursor: %w", err)
+        }
+        after = pk
+    }
+
+    entities := []*pb.{{.Name}}{}
+    var last {{.Name}}Key
+    it := repo.iterateRecords(tr, nil, after, fdb.RangeOptions{Reverse: opts.Reverse, Mode: opts.Mode})
+    for (opts.Limit == 0 || len(entities) < opts.Limit) && it.Advance() {
+        if err := ctx.Err(); err != nil {
+            return nil, nil, err
+        }
+        kv, err := it.Get()
+        if err != nil {
+            return nil, nil, err
+        }
+        key, ok, err := repo.unpackKey(kv.Key)
+        if err != nil {
+            return nil, nil, err
+        }
+        if !ok {
+            // Not a record of this message
+            continue
+        }
+        txStatsFrom(ctx).read(len(kv.Key) + len(kv.Value))
+        entity := &pb.{{.Name}}{}
+        if err := repo.unmarshal(kv.Value, entity); err != nil {
+            return nil, nil, err
+        }
+        {{if .CRDTFields}}if err := repo.loadCRDTFields(tr, entity); err != nil {
+            return nil, nil, err
+        }
+        {{end}}
+        entities = append(entities, entity)
+        last = key
+    }
+    if opts.Limit == 0 || len(entities) < opts.Limit {
+        return entities, nil, nil
+    }
+    return entities, Cursor(last.toTuple().Pack()), nil
+}
+{{end}}`
@@ -1,9 +1,13 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"go/token"
 	"log"
 	"os"
+	"regexp"
+	"strconv"
 	"strings"
 	"text/template"
 
@@ -15,26 +19,514 @@ import (
 )
 
 type Field struct {
-	Name string
-	Type string
+	Name      string
+	ProtoName string // name of the field in the .proto file
+	Number    int32
+	Type      string
+	TupleType string // Go type produced by tuple.Unpack for this field
+	Map       bool   // a map field, whose Type is a Go map type
+	// Path reads the field from a message, e.g. entity.{{.Path}}: its Go
+	// name, or getters through the messages holding a nested field.
+	Path string
+	// Parents are the message fields holding a nested field, outermost
+	// first. The Name of a nested field joins their names and its own,
+	// its ProtoName is the dotted path.
+	Parents []FieldParent
+	GoName  string // Go name of the field in the message declaring it
+	// StringKey holds the string_key constraints of a string field, or nil.
+	StringKey *StringKey
+	// AutoUUID marks a string or bytes field with the auto_uuid option,
+	// packed as a tuple.UUID.
+	AutoUUID bool
+	// Oneof marks a member of a oneof, including a proto3 optional field,
+	// or a field nested in one. Its Path reads it through getters, and it
+	// cannot be assigned as a field of the message.
+	Oneof bool
+	// Optional marks a proto3 optional field of the message, whose Go field
+	// is a pointer, nil when unset.
+	Optional bool
+}
+
+// StringKey constrains the values of a string primary key or index field.
+type StringKey struct {
+	MaxBytes   int // 0 for no limit
+	RejectNull bool
+	// Hash packs values longer than MaxBytes as a prefix followed by their
+	// SHA-256 instead of rejecting them.
+	Hash bool
+}
+
+// UUID returns the expression generating a new random UUID of f's type.
+func (f Field) UUID() string {
+	if f.Bytes() {
+		return "uuidBytes(newUUID())"
+	}
+	return "formatUUID(newUUID())"
+}
+
+// Hashed reports whether f packs its overlong values hashed.
+func (f Field) Hashed() bool {
+	return f.StringKey != nil && f.StringKey.Hash
+}
+
+// FieldParent is a message field on the path to a nested field.
+type FieldParent struct {
+	Name string // Go name of the field
+	Type string // Go name of the message type of the field
+}
+
+// Scalar reports whether f holds a single value of a supported type, which
+// can be packed into a tuple.
+func (f Field) Scalar() bool {
+	return !f.Map && f.Type != "interface{}" && !f.Timestamp()
+}
+
+// Timestamp reports whether f is a google.protobuf.Timestamp, which keys
+// pack as a nested tuple of Unix seconds and nanoseconds so that they sort by
+// time.
+func (f Field) Timestamp() bool {
+	return f.Type == timestampType
+}
+
+// Packable reports whether f can be a primary key or index field: a scalar
+// or a timestamp.
+func (f Field) Packable() bool {
+	return f.Scalar() || f.Timestamp()
+}
+
+// Zero returns the zero value of a singular field of f's type.
+func (f Field) Zero() string {
+	switch {
+	case f.Type == "string":
+		return `""`
+	case f.Type == "bool":
+		return "false"
+	case f.Bytes() || f.Timestamp():
+		return "nil"
+	default:
+		return "0"
+	}
+}
+
+// Bytes reports whether f is a bytes field.
+func (f Field) Bytes() bool {
+	return f.Type == "[]byte"
 }
 
 type SecondaryIndex struct {
+	// Name is used in the names of the index subspace and of its GetBy
+	// method. It defaults to the field names joined with "And".
+	Name     string
+	Fields   []Field
+	Unique   bool
+	Covering bool
+	// Global indexes also write their entries into the global directory,
+	// at GlobalPosition in indexKeys.
+	Global         bool
+	GlobalPosition int
+}
+
+// Leading returns the fields of idx but the last one, which range queries
+// match by equality.
+func (idx SecondaryIndex) Leading() []Field {
+	return idx.Fields[:len(idx.Fields)-1]
+}
+
+// Last returns the last field of idx, which range queries bound.
+func (idx SecondaryIndex) Last() Field {
+	return idx.Fields[len(idx.Fields)-1]
+}
+
+// ElementIndex indexes a field holding several values, the elements of a
+// repeated field or the keys of a map field, with one entry per distinct
+// value.
+type ElementIndex struct {
+	// Name is used in the names of the index subspace and of its GetBy
+	// method: the name of the secondary_index option, which defaults to the
+	// field name, or for map keys the field name followed by "Key".
+	Name  string
+	Field Field
+	// Element has the type of the indexed values.
+	Element Field
+	// Keys is set for the keys of a map field.
+	Keys bool
+	// Position is the position of the index after the secondary indexes,
+	// as passed to getByIndex.
+	Position int
+}
+
+// Param returns the name of the parameter holding the value looked up by
+// the GetBy method of idx.
+func (idx ElementIndex) Param() string {
+	if idx.Keys {
+		return "key"
+	}
+	return "element"
+}
+
+// IndexPrefix is a leading prefix of the fields of a composite index, which
+// can be queried without the remaining fields.
+type IndexPrefix struct {
+	// Name is used in the name of the GetBy method, the field names joined
+	// with "And".
+	Name     string
+	Fields   []Field
+	Index    SecondaryIndex
+	Position int
+}
+
+type Projection struct {
+	Name   string
 	Fields []Field
 }
 
+// ArchiveField is the field deciding when a record is archived.
+type ArchiveField struct {
+	Name      string
+	Timestamp bool // a google.protobuf.Timestamp rather than Unix seconds
+}
+
+// BlobRef is a string field referencing an object in external storage.
+type BlobRef struct {
+	Field   Field
+	Pattern string
+	Cleanup bool
+}
+
+// CRDTField is a field stored outside the record so that it can be changed
+// without conflicts: a counter, a set of elements, a heartbeat time or a
+// side-stored value. The Type of a set is the type of its elements.
+type CRDTField struct {
+	Field Field
+	Set   bool
+	// Touch marks a heartbeat time, which only moves forward.
+	Touch bool
+	// Side marks a value overwritten as a whole, the last write winning.
+	Side bool
+}
+
 type Message struct {
 	Name             string
 	Fields           []Field
 	PrimaryKeyFields []Field
 	SecondaryIndexes []SecondaryIndex
-	GoPackagePath    string
+	ElementIndexes   []ElementIndex
+	IndexPrefixes    []IndexPrefix
+	Projections      []Projection
+	DirectoryPath    []string
+	ChangeLog        bool
+	SearchSync       bool
+	Archive          *ArchiveField
+	BlobRefs         []BlobRef
+	Webhooks         []string
+	FieldMerge       bool
+	CRDTFields       []CRDTField
+	// Serializer names the registered Serializer encoding records, "" for
+	// the binary protobuf encoding.
+	Serializer string
+	// Profile is minimal, standard or full, see profileTemplates.
+	Profile             string
+	SkipUnchangedWrites bool
+	// ETag is set if GetWithETag and the IfMatch methods are generated, and
+	// writes store the versions of the records their ETags are made of.
+	ETag bool
+	// PreviousVersions are the earlier types of the records, oldest first.
+	PreviousVersions []PreviousVersion
+	// Buckets is the number of buckets the records are spread over, 0 if
+	// they are stored in primary key order.
+	Buckets int
+	// RecordLayer is set if the records are laid out like a Record Layer
+	// record store.
+	RecordLayer   *RecordLayer
+	GoPackagePath string
+}
+
+// AutoUUIDField returns the primary key field of m with the auto_uuid option,
+// or nil.
+func (m Message) AutoUUIDField() *Field {
+	for _, f := range m.PrimaryKeyFields {
+		if f.AutoUUID {
+			return &f
+		}
+	}
+	return nil
+}
+
+// HasStringKeys reports whether a primary key or secondary index field of m
+// has the string_key option.
+func (m Message) HasStringKeys() bool {
+	return len(m.StringKeyFields()) > 0
+}
+
+// StringKeyFields returns the primary key and secondary index fields of m
+// with the string_key option, once each.
+func (m Message) StringKeyFields() []Field {
+	keyFields := append([]Field{}, m.PrimaryKeyFields...)
+	for _, idx := range m.SecondaryIndexes {
+		keyFields = append(keyFields, idx.Fields...)
+	}
+	fields := []Field{}
+	seen := map[string]bool{}
+	for _, f := range keyFields {
+		if f.StringKey != nil && !seen[f.ProtoName] {
+			seen[f.ProtoName] = true
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// RejectsNullKeys reports whether a string key field of m rejects null bytes.
+func (m Message) RejectsNullKeys() bool {
+	for _, f := range m.StringKeyFields() {
+		if f.StringKey.RejectNull {
+			return true
+		}
+	}
+	return false
+}
+
+// HasBlobRefPatterns reports whether a blob reference field of m has a
+// pattern to validate.
+func (m Message) HasBlobRefPatterns() bool {
+	for _, ref := range m.BlobRefs {
+		if ref.Pattern != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// HasOneofFields reports whether a scalar field of m is a oneof member or a
+// proto3 optional field.
+func (m Message) HasOneofFields() bool {
+	for _, f := range m.ScalarFields() {
+		if f.Oneof {
+			return true
+		}
+	}
+	return false
+}
+
+// ScalarFields returns the fields of m that are neither messages, maps nor
+// repeated, in declaration order, followed by the nested fields of its
+// primary key and indexes. Oneof members and proto3 optional fields are included,
+// read through the getters of their Path.
+func (m Message) ScalarFields() []Field {
+	fields := []Field{}
+	for _, f := range m.Fields {
+		if f.Scalar() {
+			fields = append(fields, f)
+		}
+	}
+	keyFields := append([]Field{}, m.PrimaryKeyFields...)
+	for _, idx := range m.SecondaryIndexes {
+		keyFields = append(keyFields, idx.Fields...)
+	}
+	seen := map[string]bool{}
+	for _, f := range keyFields {
+		if len(f.Parents) > 0 && f.Scalar() && !seen[f.ProtoName] {
+			seen[f.ProtoName] = true
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// ReplicaFields returns the fields of m that have a column in its SQL
+// replicas: its scalar fields, then the timestamp fields of its primary key
+// and secondary indexes.
+func (m Message) ReplicaFields() []Field {
+	fields := m.ScalarFields()
+	keyFields := append([]Field{}, m.PrimaryKeyFields...)
+	for _, idx := range m.SecondaryIndexes {
+		keyFields = append(keyFields, idx.Fields...)
+	}
+	seen := map[string]bool{}
+	for _, f := range keyFields {
+		if f.Timestamp() && !seen[f.ProtoName] {
+			seen[f.ProtoName] = true
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// HasGlobalIndexes reports whether a secondary index of m is global.
+func (m Message) HasGlobalIndexes() bool {
+	for _, idx := range m.SecondaryIndexes {
+		if idx.Global {
+			return true
+		}
+	}
+	return false
+}
+
+// HasUniqueIndexes reports whether a secondary index of m is unique.
+func (m Message) HasUniqueIndexes() bool {
+	for _, idx := range m.SecondaryIndexes {
+		if idx.Unique {
+			return true
+		}
+	}
+	return false
+}
+
+// profileTemplates lists the optional templates generated for the messages
+// of every profile but full, which generates all of them. Templates enabled
+// by annotations, such as change_log or archive, and the core repository
+// are generated in every profile.
+var profileTemplates = map[string]map[string]bool{
+	"minimal": {},
+	"standard": {
+		"batch":  true,
+		"writer": true,
+		"watch":  true,
+		"cache":  true,
+		"query":  true,
+		"intent": true,
+	},
+}
+
+// Generates reports whether the optional template named name is generated
+// for m, according to its profile.
+func (m Message) Generates(name string) bool {
+	if m.Profile == "full" {
+		return true
+	}
+	return profileTemplates[m.Profile][name]
+}
+
+// HasTouchFields reports whether a CRDT field of m is a touch field.
+func (m Message) HasTouchFields() bool {
+	for _, f := range m.CRDTFields {
+		if f.Touch {
+			return true
+		}
+	}
+	return false
+}
+
+// HasCountersOrSets reports whether a CRDT field of m is a counter or an
+// element set, which Set only writes for new records.
+func (m Message) HasCountersOrSets() bool {
+	for _, f := range m.CRDTFields {
+		if !f.Touch && !f.Side {
+			return true
+		}
+	}
+	return false
+}
+
+// ScalarKey reports whether the primary key fields of m are all scalars,
+// which queries can select a single record by.
+func (m Message) ScalarKey() bool {
+	for _, f := range m.PrimaryKeyFields {
+		if !f.Scalar() {
+			return false
+		}
+	}
+	return true
+}
+
+// HasTimestampKeys reports whether a primary key or index field of m is a
+// timestamp.
+func (m Message) HasTimestampKeys() bool {
+	for _, f := range m.PrimaryKeyFields {
+		if f.Timestamp() {
+			return true
+		}
+	}
+	for _, idx := range m.SecondaryIndexes {
+		for _, f := range idx.Fields {
+			if f.Timestamp() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// HasBytesFields reports whether a scalar field of m, which keys and queries
+// compare, is a bytes field, whose values cannot be compared with ==.
+func (m Message) HasBytesFields() bool {
+	for _, f := range m.ScalarFields() {
+		if f.Bytes() {
+			return true
+		}
+	}
+	return false
+}
+
+// HasCoveringIndexes reports whether an index of m stores copies of records.
+func (m Message) HasCoveringIndexes() bool {
+	for _, idx := range m.SecondaryIndexes {
+		if idx.Covering {
+			return true
+		}
+	}
+	return false
+}
+
+// HasBlobCleanup reports whether deleting a record of m queues referenced
+// objects for cleanup.
+func (m Message) HasBlobCleanup() bool {
+	for _, ref := range m.BlobRefs {
+		if ref.Cleanup {
+			return true
+		}
+	}
+	return false
+}
+
+// optionalBuildTags are the build tags of the optional components, which
+// the build_tags=true plugin option compiles only when their tag is set, so
+// that builds of the core layer do not compile their dependencies.
+var optionalBuildTags = map[string]string{
+	"admin":       "fdbadmin",
+	"testharness": "fdbtestharness",
 }
 
 func main() {
-	protogen.Options{}.Run(func(plugin *protogen.Plugin) error {
+	flags, generate := newGenerator()
+	protogen.Options{ParamFunc: flags.Set}.Run(generate)
+}
+
+// newGenerator returns the flags of the plugin options and the function
+// generating the repositories of a run, which reads them.
+func newGenerator() (*flag.FlagSet, func(*protogen.Plugin) error) {
+	var flags flag.FlagSet
+	genAdmin := flags.Bool("admin", false, "generate a gRPC admin service for maintenance operations")
+	genTestHarness := flags.Bool("testharness", false, "generate a TestMain helper providing a FoundationDB database")
+	buildTags := flags.Bool("build_tags", false, "compile the admin service and the test harness only with the fdbadmin and fdbtestharness build tags")
+	splitFiles := flags.Bool("split_files", false, "generate the code of each message in files per concern, <message>_store.go, _indexes.go, _query.go and _admin.go, instead of <message>_repository.go")
+	keyspaceMD := flags.Bool("keyspace_md", false, "also write the Keyspace documentation of the generated package to keyspace.md")
+	jsonNames := flags.String("json_names", "camel", "JSON field names of the generated JSON helpers: camel or proto")
+	jsonEmitDefaults := flags.Bool("json_emit_defaults", false, "emit fields with default values in the generated JSON helpers")
+	features := map[string]*bool{
+		"cdc":   flags.Bool("cdc", true, "generate the change log and what it feeds: SubscribeByPrefix, SQL replicas, search sync and webhooks"),
+		"cache": flags.Bool("cache", true, "generate the cache layer: WithCache, GetCached and the access stats"),
+	}
+
+	return &flags, func(plugin *protogen.Plugin) error {
+		if *jsonNames != "camel" && *jsonNames != "proto" {
+			return fmt.Errorf("invalid json_names %q: must be camel or proto", *jsonNames)
+		}
+		// All files of the run feed one package, whose shared helpers are
+		// generated once for all their messages
 		messages := []Message{}
-		processedMessages := make(map[string]bool) // To track processed messages
+		processedMessages := make(map[string]string) // File declaring each message
+		messageTypes := map[protoreflect.FullName]*protogen.Message{}
+		var addMessageTypes func([]*protogen.Message)
+		addMessageTypes = func(msgs []*protogen.Message) {
+			for _, msg := range msgs {
+				messageTypes[msg.Desc.FullName()] = msg
+				addMessageTypes(msg.Messages)
+			}
+		}
+		for _, file := range plugin.Files {
+			addMessageTypes(file.Messages)
+		}
 
 		for _, file := range plugin.Files {
 			if !file.Generate {
@@ -46,15 +538,23 @@ func main() {
 			for _, message := range file.Messages {
 				msgName := message.GoIdent.GoName
 
-				// Skip if already processed
-				if processedMessages[msgName] {
+				// Messages without a primary key, such as value types shared
+				// between files, are not stored on their own
+				if !proto.HasExtension(message.Desc.Options(), annotationspb.E_PrimaryKey) {
 					continue
 				}
-				processedMessages[msgName] = true
+				if other, ok := processedMessages[msgName]; ok {
+					return fmt.Errorf("message %s is declared in both %s and %s, which generate the same repository", msgName, other, file.Desc.Path())
+				}
+				processedMessages[msgName] = file.Desc.Path()
 
 				msgOptions := message.Desc.Options()
-				processedMessage := processMessage(message, msgOptions)
+				processedMessage := processMessage(message, msgOptions, messageTypes)
+				if processedMessage != nil && !*features["cdc"] && (processedMessage.ChangeLog || len(processedMessage.Webhooks) > 0) {
+					log.Fatalf("Message %s uses the change log, with change_log, search_sync or webhook, which cdc=false leaves out", msgName)
+				}
 				if processedMessage != nil {
+					checkReservedNames(processedMessage)
 					processedMessage.GoPackagePath = goPackagePath
 					messages = append(messages, *processedMessage)
 				}
@@ -63,13 +563,108 @@ func main() {
 
 		// Generate code for each message
 		tmpl := template.Must(template.New("fdb").Funcs(template.FuncMap{
-			"joinFieldNames": joinFieldNames,
+			"toTuple":       toTuple,
+			"fromTuple":     fromTuple,
+			"assertTuple":   assertTuple,
+			"lowerFirst":    lowerFirst,
+			"stringSlice":   stringSlice,
+			"pluginVersion": pluginVersion,
+			"keyLayoutVersion": func() int {
+				return keyLayoutVersion
+			},
+			"globalDirectory": func() string {
+				return globalDirectory
+			},
+			"join":         strings.Join,
+			"sqliteSchema": sqliteSchema,
+			"sqliteInsert": sqliteInsert,
+			"sqlDialects":  sqlDialects,
+			"sqlReplica":   sqlReplica,
+			"setField":     setField,
+			"keyspaceDoc": func(messages []Message) string {
+				return keyspaceDoc(messages, *features["cache"])
+			},
+			"feature": func(name string) bool {
+				return *features[name]
+			},
+			"buildTag": func(component string) string {
+				if !*buildTags {
+					return ""
+				}
+				return optionalBuildTags[component]
+			},
 		}).Parse(fdbTemplate))
+		template.Must(tmpl.Parse(batchTemplate))
+		template.Must(tmpl.Parse(writerTemplate))
+		template.Must(tmpl.Parse(importTemplate))
+		template.Must(tmpl.Parse(maintenanceTemplate))
+		template.Must(tmpl.Parse(storesTemplate))
+		template.Must(tmpl.Parse(descriptorTemplate))
+		template.Must(tmpl.Parse(jsonTemplate))
+		template.Must(tmpl.Parse(jsonMessageTemplate))
+		template.Must(tmpl.Parse(exportTemplate))
+		template.Must(tmpl.Parse(documentsTemplate))
+		template.Must(tmpl.Parse(changesTemplate))
+		template.Must(tmpl.Parse(replicaTemplate))
+		template.Must(tmpl.Parse(searchTemplate))
+		template.Must(tmpl.Parse(archiveTemplate))
+		template.Must(tmpl.Parse(blobRefTemplate))
+		template.Must(tmpl.Parse(stringKeyTemplate))
+		template.Must(tmpl.Parse(globalIndexTemplate))
+		template.Must(tmpl.Parse(webhookTemplate))
+		template.Must(tmpl.Parse(webhooksTemplate))
+		template.Must(tmpl.Parse(mergeTemplate))
+		template.Must(tmpl.Parse(versionsTemplate))
+		template.Must(tmpl.Parse(crdtTemplate))
+		template.Must(tmpl.Parse(etagTemplate))
+		template.Must(tmpl.Parse(watchTemplate))
+		template.Must(tmpl.Parse(watchEventTemplate))
+		template.Must(tmpl.Parse(cacheTemplate))
+		template.Must(tmpl.Parse(queryTemplate))
+		template.Must(tmpl.Parse(stagedTemplate))
+		template.Must(tmpl.Parse(intentsTemplate))
+		template.Must(tmpl.Parse(intentTemplate))
+		template.Must(tmpl.Parse(listTemplate))
+		template.Must(tmpl.Parse(multiGetTemplate))
+		template.Must(tmpl.Parse(sharedTemplate))
+		template.Must(tmpl.Parse(adminTemplate))
+		template.Must(tmpl.Parse(workerTemplate))
+		template.Must(tmpl.Parse(testHarnessTemplate))
+		template.Must(tmpl.Parse(faultsTemplate))
+		template.Must(tmpl.Parse(noFaultsTemplate))
+		template.Must(tmpl.Parse(keyspaceTemplate))
+
+		// The generated files and their names, checked for duplicate
+		// identifiers once all are generated
+		var genFiles []*protogen.GeneratedFile
+		var genNames []string
+		newGeneratedFile := func(fileName string) *protogen.GeneratedFile {
+			genFile := plugin.NewGeneratedFile(fileName, "")
+			genFiles = append(genFiles, genFile)
+			genNames = append(genNames, fileName)
+			return genFile
+		}
 
 		for _, msg := range messages {
+			if *splitFiles {
+				for _, f := range messageFiles {
+					content, err := executeMessageFile(tmpl, f.template, msg)
+					if err != nil {
+						return err
+					}
+					if content == nil {
+						continue
+					}
+					fileName := fmt.Sprintf("%s_%s.go", strings.ToLower(msg.Name), f.suffix)
+					newGeneratedFile(fileName).Write(content)
+					fmt.Fprintf(os.Stderr, "Generated %s\n", fileName)
+				}
+				continue
+			}
+
 			// Create a new generated file
 			fileName := fmt.Sprintf("%s_repository.go", strings.ToLower(msg.Name))
-			genFile := plugin.NewGeneratedFile(fileName, "")
+			genFile := newGeneratedFile(fileName)
 
 			err := tmpl.Execute(genFile, msg)
 			if err != nil {
@@ -77,13 +672,72 @@ func main() {
 			}
 			fmt.Fprintf(os.Stderr, "Generated %s\n", fileName)
 		}
-		return nil
-	})
+
+		// Generate the package-level files
+		if len(messages) > 0 {
+			for _, f := range []struct{ fileName, template string }{
+				{"repositories.go", "shared"},
+				{"worker.go", "worker"},
+				{"faults.go", "faults"},
+				{"nofaults.go", "nofaults"},
+				{"documents.go", "documents"},
+				{"webhooks.go", "webhooks"},
+				{"intents.go", "intents"},
+				{"keyspace.go", "keyspace"},
+			} {
+				if f.template == "webhooks" && !*features["cdc"] {
+					continue
+				}
+				genFile := newGeneratedFile(f.fileName)
+				if err := tmpl.ExecuteTemplate(genFile, f.template, messages); err != nil {
+					return err
+				}
+				fmt.Fprintf(os.Stderr, "Generated %s\n", f.fileName)
+			}
+		}
+
+		// keyspace.md is not Go, so it is left out of checkIdentifiers
+		if *keyspaceMD && len(messages) > 0 {
+			plugin.NewGeneratedFile("keyspace.md", "").P(keyspaceDoc(messages, *features["cache"]))
+			fmt.Fprintf(os.Stderr, "Generated %s\n", "keyspace.md")
+		}
+
+		if len(messages) > 0 {
+			genFile := newGeneratedFile("json.go")
+			err := tmpl.ExecuteTemplate(genFile, "json", struct {
+				UseProtoNames, EmitDefaults bool
+			}{*jsonNames == "proto", *jsonEmitDefaults})
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "Generated %s\n", "json.go")
+		}
+
+		if *genAdmin && len(messages) > 0 {
+			genFile := newGeneratedFile("admin_service.go")
+			if err := tmpl.ExecuteTemplate(genFile, "admin", messages); err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "Generated %s\n", "admin_service.go")
+		}
+
+		if *genTestHarness && len(messages) > 0 {
+			genFile := newGeneratedFile("testharness.go")
+			if err := tmpl.ExecuteTemplate(genFile, "testharness", messages); err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "Generated %s\n", "testharness.go")
+		}
+		return checkIdentifiers(genFiles, genNames)
+	}
 }
 
-func processMessage(message *protogen.Message, msgOptions proto.Message) *Message {
+// processMessage collects the options of message. messageTypes holds the
+// messages of the run by full name, which previous versions refer to.
+func processMessage(message *protogen.Message, msgOptions proto.Message, messageTypes map[protoreflect.FullName]*protogen.Message) *Message {
 	primaryKeyFields := []Field{}
 	secondaryIndexes := []SecondaryIndex{}
+	projections := []Projection{}
 
 	msgName := message.GoIdent.GoName
 
@@ -93,10 +747,7 @@ func processMessage(message *protogen.Message, msgOptions proto.Message) *Messag
 	for _, field := range message.Fields {
 		fieldName := field.Desc.Name()
 		fieldMap[string(fieldName)] = field
-		fields = append(fields, Field{
-			Name: field.GoName,
-			Type: goType(field.Desc.Kind()),
-		})
+		fields = append(fields, newField(field))
 	}
 
 	// Collect primary key fields
@@ -120,208 +771,2049 @@ func processMessage(message *protogen.Message, msgOptions proto.Message) *Messag
 	}
 
 	for _, pkName := range primaryKey {
-		if field, ok := fieldMap[pkName]; ok {
-			primaryKeyFields = append(primaryKeyFields, Field{
-				Name: field.GoName,
-				Type: goType(field.Desc.Kind()),
-			})
+		if field, pkField, ok := resolveField(fieldMap, pkName, msgName); ok {
+			if field.Desc.IsMap() {
+				log.Fatalf("Primary key field %s in message %s cannot be a map", pkName, msgName)
+			}
+			if !pkField.Packable() {
+				log.Fatalf("Primary key field %s in message %s has unsupported kind %s", pkName, msgName, field.Desc.Kind())
+			}
+			if pkField.Oneof {
+				log.Fatalf("Primary key field %s in message %s cannot be in a oneof or optional", pkName, msgName)
+			}
+			primaryKeyFields = append(primaryKeyFields, pkField)
 		} else {
 			log.Fatalf("Primary key field %s not found in message %s", pkName, msgName)
 		}
 	}
 
-	// Collect secondary indexes
+	// Collect secondary indexes. Indexes of a repeated field have an entry
+	// per element and follow the others, with the indexes of map keys
+	elementIndexes := []ElementIndex{}
 	if proto.HasExtension(msgOptions, annotationspb.E_SecondaryIndex) {
 		siValues := proto.GetExtension(msgOptions, annotationspb.E_SecondaryIndex)
-		if siValues != nil {
-			switch v := siValues.(type) {
-			case []*annotationspb.SecondaryIndex:
-				for _, idx := range v {
-					idxFields := []Field{}
-					for _, idxFieldName := range idx.Fields {
-						if field, ok := fieldMap[idxFieldName]; ok {
-							idxFields = append(idxFields, Field{
-								Name: field.GoName,
-								Type: goType(field.Desc.Kind()),
-							})
-						} else {
-							log.Fatalf("Secondary index field %s not found in message %s", idxFieldName, msgName)
+		var declared []*annotationspb.SecondaryIndex
+		switch v := siValues.(type) {
+		case []*annotationspb.SecondaryIndex:
+			declared = v
+		case *annotationspb.SecondaryIndex:
+			declared = []*annotationspb.SecondaryIndex{v}
+		case nil:
+		default:
+			log.Fatalf("Unknown type for secondary_index: %T", v)
+		}
+		for _, idx := range declared {
+			if listIndex, ok := newListIndex(idx, fieldMap, msgName); ok {
+				elementIndexes = append(elementIndexes, listIndex)
+			} else {
+				secondaryIndexes = append(secondaryIndexes, newSecondaryIndex(idx, fieldMap, msgName))
+			}
+		}
+	}
+
+	// Collect the indexes of map keys
+	for _, field := range message.Fields {
+		fieldOptions := field.Desc.Options()
+		if !proto.HasExtension(fieldOptions, annotationspb.E_IndexKeys) || !proto.GetExtension(fieldOptions, annotationspb.E_IndexKeys).(bool) {
+			continue
+		}
+		if !field.Desc.IsMap() {
+			log.Fatalf("Field %s in message %s has index_keys but is not a map", field.Desc.Name(), msgName)
+		}
+		elementIndexes = append(elementIndexes, ElementIndex{
+			Name:    field.GoName + "Key",
+			Field:   newField(field),
+			Element: newField(field.Message.Fields[0]),
+			Keys:    true,
+		})
+	}
+	for i := range elementIndexes {
+		elementIndexes[i].Position = len(secondaryIndexes) + i
+	}
+	// The global entries follow the other entries in indexKeys
+	globals := 0
+	for i := range secondaryIndexes {
+		if secondaryIndexes[i].Global {
+			secondaryIndexes[i].GlobalPosition = len(secondaryIndexes) + globals
+			globals++
+		}
+	}
+
+	// An index serves queries on its leading fields, so an index whose
+	// fields lead another one only costs writes
+	for i, idx := range secondaryIndexes {
+		for j, other := range secondaryIndexes {
+			if i != j && !idx.Unique && len(idx.Fields) < len(other.Fields) && joinFieldNames(other.Fields[:len(idx.Fields)]) == joinFieldNames(idx.Fields) {
+				log.Printf("Warning: secondary index %s of message %s is redundant with %s, whose leading fields are the same", idx.Name, msgName, other.Name)
+				break
+			}
+		}
+	}
+
+	// Every leading prefix of a composite index can be queried, unless an
+	// index has exactly the fields of the prefix
+	indexPrefixes := []IndexPrefix{}
+	queryable := map[string]bool{}
+	for _, idx := range secondaryIndexes {
+		queryable[joinFieldNames(idx.Fields)] = true
+	}
+	for i, idx := range secondaryIndexes {
+		for n := 1; n < len(idx.Fields); n++ {
+			name := joinFieldNames(idx.Fields[:n])
+			if queryable[name] {
+				continue
+			}
+			queryable[name] = true
+			indexPrefixes = append(indexPrefixes, IndexPrefix{Name: name, Fields: idx.Fields[:n], Index: idx, Position: i})
+		}
+	}
+
+	// Collect projections
+	if proto.HasExtension(msgOptions, annotationspb.E_Projection) {
+		projValues := proto.GetExtension(msgOptions, annotationspb.E_Projection)
+		if projValues != nil {
+			switch v := projValues.(type) {
+			case []*annotationspb.Projection:
+				for _, proj := range v {
+					if proj.Name == "" {
+						log.Fatalf("Projection without a name in message %s", msgName)
+					}
+					projFields := []Field{}
+					for _, projFieldName := range proj.Fields {
+						field, ok := fieldMap[projFieldName]
+						if !ok {
+							log.Fatalf("Projection field %s not found in message %s", projFieldName, msgName)
 						}
+						projField := newField(field)
+						if !projField.Scalar() {
+							log.Fatalf("Projection field %s in message %s has unsupported kind %s", projFieldName, msgName, field.Desc.Kind())
+						}
+						if projField.Oneof {
+							log.Fatalf("Projection field %s in message %s cannot be in a oneof or optional", projFieldName, msgName)
+						}
+						projFields = append(projFields, projField)
 					}
-					secondaryIndexes = append(secondaryIndexes, SecondaryIndex{
-						Fields: idxFields,
+					projections = append(projections, Projection{
+						Name:   proj.Name,
+						Fields: projFields,
 					})
 				}
-			case *annotationspb.SecondaryIndex:
-				idxFields := []Field{}
-				for _, idxFieldName := range v.Fields {
-					if field, ok := fieldMap[idxFieldName]; ok {
-						idxFields = append(idxFields, Field{
-							Name: field.GoName,
-							Type: goType(field.Desc.Kind()),
-						})
-					} else {
-						log.Fatalf("Secondary index field %s not found in message %s", idxFieldName, msgName)
-					}
-				}
-				secondaryIndexes = append(secondaryIndexes, SecondaryIndex{
-					Fields: idxFields,
-				})
 			default:
-				log.Fatalf("Unknown type for secondary_index: %T", v)
+				log.Fatalf("Unknown type for projection: %T", v)
 			}
 		}
 	}
 
-	return &Message{
-		Name:             msgName,
-		Fields:           fields,
-		PrimaryKeyFields: primaryKeyFields,
-		SecondaryIndexes: secondaryIndexes,
+	// Collect the directory path
+	directoryPath := []string{msgName}
+	if proto.HasExtension(msgOptions, annotationspb.E_Directory) {
+		dirValues := proto.GetExtension(msgOptions, annotationspb.E_Directory)
+		switch v := dirValues.(type) {
+		case []string:
+			if len(v) > 0 {
+				directoryPath = v
+			}
+		default:
+			log.Fatalf("Unknown type for directory: %T", v)
+		}
+		for _, elem := range directoryPath {
+			if elem == "" {
+				log.Fatalf("Empty directory path element in message %s", msgName)
+			}
+		}
 	}
-}
 
-func goType(kind protoreflect.Kind) string {
-	switch kind {
-	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Uint32Kind, protoreflect.Fixed32Kind, protoreflect.Sfixed32Kind:
-		return "int32"
-	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Uint64Kind, protoreflect.Fixed64Kind, protoreflect.Sfixed64Kind:
-		return "int64"
-	case protoreflect.FloatKind:
-		return "float32"
-	case protoreflect.DoubleKind:
-		return "float64"
-	case protoreflect.StringKind:
-		return "string"
-	case protoreflect.BoolKind:
-		return "bool"
-	default:
-		return "interface{}"
+	changeLog := false
+	if proto.HasExtension(msgOptions, annotationspb.E_ChangeLog) {
+		changeLog = proto.GetExtension(msgOptions, annotationspb.E_ChangeLog).(bool)
 	}
-}
-
-func joinFieldNames(fields []Field) string {
-	names := []string{}
-	for _, f := range fields {
-		names = append(names, f.Name)
+	fieldMerge := false
+	if proto.HasExtension(msgOptions, annotationspb.E_FieldMerge) {
+		fieldMerge = proto.GetExtension(msgOptions, annotationspb.E_FieldMerge).(bool)
+	}
+	serializer := ""
+	if proto.HasExtension(msgOptions, annotationspb.E_Serializer) {
+		serializer = proto.GetExtension(msgOptions, annotationspb.E_Serializer).(string)
+		if serializer == "proto" {
+			serializer = ""
+		}
+	}
+	profile := "full"
+	if proto.HasExtension(msgOptions, annotationspb.E_Profile) {
+		profile = proto.GetExtension(msgOptions, annotationspb.E_Profile).(string)
+		if profile != "full" && profileTemplates[profile] == nil {
+			log.Fatalf("Unknown profile %q of message %s: must be minimal, standard or full", profile, msgName)
+		}
+	}
+	previousVersions := []PreviousVersion{}
+	if proto.HasExtension(msgOptions, annotationspb.E_PreviousVersion) {
+		seen := map[string]bool{}
+		for i, name := range proto.GetExtension(msgOptions, annotationspb.E_PreviousVersion).([]string) {
+			fullName := protoreflect.FullName(name)
+			if !strings.Contains(name, ".") {
+				fullName = message.Desc.ParentFile().Package().Append(protoreflect.Name(name))
+			}
+			previous, ok := messageTypes[fullName]
+			switch {
+			case !ok:
+				log.Fatalf("Previous version %s of message %s not found", name, msgName)
+			case previous == message || seen[name]:
+				log.Fatalf("Previous version %s of message %s is listed twice or is the message itself", name, msgName)
+			case previous.GoIdent.GoImportPath != message.GoIdent.GoImportPath:
+				log.Fatalf("Previous version %s of message %s is in another Go package", name, msgName)
+			}
+			seen[name] = true
+			previousVersions = append(previousVersions, PreviousVersion{Type: previous.GoIdent.GoName, Version: i + 1})
+		}
+	}
+	buckets := 0
+	if proto.HasExtension(msgOptions, annotationspb.E_Buckets) {
+		if n := proto.GetExtension(msgOptions, annotationspb.E_Buckets).(uint32); n > 1 {
+			buckets = int(n)
+		}
+	}
+	skipUnchangedWrites := false
+	if proto.HasExtension(msgOptions, annotationspb.E_SkipUnchangedWrites) {
+		skipUnchangedWrites = proto.GetExtension(msgOptions, annotationspb.E_SkipUnchangedWrites).(bool)
+	}
+	etag := false
+	if proto.HasExtension(msgOptions, annotationspb.E_Etag) {
+		etag = proto.GetExtension(msgOptions, annotationspb.E_Etag).(bool)
+	}
+	searchSync := false
+	if proto.HasExtension(msgOptions, annotationspb.E_SearchSync) {
+		searchSync = proto.GetExtension(msgOptions, annotationspb.E_SearchSync).(bool)
 	}
-	return strings.Join(names, "And")
-}
 
-const fdbTemplate = `package repositories
+	// Collect the counter and element set fields
+	crdtFields := []CRDTField{}
+	for _, field := range message.Fields {
+		fieldOptions := field.Desc.Options()
+		counter := proto.HasExtension(fieldOptions, annotationspb.E_Counter) && proto.GetExtension(fieldOptions, annotationspb.E_Counter).(bool)
+		set := proto.HasExtension(fieldOptions, annotationspb.E_ElementSet) && proto.GetExtension(fieldOptions, annotationspb.E_ElementSet).(bool)
+		touch := proto.HasExtension(fieldOptions, annotationspb.E_Touch) && proto.GetExtension(fieldOptions, annotationspb.E_Touch).(bool)
+		side := proto.HasExtension(fieldOptions, annotationspb.E_SideStored) && proto.GetExtension(fieldOptions, annotationspb.E_SideStored).(bool)
+		typ := elementType(field)
+		switch {
+		case counter && set:
+			log.Fatalf("Field %s in message %s cannot be both a counter and an element set", field.Desc.Name(), msgName)
+		case touch && (counter || set):
+			log.Fatalf("Touch field %s in message %s cannot be a counter or an element set", field.Desc.Name(), msgName)
+		case side && (counter || set || touch):
+			log.Fatalf("Side-stored field %s in message %s cannot be a counter, an element set or a touch field", field.Desc.Name(), msgName)
+		case side && (field.Desc.IsList() || field.Desc.IsMap() || typ == "interface{}"):
+			log.Fatalf("Side-stored field %s in message %s must be a singular scalar", field.Desc.Name(), msgName)
+		case touch && (field.Desc.IsList() || typ != "int64"):
+			log.Fatalf("Touch field %s in message %s must be a singular int64 holding Unix seconds", field.Desc.Name(), msgName)
+		case counter && (field.Desc.IsList() || (typ != "int32" && typ != "int64" && typ != "uint32" && typ != "uint64")):
+			log.Fatalf("Counter field %s in message %s must be a singular integer", field.Desc.Name(), msgName)
+		case set && (!field.Desc.IsList() || typ == "interface{}"):
+			log.Fatalf("Element set field %s in message %s must be a repeated scalar", field.Desc.Name(), msgName)
+		case counter || set || touch || side:
+			crdtField := CRDTField{Field: newField(field), Set: set, Touch: touch, Side: side}
+			crdtField.Field.Type, crdtField.Field.TupleType = typ, tupleType(typ)
+			crdtFields = append(crdtFields, crdtField)
+		}
+	}
+	for _, crdtField := range crdtFields {
+		keyFields := append([]Field{}, primaryKeyFields...)
+		for _, index := range secondaryIndexes {
+			keyFields = append(keyFields, index.Fields...)
+		}
+		for _, index := range elementIndexes {
+			keyFields = append(keyFields, index.Field)
+		}
+		for _, f := range keyFields {
+			if f.Name == crdtField.Field.Name {
+				log.Fatalf("Field %s in message %s is stored outside the record and cannot be part of a key or index", f.ProtoName, msgName)
+			}
+		}
+	}
 
-import (
-    "context"
-    "fmt"
+	if skipUnchangedWrites && len(crdtFields) > 0 {
+		// Set writes the fields stored outside the record even if the record
+		// is unchanged
+		log.Fatalf("Message %s cannot skip unchanged writes since it has counter, element set, touch or side-stored fields", msgName)
+	}
 
-    "github.com/apple/foundationdb/bindings/go/src/fdb"
-	"github.com/apple/foundationdb/bindings/go/src/fdb/tuple"
-    "github.com/apple/foundationdb/bindings/go/src/fdb/directory"
-	"google.golang.org/protobuf/proto"
+	// Check the string_key and auto_uuid options, which newField reads into
+	// the key fields
+	keyFields := append([]Field{}, primaryKeyFields...)
+	for _, index := range secondaryIndexes {
+		keyFields = append(keyFields, index.Fields...)
+	}
+	for _, f := range keyFields {
+		switch {
+		case f.AutoUUID && f.StringKey != nil:
+			log.Fatalf("Field %s in message %s cannot have both the auto_uuid and string_key options", f.ProtoName, msgName)
+		case f.AutoUUID && f.Type != "string" && !f.Bytes():
+			log.Fatalf("Auto UUID field %s in message %s must be a singular string or bytes", f.ProtoName, msgName)
+		case f.AutoUUID && len(f.Parents) > 0:
+			log.Fatalf("Auto UUID field %s in message %s must be a field of the message itself", f.ProtoName, msgName)
+		case f.StringKey == nil:
+		case f.Type != "string":
+			log.Fatalf("String key field %s in message %s must be a singular string", f.ProtoName, msgName)
+		case f.StringKey.Hash && f.StringKey.MaxBytes <= 64:
+			log.Fatalf("String key field %s in message %s hashes overlong values, so its max_bytes must be more than 64", f.ProtoName, msgName)
+		}
+	}
+	autoUUIDs := 0
+	for _, f := range primaryKeyFields {
+		if f.AutoUUID {
+			autoUUIDs++
+		}
+	}
+	if autoUUIDs > 1 {
+		log.Fatalf("Message %s has more than one auto_uuid primary key field", msgName)
+	}
+	for _, field := range message.Fields {
+		if proto.HasExtension(field.Desc.Options(), annotationspb.E_AutoUuid) && proto.GetExtension(field.Desc.Options(), annotationspb.E_AutoUuid).(bool) {
+			primary := false
+			for _, f := range primaryKeyFields {
+				primary = primary || f.ProtoName == string(field.Desc.Name())
+			}
+			if !primary {
+				log.Fatalf("Auto UUID field %s in message %s must be a primary key field", field.Desc.Name(), msgName)
+			}
+		}
+		if !proto.HasExtension(field.Desc.Options(), annotationspb.E_StringKey) {
+			continue
+		}
+		if field.Desc.IsList() || field.Desc.IsMap() {
+			log.Fatalf("String key field %s in message %s must be a singular string", field.Desc.Name(), msgName)
+		}
+		found := false
+		for _, f := range keyFields {
+			found = found || f.ProtoName == string(field.Desc.Name())
+		}
+		if !found {
+			log.Fatalf("Field %s in message %s has the string_key option but is neither a primary key nor a secondary index field", field.Desc.Name(), msgName)
+		}
+	}
+
+	// Collect the blob reference fields
+	blobRefs := []BlobRef{}
+	for _, field := range message.Fields {
+		fieldOptions := field.Desc.Options()
+		if !proto.HasExtension(fieldOptions, annotationspb.E_BlobRef) {
+			continue
+		}
+		opt := proto.GetExtension(fieldOptions, annotationspb.E_BlobRef).(*annotationspb.BlobRef)
+		if field.Desc.Kind() != protoreflect.StringKind || field.Desc.IsList() {
+			log.Fatalf("Blob reference field %s in message %s must be a singular string", field.Desc.Name(), msgName)
+		}
+		if _, err := regexp.Compile(opt.Pattern); err != nil {
+			log.Fatalf("Invalid pattern of blob reference field %s in message %s: %v", field.Desc.Name(), msgName, err)
+		}
+		blobRefs = append(blobRefs, BlobRef{Field: newField(field), Pattern: opt.Pattern, Cleanup: opt.Cleanup})
+	}
+
+	// Collect the webhook URL templates
+	webhooks := []string{}
+	if proto.HasExtension(msgOptions, annotationspb.E_Webhook) {
+		webhooks = proto.GetExtension(msgOptions, annotationspb.E_Webhook).([]string)
+		for _, webhook := range webhooks {
+			for _, placeholder := range webhookPlaceholder.FindAllStringSubmatch(webhook, -1) {
+				found := false
+				for _, f := range primaryKeyFields {
+					found = found || f.ProtoName == placeholder[1]
+				}
+				if !found {
+					log.Fatalf("Webhook %s of message %s refers to %s, which is not a primary key field", webhook, msgName, placeholder[0])
+				}
+			}
+		}
+	}
+
+	// Collect the archive settings
+	var archive *ArchiveField
+	if proto.HasExtension(msgOptions, annotationspb.E_Archive) {
+		opt := proto.GetExtension(msgOptions, annotationspb.E_Archive).(*annotationspb.Archive)
+		field, ok := fieldMap[opt.TimeField]
+		if !ok {
+			log.Fatalf("Archive time field %s not found in message %s", opt.TimeField, msgName)
+		}
+		switch {
+		case field.Desc.Kind() == protoreflect.Int64Kind:
+			archive = &ArchiveField{Name: field.GoName}
+		case field.Message != nil && field.Message.Desc.FullName() == "google.protobuf.Timestamp":
+			archive = &ArchiveField{Name: field.GoName, Timestamp: true}
+		default:
+			log.Fatalf("Archive time field %s in message %s must be an int64 or a google.protobuf.Timestamp", opt.TimeField, msgName)
+		}
+	}
+
+	var recordLayer *RecordLayer
+	if proto.HasExtension(msgOptions, annotationspb.E_RecordLayer) {
+		opt := proto.GetExtension(msgOptions, annotationspb.E_RecordLayer).(*annotationspb.RecordLayer)
+		recordLayer = &RecordLayer{UnionField: int(opt.UnionField), MetaDataVersion: int(opt.MetaDataVersion)}
+	}
+
+	m := &Message{
+		Name:                msgName,
+		Fields:              fields,
+		PrimaryKeyFields:    primaryKeyFields,
+		SecondaryIndexes:    secondaryIndexes,
+		ElementIndexes:      elementIndexes,
+		IndexPrefixes:       indexPrefixes,
+		Projections:         projections,
+		DirectoryPath:       directoryPath,
+		ChangeLog:           changeLog || searchSync || len(webhooks) > 0,
+		SearchSync:          searchSync,
+		Archive:             archive,
+		BlobRefs:            blobRefs,
+		Webhooks:            webhooks,
+		FieldMerge:          fieldMerge,
+		CRDTFields:          crdtFields,
+		Serializer:          serializer,
+		Profile:             profile,
+		SkipUnchangedWrites: skipUnchangedWrites,
+		ETag:                etag,
+		PreviousVersions:    previousVersions,
+		Buckets:             buckets,
+		RecordLayer:         recordLayer,
+	}
+	if recordLayer != nil {
+		checkRecordLayer(m)
+	}
+	return m
+}
+
+// newListIndex returns the index declared by idx in message msgName if it is
+// an index of a repeated field, which must be its only field, or false for
+// other indexes.
+func newListIndex(idx *annotationspb.SecondaryIndex, fieldMap map[string]*protogen.Field, msgName string) (ElementIndex, bool) {
+	list := false
+	for _, name := range idx.Fields {
+		field, ok := fieldMap[name]
+		list = list || ok && field.Desc.IsList()
+	}
+	if !list {
+		return ElementIndex{}, false
+	}
+	if len(idx.Fields) > 1 {
+		log.Fatalf("Secondary index of message %s over the repeated field %s cannot have other fields", msgName, idx.Fields[0])
+	}
+	if idx.Unique || idx.Covering || idx.Global {
+		log.Fatalf("Secondary index of message %s over the repeated field %s cannot be unique, covering or global", msgName, idx.Fields[0])
+	}
+	field := fieldMap[idx.Fields[0]]
+	element := newField(field)
+	typ := elementType(field)
+	if typ == "interface{}" {
+		log.Fatalf("Secondary index field %s in message %s must be a repeated scalar", idx.Fields[0], msgName)
+	}
+	element.Type, element.TupleType = typ, tupleType(typ)
+	name := idx.Name
+	if name == "" {
+		name = field.GoName
+	} else if !token.IsIdentifier(name) || !token.IsExported(name) {
+		log.Fatalf("Secondary index name %q in message %s must be a capitalized Go identifier", name, msgName)
+	}
+	return ElementIndex{Name: name, Field: newField(field), Element: element}, true
+}
+
+// newSecondaryIndex returns the index declared by idx in message msgName,
+// whose fields are in fieldMap. The entries of the index pack its fields in
+// the order they are listed, which need not be their declaration order.
+func newSecondaryIndex(idx *annotationspb.SecondaryIndex, fieldMap map[string]*protogen.Field, msgName string) SecondaryIndex {
+	if len(idx.Fields) == 0 {
+		log.Fatalf("Secondary index without fields in message %s", msgName)
+	}
+	idxFields := []Field{}
+	seen := map[string]bool{}
+	for _, idxFieldName := range idx.Fields {
+		field, idxField, ok := resolveField(fieldMap, idxFieldName, msgName)
+		if !ok {
+			log.Fatalf("Secondary index field %s not found in message %s", idxFieldName, msgName)
+		}
+		if seen[idxFieldName] {
+			log.Fatalf("Secondary index field %s is listed twice in an index of message %s", idxFieldName, msgName)
+		}
+		seen[idxFieldName] = true
+		if field.Desc.IsMap() {
+			log.Fatalf("Secondary index field %s in message %s is a map; index its keys with the index_keys option instead", idxFieldName, msgName)
+		}
+		if !idxField.Packable() {
+			log.Fatalf("Secondary index field %s in message %s has unsupported kind %s", idxFieldName, msgName, field.Desc.Kind())
+		}
+		idxFields = append(idxFields, idxField)
+	}
+	name := idx.Name
+	if name == "" {
+		name = joinFieldNames(idxFields)
+	} else if !token.IsIdentifier(name) || !token.IsExported(name) {
+		log.Fatalf("Secondary index name %q in message %s must be a capitalized Go identifier", name, msgName)
+	}
+	return SecondaryIndex{Name: name, Fields: idxFields, Unique: idx.Unique, Covering: idx.Covering, Global: idx.Global}
+}
+
+func newField(field *protogen.Field) Field {
+	typ := elementType(field)
+	isMap := false
+	switch {
+	case field.Desc.IsMap():
+		// Maps of scalars get their Go map type, others stay unsupported
+		key, value := goType(field.Desc.MapKey().Kind()), elementType(field.Message.Fields[1])
+		typ = "interface{}"
+		if key != "interface{}" && value != "interface{}" {
+			typ, isMap = fmt.Sprintf("map[%s]%s", key, value), true
+		}
+	case field.Desc.IsList():
+		typ = "interface{}"
+	case field.Message != nil && field.Message.Desc.FullName() == "google.protobuf.Timestamp":
+		typ = timestampType
+	}
+	var stringKey *StringKey
+	if proto.HasExtension(field.Desc.Options(), annotationspb.E_StringKey) {
+		opt := proto.GetExtension(field.Desc.Options(), annotationspb.E_StringKey).(*annotationspb.StringKey)
+		stringKey = &StringKey{MaxBytes: int(opt.MaxBytes), RejectNull: opt.RejectNull, Hash: opt.Hash}
+	}
+	autoUUID := proto.HasExtension(field.Desc.Options(), annotationspb.E_AutoUuid) && proto.GetExtension(field.Desc.Options(), annotationspb.E_AutoUuid).(bool)
+	tupleTyp := tupleType(typ)
+	if autoUUID {
+		tupleTyp = "tuple.UUID"
+	}
+	path := field.GoName
+	if field.Oneof != nil {
+		// Oneof members are wrapped and proto3 optional fields are pointers
+		path = "Get" + field.GoName + "()"
+	}
+	return Field{
+		Name:      field.GoName,
+		ProtoName: string(field.Desc.Name()),
+		Number:    int32(field.Desc.Number()),
+		Type:      typ,
+		TupleType: tupleTyp,
+		Map:       isMap,
+		Path:      path,
+		GoName:    field.GoName,
+		StringKey: stringKey,
+		AutoUUID:  autoUUID,
+		Oneof:     field.Oneof != nil,
+		Optional:  field.Desc.HasOptionalKeyword(),
+	}
+}
+
+// resolveField returns the field of message msgName at path, a field name
+// or a dotted path such as "address.country" through singular message
+// fields, whose message types must be in the Go package of the message. The
+// fields of the message are in fieldMap. It reports false if there is no
+// such field.
+func resolveField(fieldMap map[string]*protogen.Field, path, msgName string) (*protogen.Field, Field, bool) {
+	names := strings.Split(path, ".")
+	field, ok := fieldMap[names[0]]
+	if !ok {
+		return nil, Field{}, false
+	}
+	parents := []FieldParent{}
+	oneof := false
+	for _, name := range names[1:] {
+		if field.Message == nil || field.Desc.IsList() || field.Desc.IsMap() {
+			return nil, Field{}, false
+		}
+		oneof = oneof || field.Oneof != nil
+		if field.Message.GoIdent.GoImportPath != field.Parent.GoIdent.GoImportPath {
+			log.Fatalf("Field path %s in message %s goes through %s, which is in another Go package", path, msgName, field.Message.GoIdent.GoName)
+		}
+		parents = append(parents, FieldParent{Name: field.GoName, Type: field.Message.GoIdent.GoName})
+		var next *protogen.Field
+		for _, f := range field.Message.Fields {
+			if string(f.Desc.Name()) == name {
+				next = f
+			}
+		}
+		if next == nil {
+			return nil, Field{}, false
+		}
+		field = next
+	}
+	f := newField(field)
+	if len(parents) > 0 {
+		f.Name, f.ProtoName, f.Path, f.Parents = "", path, "", parents
+		for _, p := range parents {
+			f.Name += p.Name
+			f.Path += "Get" + p.Name + "()."
+		}
+		f.Name += field.GoName
+		f.Path += "Get" + field.GoName + "()"
+		f.Oneof = f.Oneof || oneof
+		f.Optional = false
+	}
+	return field, f, true
+}
+
+// setField renders the statements assigning value to the field f of the
+// message receiver, first creating the messages holding a nested field if
+// they are nil.
+func setField(receiver, value string, f Field) string {
+	var b strings.Builder
+	for _, p := range f.Parents {
+		receiver += "." + p.Name
+		fmt.Fprintf(&b, "if %s == nil {\n%s = &pb.%s{}\n}\n", receiver, receiver, p.Type)
+	}
+	fmt.Fprintf(&b, "%s.%s = %s", receiver, f.GoName, value)
+	return b.String()
+}
+
+// elementType returns the Go type of field, or of its elements if it is
+// repeated: the type of its kind, or for an enum declared in the Go package
+// of the message, the generated enum type.
+func elementType(field *protogen.Field) string {
+	if field.Enum != nil && field.Enum.GoIdent.GoImportPath == field.Parent.GoIdent.GoImportPath {
+		return "pb." + field.Enum.GoIdent.GoName
+	}
+	return goType(field.Desc.Kind())
+}
+
+// isEnumType reports whether typ is the Go type of an enum, the only types
+// of the generated proto package that fields are given.
+func isEnumType(typ string) bool {
+	return strings.HasPrefix(typ, "pb.")
+}
+
+func goType(kind protoreflect.Kind) string {
+	switch kind {
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		return "int32"
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return "int64"
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return "uint32"
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return "uint64"
+	case protoreflect.FloatKind:
+		return "float32"
+	case protoreflect.DoubleKind:
+		return "float64"
+	case protoreflect.StringKind:
+		return "string"
+	case protoreflect.BoolKind:
+		return "bool"
+	case protoreflect.BytesKind:
+		return "[]byte"
+	default:
+		return "interface{}"
+	}
+}
+
+// timestampType is the Go type of google.protobuf.Timestamp fields.
+const timestampType = "*timestamppb.Timestamp"
+
+// tupleType returns the Go type tuple.Unpack yields for a value packed from
+// a field of the given Go type. Signed integers, including enums, always come
+// back as int64, and timestamps as a nested tuple, unpacked with
+// tupleTimestamp. Unsigned integers are packed as uint64, which comes back as
+// int64 below 1<<63, so they are unpacked with tupleUint.
+func tupleType(typ string) string {
+	if typ == timestampType {
+		return "tuple.Tuple"
+	}
+	if isEnumType(typ) {
+		return "int64"
+	}
+	switch typ {
+	case "int32", "int64":
+		return "int64"
+	case "uint32", "uint64":
+		return "uint64"
+	default:
+		return typ
+	}
+}
+
+// toTuple converts expr, a value of the field's Go type, into a value that
+// can be packed into a tuple.
+func toTuple(expr string, f Field) string {
+	if f.AutoUUID && f.Bytes() {
+		return fmt.Sprintf("uuidFromBytes(%s)", expr)
+	}
+	if f.AutoUUID {
+		return fmt.Sprintf("uuidFromString(%s)", expr)
+	}
+	if f.Hashed() {
+		return fmt.Sprintf("hashKeyString(%s, %d)", expr, f.StringKey.MaxBytes)
+	}
+	if f.Timestamp() {
+		return fmt.Sprintf("timestampKey(%s.AsTime())", expr)
+	}
+	if f.TupleType == f.Type {
+		return expr
+	}
+	return fmt.Sprintf("%s(%s)", f.TupleType, expr)
+}
+
+// assertTuple renders the assertion of expr, an unpacked tuple element, to
+// the field's TupleType, yielding the value and whether it has that type.
+func assertTuple(expr string, f Field) string {
+	if f.TupleType == "uint64" {
+		return fmt.Sprintf("tupleUint(%s)", expr)
+	}
+	if f.Timestamp() {
+		return fmt.Sprintf("tupleTimestamp(%s)", expr)
+	}
+	return fmt.Sprintf("%s.(%s)", expr, f.TupleType)
+}
+
+// fromTuple converts expr, an unpacked tuple element already asserted to the
+// field's TupleType, back into the field's Go type.
+func fromTuple(expr string, f Field) string {
+	if f.AutoUUID && f.Bytes() {
+		return fmt.Sprintf("uuidBytes(%s)", expr)
+	}
+	if f.AutoUUID {
+		return fmt.Sprintf("formatUUID(%s)", expr)
+	}
+	if f.Timestamp() {
+		return fmt.Sprintf("timestamppb.New(timeFromKey(%s))", expr)
+	}
+	if f.TupleType == f.Type {
+		return expr
+	}
+	return fmt.Sprintf("%s(%s)", f.Type, expr)
+}
+
+func lowerFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToLower(s[:1]) + s[1:]
+}
+
+// sqliteType returns the SQLite column type of a field of the given Go type,
+// or "" if the field has no column.
+func sqliteType(typ string) string {
+	if isEnumType(typ) {
+		return "INTEGER"
+	}
+	switch typ {
+	case "int32", "int64", "uint32", "uint64", "bool":
+		return "INTEGER"
+	case "float32", "float64":
+		return "REAL"
+	case "string":
+		return "TEXT"
+	case "[]byte":
+		return "BLOB"
+	default:
+		return ""
+	}
+}
+
+// sqliteColumns returns the quoted column names of fields, or nil if one of
+// them has no column.
+func sqliteColumns(fields []Field) []string {
+	columns := []string{}
+	for _, f := range fields {
+		if sqliteType(f.Type) == "" {
+			return nil
+		}
+		columns = append(columns, strconv.Quote(f.ProtoName))
+	}
+	return columns
+}
+
+// sqliteSchema returns the statements creating the SQLite table of msg and
+// its indexes. The table has a column per scalar field, plus the record as
+// JSON and as protobuf.
+func sqliteSchema(msg Message) []string {
+	table := strconv.Quote(msg.Name)
+	columns := []string{}
+	for _, f := range msg.ScalarFields() {
+		if typ := sqliteType(f.Type); typ != "" {
+			columns = append(columns, strconv.Quote(f.ProtoName)+" "+typ)
+		}
+	}
+	columns = append(columns, `"_json" TEXT`, `"_record" BLOB`)
+	if pk := sqliteColumns(msg.PrimaryKeyFields); pk != nil {
+		columns = append(columns, "PRIMARY KEY ("+strings.Join(pk, ", ")+")")
+	}
+	stmts := []string{fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s)", table, strings.Join(columns, ", "))}
+	for _, idx := range msg.SecondaryIndexes {
+		if columns := sqliteColumns(idx.Fields); columns != nil {
+			name := strconv.Quote(msg.Name + "_" + idx.Name + "_index")
+			stmts = append(stmts, fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s (%s)", name, table, strings.Join(columns, ", ")))
+		}
+	}
+	return stmts
+}
+
+// sqliteInsert returns the statement upserting a row into the SQLite table of
+// msg. Its parameters are the scalar fields in order, the JSON and the
+// protobuf encodings of the record.
+func sqliteInsert(msg Message) string {
+	columns, params := []string{}, []string{}
+	for _, f := range msg.ScalarFields() {
+		if sqliteType(f.Type) != "" {
+			columns = append(columns, strconv.Quote(f.ProtoName))
+			params = append(params, "?")
+		}
+	}
+	columns = append(columns, `"_json"`, `"_record"`)
+	params = append(params, "?", "?")
+	return fmt.Sprintf("INSERT OR REPLACE INTO %s (%s) VALUES (%s)", strconv.Quote(msg.Name), strings.Join(columns, ", "), strings.Join(params, ", "))
+}
+
+// stringSlice renders values as a Go []string literal.
+func stringSlice(values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = strconv.Quote(v)
+	}
+	return "[]string{" + strings.Join(quoted, ", ") + "}"
+}
+
+func joinFieldNames(fields []Field) string {
+	names := []string{}
+	for _, f := range fields {
+		names = append(names, f.Name)
+	}
+	return strings.Join(names, "And")
+}
+
+// fdbTemplate generates the repository file of a message. Its sections,
+// the message* templates, are the files split_files=true generates instead.
+const fdbTemplate = `{{define "header"}}// Code generated by fdb-go-layer-plugin {{pluginVersion}}. DO NOT EDIT.
+// Schema fingerprint: {{.Fingerprint}}
+
+package repositories
+
+import (
+    {{if or .SecondaryIndexes .ElementIndexes .SkipUnchangedWrites .ChangeLog .Webhooks .HasBytesFields .HasTimestampKeys (.Generates "maintenance") (.Generates "watch")}}"bytes"{{end}}
+    "context"
+    {{if or .ChangeLog (.Generates "export")}}"database/sql"{{end}}
+    {{if or .CRDTFields (and (feature "cache") (.Generates "cache"))}}"encoding/binary"{{end}}
+    "errors"
+    "fmt"
+    {{if .Generates "import"}}"io"{{end}}
+    {{if .Webhooks}}"encoding/json"{{end}}
+    {{if .Webhooks}}"net/http"{{end}}
+    {{if or .SearchSync .Webhooks}}"net/url"{{end}}
+    {{if .HasBlobRefPatterns}}"regexp"{{end}}
+    {{if or .Webhooks .RejectsNullKeys (.Generates "query")}}"strings"{{end}}
+    {{if or .FieldMerge (.Generates "batch") (and (feature "cache") (.Generates "cache"))}}"sort"{{end}}
+    {{if or .ChangeLog .Archive .Webhooks .FieldMerge .HasTouchFields .HasTimestampKeys (.Generates "batch") (.Generates "maintenance")}}"time"{{end}}
+
+    "github.com/apple/foundationdb/bindings/go/src/fdb"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/tuple"
+    "github.com/apple/foundationdb/bindings/go/src/fdb/directory"
+    "github.com/apple/foundationdb/bindings/go/src/fdb/subspace"
+	"google.golang.org/protobuf/proto"
+    {{if .FieldMerge}}"google.golang.org/protobuf/reflect/protoreflect"{{end}}
+    {{if .HasTimestampKeys}}"google.golang.org/protobuf/types/known/timestamppb"{{end}}
     pb "{{.GoPackagePath}}"
 )
+{{end}}
+
+{{define "messageStore"}}
+
+type {{.Name}}Repository struct {
+    db     fdb.Transactor
+    dir    directory.DirectorySubspace
+    dryRun bool
+    {{if .Archive}}blobs  BlobStore{{end}}
+    {{if feature "cache"}}cache    Cache
+    accesses *accessCounter{{end}}
+    sampler  *QuerySampler
+    guard    *FullScanGuard
+    slowOps  *SlowOpLogger
+    {{if .Generates "batch"}}batchLimits BatchLimits{{end}}
+    marshalOpts   proto.MarshalOptions
+    unmarshalOpts proto.UnmarshalOptions
+    {{if .HasGlobalIndexes}}// global holds the entries of the global indexes of every prefix,
+    // tenant the prefix of this repository.
+    global directory.DirectorySubspace
+    tenant tuple.Tuple{{end}}
+}
+
+var (
+    // Err{{.Name}}NotFound is returned for a {{.Name}} that is not stored. It
+    // matches ErrNotFound with errors.Is.
+    Err{{.Name}}NotFound = fmt.Errorf("{{.Name}}: %w", ErrNotFound)
+    // Err{{.Name}}AlreadyExists is returned when creating a {{.Name}} that is
+    // already stored. It matches ErrAlreadyExists with errors.Is.
+    Err{{.Name}}AlreadyExists = fmt.Errorf("{{.Name}}: %w", ErrAlreadyExists)
+)
+
+// New{{.Name}}Repository opens the {{.Name}} directory, creating it if needed.
+// A non-empty prefix, such as an environment name or a test run ID, nests the
+// directory under that path so that several environments can share a cluster.
+func New{{.Name}}Repository(db fdb.Transactor, prefix ...string) (*{{.Name}}Repository, error) {
+    return open{{.Name}}Repository(db, db, prefix)
+}
+
+// open{{.Name}}Repository opens the directories of the repository in t, db
+// itself or one of its transactions, and returns a repository of db.{{if .RecordLayer}} The
+// header of the Record Layer store is checked in the same transaction.{{end}}
+func open{{.Name}}Repository(db, t fdb.Transactor, prefix []string) (*{{.Name}}Repository, error) {
+    result, err := t.Transact(func(tr fdb.Transaction) (interface{}, error) {
+        path := append(append([]string{}, prefix...), {{stringSlice .DirectoryPath}}...)
+        dir, err := directory.CreateOrOpen(tr, path, nil)
+        if err != nil {
+            return nil, err
+        }
+        {{with .RecordLayer}}if err := openRecordStore(tr, dir, {{.MetaDataVersion}}); err != nil {
+            return nil, fmt.Errorf("{{$.Name}}: %w", err)
+        }
+        {{end}}{{if .HasGlobalIndexes}}global, err := directory.CreateOrOpen(tr, append([]string{GlobalDirectory}, {{stringSlice .DirectoryPath}}...), nil)
+        if err != nil {
+            return nil, err
+        }
+        tenant := tuple.Tuple{}
+        for _, p := range prefix {
+            tenant = append(tenant, p)
+        }
+        return &{{.Name}}Repository{db: db, dir: dir, global: global, tenant: tenant}, nil{{else}}return &{{.Name}}Repository{db: db, dir: dir}, nil{{end}}
+    })
+    if err != nil {
+        return nil, err
+    }
+    return result.(*{{.Name}}Repository), nil
+}
+
+// NewTest{{.Name}}Repository returns a repository in a unique throwaway
+// directory that is removed when the test finishes, so that tests can run in
+// parallel against a shared cluster.
+func NewTest{{.Name}}Repository(t TestingT, db fdb.Transactor) *{{.Name}}Repository {
+    t.Helper()
+    repo, err := New{{.Name}}Repository(db, NewTestPrefix(t, db)...)
+    if err != nil {
+        t.Fatalf("creating {{.Name}} repository: %v", err)
+    }
+    return repo
+}
+
+// WithSlowOpLogger returns a copy of the repository logging its slow
+// operations with logger.
+func (repo *{{.Name}}Repository) WithSlowOpLogger(logger SlowOpLogger) *{{.Name}}Repository {
+    withLogger := *repo
+    withLogger.slowOps = &logger
+    return &withLogger
+}
+
+// WithMarshalOptions returns a copy of the repository encoding records with
+// opts, e.g. with Deterministic set so that equal records are stored as
+// equal bytes for checksumming and diffing. {{if .Serializer}}The options are
+// ignored, since records are encoded with the "{{.Serializer}}" Serializer.{{else}}The options only apply to the
+// default proto serializer.{{end}}
+func (repo *{{.Name}}Repository) WithMarshalOptions(opts proto.MarshalOptions) *{{.Name}}Repository {
+    withOpts := *repo
+    withOpts.marshalOpts = opts
+    return &withOpts
+}
+
+// WithUnmarshalOptions returns a copy of the repository decoding records
+// with opts, e.g. with DiscardUnknown or AllowPartial set. {{if .Serializer}}The options are
+// ignored, since records are decoded with the "{{.Serializer}}" Serializer.{{else}}The options only
+// apply to the default proto serializer.{{end}}
+func (repo *{{.Name}}Repository) WithUnmarshalOptions(opts proto.UnmarshalOptions) *{{.Name}}Repository {
+    withOpts := *repo
+    withOpts.unmarshalOpts = opts
+    return &withOpts
+}
+
+func (repo *{{.Name}}Repository) Get(ctx context.Context, tr fdb.ReadTransaction, {{range $index, $element := .PrimaryKeyFields}}{{if $index}}, {{end}}{{.Name}} {{.Type}}{{end}}) (*pb.{{.Name}}, error) {
+    var entity *pb.{{.Name}}
+    op := repo.slowOps.start("{{.Name}}", "Get")
+    defer op.finish()
+
+    key := repo.recordKey(tuple.Tuple{ {{range .PrimaryKeyFields}} {{toTuple .Name .}}, {{end}} })
+    value, err := tr.Get(key).Get()
+    if err != nil {
+        return nil, err
+    }
+    if value == nil {
+        return nil, Err{{.Name}}NotFound
+    }
+    op.add(1, len(value))
+    txStatsFrom(ctx).read(len(key) + len(value))
+    entity = &pb.{{.Name}}{}
+    err = repo.unmarshal(value, entity)
+    if err != nil {
+        return nil, err
+    }
+    {{if .CRDTFields}}if err := repo.loadCRDTFields(tr, entity); err != nil {
+        return nil, err
+    }
+    {{end}}
+    return entity, nil
+}
+
+// GetInto reads a record into dst like Get, reusing dst instead of
+// allocating a new message, for hot paths doing many point reads. dst is
+// reset first and left reset if the record does not exist.
+func (repo *{{.Name}}Repository) GetInto(ctx context.Context, tr fdb.ReadTransaction, {{range $index, $element := .PrimaryKeyFields}}{{if $index}}, {{end}}{{.Name}} {{.Type}}{{end}}, dst *pb.{{.Name}}) error {
+    op := repo.slowOps.start("{{.Name}}", "Get")
+    defer op.finish()
+
+    proto.Reset(dst)
+    key := repo.recordKey(tuple.Tuple{ {{range .PrimaryKeyFields}} {{toTuple .Name .}}, {{end}} })
+    value, err := tr.Get(key).Get()
+    if err != nil {
+        return err
+    }
+    if value == nil {
+        return Err{{.Name}}NotFound
+    }
+    op.add(1, len(value))
+    txStatsFrom(ctx).read(len(key) + len(value))
+    if err := repo.unmarshal(value, dst); err != nil {
+        return err
+    }
+    {{if .CRDTFields}}if err := repo.loadCRDTFields(tr, dst); err != nil {
+        return err
+    }
+    {{end}}
+    return nil
+}
+
+// Set writes entity, replacing the stored record with the same primary key.{{if .HasCountersOrSets}}
+// The counters and element sets of entity initialize those of a new record,
+// but those of a stored record are left to their mutators, so that writing a
+// record read earlier does not undo their concurrent changes.{{end}}
+func (repo *{{.Name}}Repository) Set(ctx context.Context, tr fdb.Transaction, entity *pb.{{.Name}}) error {
+    return repo.set(ctx, tr, entity, false)
+}
+
+// Exists reports whether a record with the given primary key exists, without
+// decoding it.
+func (repo *{{.Name}}Repository) Exists(ctx context.Context, tr fdb.ReadTransaction, {{range $index, $element := .PrimaryKeyFields}}{{if $index}}, {{end}}{{.Name}} {{.Type}}{{end}}) (bool, error) {
+    key := repo.recordKey(tuple.Tuple{ {{range .PrimaryKeyFields}} {{toTuple .Name .}}, {{end}} })
+    value, err := tr.Get(key).Get()
+    if err != nil {
+        return false, err
+    }
+    txStatsFrom(ctx).read(len(key) + len(value))
+    return value != nil, nil
+}
+
+// getIfExists returns the stored record, or nil if there is none.
+func (repo *{{.Name}}Repository) getIfExists(tr fdb.ReadTransaction, {{range $index, $element := .PrimaryKeyFields}}{{if $index}}, {{end}}{{.Name}} {{.Type}}{{end}}) (*pb.{{.Name}}, error) {
+    value, err := tr.Get(repo.recordKey(tuple.Tuple{ {{range .PrimaryKeyFields}} {{toTuple .Name .}}, {{end}} })).Get()
+    if err != nil || value == nil {
+        return nil, err
+    }
+    entity := &pb.{{.Name}}{}
+    if err := repo.unmarshal(value, entity); err != nil {
+        return nil, err
+    }
+    {{if .CRDTFields}}if err := repo.loadCRDTFields(tr, entity); err != nil {
+        return nil, err
+    }
+    {{end}}
+    return entity, nil
+}
+
+{{with .AutoUUIDField}}// Create writes entity like Set, but fails with Err{{$.Name}}AlreadyExists if a
+// record with the same primary key exists. An empty {{.Name}} is first set to a
+// new random UUID. It returns the {{.Name}} of the record.
+func (repo *{{$.Name}}Repository) Create(ctx context.Context, tr fdb.Transaction, entity *pb.{{$.Name}}) ({{.Type}}, error) {
+    if len(entity.{{.Name}}) == 0 {
+        entity.{{.Name}} = {{.UUID}}
+    }
+    return entity.{{.Name}}, repo.create(ctx, tr, entity)
+}{{else}}// Create writes entity like Set, but fails with Err{{.Name}}AlreadyExists if a
+// record with the same primary key exists.
+func (repo *{{.Name}}Repository) Create(ctx context.Context, tr fdb.Transaction, entity *pb.{{.Name}}) error {
+    return repo.create(ctx, tr, entity)
+}{{end}}
+
+// create writes entity unless a record with the same primary key exists.
+func (repo *{{.Name}}Repository) create(ctx context.Context, tr fdb.Transaction, entity *pb.{{.Name}}) error {
+    exists, err := repo.Exists(ctx, tr, {{range $index, $element := .PrimaryKeyFields}}{{if $index}}, {{end}}entity.{{.Path}}{{end}})
+    if err != nil {
+        return err
+    }
+    if exists {
+        return Err{{.Name}}AlreadyExists
+    }
+    return repo.set(ctx, tr, entity, false)
+}
+
+// GetOrCreate returns the record with the given primary key, or creates it
+// from the one returned by factory if it does not exist and reports true.
+// The primary key fields of the created record are set to the given values.
+// Both happen in tr, so concurrent calls cannot create the record twice. A
+// factory returning nil is an error.
+func (repo *{{.Name}}Repository) GetOrCreate(ctx context.Context, tr fdb.Transaction, {{range $index, $element := .PrimaryKeyFields}}{{if $index}}, {{end}}{{.Name}} {{.Type}}{{end}}, factory func() *pb.{{.Name}}) (*pb.{{.Name}}, bool, error) {
+    entity, err := repo.Get(ctx, tr, {{range $index, $element := .PrimaryKeyFields}}{{if $index}}, {{end}}{{.Name}}{{end}})
+    if err == nil {
+        return entity, false, nil
+    }
+    if !errors.Is(err, Err{{.Name}}NotFound) {
+        return nil, false, err
+    }
+    entity = factory()
+    if entity == nil {
+        return nil, false, fmt.Errorf("{{.Name}}: GetOrCreate factory returned nil")
+    }
+    {{range .PrimaryKeyFields}}{{setField "entity" .Name .}}
+    {{end}}if err := repo.set(ctx, tr, entity, false); err != nil {
+        return nil, false, err
+    }
+    return entity, true, nil
+}
+
+// Update replaces the stored record with entity like Set, but fails with
+// Err{{.Name}}NotFound if no record with the same primary key exists.
+func (repo *{{.Name}}Repository) Update(ctx context.Context, tr fdb.Transaction, entity *pb.{{.Name}}) error {
+    exists, err := repo.Exists(ctx, tr, {{range $index, $element := .PrimaryKeyFields}}{{if $index}}, {{end}}entity.{{.Path}}{{end}})
+    if err != nil {
+        return err
+    }
+    if !exists {
+        return Err{{.Name}}NotFound
+    }
+    return repo.set(ctx, tr, entity, false)
+}
+
+// Upsert writes entity whether or not a record with the same primary key
+// exists, replacing it. It is Set under a name stating the intent.
+func (repo *{{.Name}}Repository) Upsert(ctx context.Context, tr fdb.Transaction, entity *pb.{{.Name}}) error {
+    return repo.set(ctx, tr, entity, false)
+}
+
+// set writes entity. If staged, the index entries are left to applyStaged.
+func (repo *{{.Name}}Repository) set(ctx context.Context, tr fdb.Transaction, entity *pb.{{.Name}}, staged bool) error {
+    {{with .AutoUUIDField}}if {{toTuple (printf "entity.%s" .Name) .}} == (tuple.UUID{}) {
+        return fmt.Errorf("{{$.Name}}: {{.Name}} is not a UUID: %w", ErrInvalidKey)
+    }
+    {{end}}{{if .HasStringKeys}}if err := validate{{.Name}}StringKeys(entity); err != nil {
+        return err
+    }
+    {{end}}{{if .HasBlobRefPatterns}}if err := validate{{.Name}}BlobRefs(entity); err != nil {
+        return err
+    }
+    {{end}}    op := repo.slowOps.start("{{.Name}}", "Set")
+    defer op.finish()
+    key := repo.recordKey(tuple.Tuple{ {{range .PrimaryKeyFields}} {{toTuple (printf "entity.%s" .Path) .}}, {{end}} })
+    {{if .CRDTFields}}// Counters and element sets are stored outside the record
+    stored := proto.Clone(entity).(*pb.{{.Name}})
+    {{range .CRDTFields}}stored.{{.Field.Name}} = {{if .Set}}nil{{else}}{{.Field.Zero}}{{end}}
+    {{end}}
+    {{end}}buf := getValueBuffer()
+    defer putValueBuffer(buf)
+    value, err := repo.marshalAppend((*buf)[:0], {{if .CRDTFields}}stored{{else}}entity{{end}})
+    if err != nil {
+        return err
+    }
+    *buf = value
+    stats := txStatsFrom(ctx)
+    {{if or .SecondaryIndexes .ElementIndexes .SkipUnchangedWrites .HasCountersOrSets}}previous, err := tr.Get(key).Get()
+    if err != nil {
+        return err
+    }
+    stats.read(len(key) + len(previous))
+    {{end}}{{if .SkipUnchangedWrites}}if previous != nil && bytes.Equal(previous, value) {
+        return nil
+    }
+    {{end}}{{if .HasUniqueIndexes}}if err := repo.checkUnique(tr, entity); err != nil {
+        return err
+    }
+    {{end}}{{if .RecordLayer}}// Clear the split parts and version the Record Layer may have stored
+    tr.ClearRange(repo.recordSubspace().Sub({{range .PrimaryKeyFields}} {{toTuple (printf "entity.%s" .Path) .}}, {{end}}))
+    {{end}}
+    tr.Set(key, value)
+    op.add(1, len(value))
+    stats.write(len(key) + len(value))
+    {{if .ETag}}if err := repo.setRecordVersion(tr, key, tuple.Tuple{ {{range .PrimaryKeyFields}} {{toTuple (printf "entity.%s" .Path) .}}, {{end}} }); err != nil {
+        return err
+    }{{end}}
+    {{if .CRDTFields}}repo.setCRDTFields(tr, entity{{if .HasCountersOrSets}}, previous == nil{{end}}){{end}}
+    {{if feature "cache"}}if repo.cache != nil {
+        repo.cache.Delete(string(key))
+    }{{end}}
+
+    {{if .SecondaryIndexes}}if staged {
+        if err := repo.stageIndexes(tr, key, previous); err != nil {
+            return err
+        }
+        {{if .HasUniqueIndexes}}// Unique entries are written at once, so that concurrent writes of the
+        // same values conflict
+        indexKeys := repo.indexKeys(entity)
+        {{range $i, $idx := .SecondaryIndexes}}{{if $idx.Unique}}tr.Set(indexKeys[{{$i}}], repo.indexValue({{$i}}, value))
+        {{end}}{{end}}{{end}}
+    } else {
+        indexKeys := repo.indexKeys(entity)
+        // Clear the entries of the stored version that no longer apply
+        if previous != nil {
+            old := &pb.{{.Name}}{}
+            if err := repo.unmarshal(previous, old); err != nil {
+                return err
+            }
+            for i, oldKey := range repo.indexKeys(old) {
+                if !bytes.Equal(oldKey, indexKeys[i]) {
+                    tr.Clear(oldKey)
+                    stats.write(len(oldKey))
+                }
+            }
+        }
+        for i, indexKey := range indexKeys {
+            indexValue := repo.indexValue(i, value)
+            tr.Set(indexKey, indexValue)
+            stats.write(len(indexKey) + len(indexValue))
+        }
+    }
+    {{end}}{{if .ElementIndexes}}if err := repo.setElementKeys(ctx, tr, entity, previous); err != nil {
+        return err
+    }
+    {{end}}    {{if .ChangeLog}}
+    if err := repo.logChange(tr, tuple.Tuple{ {{range .PrimaryKeyFields}} {{toTuple (printf "entity.%s" .Path) .}}, {{end}} }, value); err != nil {
+        return err
+    }
+    {{end}}
+    return nil
+}
+
+func (repo *{{.Name}}Repository) Delete(ctx context.Context, tr fdb.Transaction, {{range $index, $element := .PrimaryKeyFields}}{{if $index}}, {{end}}{{.Name}} {{.Type}}{{end}}) error {
+    op := repo.slowOps.start("{{.Name}}", "Delete")
+    defer op.finish()
+    key := repo.recordKey(tuple.Tuple{ {{range .PrimaryKeyFields}} {{toTuple .Name .}}, {{end}} })
+    value, err := tr.Get(key).Get()
+    if err != nil {
+        return err
+    }
+    op.add(1, len(value))
+    stats := txStatsFrom(ctx)
+    stats.read(len(key) + len(value))
+    if value != nil {
+        entity := &pb.{{.Name}}{}
+        err := repo.unmarshal(value, entity)
+        if err == nil {
+            for _, indexKey := range repo.indexKeys(entity) {
+                tr.Clear(indexKey)
+                stats.write(len(indexKey))
+            }
+            {{if .ElementIndexes}}for _, elementKey := range repo.elementKeys(entity) {
+                tr.Clear(elementKey)
+                stats.write(len(elementKey))
+            }
+            {{end}}{{range .BlobRefs}}{{if .Cleanup}}if entity.{{.Field.Name}} != "" {
+                tr.Set(MetaSubspace(repo.dir, BlobCleanupSubspace).Pack(tuple.Tuple{entity.{{.Field.Name}}}), []byte{})
+            }
+            {{end}}{{end}}
+        }
+        {{if .ChangeLog}}
+        if err := repo.logChange(tr, tuple.Tuple{ {{range .PrimaryKeyFields}} {{toTuple .Name .}}, {{end}} }, nil); err != nil {
+            return err
+        }
+        {{end}}
+    }
+    {{if .RecordLayer}}tr.ClearRange(repo.recordSubspace().Sub({{range .PrimaryKeyFields}} {{toTuple .Name .}}, {{end}})){{else}}tr.Clear(key){{end}}
+    stats.write(len(key))
+    {{if feature "cache"}}if repo.cache != nil {
+        repo.cache.Delete(string(key))
+    }{{end}}
+    {{if .CRDTFields}}tr.ClearRange(MetaSubspace(repo.dir, CRDTSubspace).Sub({{range .PrimaryKeyFields}} {{toTuple .Name .}}, {{end}})){{end}}
+    {{if .FieldMerge}}tr.Clear(MetaSubspace(repo.dir, FieldClocksSubspace).Pack(tuple.Tuple{ {{range .PrimaryKeyFields}} {{toTuple .Name .}}, {{end}} })){{end}}
+    {{if .Archive}}tr.Clear(MetaSubspace(repo.dir, ArchiveSubspace).Pack(tuple.Tuple{ {{range .PrimaryKeyFields}} {{toTuple .Name .}}, {{end}} })){{end}}
+    {{if .ETag}}tr.Clear(MetaSubspace(repo.dir, VersionsSubspace).Pack(tuple.Tuple{ {{range .PrimaryKeyFields}} {{toTuple .Name .}}, {{end}} })){{end}}
+    return nil
+}
+
+// marshal encodes entity as stored{{if .Serializer}}, with the "{{.Serializer}}" Serializer{{end}}{{if .PreviousVersions}}, in the
+// envelope of version {{.Version}}{{else if .RecordLayer}}, in the
+// RecordTypeUnion message of the Record Layer store{{end}}.
+func (repo *{{.Name}}Repository) marshal(entity *pb.{{.Name}}) ([]byte, error) {
+    {{if or .PreviousVersions .RecordLayer}}return repo.marshalAppend(nil, entity){{else if .Serializer}}s, err := lookupSerializer("{{.Serializer}}")
+    if err != nil {
+        return nil, err
+    }
+    return s.Marshal(entity){{else}}return repo.marshalOpts.Marshal(entity){{end}}
+}
+
+// marshalAppend is marshal appending to buf, which write paths take from
+// valueBuffers.
+func (repo *{{.Name}}Repository) marshalAppend(buf []byte, entity *pb.{{.Name}}) ([]byte, error) {
+    {{if .PreviousVersions}}buf = appendRecordVersion(buf, {{.Version}})
+    {{end}}{{if .Serializer}}s, err := lookupSerializer("{{.Serializer}}")
+    if err != nil {
+        return nil, err
+    }
+    {{if .PreviousVersions}}data, err := s.Marshal(entity)
+    if err != nil {
+        return nil, err
+    }
+    return append(buf, data...), nil{{else}}return s.Marshal(entity){{end}}{{else if .RecordLayer}}{{if .SkipUnchangedWrites}}// Unchanged records must encode to the stored bytes
+    opts := repo.marshalOpts
+    opts.Deterministic = true
+    return appendUnionRecord(buf, {{.RecordLayer.UnionField}}, opts, entity){{else}}return appendUnionRecord(buf, {{.RecordLayer.UnionField}}, repo.marshalOpts, entity){{end}}{{else}}{{if .SkipUnchangedWrites}}// Unchanged records must encode to the stored bytes
+    opts := repo.marshalOpts
+    opts.Deterministic = true
+    return opts.MarshalAppend(buf, entity){{else}}return repo.marshalOpts.MarshalAppend(buf, entity){{end}}{{end}}
+}
+
+// unmarshal decodes a stored value into entity.{{if .PreviousVersions}} Values of earlier
+// versions are decoded as their type and converted.{{else if .RecordLayer}} Values holding another
+// field of the RecordTypeUnion message, records of other types, are an
+// error.{{end}}
+func (repo *{{.Name}}Repository) unmarshal(value []byte, entity *pb.{{.Name}}) error {
+    {{if .PreviousVersions}}version, value, ok := splitRecordVersion(value)
+    if !ok {
+        // Records written before previous_version was declared
+        version = 1
+    }
+    if version != {{.Version}} {
+        return repo.unmarshalVersion(version, value, entity)
+    }
+    {{end}}{{if .Serializer}}s, err := lookupSerializer("{{.Serializer}}")
+    if err != nil {
+        return err
+    }
+    return s.Unmarshal(value, entity){{else if .RecordLayer}}record, ok, err := unionRecord(value, {{.RecordLayer.UnionField}})
+    if err != nil {
+        return err
+    }
+    if !ok {
+        return errors.New("{{.Name}}: stored record is of another type of the Record Layer store")
+    }
+    return repo.unmarshalOpts.Unmarshal(record, entity){{else}}return repo.unmarshalOpts.Unmarshal(value, entity){{end}}
+}
 
-type {{.Name}}Repository struct {
-    db  fdb.Database
-    dir directory.DirectorySubspace
+// {{.Name}}Key holds the primary key fields of a {{.Name}}.
+type {{.Name}}Key struct {
+    {{range .PrimaryKeyFields}}{{.Name}} {{.Type}}
+    {{end}}
+}
+
+func (k {{.Name}}Key) toTuple() tuple.Tuple {
+    return tuple.Tuple{ {{range .PrimaryKeyFields}} {{toTuple (printf "k.%s" .Name) .}}, {{end}} }
 }
 
-func New{{.Name}}Repository(db fdb.Database) (*{{.Name}}Repository, error) {
-    dir, err := directory.CreateOrOpen(db, []string{"{{.Name}}"}, nil)
+// RenameKey moves the record stored under oldKey to newKey in tr, rewriting
+// its index entries and moving its counters, element sets and touch times{{if .FieldMerge}}
+// and its field clocks{{end}}.
+// The change log, if any, records the deletion of the old key and the
+// creation of the new one. It fails with Err{{.Name}}NotFound if no record is
+// stored under oldKey and with Err{{.Name}}AlreadyExists if one is stored
+// under newKey.
+func (repo *{{.Name}}Repository) RenameKey(ctx context.Context, tr fdb.Transaction, oldKey, newKey {{.Name}}Key) error {
+    if {{if or .HasBytesFields .HasTimestampKeys}}bytes.Equal(oldKey.toTuple().Pack(), newKey.toTuple().Pack()){{else}}oldKey == newKey{{end}} {
+        return nil
+    }
+    entity, err := repo.Get(ctx, tr, {{range $index, $element := .PrimaryKeyFields}}{{if $index}}, {{end}}oldKey.{{.Name}}{{end}})
     if err != nil {
-        return nil, err
+        return err
+    }
+    exists, err := repo.Exists(ctx, tr, {{range $index, $element := .PrimaryKeyFields}}{{if $index}}, {{end}}newKey.{{.Name}}{{end}})
+    if err != nil {
+        return err
+    }
+    if exists {
+        return Err{{.Name}}AlreadyExists
+    }
+    {{if .FieldMerge}}clocks, err := tr.Get(MetaSubspace(repo.dir, FieldClocksSubspace).Pack(oldKey.toTuple())).Get()
+    if err != nil {
+        return err
+    }
+    {{end}}if err := repo.Delete(ctx, tr, {{range $index, $element := .PrimaryKeyFields}}{{if $index}}, {{end}}oldKey.{{.Name}}{{end}}); err != nil {
+        return err
     }
-    return &{{.Name}}Repository{db: db, dir: dir}, nil
+    {{range .PrimaryKeyFields}}{{setField "entity" (printf "newKey.%s" .Name) .}}
+    {{end}}if err := repo.set(ctx, tr, entity, false); err != nil {
+        return err
+    }
+    {{if .FieldMerge}}if clocks != nil {
+        tr.Set(MetaSubspace(repo.dir, FieldClocksSubspace).Pack(newKey.toTuple()), clocks)
+    }
+    {{end}}return nil
 }
 
-func (repo *{{.Name}}Repository) Get(ctx context.Context, tr fdb.ReadTransaction, {{range $index, $element := .PrimaryKeyFields}}{{if $index}}, {{end}}{{.Name}} {{.Type}}{{end}}) (*pb.{{.Name}}, error) {
-    var entity *pb.{{.Name}}
+// Copy writes the record with the given primary key to dst, a repository of
+// another directory such as one opened with another prefix for tenant
+// cloning, deriving its index entries there. Both are accessed through tr. A
+// record stored under the key in dst is replaced. Copy fails with
+// Err{{.Name}}NotFound if repo holds no such record.
+func (repo *{{.Name}}Repository) Copy(ctx context.Context, tr fdb.Transaction, dst *{{.Name}}Repository, {{range $index, $element := .PrimaryKeyFields}}{{if $index}}, {{end}}{{.Name}} {{.Type}}{{end}}) error {
+    entity, err := repo.Get(ctx, tr, {{range $index, $element := .PrimaryKeyFields}}{{if $index}}, {{end}}{{.Name}}{{end}})
+    if err != nil {
+        return err
+    }
+    return dst.set(ctx, tr, entity, false)
+}
 
-    key := repo.dir.Pack(tuple.Tuple{ {{range .PrimaryKeyFields}} {{.Name}}, {{end}} })
-    value := tr.Get(key).MustGet()
-    if value == nil {
-        return nil, fmt.Errorf("{{.Name}} not found")
+// ListKeys returns the primary keys of stored {{.Name}} records in key order,
+// or descending with opts.Reverse, without unmarshaling any values.
+// opts.Limit counts records, not raw keys.
+func (repo *{{.Name}}Repository) ListKeys(ctx context.Context, tr fdb.ReadTransaction, opts QueryOptions) ([]{{.Name}}Key, error) {
+    keys := []{{.Name}}Key{}
+
+    rangeOpts := opts.rangeOptions()
+    rangeOpts.Limit = 0
+    it := repo.iterateRecords(tr, nil, nil, rangeOpts)
+    limit := opts.Limit
+    for (limit == 0 || len(keys) < limit) && it.Advance() {
+        if err := ctx.Err(); err != nil {
+            return nil, err
+        }
+        kv, err := it.Get()
+        if err != nil {
+            return nil, err
+        }
+        key, ok, err := repo.unpackKey(kv.Key)
+        if err != nil {
+            return nil, err
+        }
+        if !ok {
+            // Not a record of this message
+            continue
+        }
+        keys = append(keys, key)
     }
-    entity = &pb.{{.Name}}{}
-    err := proto.Unmarshal(value, entity)
+    return keys, nil
+}
+
+// Count returns the number of {{.Name}} records, reading keys and values but
+// decoding no record. It reads the whole directory in tr, so large message
+// types should rather be sized with EstimatedSizeBytes.
+func (repo *{{.Name}}Repository) Count(ctx context.Context, tr fdb.ReadTransaction) (int, error) {
+    count := 0
+    it := tr.GetRange(RecordRange(repo.recordSubspace()), fdb.RangeOptions{Mode: fdb.StreamingModeWantAll}).Iterator()
+    for it.Advance() {
+        if err := ctx.Err(); err != nil {
+            return 0, err
+        }
+        kv, err := it.Get()
+        if err != nil {
+            return 0, err
+        }
+        if _, ok, err := repo.unpackKey(kv.Key); err != nil {
+            return 0, err
+        } else if ok {
+            count++
+        }
+    }
+    return count, nil
+}
+
+{{if .Buckets}}// {{lowerFirst .Name}}Buckets is the number of buckets the records of {{.Name}}
+// are spread over, set by its buckets option.
+const {{lowerFirst .Name}}Buckets = {{.Buckets}}
+
+{{end}}// recordSubspace returns the subspace holding the records{{if .RecordLayer}}, that of the
+// Record Layer store in the directory{{else}}, the directory
+// itself{{end}}.
+func (repo *{{.Name}}Repository) recordSubspace() subspace.Subspace {
+    {{if .RecordLayer}}return repo.dir.Sub(recordLayerRecords){{else}}return repo.dir{{end}}
+}
+
+// indexSubspace returns the subspace holding the entries of the named index{{if .RecordLayer}},
+// in the index subspace of the Record Layer store{{end}}.
+func (repo *{{.Name}}Repository) indexSubspace(name string) subspace.Subspace {
+    {{if .RecordLayer}}return repo.dir.Sub(recordLayerIndexes, name){{else}}return MetaSubspace(repo.dir, name){{end}}
+}
+
+// recordKey returns the key of the record with primary key pk{{if .Buckets}}, in
+// the bucket recordBucket assigns it{{else if .RecordLayer}}, followed by
+// the suffix of records stored in a single key{{end}}.
+func (repo *{{.Name}}Repository) recordKey(pk tuple.Tuple) fdb.Key {
+    {{if .Buckets}}return repo.dir.Pack(append(tuple.Tuple{recordBucket(pk, {{lowerFirst .Name}}Buckets)}, pk...)){{else if .RecordLayer}}return repo.recordSubspace().Pack(append(append(tuple.Tuple{}, pk...), recordLayerUnsplitRecord)){{else}}return repo.dir.Pack(pk){{end}}
+}
+
+// recordPK returns the primary key tuple of a record key{{if .Buckets}}, without its
+// bucket{{else if .RecordLayer}}, without its
+// suffix. It returns nil for the other keys of a record, such as the split
+// parts and the version the Record Layer can store beside it{{end}}.
+func (repo *{{.Name}}Repository) recordPK(k fdb.Key) (tuple.Tuple, error) {
+    {{if .Buckets}}tpl, err := repo.dir.Unpack(k)
     if err != nil {
         return nil, err
     }
-    return entity, nil
+    if len(tpl) == 0 {
+        return tpl, nil
+    }
+    if _, ok := tpl[0].(int64); !ok {
+        // Auxiliary data, starting with nil, which is no primary key
+        return tpl, nil
+    }
+    return tpl[1:], nil{{else if .RecordLayer}}tpl, err := repo.recordSubspace().Unpack(k)
+    if err != nil {
+        return nil, err
+    }
+    if len(tpl) == 0 || tpl[len(tpl)-1] != recordLayerUnsplitRecord {
+        return nil, nil
+    }
+    return tpl[:len(tpl)-1], nil{{else}}return repo.dir.Unpack(k){{end}}
 }
 
-func (repo *{{.Name}}Repository) Set(ctx context.Context, tr fdb.Transaction, entity *pb.{{.Name}}) error {
-    key := repo.dir.Pack(tuple.Tuple{ {{range .PrimaryKeyFields}} entity.{{.Name}}, {{end}} })
-    value, err := proto.Marshal(entity)
+// iterateRecords reads the records whose primary key starts with prefix, and
+// comes after after if it is not nil, in primary key order, descending with
+// opts.Reverse.{{if .Buckets}} It merges the reads of every bucket, whose
+// records are each in primary key order.{{end}}
+func (repo *{{.Name}}Repository) iterateRecords(tr fdb.ReadTransaction, prefix, after tuple.Tuple, opts fdb.RangeOptions) keyValueIterator {
+    {{if .Buckets}}its := make([]*fdb.RangeIterator, {{lowerFirst .Name}}Buckets)
+    for i := range its {
+        r := recordRange(repo.dir.Sub(int64(i)), prefix, after, opts.Reverse)
+        its[i] = tr.GetRange(r, opts).Iterator()
+    }
+    return newBucketIterator(its, repo.recordPK, opts.Reverse){{else}}return tr.GetRange(recordRange(repo.recordSubspace(), prefix, after, opts.Reverse), opts).Iterator(){{end}}
+}
+
+// unpackKey decodes a record key. It reports false for keys that are not
+// records, such as auxiliary data.
+func (repo *{{.Name}}Repository) unpackKey(k fdb.Key) ({{.Name}}Key, bool, error) {
+    tpl, err := repo.recordPK(k)
     if err != nil {
-        return err
+        return {{.Name}}Key{}, false, err
     }
-    tr.Set(key, value)
+    key, ok := {{lowerFirst .Name}}KeyFromTuple(tpl)
+    return key, ok, nil
+}
 
-    // Handle secondary indexes
-    {{range $idxIndex, $idx := .SecondaryIndexes}}
-    indexKey := repo.dir.Sub("{{joinFieldNames $idx.Fields}}_index").Pack(tuple.Tuple{
-        {{range $i, $f := $idx.Fields}} entity.{{ $f.Name }}, {{end}}
-        {{range $.PrimaryKeyFields}} entity.{{.Name}}, {{end}}
-    })
-    tr.Set(indexKey, []byte{})
+// {{lowerFirst .Name}}KeyFromTuple converts a primary key tuple. It reports
+// false if tpl is not a {{.Name}} primary key.
+func {{lowerFirst .Name}}KeyFromTuple(tpl tuple.Tuple) ({{.Name}}Key, bool) {
+    var key {{.Name}}Key
+    if len(tpl) != {{len .PrimaryKeyFields}} {
+        return key, false
+    }
+    {{range $i, $f := .PrimaryKeyFields}}
+    if v, ok := {{assertTuple (printf "tpl[%d]" $i) $f}}; ok {
+        key.{{$f.Name}} = {{fromTuple "v" $f}}
+    } else {
+        return key, false
+    }
     {{end}}
+    return key, true
+}
 
-    return nil
+{{/* Generate projection structs */}}
+{{range $proj := .Projections}}
+// {{$.Name}}{{$proj.Name}} is the "{{$proj.Name}}" projection of {{$.Name}}.
+type {{$.Name}}{{$proj.Name}} struct {
+    {{range $proj.Fields}}{{.Name}} {{.Type}}
+    {{end}}
 }
 
-func (repo *{{.Name}}Repository) Delete(ctx context.Context, tr fdb.Transaction, {{range $index, $element := .PrimaryKeyFields}}{{if $index}}, {{end}}{{.Name}} {{.Type}}{{end}}) error {
-    key := repo.dir.Pack(tuple.Tuple{ {{range .PrimaryKeyFields}} {{.Name}}, {{end}} })
-    value := tr.Get(key).MustGet()
-    if value != nil {
-        entity := &pb.{{.Name}}{}
-        err := proto.Unmarshal(value, entity)
-        if err == nil {
-            // Handle index cleanup
-            {{range $idxIndex, $idx := .SecondaryIndexes}}
-            indexKey := repo.dir.Sub("{{joinFieldNames $idx.Fields}}_index").Pack(tuple.Tuple{
-                {{range $i, $f := $idx.Fields}} entity.{{ $f.Name }}, {{end}}
-                {{range $.PrimaryKeyFields}} entity.{{.Name}}, {{end}}
-            })
-            tr.Clear(indexKey)
-            {{end}}
+// New{{$.Name}}{{$proj.Name}} copies the projected fields out of entity.
+func New{{$.Name}}{{$proj.Name}}(entity *pb.{{$.Name}}) *{{$.Name}}{{$proj.Name}} {
+    return &{{$.Name}}{{$proj.Name}}{
+        {{range $proj.Fields}}{{.Name}}: entity.{{.Name}},
+        {{end}}
+    }
+}
+
+// ToProto returns a {{$.Name}} with only the projected fields populated.
+func (p *{{$.Name}}{{$proj.Name}}) ToProto() *pb.{{$.Name}} {
+    return &pb.{{$.Name}}{
+        {{range $proj.Fields}}{{.Name}}: p.{{.Name}},
+        {{end}}
+    }
+}
+
+// Pack encodes the projection as a tuple, which is far cheaper to store and
+// decode than the full marshaled record.
+func (p *{{$.Name}}{{$proj.Name}}) Pack() []byte {
+    return tuple.Tuple{ {{range $proj.Fields}} {{toTuple (printf "p.%s" .Name) .}}, {{end}} }.Pack()
+}
+
+// Unpack{{$.Name}}{{$proj.Name}} decodes a projection encoded with Pack.
+func Unpack{{$.Name}}{{$proj.Name}}(b []byte) (*{{$.Name}}{{$proj.Name}}, error) {
+    tpl, err := tuple.Unpack(b)
+    if err != nil {
+        return nil, err
+    }
+    if len(tpl) != {{len $proj.Fields}} {
+        return nil, fmt.Errorf("{{$.Name}}{{$proj.Name}}: expected {{len $proj.Fields}} elements, got %d", len(tpl))
+    }
+    p := &{{$.Name}}{{$proj.Name}}{}
+    {{range $i, $f := $proj.Fields}}
+    if v, ok := {{assertTuple (printf "tpl[%d]" $i) $f}}; ok {
+        p.{{$f.Name}} = {{fromTuple "v" $f}}
+    } else {
+        return nil, fmt.Errorf("{{$.Name}}{{$proj.Name}}: unexpected type %T for {{$f.Name}}", tpl[{{$i}}])
+    }
+    {{end}}
+    return p, nil
+}
+{{end}}
+
+{{if .Generates "batch"}}{{template "batch" .}}{{end}}
+
+{{if .Generates "writer"}}{{template "writer" .}}{{end}}
+
+{{template "stores" .}}
+
+{{template "descriptor" .}}
+
+{{template "jsonMessage" .}}
+
+{{template "changes" .}}
+
+{{template "replica" .}}
+
+{{template "search" .}}
+
+{{template "archive" .}}
+
+{{template "blobRef" .}}
+
+{{template "stringKey" .}}
+
+{{template "webhook" .}}
+
+{{template "merge" .}}
+
+{{template "versions" .}}
+
+{{template "crdt" .}}
+
+{{if .ETag}}{{template "etag" .}}{{end}}
+
+{{if or .ChangeLog (.Generates "watch")}}{{template "watchEvent" .}}{{end}}
+{{if .Generates "watch"}}{{template "watch" .}}{{end}}
+
+{{if and (feature "cache") (.Generates "cache")}}{{template "cache" .}}{{end}}
+
+{{template "staged" .}}
+
+{{if .Generates "intent"}}{{template "intent" .}}{{end}}
+
+{{template "list" .}}
+{{template "multiGet" .}}
+{{end}}
+
+{{define "messageIndexes"}}
+// indexKeys returns the secondary index entries of entity{{if .HasGlobalIndexes}}, followed by
+// those of its global indexes{{end}}.
+func (repo *{{.Name}}Repository) indexKeys(entity *pb.{{.Name}}) []fdb.Key {
+    return []fdb.Key{
+        {{range $idx := .SecondaryIndexes}}repo.indexSubspace("{{$idx.Name}}_index").Pack(tuple.Tuple{
+            {{range $idx.Fields}} {{toTuple (printf "entity.%s" .Path) .}}, {{end}}
+            {{range $.PrimaryKeyFields}} {{toTuple (printf "entity.%s" .Path) .}}, {{end}}
+        }),
+        {{end}}{{range $idx := .SecondaryIndexes}}{{if $idx.Global}}repo.global.Pack(tuple.Tuple{
+            "{{$idx.Name}}_index",
+            {{range $idx.Fields}} {{toTuple (printf "entity.%s" .Path) .}}, {{end}}
+            repo.tenant,
+            {{range $.PrimaryKeyFields}} {{toTuple (printf "entity.%s" .Path) .}}, {{end}}
+        }),
+        {{end}}{{end}}
+    }
+}
+
+{{if .ElementIndexes}}
+// elementKeys returns the entries of entity in the indexes of repeated
+// fields and map keys, one per distinct element or key.
+func (repo *{{.Name}}Repository) elementKeys(entity *pb.{{.Name}}) []fdb.Key {
+    keys := []fdb.Key{}
+    {{range $ei := .ElementIndexes}}{{if $ei.Keys}}for key := range entity.{{$ei.Field.Name}} {
+        keys = append(keys, repo.indexSubspace("{{$ei.Name}}_index").Pack(tuple.Tuple{
+            {{toTuple "key" $ei.Element}},
+            {{range $.PrimaryKeyFields}} {{toTuple (printf "entity.%s" .Path) .}}, {{end}}
+        }))
+    }
+    {{else}}{{$seen := "element"}}{{if $ei.Element.Bytes}}{{$seen = "string(element)"}}{{end}}seen{{$ei.Name}} := map[{{if $ei.Element.Bytes}}string{{else}}{{$ei.Element.Type}}{{end}}]bool{}
+    for _, element := range entity.{{$ei.Field.Name}} {
+        if seen{{$ei.Name}}[{{$seen}}] {
+            continue
+        }
+        seen{{$ei.Name}}[{{$seen}}] = true
+        keys = append(keys, repo.indexSubspace("{{$ei.Name}}_index").Pack(tuple.Tuple{
+            {{toTuple "element" $ei.Element}},
+            {{range $.PrimaryKeyFields}} {{toTuple (printf "entity.%s" .Path) .}}, {{end}}
+        }))
+    }
+    {{end}}{{end}}
+    return keys
+}
+
+// setElementKeys writes the entries of entity in the indexes of repeated
+// fields and map keys and clears those of previous, the stored version, that
+// no longer apply.
+func (repo *{{.Name}}Repository) setElementKeys(ctx context.Context, tr fdb.Transaction, entity *pb.{{.Name}}, previous []byte) error {
+    stats := txStatsFrom(ctx)
+    current := map[string]bool{}
+    for _, elementKey := range repo.elementKeys(entity) {
+        current[string(elementKey)] = true
+        tr.Set(elementKey, []byte{})
+        stats.write(len(elementKey))
+    }
+    if previous == nil {
+        return nil
+    }
+    old := &pb.{{.Name}}{}
+    if err := repo.unmarshal(previous, old); err != nil {
+        return err
+    }
+    for _, elementKey := range repo.elementKeys(old) {
+        if !current[string(elementKey)] {
+            tr.Clear(elementKey)
+            stats.write(len(elementKey))
         }
     }
-    tr.Clear(key)
     return nil
 }
+{{end}}
+{{if .HasCoveringIndexes}}
+// {{lowerFirst .Name}}CoveringIndexes tells, by position in indexKeys, the
+// indexes whose entries hold a copy of the record.
+var {{lowerFirst .Name}}CoveringIndexes = []bool{ {{range $idx := .SecondaryIndexes}}{{$idx.Covering}}, {{end}} }
+{{end}}
+// indexValue returns the value of the entry of the index at position in
+// indexKeys for a record stored as record.
+func (repo *{{.Name}}Repository) indexValue(position int, record []byte) []byte {
+    {{if .HasCoveringIndexes}}if position < len({{lowerFirst .Name}}CoveringIndexes) && {{lowerFirst .Name}}CoveringIndexes[position] {
+        return record
+    }
+    {{end}}return []byte{}
+}
 
-{{/* Generate GetBy methods for secondary indexes */}}
-{{range $idxIndex, $idx := .SecondaryIndexes}}
-func (repo *{{$.Name}}Repository) GetBy{{joinFieldNames $idx.Fields}}(ctx context.Context, tr fdb.ReadTransaction, {{range $i, $f := $idx.Fields}}{{if $i}}, {{end}}{{$f.Name}} {{$f.Type}}{{end}}) ([]*pb.{{$.Name}}, error) {
-    entities := []*pb.{{$.Name}}{}
+{{if .HasUniqueIndexes}}
+// checkUnique returns a *UniqueViolationError if another record owns the
+// entry of a unique index that entity would get. The entries are read in tr,
+// so concurrent writes of the same values conflict.
+func (repo *{{.Name}}Repository) checkUnique(tr fdb.Transaction, entity *pb.{{.Name}}) error {
+    indexKeys := repo.indexKeys(entity)
+    {{range $i, $idx := .SecondaryIndexes}}{{if $idx.Unique}}if err := repo.checkUniqueEntry(tr, "{{$idx.Name}}_index", {{$i}}, {{len $idx.Fields}}, indexKeys[{{$i}}]); err != nil {
+        return err
+    }
+    {{end}}{{end}}
+    return nil
+}
 
-    indexKeyPrefix := repo.dir.Sub("{{joinFieldNames $idx.Fields}}_index").Pack(tuple.Tuple{ {{range $i, $f := $idx.Fields}} {{$f.Name}}, {{end}} })
-    indexRange, err := fdb.PrefixRange(indexKeyPrefix)
-	if err != nil {
-		return nil, err
-	}
-    kvs := tr.GetRange(indexRange, fdb.RangeOptions{}).GetSliceOrPanic()
+// checkUniqueEntry checks the entry indexKey of the index at position in
+// indexKeys, whose first fieldCount elements are the index fields.
+func (repo *{{.Name}}Repository) checkUniqueEntry(tr fdb.Transaction, index string, position, fieldCount int, indexKey fdb.Key) error {
+    sub := repo.indexSubspace(index)
+    tpl, err := sub.Unpack(indexKey)
+    if err != nil {
+        return err
+    }
+    r, err := fdb.PrefixRange(sub.Pack(tpl[:fieldCount]))
+    if err != nil {
+        return err
+    }
+    kvs, err := tr.GetRange(r, fdb.RangeOptions{}).GetSliceWithError()
+    if err != nil {
+        return err
+    }
     for _, kv := range kvs {
-        tpl, err := repo.dir.Sub("{{joinFieldNames $idx.Fields}}_index").Unpack(kv.Key)
+        if bytes.Equal(kv.Key, indexKey) {
+            continue
+        }
+        entry, err := sub.Unpack(kv.Key)
+        if err != nil {
+            return err
+        }
+        value, err := tr.Get(repo.recordKey(entry[fieldCount:])).Get()
+        if err != nil {
+            return err
+        }
+        if value == nil {
+            continue
+        }
+        owner := &pb.{{.Name}}{}
+        if err := repo.unmarshal(value, owner); err != nil {
+            return err
+        }
+        // Entries left behind by an earlier version of a record do not count
+        if bytes.Equal(repo.indexKeys(owner)[position], kv.Key) {
+            return &UniqueViolationError{MessageType: "{{.Name}}", Index: index, Values: tpl[:fieldCount], Owner: entry[fieldCount:]}
+        }
+    }
+    return nil
+}
+{{end}}
+{{if or .SecondaryIndexes .ElementIndexes}}
+// getByIndex returns the records whose entries in the index subspace, the
+// one at position in indexKeys with fieldCount fields, start with values.
+// The indexes of map keys follow the secondary indexes.
+func (repo *{{.Name}}Repository) getByIndex(ctx context.Context, tr fdb.ReadTransaction, operation, index string, position, fieldCount int, values tuple.Tuple, opts []QueryOptions) ([]*pb.{{.Name}}, error) {
+    indexRange, err := fdb.PrefixRange(repo.indexSubspace(index).Pack(values))
+    if err != nil {
+        return nil, err
+    }
+    entities, _, err := repo.getByIndexRange(ctx, tr, operation, index, position, fieldCount, indexRange, lastQueryOptions(opts))
+    return entities, err
+}
+
+// keysByIndex returns the primary keys of the entries in the index subspace,
+// with fieldCount fields, that start with values, without reading records.
+func (repo *{{.Name}}Repository) keysByIndex(ctx context.Context, tr fdb.ReadTransaction, index string, fieldCount int, values tuple.Tuple, opts []QueryOptions) ([]{{.Name}}Key, error) {
+    {{if .RecordLayer}}if err := checkIndexReadable(tr, repo.dir, index); err != nil {
+        return nil, fmt.Errorf("{{.Name}}: %w", err)
+    }
+    {{end}}sub := repo.indexSubspace(index)
+    indexRange, err := fdb.PrefixRange(sub.Pack(values))
+    if err != nil {
+        return nil, err
+    }
+    keys := []{{.Name}}Key{}
+    it := tr.GetRange(indexRange, lastQueryOptions(opts).rangeOptions()).Iterator()
+    for it.Advance() {
+        if err := ctx.Err(); err != nil {
+            return nil, err
+        }
+        kv, err := it.Get()
         if err != nil {
             return nil, err
         }
+        txStatsFrom(ctx).read(len(kv.Key))
+        tpl, err := sub.Unpack(kv.Key)
+        if err != nil {
+            return nil, err
+        }
+        if len(tpl) < fieldCount {
+            continue
+        }
+        if key, ok := {{lowerFirst .Name}}KeyFromTuple(tpl[fieldCount:]); ok {
+            keys = append(keys, key)
+        }
+    }
+    return keys, nil
+}
+
+// getByIndexRange returns the records of the entries of the index subspace
+// in indexRange, read with opts. If the read stopped at opts.Limit, so that
+// more entries may follow, it also returns the last entry read.
+func (repo *{{.Name}}Repository) getByIndexRange(ctx context.Context, tr fdb.ReadTransaction, operation, index string, position, fieldCount int, indexRange fdb.Range, opts QueryOptions) ([]*pb.{{.Name}}, fdb.Key, error) {
+    {{if .RecordLayer}}if err := checkIndexReadable(tr, repo.dir, index); err != nil {
+        return nil, nil, fmt.Errorf("{{.Name}}: %w", err)
+    }
+    {{end}}entities := []*pb.{{.Name}}{}
+    op := repo.slowOps.start("{{.Name}}", operation)
+    defer op.finish()
+
+    // Read all records at once rather than one round trip after another
+    var entries, keys []fdb.Key
+    var futures []fdb.FutureByteSlice
+    var last fdb.Key
+    read := 0
+    it := tr.GetRange(indexRange, opts.rangeOptions()).Iterator()
+    for it.Advance() {
+        if err := ctx.Err(); err != nil {
+            return nil, nil, err
+        }
+        kv, err := it.Get()
+        if err != nil {
+            return nil, nil, err
+        }
+        read++
+        last = kv.Key
+        {{if .HasCoveringIndexes}}if position < len({{lowerFirst .Name}}CoveringIndexes) && {{lowerFirst .Name}}CoveringIndexes[position] {
+            // The entry holds a copy of the record
+            op.add(1, len(kv.Value))
+            txStatsFrom(ctx).read(len(kv.Key) + len(kv.Value))
+            entity := &pb.{{.Name}}{}
+            if err := repo.unmarshal(kv.Value, entity); err != nil {
+                return nil, nil, err
+            }
+            if !repo.hasIndexEntry(entity, position, kv.Key) {
+                continue
+            }
+            {{if .CRDTFields}}if err := repo.loadCRDTFields(tr, entity); err != nil {
+                return nil, nil, err
+            }
+            {{end}}entities = append(entities, entity)
+            continue
+        }
+        {{end}}tpl, err := repo.indexSubspace(index).Unpack(kv.Key)
+        if err != nil {
+            return nil, nil, err
+        }
+        if len(tpl) < fieldCount {
+            continue
+        }
         // The primary key fields are after the index fields
-        pkTuple := tpl[{{len $idx.Fields}}:] // Skip the index fields
-        key := repo.dir.Pack(pkTuple)
-        value := tr.Get(key).MustGet()
+        key := repo.recordKey(tpl[fieldCount:])
+        entries = append(entries, kv.Key)
+        keys = append(keys, key)
+        futures = append(futures, tr.Get(key))
+    }
+    for i, future := range futures {
+        if err := ctx.Err(); err != nil {
+            return nil, nil, err
+        }
+        value, err := future.Get()
+        if err != nil {
+            return nil, nil, err
+        }
+        op.add(1, len(value))
+        txStatsFrom(ctx).read(len(entries[i]) + len(keys[i]) + len(value))
         if value == nil {
             continue
         }
-        entity := &pb.{{$.Name}}{}
-        err = proto.Unmarshal(value, entity)
+        entity := &pb.{{.Name}}{}
+        err = repo.unmarshal(value, entity)
         if err != nil {
-            return nil, err
+            return nil, nil, err
+        }
+        if !repo.hasIndexEntry(entity, position, entries[i]) {
+            continue
         }
+        {{if .CRDTFields}}if err := repo.loadCRDTFields(tr, entity); err != nil {
+            return nil, nil, err
+        }
+        {{end}}
         entities = append(entities, entity)
     }
-    return entities, nil
+    if opts.Limit == 0 || read < opts.Limit {
+        return entities, nil, nil
+    }
+    return entities, last, nil
+}
+
+// hasIndexEntry reports whether entry is the entry of entity in the index at
+// position, or one of its entries for an index of a repeated field or of map
+// keys.
+func (repo *{{.Name}}Repository) hasIndexEntry(entity *pb.{{.Name}}, position int, entry fdb.Key) bool {
+    {{if .SecondaryIndexes}}if position < {{len .SecondaryIndexes}} {
+        return bytes.Equal(repo.indexKeys(entity)[position], entry)
+    }
+    {{end}}{{if .ElementIndexes}}for _, elementKey := range repo.elementKeys(entity) {
+        if bytes.Equal(elementKey, entry) {
+            return true
+        }
+    }
+    {{end}}return false
+}
+{{end}}
+{{template "globalIndex" .}}
+{{/* Generate GetBy methods for secondary indexes */}}
+{{range $idxIndex, $idx := .SecondaryIndexes}}
+// GetBy{{$idx.Name}} returns the records whose {{range $i, $f := $idx.Fields}}{{if $i}}, {{end}}{{$f.Name}}{{end}} match the
+// given values. Index entries and records are read through tr, so writes made
+// earlier in the same transaction are visible, including on snapshot reads.
+// A record is only returned if it still matches the values, so entries left
+// behind by an earlier version of the record are ignored. The records are
+// requested as the index entries arrive and awaited afterwards, so their
+// reads overlap instead of taking a round trip each.{{if $idx.Covering}} The index is
+// covering, so the records are read from the entries instead; while SetStaged
+// writes a record, its previous version may be returned.{{end}}
+func (repo *{{$.Name}}Repository) GetBy{{$idx.Name}}(ctx context.Context, tr fdb.ReadTransaction, {{range $i, $f := $idx.Fields}}{{if $i}}, {{end}}{{$f.Name}} {{$f.Type}}{{end}}, opts ...QueryOptions) ([]*pb.{{$.Name}}, error) {
+    return repo.getByIndex(ctx, tr, "GetBy{{$idx.Name}}", "{{$idx.Name}}_index", {{$idxIndex}}, {{len $idx.Fields}}, tuple.Tuple{ {{range $i, $f := $idx.Fields}} {{toTuple $f.Name $f}}, {{end}} }, opts)
+}
+
+// GetBy{{$idx.Name}}Range returns the records whose {{$idx.Last.Name}} is in [from, to){{if $idx.Leading}}
+// and whose {{range $i, $f := $idx.Leading}}{{if $i}}, {{end}}{{$f.Name}}{{end}} match the given values{{end}},
+// ordered by {{$idx.Last.Name}}. It reads like GetBy{{$idx.Name}}, with opts.
+func (repo *{{$.Name}}Repository) GetBy{{$idx.Name}}Range(ctx context.Context, tr fdb.ReadTransaction, {{range $i, $f := $idx.Leading}}{{$f.Name}} {{$f.Type}}, {{end}}from, to {{$idx.Last.Type}}, opts QueryOptions) ([]*pb.{{$.Name}}, error) {
+    sub := repo.indexSubspace("{{$idx.Name}}_index")
+    indexRange := fdb.KeyRange{
+        Begin: sub.Pack(tuple.Tuple{ {{range $i, $f := $idx.Leading}} {{toTuple $f.Name $f}}, {{end}} {{toTuple "from" $idx.Last}} }),
+        End:   sub.Pack(tuple.Tuple{ {{range $i, $f := $idx.Leading}} {{toTuple $f.Name $f}}, {{end}} {{toTuple "to" $idx.Last}} }),
+    }
+    entities, _, err := repo.getByIndexRange(ctx, tr, "GetBy{{$idx.Name}}Range", "{{$idx.Name}}_index", {{$idxIndex}}, {{len $idx.Fields}}, indexRange, opts)
+    return entities, err
+}
+
+// GetBy{{$idx.Name}}Page returns a page of the records GetBy{{$idx.Name}}
+// returns, in index order, and a cursor to pass as opts.After to read the next
+// page, possibly in another transaction, so that scans can outlast the
+// transaction time limit.
+// The cursor is nil after the last page. opts.Limit counts index entries, so
+// pages can be shorter than the limit before the last one.
+func (repo *{{$.Name}}Repository) GetBy{{$idx.Name}}Page(ctx context.Context, tr fdb.ReadTransaction, {{range $i, $f := $idx.Fields}}{{$f.Name}} {{$f.Type}}, {{end}}opts ListOptions) ([]*pb.{{$.Name}}, Cursor, error) {
+    sub := repo.indexSubspace("{{$idx.Name}}_index")
+    indexRange, err := fdb.PrefixRange(sub.Pack(tuple.Tuple{ {{range $i, $f := $idx.Fields}} {{toTuple $f.Name $f}}, {{end}} }))
+    if err != nil {
+        return nil, nil, err
+    }
+    if opts.After != nil {
+        entry, err := tuple.Unpack(opts.After)
+        if err != nil {
+            return nil, nil, fmt.Errorf("{{$.Name}}: invalid cursor: %w", err)
+        }
+        after := sub.Pack(entry)
+        if bytes.Compare(after, indexRange.Begin.FDBKey()) < 0 || bytes.Compare(after, indexRange.End.FDBKey()) >= 0 {
+            return nil, nil, errors.New("{{$.Name}}: cursor of another query")
+        }
+        if opts.Reverse {
+            indexRange.End = after
+        } else {
+            indexRange.Begin = append(after, 0x00)
+        }
+    }
+    entities, last, err := repo.getByIndexRange(ctx, tr, "GetBy{{$idx.Name}}Page", "{{$idx.Name}}_index", {{$idxIndex}}, {{len $idx.Fields}}, indexRange, QueryOptions{Limit: opts.Limit, Reverse: opts.Reverse, Mode: opts.Mode})
+    if err != nil || last == nil {
+        return entities, nil, err
+    }
+    entry, err := sub.Unpack(last)
+    if err != nil {
+        return nil, nil, err
+    }
+    return entities, Cursor(entry.Pack()), nil
+}
+
+// GetKeysBy{{$idx.Name}} returns the primary keys of the records whose {{range $i, $f := $idx.Fields}}{{if $i}}, {{end}}{{$f.Name}}{{end}}
+// match the given values, in index order, reading index entries only. Unlike
+// GetBy{{$idx.Name}} it cannot skip entries left behind by an earlier version of a
+// record, which MultiGet and the record's fields can rule out if needed.
+func (repo *{{$.Name}}Repository) GetKeysBy{{$idx.Name}}(ctx context.Context, tr fdb.ReadTransaction, {{range $i, $f := $idx.Fields}}{{if $i}}, {{end}}{{$f.Name}} {{$f.Type}}{{end}}, opts ...QueryOptions) ([]{{$.Name}}Key, error) {
+    return repo.keysByIndex(ctx, tr, "{{$idx.Name}}_index", {{len $idx.Fields}}, tuple.Tuple{ {{range $i, $f := $idx.Fields}} {{toTuple $f.Name $f}}, {{end}} }, opts)
+}
+
+// DeleteBy{{$idx.Name}} deletes the records matching the given {{$idx.Name}} index
+// values, with all of their index entries, and returns how many were deleted.
+func (repo *{{$.Name}}Repository) DeleteBy{{$idx.Name}}(ctx context.Context, tr fdb.Transaction, {{range $i, $f := $idx.Fields}}{{if $i}}, {{end}}{{$f.Name}} {{$f.Type}}{{end}}) (int, error) {
+    entities, err := repo.GetBy{{$idx.Name}}(ctx, tr, {{range $i, $f := $idx.Fields}}{{if $i}}, {{end}}{{$f.Name}}{{end}})
+    if err != nil {
+        return 0, err
+    }
+    for _, entity := range entities {
+        if err := repo.Delete(ctx, tr, {{range $i, $f := $.PrimaryKeyFields}}{{if $i}}, {{end}}entity.{{$f.Path}}{{end}}); err != nil {
+            return 0, err
+        }
+    }
+    return len(entities), nil
+}
+
+// CountBy{{$idx.Name}} returns the number of {{$idx.Name}} index entries with the
+// given values, without reading the records. While SetStaged calls are in
+// progress the entries may lag behind the records, so the count can differ
+// from the length of GetBy{{$idx.Name}}.
+func (repo *{{$.Name}}Repository) CountBy{{$idx.Name}}(ctx context.Context, tr fdb.ReadTransaction, {{range $i, $f := $idx.Fields}}{{if $i}}, {{end}}{{$f.Name}} {{$f.Type}}{{end}}) (int, error) {
+    {{if $.RecordLayer}}if err := checkIndexReadable(tr, repo.dir, "{{$idx.Name}}_index"); err != nil {
+        return 0, fmt.Errorf("{{$.Name}}: %w", err)
+    }
+    {{end}}indexRange, err := fdb.PrefixRange(repo.indexSubspace("{{$idx.Name}}_index").Pack(tuple.Tuple{ {{range $i, $f := $idx.Fields}} {{toTuple $f.Name $f}}, {{end}} }))
+    if err != nil {
+        return 0, err
+    }
+    count := 0
+    it := tr.GetRange(indexRange, fdb.RangeOptions{Mode: fdb.StreamingModeWantAll}).Iterator()
+    for it.Advance() {
+        if err := ctx.Err(); err != nil {
+            return 0, err
+        }
+        if _, err := it.Get(); err != nil {
+            return 0, err
+        }
+        count++
+    }
+    return count, nil
+}
+{{end}}
+
+{{range $prefix := .IndexPrefixes}}
+// GetBy{{$prefix.Name}} returns the records whose {{range $i, $f := $prefix.Fields}}{{if $i}}, {{end}}{{$f.Name}}{{end}} match the
+// given values, using the leading fields of the {{$prefix.Index.Name}} index. It reads like
+// GetBy{{$prefix.Index.Name}}.
+func (repo *{{$.Name}}Repository) GetBy{{$prefix.Name}}(ctx context.Context, tr fdb.ReadTransaction, {{range $i, $f := $prefix.Fields}}{{if $i}}, {{end}}{{$f.Name}} {{$f.Type}}{{end}}, opts ...QueryOptions) ([]*pb.{{$.Name}}, error) {
+    return repo.getByIndex(ctx, tr, "GetBy{{$prefix.Name}}", "{{$prefix.Index.Name}}_index", {{$prefix.Position}}, {{len $prefix.Index.Fields}}, tuple.Tuple{ {{range $i, $f := $prefix.Fields}} {{toTuple $f.Name $f}}, {{end}} }, opts)
+}
+{{end}}
+{{range $ei := .ElementIndexes}}
+// GetBy{{$ei.Name}} returns the records whose {{$ei.Field.Name}} {{if $ei.Keys}}map has the key key{{else}}contain element{{end}},
+// reading them like the GetBy methods of secondary indexes.
+func (repo *{{$.Name}}Repository) GetBy{{$ei.Name}}(ctx context.Context, tr fdb.ReadTransaction, {{$ei.Param}} {{$ei.Element.Type}}, opts ...QueryOptions) ([]*pb.{{$.Name}}, error) {
+    return repo.getByIndex(ctx, tr, "GetBy{{$ei.Name}}", "{{$ei.Name}}_index", {{$ei.Position}}, 1, tuple.Tuple{ {{toTuple $ei.Param $ei.Element}} }, opts)
 }
 {{end}}
+{{end}}
+
+{{define "messageQuery"}}{{if .Generates "query"}}{{template "query" .}}{{end}}{{end}}
+
+{{define "messageAdmin"}}
+{{if .Generates "import"}}{{template "import" .}}{{end}}
+{{if .Generates "maintenance"}}{{template "maintenance" .}}{{end}}
+{{if .Generates "export"}}{{template "export" .}}{{end}}
+{{end}}
+
+{{template "header" .}}
+{{template "messageStore" .}}
+{{template "messageIndexes" .}}
+{{template "messageQuery" .}}
+{{template "messageAdmin" .}}
 `
@@ -0,0 +1,361 @@
+package main
+
+const maintenanceTemplate = `{{define "maintenance"}}// DryRun returns a copy of repo in dry-run mode. Maintenance operations
+// (Purge, RebuildIndexes) run on it only compute and report the changes they
+// would make in their Plan, without writing anything.
+func (repo *{{.Name}}Repository) DryRun() *{{.Name}}Repository {
+    dryRun := *repo
+    dryRun.dryRun = true
+    return &dryRun
+}
+
+// Purge deletes every {{.Name}} record and index entry, keeping the directory
+// itself. The whole directory is cleared in one transaction without being
+// read, so Records and KeysCleared are only counted in dry-run mode.
+// progress may be nil.{{if .RecordLayer}}
+//
+// The header of the Record Layer store is written back, so that Record
+// Layer services still open it.{{end}}
+func (repo *{{.Name}}Repository) Purge(ctx context.Context, progress ProgressReporter) (Plan, error) {
+    plan := Plan{Operation: "{{.Name}}.Purge", DryRun: repo.dryRun}
+    begin, end := repo.dir.FDBRangeKeys()
+    plan.Ranges = []fdb.KeyRange{ {Begin: begin, End: end} }
+
+    estimate, err := repo.estimateBytes(repo.dir)
+    if err != nil {
+        return plan, err
+    }
+    plan.EstimatedBytes = estimate
+    tracker := newProgressTracker(progress, plan.Operation, estimate)
+
+    if repo.dryRun {
+        run := &jobRun{plan: &plan, tracker: tracker}
+        err := repo.scanRange(ctx, repo.dir, 0, run, func(tr fdb.Transaction, kvs []fdb.KeyValue, delta *Plan) error {
+            for _, kv := range kvs {
+                _, ok, err := repo.unpackKey(kv.Key)
+                if err != nil {
+                    return err
+                }
+                if ok {
+                    delta.Records++
+                }
+                delta.KeysCleared++
+            }
+            return nil
+        })
+        return plan, err
+    }
+
+    _, err = transactContext(ctx, repo.db, func(tr fdb.Transaction) (interface{}, error) {
+        {{if .RecordLayer}}// The index states are cleared too, which leaves every index of the
+        // empty store readable
+        headerKey := repo.dir.Pack(tuple.Tuple{recordLayerStoreInfo})
+        header, err := tr.Get(headerKey).Get()
+        if err != nil {
+            return nil, err
+        }
+        tr.ClearRange(repo.dir)
+        if header != nil {
+            tr.Set(headerKey, header)
+        }{{else}}tr.ClearRange(repo.dir){{end}}
+        return nil, nil
+    })
+    if err != nil {
+        return plan, err
+    }
+    tracker.report(0, end.FDBKey(), estimate)
+    return plan, nil
+}
+
+// RebuildIndexes backfills missing secondary index entries from the stored
+// records and clears entries whose record is gone or no longer matches. It
+// runs across many transactions, so concurrent writers may observe a
+// partially rebuilt index. Progress is checkpointed under the
+// JobRebuildIndexes name and an interrupted rebuild resumes where it stopped.
+// progress may be nil.
+func (repo *{{.Name}}Repository) RebuildIndexes(ctx context.Context, progress ProgressReporter) (Plan, error) {
+    plan := Plan{Operation: "{{.Name}}.RebuildIndexes", DryRun: repo.dryRun}
+
+    indexes := []subspace.Subspace{
+        {{range $idx := .SecondaryIndexes}}repo.indexSubspace("{{$idx.Name}}_index"),
+        {{end}}{{range $ei := .ElementIndexes}}repo.indexSubspace("{{$ei.Name}}_index"),
+        {{end}}
+    }
+    indexFieldCounts := []int{ {{range $idx := .SecondaryIndexes}}{{len $idx.Fields}}, {{end}}{{range .ElementIndexes}}1, {{end}} }
+    ranges := make([]fdb.ExactRange, len(indexes))
+    for i, index := range indexes {
+        begin, end := index.FDBRangeKeys()
+        plan.Ranges = append(plan.Ranges, fdb.KeyRange{Begin: begin, End: end})
+        ranges[i] = index
+    }
+    estimate, err := repo.estimateBytes(ranges...)
+    if err != nil {
+        return plan, err
+    }
+    plan.EstimatedBytes = estimate
+
+    // Both the records and the indexes are scanned
+    dirEstimate, err := repo.estimateBytes(RecordRange(repo.recordSubspace()))
+    if err != nil {
+        return plan, err
+    }
+    tracker := newProgressTracker(progress, plan.Operation, dirEstimate+estimate)
+    run, err := repo.startJob(JobRebuildIndexes, &plan, tracker)
+    if err != nil {
+        return plan, err
+    }
+
+    // Phase 0: backfill entries missing for stored records
+    err = repo.scanRange(ctx, RecordRange(repo.recordSubspace()), 0, run, func(tr fdb.Transaction, kvs []fdb.KeyValue, delta *Plan) error {
+        for _, kv := range kvs {
+            if _, ok, err := repo.unpackKey(kv.Key); err != nil {
+                return err
+            } else if !ok {
+                continue
+            }
+            entity := &pb.{{.Name}}{}
+            if err := repo.unmarshal(kv.Value, entity); err != nil {
+                return err
+            }
+            delta.Records++
+
+            indexKeys := repo.indexKeys(entity)
+            {{if .ElementIndexes}}indexKeys = append(indexKeys, repo.elementKeys(entity)...)
+            {{end}}futures := make([]fdb.FutureByteSlice, len(indexKeys))
+            for i, indexKey := range indexKeys {
+                futures[i] = tr.Get(indexKey)
+            }
+            for i, future := range futures {
+                value, err := future.Get()
+                if err != nil {
+                    return err
+                }
+                indexValue := repo.indexValue(i, kv.Value)
+                if value != nil && bytes.Equal(value, indexValue) {
+                    continue
+                }
+                delta.KeysWritten++
+                if !repo.dryRun {
+                    tr.Set(indexKeys[i], indexValue)
+                }
+            }
+        }
+        return nil
+    })
+    if err != nil {
+        return plan, err
+    }
+
+    // Phase i+1: clear stale entries of index i
+    for i, index := range indexes {
+        index, fieldCount := index, indexFieldCounts[i]
+        err = repo.scanRange(ctx, index, i+1, run, func(tr fdb.Transaction, kvs []fdb.KeyValue, delta *Plan) error {
+            return repo.clearStaleIndexEntries(tr, index, fieldCount, kvs, delta)
+        })
+        if err != nil {
+            return plan, err
+        }
+    }
+    return plan, repo.finishJob(run)
+}
+
+// clearStaleIndexEntries clears the entries in kvs, read from index, that do
+// not belong to the current version of their record. fieldCount is the number
+// of indexed fields preceding the primary key in each entry.
+func (repo *{{.Name}}Repository) clearStaleIndexEntries(tr fdb.Transaction, index subspace.Subspace, fieldCount int, kvs []fdb.KeyValue, delta *Plan) error {
+    for _, kv := range kvs {
+        tpl, err := index.Unpack(kv.Key)
+        if err != nil {
+            return err
+        }
+        if len(tpl) < fieldCount {
+            return fmt.Errorf("{{.Name}}: malformed index entry %v", tpl)
+        }
+        value, err := tr.Get(repo.recordKey(tpl[fieldCount:])).Get()
+        if err != nil {
+            return err
+        }
+        stale := value == nil
+        if !stale {
+            entity := &pb.{{.Name}}{}
+            if err := repo.unmarshal(value, entity); err != nil {
+                return err
+            }
+            stale = true
+            indexKeys := repo.indexKeys(entity)
+            {{if .ElementIndexes}}indexKeys = append(indexKeys, repo.elementKeys(entity)...)
+            {{end}}for _, indexKey := range indexKeys {
+                if bytes.Equal(indexKey, kv.Key) {
+                    stale = false
+                    break
+                }
+            }
+        }
+        if stale {
+            delta.KeysCleared++
+            if !repo.dryRun {
+                tr.Clear(kv.Key)
+            }
+        }
+    }
+    return nil
+}
+
+// scanRange reads r in batches of {{lowerFirst .Name}}ScanBatch keys, one
+// transaction per batch, calling fn for each batch. fn records its changes in
+// delta, which is added to the job's plan once the transaction commits. phase
+// identifies r among the ranges scanned by the job: for checkpointed jobs the
+// cursor is saved with every batch, and a resumed job skips the phases it
+// already finished and continues the interrupted one after its cursor.
+func (repo *{{.Name}}Repository) scanRange(ctx context.Context, r fdb.ExactRange, phase int, run *jobRun, fn func(tr fdb.Transaction, kvs []fdb.KeyValue, delta *Plan) error) error {
+    if run.status != nil && run.status.Phase > phase {
+        return nil
+    }
+    begin, end := r.FDBRangeKeys()
+    if run.status != nil && run.status.Phase == phase && len(run.status.Cursor) > 0 {
+        begin = append(append(fdb.Key{}, run.status.Cursor...), 0x00)
+    }
+    for {
+        if err := ctx.Err(); err != nil {
+            return err
+        }
+        var delta Plan
+        var status JobStatus
+        result, err := transactContext(ctx, repo.db, func(tr fdb.Transaction) (interface{}, error) {
+            delta = Plan{}
+            kvs, err := tr.GetRange(fdb.KeyRange{Begin: begin, End: end}, fdb.RangeOptions{Limit: {{lowerFirst .Name}}ScanBatch}).GetSliceWithError()
+            if err != nil {
+                return nil, err
+            }
+            if err := fn(tr, kvs, &delta); err != nil {
+                return nil, err
+            }
+            if run.status != nil && len(kvs) > 0 {
+                // Checkpoint in the same transaction as the batch's writes
+                status = *run.status
+                status.Phase = phase
+                status.Cursor = kvs[len(kvs)-1].Key
+                status.Records = run.plan.Records + delta.Records
+                status.KeysWritten = run.plan.KeysWritten + delta.KeysWritten
+                status.KeysCleared = run.plan.KeysCleared + delta.KeysCleared
+                status.UpdatedAt = time.Now()
+                tr.Set(run.key, status.pack())
+            }
+            return kvs, nil
+        })
+        if err != nil {
+            return err
+        }
+        run.plan.add(delta)
+
+        kvs := result.([]fdb.KeyValue)
+        if len(kvs) == 0 {
+            return nil
+        }
+        if run.status != nil {
+            *run.status = status
+        }
+        var batchBytes int64
+        for _, kv := range kvs {
+            batchBytes += int64(len(kv.Key) + len(kv.Value))
+        }
+        last := kvs[len(kvs)-1].Key
+        run.tracker.report(run.plan.Records, last, batchBytes)
+        if len(kvs) < {{lowerFirst .Name}}ScanBatch {
+            return nil
+        }
+        begin = append(append(fdb.Key{}, last...), 0x00)
+    }
+}
+
+// jobKey returns the key holding the checkpoint of the named job.
+func (repo *{{.Name}}Repository) jobKey(name string) fdb.Key {
+    return MetaSubspace(repo.dir, JobsSubspace).Pack(tuple.Tuple{name})
+}
+
+// startJob prepares a run of the named job, resuming from its checkpoint
+// unless the previous run finished. Dry runs are never checkpointed.
+func (repo *{{.Name}}Repository) startJob(name string, plan *Plan, tracker *progressTracker) (*jobRun, error) {
+    run := &jobRun{plan: plan, tracker: tracker}
+    if repo.dryRun {
+        return run, nil
+    }
+    result, err := readTransact(repo.db, func(tr fdb.ReadTransaction) (interface{}, error) {
+        return repo.GetJobStatus(context.Background(), tr, name)
+    })
+    if err != nil {
+        return nil, err
+    }
+    status := result.(*JobStatus)
+    if status == nil || status.Done {
+        now := time.Now()
+        status = &JobStatus{Name: name, StartedAt: now, UpdatedAt: now}
+    }
+    plan.Records = status.Records
+    plan.KeysWritten = status.KeysWritten
+    plan.KeysCleared = status.KeysCleared
+    run.status = status
+    run.key = repo.jobKey(name)
+    return run, nil
+}
+
+// finishJob marks a checkpointed job as done, so that the next run starts over.
+func (repo *{{.Name}}Repository) finishJob(run *jobRun) error {
+    if run.status == nil {
+        return nil
+    }
+    status := *run.status
+    status.Done = true
+    status.UpdatedAt = time.Now()
+    _, err := transact(repo.db, func(tr fdb.Transaction) (interface{}, error) {
+        tr.Set(run.key, status.pack())
+        return nil, nil
+    })
+    if err != nil {
+        return err
+    }
+    *run.status = status
+    return nil
+}
+
+// GetJobStatus returns the checkpointed state of the named maintenance job,
+// or nil if it never ran.
+func (repo *{{.Name}}Repository) GetJobStatus(ctx context.Context, tr fdb.ReadTransaction, name string) (*JobStatus, error) {
+    value, err := tr.Get(repo.jobKey(name)).Get()
+    if err != nil || value == nil {
+        return nil, err
+    }
+    return unpackJobStatus(name, value)
+}
+
+// EstimatedSizeBytes returns FoundationDB's estimate of the space used by
+// {{.Name}} records, indexes and job checkpoints.
+func (repo *{{.Name}}Repository) EstimatedSizeBytes(ctx context.Context) (int64, error) {
+    return repo.estimateBytes(repo.dir)
+}
+{{range $idx := .SecondaryIndexes}}
+// EstimatedSizeBytesBy{{$idx.Name}} returns FoundationDB's estimate of the space
+// used by the {{$idx.Name}} index.
+func (repo *{{$.Name}}Repository) EstimatedSizeBytesBy{{$idx.Name}}(ctx context.Context) (int64, error) {
+    return repo.estimateBytes(repo.indexSubspace("{{$idx.Name}}_index"))
+}
+{{end}}
+// estimateBytes returns the estimated total size of ranges.
+func (repo *{{.Name}}Repository) estimateBytes(ranges ...fdb.ExactRange) (int64, error) {
+    total, err := readTransact(repo.db, func(tr fdb.ReadTransaction) (interface{}, error) {
+        var total int64
+        for _, r := range ranges {
+            size, err := tr.GetEstimatedRangeSizeBytes(r).Get()
+            if err != nil {
+                return nil, err
+            }
+            total += size
+        }
+        return total, nil
+    })
+    if err != nil {
+        return 0, err
+    }
+    return total.(int64), nil
+}
+{{end}}`
@@ -0,0 +1,90 @@
+package main
+
+// mergeTemplate generates MergeSet for messages with the field_merge option.
+// The update time of every field is stored next to the record, so that
+// writers owning different fields of a record do not overwrite each other.
+const mergeTemplate = `{{define "merge"}}{{if .FieldMerge}}
+// MergeSet merges entity into the stored record field by field: each of the
+// given fields (by .proto name, or all fields if none are given) takes the
+// value from entity if at is not older than the field's last update, and
+// keeps the stored value otherwise. Fields unset in entity are cleared. On a
+// tie the latest call wins. The merged record is written with Set.
+func (repo *{{.Name}}Repository) MergeSet(ctx context.Context, tr fdb.Transaction, entity *pb.{{.Name}}, at time.Time, fields ...string) error {
+    clocksKey := MetaSubspace(repo.dir, FieldClocksSubspace).Pack(tuple.Tuple{ {{range .PrimaryKeyFields}} {{toTuple (printf "entity.%s" .Path) .}}, {{end}} })
+    clocksFuture := tr.Get(clocksKey)
+    merged, err := repo.getIfExists(tr, {{range .PrimaryKeyFields}}entity.{{.Path}}, {{end}})
+    if err != nil {
+        return err
+    }
+    if merged == nil {
+        merged = &pb.{{.Name}}{}
+    }
+
+    // Clocks are packed as (field number, Unix nanoseconds) pairs
+    clocks := map[int64]int64{}
+    value, err := clocksFuture.Get()
+    if err != nil {
+        return err
+    }
+    if value != nil {
+        tpl, err := tuple.Unpack(value)
+        if err != nil {
+            return err
+        }
+        for i := 0; i+1 < len(tpl); i += 2 {
+            number, ok1 := tpl[i].(int64)
+            updated, ok2 := tpl[i+1].(int64)
+            if !ok1 || !ok2 {
+                return fmt.Errorf("{{.Name}}: malformed field clocks %v", tpl)
+            }
+            clocks[number] = updated
+        }
+    }
+
+    in, out := entity.ProtoReflect(), merged.ProtoReflect()
+    descriptors := in.Descriptor().Fields()
+    selected := make([]protoreflect.FieldDescriptor, 0, descriptors.Len())
+    if len(fields) == 0 {
+        for i := 0; i < descriptors.Len(); i++ {
+            selected = append(selected, descriptors.Get(i))
+        }
+    }
+    for _, name := range fields {
+        fd := descriptors.ByName(protoreflect.Name(name))
+        if fd == nil {
+            return fmt.Errorf("{{.Name}}: unknown field %q", name)
+        }
+        selected = append(selected, fd)
+    }
+    for _, fd := range selected {
+        number := int64(fd.Number())
+        if at.UnixNano() < clocks[number] {
+            continue
+        }
+        if in.Has(fd) {
+            out.Set(fd, in.Get(fd))
+        } else {
+            out.Clear(fd)
+        }
+        clocks[number] = at.UnixNano()
+    }
+    // The primary key always comes from entity
+    {{range .PrimaryKeyFields}}{{setField "merged" (printf "entity.%s" .Path) .}}
+    {{end}}
+
+    if err := repo.Set(ctx, tr, merged); err != nil {
+        return err
+    }
+    numbers := make([]int64, 0, len(clocks))
+    for number := range clocks {
+        numbers = append(numbers, number)
+    }
+    sort.Slice(numbers, func(i, j int) bool { return numbers[i] < numbers[j] })
+    packed := make(tuple.Tuple, 0, 2*len(numbers))
+    for _, number := range numbers {
+        packed = append(packed, number, clocks[number])
+    }
+    tr.Set(clocksKey, packed.Pack())
+    return nil
+}
+{{end}}{{end}}`
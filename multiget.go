@@ -0,0 +1,44 @@
+package main
+
+// multiGetTemplate generates MultiGet, which reads many records by primary key
+// in one round trip.
+const multiGetTemplate = `{{define "multiGet"}}
+// MultiGet returns the records with the given primary keys, in the order of
+// keys, with nil for keys without a record. All reads are issued before any
+// is awaited, so they overlap instead of taking a round trip each.
+func (repo *{{.Name}}Repository) MultiGet(ctx context.Context, tr fdb.ReadTransaction, keys []{{.Name}}Key) ([]*pb.{{.Name}}, error) {
+    op := repo.slowOps.start("{{.Name}}", "MultiGet")
+    defer op.finish()
+    packed := make([]fdb.Key, len(keys))
+    futures := make([]fdb.FutureByteSlice, len(keys))
+    for i, key := range keys {
+        packed[i] = repo.recordKey(key.toTuple())
+        futures[i] = tr.Get(packed[i])
+    }
+    entities := make([]*pb.{{.Name}}, len(keys))
+    for i, future := range futures {
+        if err := ctx.Err(); err != nil {
+            return nil, err
+        }
+        value, err := future.Get()
+        if err != nil {
+            return nil, err
+        }
+        op.add(1, len(value))
+        txStatsFrom(ctx).read(len(packed[i]) + len(value))
+        if value == nil {
+            continue
+        }
+        entity := &pb.{{.Name}}{}
+        if err := repo.unmarshal(value, entity); err != nil {
+            return nil, err
+        }
+        {{if .CRDTFields}}if err := repo.loadCRDTFields(tr, entity); err != nil {
+            return nil, err
+        }
+        {{end}}
+        entities[i] = entity
+    }
+    return entities, nil
+}
+{{end}}`
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build/constraint"
+	"go/parser"
+	"go/token"
+	"log"
+
+	"google.golang.org/protobuf/compiler/protogen"
+)
+
+// reservedSubspaces are the names of the metadata subspaces of message
+// directories, kept in sync with the constants of the shared template.
+var reservedSubspaces = map[string]bool{
+	"_meta":     true,
+	"_jobs":     true,
+	"_txn":      true,
+	"_cdc":      true,
+	"_cursors":  true,
+	"_archive":  true,
+	"_blobgc":   true,
+	"_clocks":   true,
+	"_crdt":     true,
+	"_hot":      true,
+	"_staged":   true,
+	"_versions": true,
+}
+
+// checkReservedNames fails generation if the directory path or an index of
+// msg uses a reserved subspace name, if the directory path starts with the
+// global index directory, or if two indexes of msg, including the indexes of
+// repeated fields and map keys, share a name.
+func checkReservedNames(msg *Message) {
+	for _, elem := range msg.DirectoryPath {
+		if reservedSubspaces[elem] {
+			log.Fatalf("Directory path element %q of message %s is a reserved subspace name", elem, msg.Name)
+		}
+	}
+	if msg.DirectoryPath[0] == globalDirectory {
+		log.Fatalf("Directory path of message %s starts with %q, the directory of global indexes", msg.Name, globalDirectory)
+	}
+	indexes := map[string]bool{}
+	for _, idx := range msg.SecondaryIndexes {
+		name := idx.Name + "_index"
+		if reservedSubspaces[name] {
+			log.Fatalf("Secondary index %s of message %s is a reserved subspace name", name, msg.Name)
+		}
+		if indexes[name] {
+			log.Fatalf("Message %s has two secondary indexes named %s; set the name option of one of them", msg.Name, name)
+		}
+		indexes[name] = true
+	}
+	for _, idx := range msg.ElementIndexes {
+		name := idx.Name + "_index"
+		if reservedSubspaces[name] {
+			log.Fatalf("Secondary index %s of message %s is a reserved subspace name", name, msg.Name)
+		}
+		if indexes[name] {
+			log.Fatalf("Message %s has two secondary indexes named %s; set the name option of one of them", msg.Name, name)
+		}
+		indexes[name] = true
+	}
+}
+
+// checkIdentifiers fails if two generated files, or two declarations of the
+// same file, declare the same package-level identifier or method, which
+// happens when the name of a message, projection or index combined with a
+// generated suffix equals another generated name. Files with build
+// constraints are only checked against the files without, since they are
+// alternatives to each other or compiled separately.
+func checkIdentifiers(files []*protogen.GeneratedFile, names []string) error {
+	parsed := make([]*ast.File, len(files))
+	for i, genFile := range files {
+		content, err := genFile.Content()
+		if err != nil {
+			return err
+		}
+		if parsed[i], err = parser.ParseFile(token.NewFileSet(), names[i], content, parser.ParseComments); err != nil {
+			return err
+		}
+	}
+
+	untagged := map[string]string{}
+	for i, file := range parsed {
+		if !hasBuildConstraint(file) {
+			if err := declareIdentifiers(file, names[i], untagged); err != nil {
+				return err
+			}
+		}
+	}
+	for i, file := range parsed {
+		if hasBuildConstraint(file) {
+			declared := make(map[string]string, len(untagged))
+			for ident, fileName := range untagged {
+				declared[ident] = fileName
+			}
+			if err := declareIdentifiers(file, names[i], declared); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// declareIdentifiers adds the package-level identifiers and methods of file,
+// named fileName, to declared, which maps them to the file declaring them,
+// failing if one is declared already.
+func declareIdentifiers(file *ast.File, fileName string, declared map[string]string) error {
+	declare := func(ident string) error {
+		if other, ok := declared[ident]; ok {
+			if other == fileName {
+				return fmt.Errorf("%s is declared twice in %s; rename a message, projection or index field so that generated names differ", ident, fileName)
+			}
+			return fmt.Errorf("%s is declared in both %s and %s; rename a message, projection or index field so that generated names differ", ident, other, fileName)
+		}
+		declared[ident] = fileName
+		return nil
+	}
+
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			ident := d.Name.Name
+			if d.Recv != nil {
+				recv := d.Recv.List[0].Type
+				if star, ok := recv.(*ast.StarExpr); ok {
+					recv = star.X
+				}
+				ident = fmt.Sprintf("%s.%s", recv.(*ast.Ident).Name, ident)
+			}
+			if err := declare(ident); err != nil {
+				return err
+			}
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					if err := declare(s.Name.Name); err != nil {
+						return err
+					}
+				case *ast.ValueSpec:
+					for _, name := range s.Names {
+						if name.Name == "_" {
+							continue
+						}
+						if err := declare(name.Name); err != nil {
+							return err
+						}
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// hasBuildConstraint reports whether file has a //go:build line.
+func hasBuildConstraint(file *ast.File) bool {
+	for _, group := range file.Comments {
+		if group.Pos() > file.Package {
+			break
+		}
+		for _, c := range group.List {
+			if constraint.IsGoBuild(c.Text) {
+				return true
+			}
+		}
+	}
+	return false
+}
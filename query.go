@@ -0,0 +1,236 @@
+package main
+
+// queryTemplate generates the query builder of a message. A query holds
+// equality conditions on scalar fields. It reads the range of the primary key
+// or of the secondary index whose leading fields have the most conditions,
+// and checks every condition on the records read.
+const queryTemplate = `{{define "query"}}{{$msg := .}}
+// {{.Name}}Query selects {{.Name}} records by equality conditions on their scalar
+// fields. Create one with Query.{{if .HasOneofFields}} Oneof members and optional fields compare
+// their getter value, the zero value when unset.{{end}}
+type {{.Name}}Query struct {
+    repo  *{{.Name}}Repository
+    limit int
+    where struct {
+        {{range .ScalarFields}}{{.Name}} *{{.Type}}
+        {{end}}
+    }
+}
+
+// Query returns a query selecting all {{.Name}} records.
+func (repo *{{.Name}}Repository) Query() *{{.Name}}Query {
+    return &{{.Name}}Query{repo: repo}
+}
+{{range .ScalarFields}}
+// Where{{.Name}} selects the records whose {{.ProtoName}} equals value.
+func (q *{{$msg.Name}}Query) Where{{.Name}}(value {{.Type}}) *{{$msg.Name}}Query {
+    q.where.{{.Name}} = &value
+    return q
+}
+{{end}}
+// Limit returns at most n records. 0 means no limit.
+func (q *{{.Name}}Query) Limit(n int) *{{.Name}}Query {
+    q.limit = n
+    return q
+}
+
+// {{lowerFirst .Name}}QueryPlan is the range a query reads.
+type {{lowerFirst .Name}}QueryPlan struct {
+    // index is the subspace of the secondary index read, "" for the primary
+    // key.
+    index string
+    // fields are the conditions narrowing the range, by .proto name.
+    fields []string
+    prefix tuple.Tuple
+}
+
+// conditions returns the fields with a condition, by .proto name.
+func (q *{{.Name}}Query) conditions() []string {
+    fields := []string{}
+    {{range .ScalarFields}}if q.where.{{.Name}} != nil {
+        fields = append(fields, "{{.ProtoName}}")
+    }
+    {{end}}
+    return fields
+}
+
+// plan picks the primary key or the secondary index whose leading fields
+// have the most conditions, preferring the primary key.
+func (q *{{.Name}}Query) plan() {{lowerFirst .Name}}QueryPlan {
+    var best {{lowerFirst .Name}}QueryPlan
+    {{range $i, $f := .PrimaryKeyFields}}{{if $f.Scalar}}if len(best.prefix) == {{$i}} && q.where.{{$f.Name}} != nil {
+        best.prefix = append(best.prefix, {{toTuple (printf "*q.where.%s" $f.Name) $f}})
+        best.fields = append(best.fields, "{{$f.ProtoName}}")
+    }
+    {{end}}{{end}}
+    {{range $idx := .SecondaryIndexes}}{
+        candidate := {{lowerFirst $msg.Name}}QueryPlan{index: "{{$idx.Name}}_index"}
+        {{range $i, $f := $idx.Fields}}{{if $f.Scalar}}if len(candidate.prefix) == {{$i}} && q.where.{{$f.Name}} != nil {
+            candidate.prefix = append(candidate.prefix, {{toTuple (printf "*q.where.%s" $f.Name) $f}})
+            candidate.fields = append(candidate.fields, "{{$f.ProtoName}}")
+        }
+        {{end}}{{end}}
+        if len(candidate.prefix) > len(best.prefix) {
+            best = candidate
+        }
+    }
+    {{end}}
+    return best
+}
+
+// matches reports whether entity satisfies every condition of q.
+func (q *{{.Name}}Query) matches(entity *pb.{{.Name}}) bool {
+    {{range .ScalarFields}}if q.where.{{.Name}} != nil && {{if .Bytes}}!bytes.Equal(entity.{{.Path}}, *q.where.{{.Name}}){{else}}entity.{{.Path}} != *q.where.{{.Name}}{{end}} {
+        return false
+    }
+    {{end}}
+    return true
+}
+
+// Find returns the records matching the query, in the order of the primary
+// key or index read.
+func (q *{{.Name}}Query) Find(ctx context.Context, tr fdb.ReadTransaction) ([]*pb.{{.Name}}, error) {
+    plan := q.plan()
+    op := q.repo.slowOps.start("{{.Name}}", "Query.Find")
+    defer op.finish()
+    if q.repo.sampler != nil {
+        q.repo.sampler.record("{{.Name}}", plan.fields, q.conditions())
+    }
+    if q.repo.guard != nil && len(plan.fields) == 0 {
+        size, err := tr.GetEstimatedRangeSizeBytes(RecordRange(q.repo.recordSubspace())).Get()
+        if err != nil {
+            return nil, err
+        }
+        if size > q.repo.guard.MaxBytes {
+            if q.repo.guard.Log == nil {
+                return nil, fmt.Errorf("%w: %s, estimated %d bytes", ErrFullScan, q.Explain(), size)
+            }
+            q.repo.guard.Log(q.Explain(), size)
+        }
+    }
+
+    entities := []*pb.{{.Name}}{}
+    {{if .ScalarKey}}if plan.index == "" && len(plan.prefix) == {{len .PrimaryKeyFields}} {
+        // The range of a full primary key does not include its record
+        entity, err := q.repo.getIfExists(tr, {{range $index, $element := .PrimaryKeyFields}}{{if $index}}, {{end}}*q.where.{{.Name}}{{end}})
+        if err != nil {
+            return nil, err
+        }
+        if entity != nil && q.matches(entity) {
+            entities = append(entities, entity)
+        }
+        return entities, nil
+    }{{end}}
+    if plan.index == "" {
+        it := q.repo.iterateRecords(tr, plan.prefix, nil, fdb.RangeOptions{})
+        for (q.limit == 0 || len(entities) < q.limit) && it.Advance() {
+            if err := ctx.Err(); err != nil {
+                return nil, err
+            }
+            kv, err := it.Get()
+            if err != nil {
+                return nil, err
+            }
+            op.add(1, len(kv.Value))
+            txStatsFrom(ctx).read(len(kv.Key) + len(kv.Value))
+            if _, ok, err := q.repo.unpackKey(kv.Key); err != nil {
+                return nil, err
+            } else if !ok {
+                // Not a record of this message
+                continue
+            }
+            entity := &pb.{{.Name}}{}
+            if err := q.repo.unmarshal(kv.Value, entity); err != nil {
+                return nil, err
+            }
+            {{if .CRDTFields}}if err := q.repo.loadCRDTFields(tr, entity); err != nil {
+                return nil, err
+            }
+            {{end}}
+            if q.matches(entity) {
+                entities = append(entities, entity)
+            }
+        }
+        return entities, nil
+    }
+
+    {{if .RecordLayer}}if err := checkIndexReadable(tr, q.repo.dir, plan.index); err != nil {
+        return nil, fmt.Errorf("{{.Name}}: %w", err)
+    }
+    {{end}}index := q.repo.indexSubspace(plan.index)
+    it := tr.GetRange(index.Sub(plan.prefix...), fdb.RangeOptions{}).Iterator()
+    for (q.limit == 0 || len(entities) < q.limit) && it.Advance() {
+        if err := ctx.Err(); err != nil {
+            return nil, err
+        }
+        kv, err := it.Get()
+        if err != nil {
+            return nil, err
+        }
+        tpl, err := index.Unpack(kv.Key)
+        if err != nil {
+            return nil, err
+        }
+        // The primary key fields are after the index fields
+        key, ok := {{lowerFirst .Name}}KeyFromTuple(tpl[len(tpl)-{{len .PrimaryKeyFields}}:])
+        if !ok {
+            return nil, fmt.Errorf("{{.Name}}: malformed index entry %v", tpl)
+        }
+        entity, err := q.repo.getIfExists(tr, {{range $index, $element := .PrimaryKeyFields}}{{if $index}}, {{end}}key.{{.Name}}{{end}})
+        if err != nil {
+            return nil, err
+        }
+        op.add(1, 0)
+        txStatsFrom(ctx).read(len(kv.Key))
+        // Entries left behind by an earlier version of a record fail the
+        // conditions
+        if entity != nil && q.matches(entity) {
+            entities = append(entities, entity)
+        }
+    }
+    return entities, nil
+}
+
+// Explain returns how Find would read records, without reading anything.
+func (q *{{.Name}}Query) Explain() QueryPlan {
+    plan := q.plan()
+    result := QueryPlan{MessageType: "{{.Name}}", Index: plan.index, Scan: PrefixScan, IndexedFields: plan.fields}
+    for _, field := range q.conditions() {
+        if !contains(plan.fields, field) {
+            result.FilteredFields = append(result.FilteredFields, field)
+        }
+    }
+    switch {
+    case len(plan.fields) == 0:
+        result.Scan = FullScan
+        result.Reason = "no condition on the leading field of the primary key or an index ({{range $i, $f := .PrimaryKeyFields}}{{if not $i}}{{$f.ProtoName}}{{end}}{{end}}{{range .SecondaryIndexes}}{{range $i, $f := .Fields}}{{if not $i}}, {{$f.ProtoName}}{{end}}{{end}}{{end}})"
+    case plan.index == "" && len(plan.fields) == {{len .PrimaryKeyFields}}:
+        result.Scan = PointScan
+        result.Reason = "conditions on every primary key field"
+    case plan.index == "":
+        result.Reason = "conditions on the leading primary key fields " + strings.Join(plan.fields, ", ")
+    default:
+        result.Reason = "conditions on the leading index fields " + strings.Join(plan.fields, ", ") + ", more than on the primary key or another index"
+    }
+    if len(result.FilteredFields) > 0 {
+        result.Reason += "; " + strings.Join(result.FilteredFields, ", ") + " checked on every record read"
+    }
+    return result
+}
+
+// WithFullScanGuard returns a copy of the repository whose queries are
+// checked by guard before reading every record.
+func (repo *{{.Name}}Repository) WithFullScanGuard(guard FullScanGuard) *{{.Name}}Repository {
+    withGuard := *repo
+    withGuard.guard = &guard
+    return &withGuard
+}
+
+// WithQuerySampler returns a copy of the repository whose queries are
+// sampled by sampler.
+func (repo *{{.Name}}Repository) WithQuerySampler(sampler *QuerySampler) *{{.Name}}Repository {
+    withSampler := *repo
+    withSampler.sampler = sampler
+    return &withSampler
+}
+{{end}}`
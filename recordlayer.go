@@ -0,0 +1,76 @@
+package main
+
+import (
+	"log"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// RecordLayer holds the record_layer option of a message, whose records and
+// index entries are laid out like a record store of the Java FDB Record
+// Layer.
+type RecordLayer struct {
+	// UnionField is the number of the field of the message in the
+	// RecordTypeUnion message wrapping the stored records.
+	UnionField int
+	// MetaDataVersion is the version of the Record Layer metadata written in
+	// the store header and expected in it.
+	MetaDataVersion int
+}
+
+// recordLayerFormatVersion is the format version openRecordStore writes in the
+// headers of new stores, documented in the keyspace.
+const recordLayerFormatVersion = 6
+
+// checkRecordLayer rejects the options of m, a message with the record_layer
+// option, that change the layout of its records and keys away from that of
+// the Record Layer, or keep data beside the records that Record Layer
+// services would not maintain when they write them.
+func checkRecordLayer(m *Message) {
+	switch {
+	case !protowire.Number(m.RecordLayer.UnionField).IsValid():
+		log.Fatalf("Message %s has the record_layer option without a valid union_field", m.Name)
+	case m.Buckets > 0:
+		log.Fatalf("Message %s with the record_layer option cannot spread its records over buckets", m.Name)
+	case m.Serializer != "":
+		log.Fatalf("Message %s with the record_layer option cannot use a serializer", m.Name)
+	case len(m.PreviousVersions) > 0:
+		log.Fatalf("Message %s with the record_layer option cannot have previous versions", m.Name)
+	case m.ChangeLog:
+		log.Fatalf("Message %s with the record_layer option cannot have a change log, search sync or webhooks, which would miss the writes of Record Layer services", m.Name)
+	case m.FieldMerge:
+		log.Fatalf("Message %s with the record_layer option cannot merge fields, whose clocks would miss the writes of Record Layer services", m.Name)
+	case len(m.CRDTFields) > 0:
+		log.Fatalf("Message %s with the record_layer option cannot have counter, element set, touch or side-stored fields, which are stored outside the record", m.Name)
+	}
+	for _, idx := range m.SecondaryIndexes {
+		switch {
+		case idx.Covering:
+			log.Fatalf("Secondary index %s of message %s with the record_layer option cannot be covering", idx.Name, m.Name)
+		case idx.Global:
+			log.Fatalf("Secondary index %s of message %s with the record_layer option cannot be global", idx.Name, m.Name)
+		}
+	}
+
+	keyFields := append([]Field{}, m.PrimaryKeyFields...)
+	for _, idx := range m.SecondaryIndexes {
+		keyFields = append(keyFields, idx.Fields...)
+	}
+	for _, idx := range m.ElementIndexes {
+		keyFields = append(keyFields, idx.Element)
+	}
+	for _, f := range keyFields {
+		switch {
+		case f.AutoUUID:
+			log.Fatalf("Field %s of message %s with the record_layer option cannot be an auto_uuid field, which is packed as a UUID", f.ProtoName, m.Name)
+		case f.Hashed():
+			log.Fatalf("Field %s of message %s with the record_layer option cannot hash overlong values", f.ProtoName, m.Name)
+		case f.Timestamp():
+			log.Fatalf("Field %s of message %s with the record_layer option cannot be a key or index field, since timestamps are packed as nested tuples", f.ProtoName, m.Name)
+		case f.Type == "uint32" || f.Type == "uint64":
+			log.Fatalf("Field %s of message %s with the record_layer option cannot be an unsigned key or index field, which the Record Layer packs as signed", f.ProtoName, m.Name)
+		case f.Oneof:
+			log.Fatalf("Field %s of message %s with the record_layer option cannot be an index field in a oneof or optional, whose unset values the Record Layer indexes as null", f.ProtoName, m.Name)
+		}
+	}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// replicaTemplate generates ReplicateSQL, which applies the change log of a
+// message to a table of a Postgres or MySQL database.
+const replicaTemplate = `{{define "replica"}}{{if .ChangeLog}}
+// {{lowerFirst .Name}}SQLStatements maintain the SQL replica of {{.Name}}.
+var {{lowerFirst .Name}}SQLStatements = map[SQLDialect]sqlStatements{
+    {{range $dialect := sqlDialects}}{{$dialect}}: {{with sqlReplica $ $dialect}}{
+        schema: []string{
+            {{range .Schema}}{{printf "%q" .}},
+            {{end}}
+        },
+        upsert: {{printf "%q" .Upsert}},
+        delete: {{printf "%q" .Delete}},
+    }{{end}},
+    {{end}}
+}
+
+// ReplicateSQL applies the change log entries not replicated yet to the
+// "{{.Name}}" table of db, creating it if needed with a column per scalar
+// field and timestamp key field, and the serialized record in _record. The
+// position in the change log is stored in db with every batch of changes, in
+// the same SQL transaction, so that each change is applied once even if
+// replication is interrupted.
+// Run it periodically, for example as a WorkerJob. It returns the number of
+// changes applied.
+func (repo *{{.Name}}Repository) ReplicateSQL(ctx context.Context, db *sql.DB, dialect SQLDialect) (int, error) {
+    stmts, ok := {{lowerFirst .Name}}SQLStatements[dialect]
+    if !ok {
+        return 0, fmt.Errorf("{{.Name}}: unknown SQL dialect %d", dialect)
+    }
+    cursors := replicaCursorStatements[dialect]
+    for _, stmt := range append(stmts.schema, cursors.schema) {
+        if _, err := db.ExecContext(ctx, stmt); err != nil {
+            return 0, err
+        }
+    }
+    var cursor []byte
+    err := db.QueryRowContext(ctx, cursors.get, "{{.Name}}").Scan(&cursor)
+    if err != nil && !errors.Is(err, sql.ErrNoRows) {
+        return 0, err
+    }
+
+    applied := 0
+    for {
+        if err := ctx.Err(); err != nil {
+            return applied, err
+        }
+        result, err := readTransactContext(ctx, repo.db, func(tr fdb.ReadTransaction) (interface{}, error) {
+            return repo.ReadChanges(ctx, tr, cursor, {{lowerFirst .Name}}ScanBatch)
+        })
+        if err != nil {
+            return applied, err
+        }
+        changes := result.([]{{.Name}}Change)
+        if len(changes) == 0 {
+            return applied, nil
+        }
+        if err := repo.applySQLChanges(ctx, db, stmts, cursors, changes); err != nil {
+            return applied, err
+        }
+        applied += len(changes)
+        cursor = changes[len(changes)-1].Cursor
+        if len(changes) < {{lowerFirst .Name}}ScanBatch {
+            return applied, nil
+        }
+    }
+}
+
+// applySQLChanges applies changes and saves the cursor of the last one in a
+// single SQL transaction.
+func (repo *{{.Name}}Repository) applySQLChanges(ctx context.Context, db *sql.DB, stmts sqlStatements, cursors replicaCursorStatement, changes []{{.Name}}Change) error {
+    tx, err := db.BeginTx(ctx, nil)
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+    for _, change := range changes {
+        if change.Record == nil {
+            k := change.Key
+            if _, err := tx.ExecContext(ctx, stmts.delete, {{range .PrimaryKeyFields}}k.{{.Name}}{{if .Timestamp}}.AsTime(){{end}}, {{end}}); err != nil {
+                return err
+            }
+            continue
+        }
+        entity := change.Record
+        record, err := proto.Marshal(entity)
+        if err != nil {
+            return err
+        }
+        if _, err := tx.ExecContext(ctx, stmts.upsert, {{range .ReplicaFields}}entity.{{.Path}}{{if .Timestamp}}.AsTime(){{end}}, {{end}}record); err != nil {
+            return err
+        }
+    }
+    if _, err := tx.ExecContext(ctx, cursors.set, "{{.Name}}", []byte(changes[len(changes)-1].Cursor)); err != nil {
+        return err
+    }
+    return tx.Commit()
+}
+{{end}}{{end}}`
+
+// sqlDialects returns the names of the generated SQLDialect constants.
+func sqlDialects() []string {
+	return []string{"Postgres", "MySQL"}
+}
+
+// SQLReplica holds the SQL statements maintaining the replica of a message.
+type SQLReplica struct {
+	Schema []string
+	Upsert string // parameters: the replica fields, then the serialized record
+	Delete string // parameters: the primary key fields
+}
+
+// sqlColumnType returns the column type of a field of the given Go type in
+// dialect, or "" if the field has no column. Key columns of MySQL tables
+// need a bounded length.
+func sqlColumnType(dialect, typ string, key bool) string {
+	postgres := dialect == "Postgres"
+	if isEnumType(typ) {
+		typ = "int32"
+	}
+	switch typ {
+	case "int32":
+		return "INTEGER"
+	case "int64":
+		return "BIGINT"
+	case "uint32":
+		if postgres {
+			return "BIGINT"
+		}
+		return "INT UNSIGNED"
+	case "uint64":
+		if postgres {
+			return "NUMERIC(20)"
+		}
+		return "BIGINT UNSIGNED"
+	case "float32":
+		if postgres {
+			return "REAL"
+		}
+		return "FLOAT"
+	case "float64":
+		if postgres {
+			return "DOUBLE PRECISION"
+		}
+		return "DOUBLE"
+	case "string":
+		if key && !postgres {
+			return "VARCHAR(255)"
+		}
+		return "TEXT"
+	case "bool":
+		return "BOOLEAN"
+	case timestampType:
+		if postgres {
+			return "TIMESTAMPTZ"
+		}
+		return "DATETIME(6)"
+	case "[]byte":
+		if postgres {
+			return "BYTEA"
+		}
+		if key {
+			return "VARBINARY(255)"
+		}
+		return "BLOB"
+	default:
+		return ""
+	}
+}
+
+// sqlReplica returns the replica statements of msg in dialect.
+func sqlReplica(msg Message, dialect string) SQLReplica {
+	postgres := dialect == "Postgres"
+	quote := func(name string) string {
+		if postgres {
+			return `"` + name + `"`
+		}
+		return "`" + name + "`"
+	}
+	param := func(i int) string {
+		if postgres {
+			return fmt.Sprintf("$%d", i)
+		}
+		return "?"
+	}
+
+	keyFields := map[string]bool{}
+	for _, f := range msg.PrimaryKeyFields {
+		keyFields[f.ProtoName] = true
+	}
+	for _, idx := range msg.SecondaryIndexes {
+		for _, f := range idx.Fields {
+			keyFields[f.ProtoName] = true
+		}
+	}
+
+	table := quote(msg.Name)
+	var columns, names, params, updates []string
+	for _, f := range msg.ReplicaFields() {
+		typ := sqlColumnType(dialect, f.Type, keyFields[f.ProtoName])
+		if typ == "" {
+			continue
+		}
+		columns = append(columns, quote(f.ProtoName)+" "+typ)
+		names = append(names, quote(f.ProtoName))
+		params = append(params, param(len(params)+1))
+	}
+	recordType := "BYTEA"
+	if !postgres {
+		recordType = "LONGBLOB"
+	}
+	columns = append(columns, quote("_record")+" "+recordType)
+	names = append(names, quote("_record"))
+	params = append(params, param(len(params)+1))
+
+	var pk, where []string
+	for i, f := range msg.PrimaryKeyFields {
+		pk = append(pk, quote(f.ProtoName))
+		where = append(where, quote(f.ProtoName)+" = "+param(i+1))
+	}
+	columns = append(columns, "PRIMARY KEY ("+strings.Join(pk, ", ")+")")
+
+	var indexes []string
+	for _, idx := range msg.SecondaryIndexes {
+		var idxColumns []string
+		for _, f := range idx.Fields {
+			if sqlColumnType(dialect, f.Type, true) != "" {
+				idxColumns = append(idxColumns, quote(f.ProtoName))
+			}
+		}
+		if len(idxColumns) != len(idx.Fields) {
+			continue
+		}
+		name := quote(msg.Name + "_" + idx.Name + "_index")
+		if postgres {
+			indexes = append(indexes, fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s (%s)", name, table, strings.Join(idxColumns, ", ")))
+		} else {
+			columns = append(columns, fmt.Sprintf("INDEX %s (%s)", name, strings.Join(idxColumns, ", ")))
+		}
+	}
+
+	for _, name := range names {
+		if contains(pk, name) {
+			continue
+		}
+		if postgres {
+			updates = append(updates, name+" = EXCLUDED."+name)
+		} else {
+			updates = append(updates, name+" = VALUES("+name+")")
+		}
+	}
+	upsert := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) ", table, strings.Join(names, ", "), strings.Join(params, ", "))
+	if postgres {
+		upsert += fmt.Sprintf("ON CONFLICT (%s) DO UPDATE SET %s", strings.Join(pk, ", "), strings.Join(updates, ", "))
+	} else {
+		upsert += "ON DUPLICATE KEY UPDATE " + strings.Join(updates, ", ")
+	}
+
+	return SQLReplica{
+		Schema: append([]string{fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s)", table, strings.Join(columns, ", "))}, indexes...),
+		Upsert: upsert,
+		Delete: fmt.Sprintf("DELETE FROM %s WHERE %s", table, strings.Join(where, " AND ")),
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
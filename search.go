@@ -0,0 +1,65 @@
+package main
+
+// searchTemplate generates SyncSearch for messages with the search_sync
+// option, which tails the change log into a search index.
+const searchTemplate = `{{define "search"}}{{if .SearchSync}}
+// documentID returns the search document ID of the record with key k: its
+// primary key fields, path-escaped and joined with slashes.
+func (k {{.Name}}Key) documentID() string {
+    return {{range $i, $f := .PrimaryKeyFields}}{{if $i}} + "/" + {{end}}url.PathEscape(fmt.Sprint(k.{{$f.Name}})){{end}}
+}
+
+// SyncSearch pushes the change log entries not synced yet to index through
+// client: stored records are indexed as JSON documents, encoded with
+// Marshal{{.Name}}JSON, and deleted records are deleted. The position in the
+// change log is saved per index after every batch, so an interrupted sync
+// resumes where it stopped. Run it periodically, for example as a WorkerJob.
+// It returns the number of changes pushed.
+func (repo *{{.Name}}Repository) SyncSearch(ctx context.Context, client SearchClient, index string) (int, error) {
+    cursorKey := MetaSubspace(repo.dir, CursorsSubspace).Pack(tuple.Tuple{"search", index})
+    synced := 0
+    for {
+        if err := ctx.Err(); err != nil {
+            return synced, err
+        }
+        result, err := readTransactContext(ctx, repo.db, func(tr fdb.ReadTransaction) (interface{}, error) {
+            cursor, err := tr.Get(cursorKey).Get()
+            if err != nil {
+                return nil, err
+            }
+            return repo.ReadChanges(ctx, tr, cursor, {{lowerFirst .Name}}ScanBatch)
+        })
+        if err != nil {
+            return synced, err
+        }
+        changes := result.([]{{.Name}}Change)
+        if len(changes) == 0 {
+            return synced, nil
+        }
+
+        ops := make([]SearchOp, len(changes))
+        for i, change := range changes {
+            ops[i].ID = change.Key.documentID()
+            if change.Record != nil {
+                if ops[i].Document, err = Marshal{{.Name}}JSON(change.Record); err != nil {
+                    return synced, err
+                }
+            }
+        }
+        if err := client.Bulk(ctx, index, ops); err != nil {
+            return synced, err
+        }
+        _, err = transactContext(ctx, repo.db, func(tr fdb.Transaction) (interface{}, error) {
+            tr.Set(cursorKey, changes[len(changes)-1].Cursor)
+            return nil, nil
+        })
+        if err != nil {
+            return synced, err
+        }
+        synced += len(changes)
+        if len(changes) < {{lowerFirst .Name}}ScanBatch {
+            return synced, nil
+        }
+    }
+}
+{{end}}{{end}}`
@@ -0,0 +1,1805 @@
+package main
+
+// sharedTemplate renders repositories.go, which holds the declarations used
+// by every generated repository in the package. It is emitted once per run.
+const sharedTemplate = `{{define "shared"}}// Code generated by fdb-go-layer-plugin {{pluginVersion}}. DO NOT EDIT.
+
+package repositories
+
+import (
+    "context"
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/binary"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "hash/fnv"
+    mathrand "math/rand"
+    "sort"
+    "strings"
+    "sync"
+    "sync/atomic"
+    "time"
+
+    "github.com/apple/foundationdb/bindings/go/src/fdb"
+    "github.com/apple/foundationdb/bindings/go/src/fdb/directory"
+    "github.com/apple/foundationdb/bindings/go/src/fdb/subspace"
+    "github.com/apple/foundationdb/bindings/go/src/fdb/tuple"
+    "google.golang.org/protobuf/encoding/protojson"
+    "google.golang.org/protobuf/encoding/protowire"
+    "google.golang.org/protobuf/proto"
+)
+
+// Init creates the directories of all message types of the package in a
+// single transaction. It is idempotent and meant to be called once at
+// startup, so that directories are created in one place rather than by
+// whichever repository happens to be constructed first. prefix must match
+// the one passed to the repository constructors.
+func Init(db fdb.Transactor, prefix ...string) error {
+    _, err := transact(db, func(tr fdb.Transaction) (interface{}, error) {
+        for _, path := range [][]string{
+            {{range .}}{{stringSlice .DirectoryPath}},
+            {{end}}
+        } {
+            path = append(append([]string{}, prefix...), path...)
+            if _, err := directory.CreateOrOpen(tr, path, nil); err != nil {
+                return nil, err
+            }
+        }
+        for _, path := range [][]string{
+            {{range .}}{{if .HasGlobalIndexes}}{{stringSlice .DirectoryPath}},
+            {{end}}{{end}}
+        } {
+            path = append([]string{GlobalDirectory}, path...)
+            if _, err := directory.CreateOrOpen(tr, path, nil); err != nil {
+                return nil, err
+            }
+        }
+        return nil, nil
+    })
+    return err
+}
+
+// RemovePrefix deletes everything stored under prefix, typically a test run
+// or a discarded environment. It is a no-op if the prefix does not exist.
+func RemovePrefix(db fdb.Transactor, prefix ...string) error {
+    if len(prefix) == 0 {
+        return errors.New("RemovePrefix: refusing to remove the root directory")
+    }
+    _, err := directory.Root().Remove(db, prefix)
+    return err
+}
+
+// KeyLayoutVersion is the version of the layout of message directories.
+// Records are stored directly in the directory, packed with their primary
+// key:
+//
+//	(pk...)                                record
+//	(nil, KeyLayoutVersion, name, ...)     auxiliary data
+//
+// where name is "<Fields>_index" for the entries of a secondary index, or one
+// of the subspaces below. No primary key field packs to nil, so auxiliary keys
+// never collide with record keys, and they sort before every record. Use
+// MetaSubspace to address them. Records of message types with the buckets
+// option are packed with their bucket first, (bucket, pk...). Directories of
+// message types with the record_layer option hold a record store of the Java
+// FDB Record Layer instead, beside their auxiliary data.
+const KeyLayoutVersion = {{keyLayoutVersion}}
+
+// GlobalDirectory is the root directory, shared by every prefix, of the
+// entries of global secondary indexes. It is not nested under the prefix, so
+// RemovePrefix leaves the entries of the removed prefix behind; lookups skip
+// them.
+const GlobalDirectory = "{{globalDirectory}}"
+
+// MetaSubspace returns the subspace of dir holding the auxiliary data name,
+// such as the entries of a secondary index or JobsSubspace.
+func MetaSubspace(dir subspace.Subspace, name string) subspace.Subspace {
+    return dir.Sub(nil, int64(KeyLayoutVersion), name)
+}
+
+// RecordRange returns the range of dir holding its records, which follows
+// the auxiliary data.
+func RecordRange(dir subspace.Subspace) fdb.KeyRange {
+    _, begin := dir.Sub(nil).FDBRangeKeys()
+    _, end := dir.FDBRangeKeys()
+    return fdb.KeyRange{Begin: begin, End: end}
+}
+
+// recordRange returns the range of dir holding the records whose primary key
+// starts with prefix and, if after is not nil, comes after it, or before it
+// if reverse is set.
+func recordRange(dir subspace.Subspace, prefix, after tuple.Tuple, reverse bool) fdb.KeyRange {
+    r := RecordRange(dir)
+    if len(prefix) > 0 {
+        begin, end := dir.Sub(prefix...).FDBRangeKeys()
+        r = fdb.KeyRange{Begin: begin, End: end}
+    }
+    if after != nil {
+        if reverse {
+            r.End = dir.Pack(after)
+        } else {
+            // Past the keys of after, of which Record Layer stores have
+            // several
+            _, r.Begin = dir.Sub(after...).FDBRangeKeys()
+        }
+    }
+    return r
+}
+
+// recordBucket returns the bucket of the record with primary key pk among
+// buckets: the FNV-1a hash of the packed key modulo buckets. Records of
+// message types with the buckets option are stored under their bucket, so
+// it must not change.
+func recordBucket(pk tuple.Tuple, buckets int) int64 {
+    h := fnv.New32a()
+    h.Write(pk.Pack())
+    return int64(h.Sum32() % uint32(buckets))
+}
+
+// The subspaces of a record store of the Java FDB Record Layer used by the
+// message types with the record_layer option, whose directories hold such a
+// store:
+//
+//	(0)                              store header, a DataStoreInfo message
+//	(1, pk..., 0)                    record, in a RecordTypeUnion message
+//	(2, index, values..., pk...)     index entry, empty
+//	(5, index)                       state of an index that is not readable
+//
+// Indexes are named after their subspace in the directory, such as
+// "Email_index", which must also be their name in the Record Layer metadata.
+// Record Layer services can store the records of their split_long_records
+// metadata in several keys, (1, pk..., 1) and on, and their versions in
+// (1, pk..., -1): repositories only read records stored in a single key and
+// clear the other keys of the records they write.
+const (
+    recordLayerStoreInfo  = int64(0)
+    recordLayerRecords    = int64(1)
+    recordLayerIndexes    = int64(2)
+    recordLayerIndexState = int64(5)
+
+    // recordLayerUnsplitRecord is the suffix of records stored in a single
+    // key.
+    recordLayerUnsplitRecord = int64(0)
+)
+
+// recordLayerFormatVersion is the Record Layer format version written in the
+// headers of the stores repositories create. Since format version 5 records
+// stored in a single key have the recordLayerUnsplitRecord suffix, and since
+// version 6 record versions are stored beside their record.
+const recordLayerFormatVersion = 6
+
+// Record Layer index states, stored for the indexes that are not readable.
+const (
+    recordLayerWriteOnly             = int64(1)
+    recordLayerDisabled              = int64(2)
+    recordLayerReadableUniquePending = int64(3)
+)
+
+// ErrRecordStore is matched, with errors.Is, by the errors of repositories
+// opening a Record Layer store laid out differently than they expect.
+var ErrRecordStore = errors.New("incompatible Record Layer store")
+
+// ErrIndexNotReadable is matched, with errors.Is, by the errors of index
+// reads of a Record Layer store whose index is being built or disabled by a
+// Record Layer service, so that its entries may be missing.
+var ErrIndexNotReadable = errors.New("index is not readable")
+
+// openRecordStore checks, in tr, the header of the Record Layer store in dir,
+// which must hold records in single keys with the suffix and the metadata
+// version metaDataVersion, or writes it if the store is new.
+func openRecordStore(tr fdb.Transaction, dir subspace.Subspace, metaDataVersion int) error {
+    key := dir.Pack(tuple.Tuple{recordLayerStoreInfo})
+    header, err := tr.Get(key).Get()
+    if err != nil {
+        return err
+    }
+    if header == nil {
+        tr.Set(key, storeHeader{formatVersion: recordLayerFormatVersion, metaDataVersion: metaDataVersion}.marshal())
+        return nil
+    }
+    h, err := parseStoreHeader(header)
+    if err != nil {
+        return fmt.Errorf("reading the Record Layer store header: %w", err)
+    }
+    switch {
+    case h.formatVersion < 5 || h.omitUnsplitSuffix:
+        return fmt.Errorf("records of format version %d are stored without suffix: %w", h.formatVersion, ErrRecordStore)
+    case h.metaDataVersion != metaDataVersion:
+        return fmt.Errorf("store of metadata version %d, not %d: %w", h.metaDataVersion, metaDataVersion, ErrRecordStore)
+    }
+    return nil
+}
+
+// storeHeader holds the fields of the DataStoreInfo message of a Record
+// Layer store header that repositories check.
+type storeHeader struct {
+    formatVersion     int
+    metaDataVersion   int
+    omitUnsplitSuffix bool
+}
+
+// DataStoreInfo field numbers
+const (
+    storeHeaderFormatVersion     = protowire.Number(1)
+    storeHeaderMetaDataVersion   = protowire.Number(2)
+    storeHeaderOmitUnsplitSuffix = protowire.Number(6)
+)
+
+// marshal encodes the header of a new store.
+func (h storeHeader) marshal() []byte {
+    b := protowire.AppendTag(nil, storeHeaderFormatVersion, protowire.VarintType)
+    b = protowire.AppendVarint(b, uint64(h.formatVersion))
+    b = protowire.AppendTag(b, storeHeaderMetaDataVersion, protowire.VarintType)
+    return protowire.AppendVarint(b, uint64(h.metaDataVersion))
+}
+
+// parseStoreHeader decodes the fields of a store header repositories check,
+// skipping the others.
+func parseStoreHeader(b []byte) (storeHeader, error) {
+    var h storeHeader
+    for len(b) > 0 {
+        num, typ, n := protowire.ConsumeTag(b)
+        if n < 0 {
+            return h, protowire.ParseError(n)
+        }
+        b = b[n:]
+        if typ != protowire.VarintType {
+            n = protowire.ConsumeFieldValue(num, typ, b)
+            if n < 0 {
+                return h, protowire.ParseError(n)
+            }
+            b = b[n:]
+            continue
+        }
+        v, n := protowire.ConsumeVarint(b)
+        if n < 0 {
+            return h, protowire.ParseError(n)
+        }
+        b = b[n:]
+        switch num {
+        case storeHeaderFormatVersion:
+            h.formatVersion = int(int32(v))
+        case storeHeaderMetaDataVersion:
+            h.metaDataVersion = int(int32(v))
+        case storeHeaderOmitUnsplitSuffix:
+            h.omitUnsplitSuffix = v != 0
+        }
+    }
+    return h, nil
+}
+
+// checkIndexReadable returns an error matching ErrIndexNotReadable unless
+// the named index of the Record Layer store in dir is readable. Its state is
+// read in tr, so that a concurrent change of the state conflicts.
+func checkIndexReadable(tr fdb.ReadTransaction, dir subspace.Subspace, index string) error {
+    value, err := tr.Get(dir.Pack(tuple.Tuple{recordLayerIndexState, index})).Get()
+    if err != nil || value == nil {
+        return err
+    }
+    state, err := tuple.Unpack(value)
+    if err != nil {
+        return err
+    }
+    if len(state) == 1 {
+        switch state[0] {
+        case recordLayerReadableUniquePending:
+            // Readable, though uniqueness is not enforced yet
+            return nil
+        case recordLayerWriteOnly:
+            return fmt.Errorf("index %s is write-only: %w", index, ErrIndexNotReadable)
+        case recordLayerDisabled:
+            return fmt.Errorf("index %s is disabled: %w", index, ErrIndexNotReadable)
+        }
+    }
+    return fmt.Errorf("index %s has state %v: %w", index, state, ErrIndexNotReadable)
+}
+
+// appendUnionRecord appends to buf the RecordTypeUnion message of a Record
+// Layer store holding record, encoded with opts, in field.
+func appendUnionRecord(buf []byte, field protowire.Number, opts proto.MarshalOptions, record proto.Message) ([]byte, error) {
+    buf = protowire.AppendTag(buf, field, protowire.BytesType)
+    buf = protowire.AppendVarint(buf, uint64(opts.Size(record)))
+    return opts.MarshalAppend(buf, record)
+}
+
+// unionRecord returns the encoded record in field of value, a RecordTypeUnion
+// message. It reports false if the field is not set, for records of the
+// other types of the store.
+func unionRecord(value []byte, field protowire.Number) ([]byte, bool, error) {
+    var record []byte
+    found := false
+    for len(value) > 0 {
+        num, typ, n := protowire.ConsumeTag(value)
+        if n < 0 {
+            return nil, false, protowire.ParseError(n)
+        }
+        value = value[n:]
+        if num == field && typ == protowire.BytesType {
+            record, n = protowire.ConsumeBytes(value)
+            found = true
+        } else {
+            n = protowire.ConsumeFieldValue(num, typ, value)
+        }
+        if n < 0 {
+            return nil, false, protowire.ParseError(n)
+        }
+        value = value[n:]
+    }
+    return record, found, nil
+}
+
+// keyValueIterator iterates over the key-values of a range read: an
+// *fdb.RangeIterator, or a bucketIterator merging the records of the buckets
+// of a message type.
+type keyValueIterator interface {
+    Advance() bool
+    Get() (fdb.KeyValue, error)
+}
+
+// bucketIterator merges range reads over the buckets of a message type into
+// primary key order, reading from each bucket as its records are consumed.
+type bucketIterator struct {
+    its     []*fdb.RangeIterator
+    heads   []*bucketHead
+    pkOf    func(fdb.Key) (tuple.Tuple, error)
+    reverse bool
+    started bool
+    current int
+    err     error
+}
+
+// bucketHead is the next record of a bucket, with its packed primary key.
+type bucketHead struct {
+    kv fdb.KeyValue
+    pk string
+}
+
+// newBucketIterator merges its, iterators over the buckets of a message type,
+// by the primary keys pkOf returns for their keys, in descending order if
+// reverse is set.
+func newBucketIterator(its []*fdb.RangeIterator, pkOf func(fdb.Key) (tuple.Tuple, error), reverse bool) *bucketIterator {
+    return &bucketIterator{its: its, heads: make([]*bucketHead, len(its)), pkOf: pkOf, reverse: reverse, current: -1}
+}
+
+// Advance reports whether a bucket has a record left, or an error is to be
+// returned by Get.
+func (it *bucketIterator) Advance() bool {
+    if it.err != nil {
+        return false
+    }
+    if !it.started {
+        // The reads of every bucket were issued when their iterators were
+        // created, so waiting for them one after the other takes as long
+        // as the slowest one
+        it.started = true
+        for i := range it.its {
+            if it.err = it.next(i); it.err != nil {
+                return true
+            }
+        }
+    } else if it.current >= 0 {
+        if it.err = it.next(it.current); it.err != nil {
+            return true
+        }
+    }
+    it.current = -1
+    for i, head := range it.heads {
+        if head != nil && (it.current < 0 || (head.pk < it.heads[it.current].pk) != it.reverse) {
+            it.current = i
+        }
+    }
+    return it.current >= 0
+}
+
+// next reads the next record of bucket i into its head.
+func (it *bucketIterator) next(i int) error {
+    it.heads[i] = nil
+    if !it.its[i].Advance() {
+        return nil
+    }
+    kv, err := it.its[i].Get()
+    if err != nil {
+        return err
+    }
+    pk, err := it.pkOf(kv.Key)
+    if err != nil {
+        return err
+    }
+    it.heads[i] = &bucketHead{kv: kv, pk: string(pk.Pack())}
+    return nil
+}
+
+// Get returns the record following the previous one in primary key order,
+// or the error of a read. Advance must have returned true.
+func (it *bucketIterator) Get() (fdb.KeyValue, error) {
+    if it.err != nil {
+        return fdb.KeyValue{}, it.err
+    }
+    return it.heads[it.current].kv, nil
+}
+
+// Subspaces of a message directory reserved for metadata, under MetaSubspace.
+const (
+    // JobsSubspace holds the checkpoints of resumable maintenance jobs.
+    JobsSubspace = "_jobs"
+    // MarkersSubspace holds the markers of transactions committed at most
+    // once.
+    MarkersSubspace = "_txn"
+    // ChangesSubspace holds the change log of messages with the change_log
+    // option.
+    ChangesSubspace = "_cdc"
+    // CursorsSubspace holds the positions of change log consumers.
+    CursorsSubspace = "_cursors"
+    // ArchiveSubspace holds the stubs of records moved to a blob store.
+    ArchiveSubspace = "_archive"
+    // BlobCleanupSubspace holds the external objects referenced by deleted
+    // records, until CleanupBlobs removes them.
+    BlobCleanupSubspace = "_blobgc"
+    // FieldClocksSubspace holds the update times of the fields of messages
+    // with the field_merge option.
+    FieldClocksSubspace = "_clocks"
+    // CRDTSubspace holds the counters and element sets of records.
+    CRDTSubspace = "_crdt"
+    // AccessStatsSubspace holds the number of reads of records served
+    // through a cache.
+    AccessStatsSubspace = "_hot"
+    // StagedSubspace holds the markers of records written with SetStaged
+    // whose index entries are not all written yet.
+    StagedSubspace = "_staged"
+    // SchemaSubspace holds the schema fingerprint recorded by RecordSchema.
+    SchemaSubspace = "_meta"
+    // VersionsSubspace holds the read version of the transaction that last
+    // wrote each record, part of its ETag.
+    VersionsSubspace = "_versions"
+)
+
+// PluginVersion is the version of the plugin that generated the package.
+const PluginVersion = "{{pluginVersion}}"
+
+// SQLDialect selects the SQL database a replica is maintained in.
+type SQLDialect int
+
+const (
+    Postgres SQLDialect = iota
+    MySQL
+)
+
+// sqlStatements maintain the SQL replica of a message type.
+type sqlStatements struct {
+    schema []string
+    upsert string
+    delete string
+}
+
+// replicaCursorStatement maintains the table storing, for every replicated
+// message type, the cursor of the last change applied.
+type replicaCursorStatement struct {
+    schema string
+    get    string
+    set    string
+}
+
+var replicaCursorStatements = map[SQLDialect]replicaCursorStatement{
+    Postgres: {
+        schema: "CREATE TABLE IF NOT EXISTS fdb_replica_cursors (name TEXT PRIMARY KEY, last_key BYTEA NOT NULL)",
+        get:    "SELECT last_key FROM fdb_replica_cursors WHERE name = $1",
+        set:    "INSERT INTO fdb_replica_cursors (name, last_key) VALUES ($1, $2) ON CONFLICT (name) DO UPDATE SET last_key = EXCLUDED.last_key",
+    },
+    MySQL: {
+        schema: "CREATE TABLE IF NOT EXISTS fdb_replica_cursors (name VARCHAR(255) PRIMARY KEY, last_key VARBINARY(10000) NOT NULL)",
+        get:    "SELECT last_key FROM fdb_replica_cursors WHERE name = ?",
+        set:    "INSERT INTO fdb_replica_cursors (name, last_key) VALUES (?, ?) ON DUPLICATE KEY UPDATE last_key = VALUES(last_key)",
+    },
+}
+
+// SearchOp is an operation on a document of a search index.
+type SearchOp struct {
+    // ID is the document ID, derived from the record's primary key.
+    ID string
+    // Document is the record as JSON, or nil to delete the document.
+    Document []byte
+}
+
+// SearchClient applies operations to a search index, such as an
+// Elasticsearch or OpenSearch index through its bulk API. Operations must be
+// applied in order. They may be applied more than once, since the position
+// of SyncSearch in the change log is saved after Bulk returns.
+type SearchClient interface {
+    Bulk(ctx context.Context, index string, ops []SearchOp) error
+}
+
+// BlobStore stores archived records in object storage such as S3 or GCS.
+type BlobStore interface {
+    Put(ctx context.Context, key string, data []byte) error
+    Get(ctx context.Context, key string) ([]byte, error)
+}
+
+{{if feature "cache"}}// Cache is the optional cache of records in front of FoundationDB, such as
+// an in-process LRU or a memcached client. Values are serialized records.
+type Cache interface {
+    Get(key string) ([]byte, bool)
+    Set(key string, value []byte)
+    Delete(key string)
+}
+
+// accessCounter counts the reads of records, by packed primary key, until
+// they are flushed to the access stats.
+type accessCounter struct {
+    mu     sync.Mutex
+    counts map[string]int64
+}
+
+func (c *accessCounter) add(pk []byte) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    if c.counts == nil {
+        c.counts = map[string]int64{}
+    }
+    c.counts[string(pk)]++
+}
+
+// take returns the counts and resets them.
+func (c *accessCounter) take() map[string]int64 {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    counts := c.counts
+    c.counts = nil
+    return counts
+}
+{{end}}
+// ScanType is how a query reads records.
+type ScanType string
+
+const (
+    // PointScan reads a single record by its full primary key.
+    PointScan ScanType = "point"
+    // PrefixScan reads the records or index entries starting with the values
+    // of leading key fields.
+    PrefixScan ScanType = "prefix"
+    // FullScan reads every record.
+    FullScan ScanType = "full scan"
+)
+
+// QueryPlan describes how a query reads records, as returned by Explain.
+type QueryPlan struct {
+    MessageType string
+    // Index is the subspace of the secondary index read, "" for the primary
+    // key.
+    Index string
+    Scan  ScanType
+    // IndexedFields are the conditions narrowing the range read, by .proto
+    // name.
+    IndexedFields []string
+    // FilteredFields are the conditions checked on every record read.
+    FilteredFields []string
+    // Reason explains the choice of Index and Scan.
+    Reason string
+}
+
+// String returns a one-line description of the plan.
+func (p QueryPlan) String() string {
+    index := "primary key"
+    if p.Index != "" {
+        index = "index " + p.Index
+    }
+    return fmt.Sprintf("%s: %s on %s: %s", p.MessageType, p.Scan, index, p.Reason)
+}
+
+// Cursor identifies the last record of a page returned by List, or the last
+// index entry of a page returned by a GetBy...Page method, to continue from
+// in another transaction.
+type Cursor []byte
+
+// String encodes the cursor for APIs, e.g. as a page token.
+func (c Cursor) String() string {
+    return base64.RawURLEncoding.EncodeToString(c)
+}
+
+// ParseCursor decodes a cursor encoded with String.
+func ParseCursor(s string) (Cursor, error) {
+    return base64.RawURLEncoding.DecodeString(s)
+}
+
+// ListOptions selects a page of records.
+type ListOptions struct {
+    // Limit is the maximum number of records, 0 for all.
+    Limit int
+    // Reverse lists records in descending primary key order.
+    Reverse bool
+    // After continues after the last record of a previous page listed with
+    // the same Reverse. nil starts from the first record.
+    After Cursor
+    // Mode is the streaming mode of the range read, the default
+    // fdb.StreamingModeIterator if zero.
+    Mode fdb.StreamingMode
+}
+
+// BatchLimits bound the transactions ApplyBatch, the Batch methods, writers
+// and Import group operations into. Zero fields take the defaults, which are
+// well below FoundationDB's 10MB and 5 second transaction limits.
+type BatchLimits struct {
+    // MaxBytes bounds the encoded size of the records written per
+    // transaction, 1MB by default.
+    MaxBytes int
+    // MaxOps bounds the number of operations per transaction, 1000 by
+    // default.
+    MaxOps int
+    // MaxDuration bounds the time ApplyBatch spends on the operations of a
+    // transaction before splitting them, 2 seconds by default.
+    MaxDuration time.Duration
+}
+
+// withDefaults returns l with its zero fields set to their defaults.
+func (l BatchLimits) withDefaults() BatchLimits {
+    if l.MaxBytes <= 0 {
+        l.MaxBytes = 1 << 20
+    }
+    if l.MaxOps <= 0 {
+        l.MaxOps = 1000
+    }
+    if l.MaxDuration <= 0 {
+        l.MaxDuration = 2 * time.Second
+    }
+    return l
+}
+
+// QueryOptions shape the index range read by GetBy methods, and the range of
+// primary keys read by ListKeys.
+type QueryOptions struct {
+    // Limit is the maximum number of index entries read, 0 for all. Fewer
+    // records are returned if some entries were left behind by an earlier
+    // version of their record. ListKeys returns at most Limit keys.
+    Limit int
+    // Reverse returns records in descending index order.
+    Reverse bool
+    // Mode is the streaming mode of the range read, the default
+    // fdb.StreamingModeIterator if zero.
+    Mode fdb.StreamingMode
+}
+
+func (o QueryOptions) rangeOptions() fdb.RangeOptions {
+    return fdb.RangeOptions{Limit: o.Limit, Reverse: o.Reverse, Mode: o.Mode}
+}
+
+// lastQueryOptions returns the last of the variadic options of a GetBy
+// method, or the zero options.
+func lastQueryOptions(opts []QueryOptions) QueryOptions {
+    if len(opts) == 0 {
+        return QueryOptions{}
+    }
+    return opts[len(opts)-1]
+}
+
+// TransactionSizeLimit is the FoundationDB limit on the bytes written by a
+// transaction.
+const TransactionSizeLimit = 10_000_000
+
+// TxStats counts the bytes read and written and the mutations made by the
+// generated operations of a transaction, so that batch jobs can commit before
+// reaching the transaction limits. Sizes are approximate: key and value
+// lengths, without the change log and other metadata. It is safe for
+// concurrent use.
+type TxStats struct {
+    readBytes, writtenBytes, mutations atomic.Int64
+}
+
+type txStatsKey struct{}
+
+// WithTxStats returns a context making the operations it is passed to count
+// into the returned stats. Create new stats for every attempt of a
+// transaction.
+func WithTxStats(ctx context.Context) (context.Context, *TxStats) {
+    stats := &TxStats{}
+    return context.WithValue(ctx, txStatsKey{}, stats), stats
+}
+
+// txStatsFrom returns the stats attached to ctx, or nil.
+func txStatsFrom(ctx context.Context) *TxStats {
+    stats, _ := ctx.Value(txStatsKey{}).(*TxStats)
+    return stats
+}
+
+func (s *TxStats) ReadBytes() int64    { return s.readBytes.Load() }
+func (s *TxStats) WrittenBytes() int64 { return s.writtenBytes.Load() }
+func (s *TxStats) Mutations() int64    { return s.mutations.Load() }
+
+// Remaining returns the bytes that can still be written before reaching
+// TransactionSizeLimit.
+func (s *TxStats) Remaining() int64 {
+    return TransactionSizeLimit - s.WrittenBytes()
+}
+
+func (s *TxStats) read(n int) {
+    if s != nil {
+        s.readBytes.Add(int64(n))
+    }
+}
+
+// write counts a mutation of n bytes.
+func (s *TxStats) write(n int) {
+    if s != nil {
+        s.writtenBytes.Add(int64(n))
+        s.mutations.Add(1)
+    }
+}
+
+// SlowOp describes an operation slower than the threshold of a
+// SlowOpLogger.
+type SlowOp struct {
+    Operation   string
+    MessageType string
+    Duration    time.Duration
+    // Rows and Bytes count the records and bytes read or written.
+    Rows  int
+    Bytes int
+    // Retries counts the retried transactions of operations running their
+    // own. It is 0 for operations running in a caller's transaction.
+    Retries int
+}
+
+// SlowOpLogger logs the operations of a repository that take Threshold or
+// more, set with WithSlowOpLogger.
+type SlowOpLogger struct {
+    Threshold time.Duration
+    Log       func(op SlowOp)
+}
+
+// slowOpTimer times an operation for a SlowOpLogger. The methods of a nil
+// timer do nothing, so that operations are cheap without a logger.
+type slowOpTimer struct {
+    SlowOp
+    logger *SlowOpLogger
+    start  time.Time
+}
+
+func (l *SlowOpLogger) start(messageType, operation string) *slowOpTimer {
+    if l == nil {
+        return nil
+    }
+    return &slowOpTimer{SlowOp: SlowOp{Operation: operation, MessageType: messageType}, logger: l, start: time.Now()}
+}
+
+func (t *slowOpTimer) add(rows, n int) {
+    if t != nil {
+        t.Rows += rows
+        t.Bytes += n
+    }
+}
+
+func (t *slowOpTimer) retry() {
+    if t != nil {
+        t.Retries++
+    }
+}
+
+func (t *slowOpTimer) finish() {
+    if t == nil {
+        return
+    }
+    t.Duration = time.Since(t.start)
+    if t.Duration >= t.logger.Threshold {
+        t.logger.Log(t.SlowOp)
+    }
+}
+
+// ErrFullScan is returned by queries rejected by a FullScanGuard.
+var ErrFullScan = errors.New("query would scan every record")
+
+// FullScanGuard protects clusters from queries that no index serves, set on a
+// repository with WithFullScanGuard.
+type FullScanGuard struct {
+    // MaxBytes is the estimated size of the records above which full scans
+    // are guarded.
+    MaxBytes int64
+    // Log, if set, is called for guarded full scans, which then run. If nil,
+    // they fail with ErrFullScan.
+    Log func(plan QueryPlan, estimatedBytes int64)
+}
+
+// QuerySampler samples the queries of the repositories it is set on with
+// WithQuerySampler, recording those with conditions that no index covers, and
+// suggests secondary indexes serving them. It is safe for concurrent use.
+type QuerySampler struct {
+    rate   float64
+    mu     sync.Mutex
+    counts map[querySample]int64
+}
+
+// querySample is a query with unindexed conditions.
+type querySample struct {
+    messageType string
+    // fields are the .proto names of the conditions, the indexed ones first,
+    // joined with commas.
+    fields string
+}
+
+// NewQuerySampler returns a sampler recording the given fraction of queries,
+// between 0 and 1.
+func NewQuerySampler(rate float64) *QuerySampler {
+    return &QuerySampler{rate: rate, counts: map[querySample]int64{}}
+}
+
+// record samples a query with the given conditions, of which indexed narrow
+// the range read.
+func (s *QuerySampler) record(messageType string, indexed, conditions []string) {
+    if len(conditions) == len(indexed) || mathrand.Float64() >= s.rate {
+        return
+    }
+    fields := append([]string{}, indexed...)
+    for _, field := range conditions {
+        if !contains(indexed, field) {
+            fields = append(fields, field)
+        }
+    }
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.counts[querySample{messageType, strings.Join(fields, ",")}]++
+}
+
+func contains(values []string, value string) bool {
+    for _, v := range values {
+        if v == value {
+            return true
+        }
+    }
+    return false
+}
+
+// IndexAdvice suggests a secondary index for sampled queries.
+type IndexAdvice struct {
+    MessageType string
+    // Fields are the .proto names of the index fields, in order.
+    Fields []string
+    // Queries is the number of sampled queries the index would serve.
+    Queries int64
+}
+
+// String returns the annotation adding the index.
+func (a IndexAdvice) String() string {
+    quoted := make([]string, len(a.Fields))
+    for i, field := range a.Fields {
+        quoted[i] = fmt.Sprintf("%q", field)
+    }
+    return fmt.Sprintf("%s: option (annotations.secondary_index) = { fields: [%s] }; // %d sampled queries", a.MessageType, strings.Join(quoted, ", "), a.Queries)
+}
+
+// Report returns the indexes suggested by the queries sampled so far, most
+// useful first.
+func (s *QuerySampler) Report() []IndexAdvice {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    advice := make([]IndexAdvice, 0, len(s.counts))
+    for sample, count := range s.counts {
+        advice = append(advice, IndexAdvice{MessageType: sample.messageType, Fields: strings.Split(sample.fields, ","), Queries: count})
+    }
+    sort.Slice(advice, func(i, j int) bool {
+        if advice[i].Queries != advice[j].Queries {
+            return advice[i].Queries > advice[j].Queries
+        }
+        return advice[i].String() < advice[j].String()
+    })
+    return advice
+}
+
+// FieldDescriptor describes a field that is part of a key.
+type FieldDescriptor struct {
+    // Name is the Go name of the field.
+    Name string
+    // Type is the Go type of the field.
+    Type string
+}
+
+// IndexDescriptor describes a secondary index. Its entries are stored in
+// MetaSubspace(dir, Subspace) of the message directory, or at (2, Subspace)
+// in the directory of Record Layer stores, with empty values, at keys packing
+// Fields followed by the primary key.
+type IndexDescriptor struct {
+    Subspace string
+    Fields   []FieldDescriptor
+    // Unique is set if no two records may have the same values of Fields.
+    Unique bool
+    // Covering is set if the entries hold a copy of their record.
+    Covering bool
+    // Global is set if the entries are also written to the directory
+    // GlobalDirectory followed by the path of the message type, as
+    // (Subspace, Fields..., prefix, primary key...) with prefix the tuple of
+    // the prefix of the repository.
+    Global bool
+    // Keys is set if the index holds the keys of the map field in Fields,
+    // with an entry per key, and the Type of the field is that of its keys.
+    Keys bool
+    // Elements is set if the index holds the elements of the repeated field
+    // in Fields, with an entry per distinct element, and the Type of the
+    // field is that of its elements.
+    Elements bool
+}
+
+// MessageDescriptor describes how a message type is stored, so that tools
+// can work with the keyspace of any generated repository.
+type MessageDescriptor struct {
+    Name          string
+    DirectoryPath []string
+    PrimaryKey    []FieldDescriptor
+    Indexes       []IndexDescriptor
+    // ChangeLog reports whether changes are logged in ChangesSubspace.
+    ChangeLog bool
+    // Buckets is the number of buckets records are spread over, their keys
+    // starting with the bucket of their primary key, or 0 if records are
+    // packed with their primary key alone.
+    Buckets int
+    // RecordLayer reports whether the directory holds a record store of the
+    // Java FDB Record Layer: records at (1, primary key..., 0) and index
+    // entries at (2, subspace, ...), instead of under MetaSubspace.
+    RecordLayer bool
+    // SchemaFingerprint identifies the storage layout of the message type:
+    // code generated from schemas with different fingerprints must not
+    // share its directory.
+    SchemaFingerprint string
+}
+
+// SchemaMismatch reports a message type whose recorded schema fingerprint
+// differs from the one of this package.
+type SchemaMismatch struct {
+    MessageType string
+    // Recorded and RecordedBy are the fingerprint recorded by RecordSchema
+    // and the version of the plugin that generated the recording code.
+    Recorded   string
+    RecordedBy string
+    // Fingerprint is the fingerprint of this package.
+    Fingerprint string
+}
+
+func (m SchemaMismatch) String() string {
+    return fmt.Sprintf("%s: schema %s recorded by code generated with %s, this package has %s (generated with %s)", m.MessageType, m.Recorded, m.RecordedBy, m.Fingerprint, PluginVersion)
+}
+
+// schemaKey returns the key holding the recorded schema of a message type
+// stored in dir.
+func schemaKey(dir subspace.Subspace) fdb.Key {
+    return MetaSubspace(dir, SchemaSubspace).Pack(tuple.Tuple{"fingerprint"})
+}
+
+// CheckSchema compares the schema fingerprints recorded by RecordSchema with
+// those of the message types of this package, and returns the message types
+// that differ. Run it at startup to refuse serving next to instances whose
+// generated code stores records differently. Message types without a
+// recorded fingerprint are not reported. prefix must match the one passed to
+// Init.
+func CheckSchema(ctx context.Context, db fdb.Transactor, prefix ...string) ([]SchemaMismatch, error) {
+    result, err := readTransactContext(ctx, db, func(tr fdb.ReadTransaction) (interface{}, error) {
+        mismatches := []SchemaMismatch{}
+        for _, desc := range Descriptors() {
+            path := append(append([]string{}, prefix...), desc.DirectoryPath...)
+            exists, err := directory.Exists(tr, path)
+            if err != nil {
+                return nil, err
+            }
+            if !exists {
+                continue
+            }
+            dir, err := directory.Open(tr, path, nil)
+            if err != nil {
+                return nil, err
+            }
+            value, err := tr.Get(schemaKey(dir)).Get()
+            if err != nil {
+                return nil, err
+            }
+            if value == nil {
+                continue
+            }
+            tpl, err := tuple.Unpack(value)
+            if err != nil {
+                return nil, err
+            }
+            if len(tpl) != 2 {
+                return nil, fmt.Errorf("%s: malformed schema record %v", desc.Name, tpl)
+            }
+            recorded, ok1 := tpl[0].(string)
+            recordedBy, ok2 := tpl[1].(string)
+            if !ok1 || !ok2 {
+                return nil, fmt.Errorf("%s: malformed schema record %v", desc.Name, tpl)
+            }
+            if recorded != desc.SchemaFingerprint {
+                mismatches = append(mismatches, SchemaMismatch{MessageType: desc.Name, Recorded: recorded, RecordedBy: recordedBy, Fingerprint: desc.SchemaFingerprint})
+            }
+        }
+        return mismatches, nil
+    })
+    if err != nil {
+        return nil, err
+    }
+    return result.([]SchemaMismatch), nil
+}
+
+// RecordSchema records the schema fingerprints of the message types of this
+// package, creating their directories if needed, for CheckSchema to compare
+// against. Run it once a deployment of a new schema has replaced every
+// instance running the previous one.
+func RecordSchema(ctx context.Context, db fdb.Transactor, prefix ...string) error {
+    _, err := transactContext(ctx, db, func(tr fdb.Transaction) (interface{}, error) {
+        for _, desc := range Descriptors() {
+            path := append(append([]string{}, prefix...), desc.DirectoryPath...)
+            dir, err := directory.CreateOrOpen(tr, path, nil)
+            if err != nil {
+                return nil, err
+            }
+            tr.Set(schemaKey(dir), tuple.Tuple{desc.SchemaFingerprint, PluginVersion}.Pack())
+        }
+        return nil, nil
+    })
+    return err
+}
+
+// MessageHealth is the state of one message type checked by HealthCheck.
+type MessageHealth struct {
+    MessageType string
+    // DirectoryExists reports whether the directory of the message type was
+    // created, by Init or a repository constructor.
+    DirectoryExists bool
+    // SchemaMismatch is set if the recorded schema fingerprint differs from
+    // the one of this package.
+    SchemaMismatch *SchemaMismatch
+    // Latency is the time taken to write a probe key into the directory and
+    // read it back in a second transaction.
+    Latency time.Duration
+    // Err is the error of the probe, if any.
+    Err error
+}
+
+// Healthy reports whether the message type can be served.
+func (h MessageHealth) Healthy() bool {
+    return h.DirectoryExists && h.SchemaMismatch == nil && h.Err == nil
+}
+
+// HealthReport is the result of HealthCheck.
+type HealthReport struct {
+    Messages []MessageHealth
+}
+
+// Healthy reports whether every message type can be served.
+func (r *HealthReport) Healthy() bool {
+    for _, m := range r.Messages {
+        if !m.Healthy() {
+            return false
+        }
+    }
+    return true
+}
+
+// healthKey returns the key written by the probes of HealthCheck in dir.
+func healthKey(dir subspace.Subspace) fdb.Key {
+    return MetaSubspace(dir, SchemaSubspace).Pack(tuple.Tuple{"health"})
+}
+
+// HealthCheck checks that the cluster is reachable and, for every message
+// type, that its directory exists, that its recorded schema fingerprint
+// matches and how long a write and read round trip takes. It returns an error
+// if the cluster cannot be read at all; the failures of single message types
+// are reported in the HealthReport. Pass a ctx with a deadline, since
+// FoundationDB retries unreachable clusters indefinitely. prefix must match
+// the one passed to Init.
+func HealthCheck(ctx context.Context, db fdb.Transactor, prefix ...string) (*HealthReport, error) {
+    mismatches, err := CheckSchema(ctx, db, prefix...)
+    if err != nil {
+        return nil, err
+    }
+    mismatched := map[string]SchemaMismatch{}
+    for _, m := range mismatches {
+        mismatched[m.MessageType] = m
+    }
+    report := &HealthReport{}
+    for _, desc := range Descriptors() {
+        health := MessageHealth{MessageType: desc.Name}
+        if m, ok := mismatched[desc.Name]; ok {
+            health.SchemaMismatch = &m
+        }
+        path := append(append([]string{}, prefix...), desc.DirectoryPath...)
+        start := time.Now()
+        var key fdb.Key
+        _, err := transactContext(ctx, db, func(tr fdb.Transaction) (interface{}, error) {
+            exists, err := directory.Exists(tr, path)
+            if err != nil || !exists {
+                return nil, err
+            }
+            dir, err := directory.Open(tr, path, nil)
+            if err != nil {
+                return nil, err
+            }
+            key = healthKey(dir)
+            tr.Set(key, tuple.Tuple{start.UnixNano()}.Pack())
+            return nil, nil
+        })
+        if err == nil && key != nil {
+            health.DirectoryExists = true
+            var value interface{}
+            value, err = readTransactContext(ctx, db, func(tr fdb.ReadTransaction) (interface{}, error) {
+                return tr.Get(key).Get()
+            })
+            // Concurrent checks overwrite each other's probes, so only the
+            // presence of one is checked
+            if err == nil && value.([]byte) == nil {
+                err = fmt.Errorf("%s: health probe written but not read back", desc.Name)
+            }
+        }
+        health.Latency = time.Since(start)
+        health.Err = err
+        report.Messages = append(report.Messages, health)
+    }
+    return report, nil
+}
+
+// Descriptors returns the descriptors of all message types of the package.
+func Descriptors() []MessageDescriptor {
+    return []MessageDescriptor{
+        {{range .}}{{.Name}}Descriptor,
+        {{end}}
+    }
+}
+
+// Stores exposes the repositories of every message type of the package,
+// bound to the transaction of a WithStores call.
+type Stores struct {
+    {{range .}}{{.Name}} *{{.Name}}Tx
+    {{end}}
+}
+
+// WithStores runs fn in a retried transaction with all repositories bound to
+// it, so that invariants spanning several message types can be kept without
+// passing the transaction around. fn may run several times and must not have
+// side effects outside the transaction. prefix must match the one passed to
+// Init.
+func WithStores(db fdb.Transactor, fn func(tx *Stores) error, prefix ...string) error {
+    _, err := transact(db, func(tr fdb.Transaction) (interface{}, error) {
+        var err error
+        tx := &Stores{}
+        {{range .}}if tx.{{.Name}}, err = new{{.Name}}Tx(db, tr, prefix); err != nil {
+            return nil, err
+        }
+        {{end}}
+        return nil, fn(tx)
+    })
+    return err
+}
+
+// Store holds the database and the repositories of every message type of the
+// package. Its methods, such as GetUser or SetUser, each run one operation in
+// its own retried transaction; use the repositories, or WithStores, to run
+// several operations in one transaction.
+type Store struct {
+    db fdb.Transactor
+    {{range .}}{{.Name}} *{{.Name}}Repository
+    {{end}}
+}
+
+// NewStore opens the directories of every message type, creating them if
+// needed. A non-empty prefix nests them like in the repository constructors.
+func NewStore(db fdb.Transactor, prefix ...string) (*Store, error) {
+    if err := Init(db, prefix...); err != nil {
+        return nil, err
+    }
+    s := &Store{db: db}
+    var err error
+    {{range .}}if s.{{.Name}}, err = New{{.Name}}Repository(db, prefix...); err != nil {
+        return nil, err
+    }
+    {{end}}
+    return s, nil
+}
+
+// transactContext runs fn in a retried transaction like transact, bound to
+// ctx: no attempt starts once ctx is done, every attempt times out at the
+// deadline of ctx and is cancelled with it, and the error of ctx is returned
+// instead of the resulting transaction_timed_out or transaction_cancelled.
+func transactContext(ctx context.Context, db fdb.Transactor, fn func(fdb.Transaction) (interface{}, error)) (interface{}, error) {
+    result, err := transact(db, func(tr fdb.Transaction) (interface{}, error) {
+        stop, err := bindContext(ctx, tr)
+        if err != nil {
+            return nil, err
+        }
+        defer stop()
+        return fn(tr)
+    })
+    return result, contextError(ctx, err)
+}
+
+// readTransactContext is the read-only counterpart of transactContext.
+func readTransactContext(ctx context.Context, db fdb.Transactor, fn func(fdb.ReadTransaction) (interface{}, error)) (interface{}, error) {
+    result, err := readTransact(db, func(rtr fdb.ReadTransaction) (interface{}, error) {
+        if tr, ok := rtr.(fdb.Transaction); ok {
+            stop, err := bindContext(ctx, tr)
+            if err != nil {
+                return nil, err
+            }
+            defer stop()
+        }
+        return fn(rtr)
+    })
+    return result, contextError(ctx, err)
+}
+
+// bindContext makes the current attempt of tr time out at the deadline of
+// ctx and be cancelled when ctx is. The returned function must be called when
+// the attempt ends.
+func bindContext(ctx context.Context, tr fdb.Transaction) (func(), error) {
+    if err := ctx.Err(); err != nil {
+        return nil, err
+    }
+    if deadline, ok := ctx.Deadline(); ok {
+        // A timeout of 0 disables it
+        timeout := time.Until(deadline).Milliseconds()
+        if timeout < 1 {
+            timeout = 1
+        }
+        if err := tr.Options().SetTimeout(timeout); err != nil {
+            return nil, err
+        }
+    }
+    if ctx.Done() == nil {
+        return func() {}, nil
+    }
+    done := make(chan struct{})
+    go func() {
+        select {
+        case <-ctx.Done():
+            tr.Cancel()
+        case <-done:
+        }
+    }()
+    return func() { close(done) }, nil
+}
+
+// contextError returns the error of ctx instead of err if err is the timeout
+// or cancellation of a transaction bound to ctx.
+func contextError(ctx context.Context, err error) error {
+    var fdbErr fdb.Error
+    if ctx.Err() != nil && errors.As(err, &fdbErr) && (fdbErr.Code == 1031 || fdbErr.Code == 1025) {
+        return ctx.Err()
+    }
+    return err
+}
+
+// transactOnce runs fn in a retried transaction like transact, but commits
+// it at most once. A marker holding a random token is written with fn's
+// writes; when a retry after commit_unknown_result finds it, the earlier
+// attempt committed and fn is not run again. Results must therefore be
+// passed through variables captured by fn, which keep the values of the
+// committed attempt. The marker is cleared once the transaction succeeds.
+func transactOnce(ctx context.Context, db fdb.Transactor, markers subspace.Subspace, fn func(tr fdb.Transaction) error) error {
+    token := make([]byte, 16)
+    if _, err := rand.Read(token); err != nil {
+        return err
+    }
+    marker := markers.Pack(tuple.Tuple{token})
+    _, err := transactContext(ctx, db, func(tr fdb.Transaction) (interface{}, error) {
+        committed, err := tr.Get(marker).Get()
+        if err != nil || committed != nil {
+            return nil, err
+        }
+        if err := fn(tr); err != nil {
+            return nil, err
+        }
+        tr.Set(marker, tuple.Tuple{time.Now().UnixNano()}.Pack())
+        return nil, nil
+    })
+    if err != nil {
+        return err
+    }
+    // A leftover marker only costs space, so failing to clear it is not an
+    // error for the caller.
+    transact(db, func(tr fdb.Transaction) (interface{}, error) {
+        tr.Clear(marker)
+        return nil, nil
+    })
+    return nil
+}
+
+// waitWatches blocks until one of watches fires or fails, or ctx is done, and
+// then cancels them all. Only errors re-establishing the watches cannot fix
+// are returned.
+func waitWatches(ctx context.Context, watches []fdb.FutureNil) error {
+    defer cancelWatches(watches)
+    fired := make(chan error, len(watches))
+    for _, watch := range watches {
+        go func(watch fdb.FutureNil) { fired <- watch.Get() }(watch)
+    }
+    select {
+    case err := <-fired:
+        // too_many_watches
+        var fdbErr fdb.Error
+        if errors.As(err, &fdbErr) && fdbErr.Code == 1032 {
+            return err
+        }
+    case <-ctx.Done():
+    }
+    return nil
+}
+
+func cancelWatches(watches []fdb.FutureNil) {
+    for _, watch := range watches {
+        watch.Cancel()
+    }
+}
+
+// ErrPreconditionFailed is returned by the IfMatch methods when the stored
+// record does not match the given ETag.
+var ErrPreconditionFailed = errors.New("precondition failed")
+
+// ETagAny matches any stored record, like "If-Match: *" in HTTP.
+const ETagAny = "*"
+
+// recordETag returns the strong HTTP entity tag of a stored record value and
+// of the version stored beside it: the quoted hex of the first 16 bytes of
+// their SHA-256 hash. It changes with every write of the record, even one
+// storing the same value. Records written before versions were stored have
+// a nil version.
+func recordETag(version, value []byte) string {
+    h := sha256.New()
+    h.Write(version)
+    h.Write(value)
+    return "\"" + hex.EncodeToString(h.Sum(nil)[:16]) + "\""
+}
+
+// matchETag checks an If-Match precondition against the ETag of a stored
+// record, "" if there is no record.
+func matchETag(current, etag string) error {
+    if current == "" || (etag != ETagAny && etag != current) {
+        return ErrPreconditionFailed
+    }
+    return nil
+}
+
+// ErrUniqueViolation is matched, with errors.Is, by the *UniqueViolationError
+// returned when a write would give the values of a unique index to a second
+// record.
+var ErrUniqueViolation = errors.New("unique index violation")
+
+// UniqueViolationError reports a write rejected by a unique index.
+type UniqueViolationError struct {
+    MessageType string
+    // Index is the subspace of the index, as in IndexDescriptor.
+    Index string
+    // Values are the values of the index fields.
+    Values tuple.Tuple
+    // Owner is the primary key of the record that already has Values.
+    Owner tuple.Tuple
+}
+
+func (e *UniqueViolationError) Error() string {
+    return fmt.Sprintf("%s: %s %v already used by %v", e.MessageType, e.Index, e.Values, e.Owner)
+}
+
+func (e *UniqueViolationError) Unwrap() error {
+    return ErrUniqueViolation
+}
+
+// Serializer encodes the records of the message types whose serializer
+// option names it. It must be safe for concurrent use.
+type Serializer interface {
+    Marshal(m proto.Message) ([]byte, error)
+    Unmarshal(data []byte, m proto.Message) error
+}
+
+var (
+    serializersMu sync.RWMutex
+    serializers   = map[string]Serializer{
+        "proto":     protoSerializer{},
+        "protojson": protoJSONSerializer{},
+    }
+)
+
+// RegisterSerializer registers s under name, for the message types whose
+// serializer option is name. Call it from an init function, before any
+// repository reads or writes records.
+func RegisterSerializer(name string, s Serializer) {
+    serializersMu.Lock()
+    defer serializersMu.Unlock()
+    serializers[name] = s
+}
+
+func lookupSerializer(name string) (Serializer, error) {
+    serializersMu.RLock()
+    defer serializersMu.RUnlock()
+    s, ok := serializers[name]
+    if !ok {
+        return nil, fmt.Errorf("serializer %q is not registered", name)
+    }
+    return s, nil
+}
+
+// protoSerializer is the binary protobuf encoding, the default.
+type protoSerializer struct{}
+
+func (protoSerializer) Marshal(m proto.Message) ([]byte, error) {
+    return proto.Marshal(m)
+}
+
+func (protoSerializer) Unmarshal(data []byte, m proto.Message) error {
+    return proto.Unmarshal(data, m)
+}
+
+// protoJSONSerializer stores records as protojson, readable in debugging
+// tools at the cost of size and speed. Unknown fields, written by newer
+// schemas, are ignored.
+type protoJSONSerializer struct{}
+
+func (protoJSONSerializer) Marshal(m proto.Message) ([]byte, error) {
+    return protojson.Marshal(m)
+}
+
+func (protoJSONSerializer) Unmarshal(data []byte, m proto.Message) error {
+    return protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(data, m)
+}
+
+// recordVersionMarker starts the stored values of message types with the
+// previous_version option, followed by the version of the record as a
+// uvarint. No binary protobuf or JSON encoding starts with it, so values
+// written before the option was declared are told apart; custom Serializers
+// of such message types must not produce values starting with it either.
+const recordVersionMarker = 0xff
+
+// ErrNoConverter is returned when reading a record stored as an earlier type
+// of its message type whose converter is not registered.
+var ErrNoConverter = errors.New("no converter registered for record version")
+
+// appendRecordVersion appends the envelope of a record of the given version
+// to buf.
+func appendRecordVersion(buf []byte, version uint64) []byte {
+    return binary.AppendUvarint(append(buf, recordVersionMarker), version)
+}
+
+// splitRecordVersion returns the version of a stored value and the encoded
+// record it holds, or false if the value has no envelope.
+func splitRecordVersion(value []byte) (uint64, []byte, bool) {
+    if len(value) == 0 || value[0] != recordVersionMarker {
+        return 0, value, false
+    }
+    version, n := binary.Uvarint(value[1:])
+    if n <= 0 {
+        return 0, value, false
+    }
+    return version, value[1+n:], true
+}
+
+// newUUID returns a random version 4 UUID, as auto_uuid fields are set to by
+// Create.
+func newUUID() tuple.UUID {
+    var u tuple.UUID
+    if _, err := rand.Read(u[:]); err != nil {
+        panic(err)
+    }
+    u[6] = u[6]&0x0f | 0x40
+    u[8] = u[8]&0x3f | 0x80
+    return u
+}
+
+// formatUUID returns u in canonical form, e.g.
+// "f81d4fae-7dec-41d0-a765-00a0c91e6bf6".
+func formatUUID(u tuple.UUID) string {
+    var b [36]byte
+    hex.Encode(b[0:8], u[0:4])
+    hex.Encode(b[9:13], u[4:6])
+    hex.Encode(b[14:18], u[6:8])
+    hex.Encode(b[19:23], u[8:10])
+    hex.Encode(b[24:], u[10:])
+    b[8], b[13], b[18], b[23] = '-', '-', '-', '-'
+    return string(b[:])
+}
+
+// uuidFromString parses s, a UUID in canonical form, to pack it. It returns
+// the nil UUID, which Set rejects, if s is not one.
+func uuidFromString(s string) tuple.UUID {
+    var u tuple.UUID
+    if len(s) != 36 || s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-' {
+        return tuple.UUID{}
+    }
+    digits := s[0:8] + s[9:13] + s[14:18] + s[19:23] + s[24:]
+    if _, err := hex.Decode(u[:], []byte(digits)); err != nil {
+        return tuple.UUID{}
+    }
+    return u
+}
+
+// uuidFromBytes converts b, a 16-byte UUID, to pack it. It returns the nil
+// UUID, which Set rejects, if b has another length.
+func uuidFromBytes(b []byte) tuple.UUID {
+    var u tuple.UUID
+    if len(b) != len(u) {
+        return u
+    }
+    copy(u[:], b)
+    return u
+}
+
+// uuidBytes returns u as a byte slice.
+func uuidBytes(u tuple.UUID) []byte {
+    return u[:]
+}
+
+// tupleUint returns the value of an unpacked tuple element holding an
+// unsigned integer, which tuple.Unpack yields as an int64 below 1<<63 and as
+// a uint64 above. It reports false if v is neither.
+func tupleUint(v tuple.TupleElement) (uint64, bool) {
+    switch v := v.(type) {
+    case int64:
+        return uint64(v), v >= 0
+    case uint64:
+        return v, true
+    default:
+        return 0, false
+    }
+}
+
+// timestampKey packs t as a key element: a nested tuple of its Unix seconds
+// and nanoseconds, which sorts by time over the whole range of
+// google.protobuf.Timestamp, unlike Unix nanoseconds alone.
+func timestampKey(t time.Time) tuple.Tuple {
+    return tuple.Tuple{t.Unix(), int64(t.Nanosecond())}
+}
+
+// tupleTimestamp returns the value of an unpacked tuple element packed by
+// timestampKey. It reports false if v is not such a tuple.
+func tupleTimestamp(v tuple.TupleElement) (tuple.Tuple, bool) {
+    t, ok := v.(tuple.Tuple)
+    if !ok || len(t) != 2 {
+        return nil, false
+    }
+    if _, ok := t[0].(int64); !ok {
+        return nil, false
+    }
+    nanos, ok := t[1].(int64)
+    return t, ok && nanos >= 0 && nanos < 1e9
+}
+
+// timeFromKey returns the time packed by timestampKey into t, checked by
+// tupleTimestamp.
+func timeFromKey(t tuple.Tuple) time.Time {
+    return time.Unix(t[0].(int64), t[1].(int64)).UTC()
+}
+
+// ErrInvalidKey is returned by Set when a key field breaks its string_key
+// option, or an auto_uuid field holds no UUID.
+var ErrInvalidKey = errors.New("invalid string key field")
+
+// hashKeyString returns s if it is at most max bytes long, or else its first
+// max-64 bytes followed by the hex SHA-256 of s: max bytes that keep the
+// order of prefixes. Overlong values of string key fields with the hash
+// option are packed this way, and so are the values looking them up.
+func hashKeyString(s string, max int) string {
+    if len(s) <= max {
+        return s
+    }
+    sum := sha256.Sum256([]byte(s))
+    return s[:max-64] + hex.EncodeToString(sum[:])
+}
+
+// maxPooledValueSize bounds the buffers kept by valueBuffers, so that one
+// large record does not pin its buffer for the life of the process.
+const maxPooledValueSize = 64 << 10
+
+// valueBuffers pools the buffers records are marshaled into when written.
+// FoundationDB copies values when they are set, so a buffer can be reused as
+// soon as the write returns.
+var valueBuffers = sync.Pool{
+    New: func() interface{} {
+        buf := make([]byte, 0, 512)
+        return &buf
+    },
+}
+
+func getValueBuffer() *[]byte {
+    return valueBuffers.Get().(*[]byte)
+}
+
+func putValueBuffer(buf *[]byte) {
+    if cap(*buf) > maxPooledValueSize {
+        return
+    }
+    *buf = (*buf)[:0]
+    valueBuffers.Put(buf)
+}
+
+// ErrAlreadyExists is returned when creating a record whose primary key is
+// already stored.
+var ErrAlreadyExists = errors.New("record already exists")
+
+// ErrNotFound is returned when reading or updating a record that is not
+// stored.
+var ErrNotFound = errors.New("record not found")
+
+// ErrImportConflict is returned by Import with ImportFailOnConflict when an
+// incoming record already exists.
+var ErrImportConflict = errors.New("record already exists")
+
+// ImportStrategy decides what Import does with a record whose primary key is
+// already stored.
+type ImportStrategy int
+
+const (
+    // ImportSkipExisting keeps the stored record.
+    ImportSkipExisting ImportStrategy = iota
+    // ImportOverwrite replaces the stored record.
+    ImportOverwrite
+    // ImportFailOnConflict aborts the import with ErrImportConflict.
+    ImportFailOnConflict
+    // ImportMerge stores the result of the merge callback.
+    ImportMerge
+)
+
+// ImportStats summarizes a finished or aborted import.
+type ImportStats struct {
+    Written int // records stored, including overwritten and merged ones
+    Skipped int // records left untouched because they already existed
+}
+
+// Plan reports the changes made by a maintenance operation or, when the
+// repository is in dry-run mode, the changes it would make.
+type Plan struct {
+    Operation      string
+    DryRun         bool
+    Records        int            // records read or affected
+    KeysWritten    int            // keys set
+    KeysCleared    int            // keys cleared
+    Ranges         []fdb.KeyRange // key ranges touched by the operation
+    EstimatedBytes int64          // estimated size of Ranges before the operation
+}
+
+func (p *Plan) add(delta Plan) {
+    p.Records += delta.Records
+    p.KeysWritten += delta.KeysWritten
+    p.KeysCleared += delta.KeysCleared
+}
+
+// Progress is a snapshot of a long-running operation.
+type Progress struct {
+    Operation string
+    Records   int           // records processed so far
+    LastKey   fdb.Key       // last key processed
+    Elapsed   time.Duration
+    ETA       time.Duration // estimated time remaining, zero if unknown
+}
+
+// ProgressReporter receives progress updates from long-running operations
+// such as Purge and RebuildIndexes, so that callers can surface them in
+// their own tooling. ReportProgress is called after every committed batch.
+type ProgressReporter interface {
+    ReportProgress(p Progress)
+}
+
+// progressTracker turns scan positions into Progress reports. The ETA is
+// extrapolated from the bytes processed against the estimated total.
+type progressTracker struct {
+    reporter   ProgressReporter
+    operation  string
+    start      time.Time
+    totalBytes int64
+    doneBytes  int64
+}
+
+func newProgressTracker(reporter ProgressReporter, operation string, totalBytes int64) *progressTracker {
+    return &progressTracker{
+        reporter:   reporter,
+        operation:  operation,
+        start:      time.Now(),
+        totalBytes: totalBytes,
+    }
+}
+
+func (t *progressTracker) report(records int, lastKey fdb.Key, bytes int64) {
+    if t == nil || t.reporter == nil {
+        return
+    }
+    t.doneBytes += bytes
+    p := Progress{
+        Operation: t.operation,
+        Records:   records,
+        LastKey:   lastKey,
+        Elapsed:   time.Since(t.start),
+    }
+    if t.doneBytes > 0 && t.totalBytes > t.doneBytes {
+        p.ETA = time.Duration(float64(p.Elapsed) * float64(t.totalBytes-t.doneBytes) / float64(t.doneBytes))
+    }
+    t.reporter.ReportProgress(p)
+}
+
+// Names of the resumable maintenance jobs, as accepted by GetJobStatus.
+const (
+    JobRebuildIndexes = "RebuildIndexes"
+)
+
+// JobStatus is the checkpointed state of a resumable maintenance job.
+type JobStatus struct {
+    Name        string
+    Phase       int     // index of the key range being scanned
+    Cursor      fdb.Key // last key processed in that range
+    Records     int
+    KeysWritten int
+    KeysCleared int
+    Done        bool
+    StartedAt   time.Time
+    UpdatedAt   time.Time
+}
+
+func (s JobStatus) pack() []byte {
+    return tuple.Tuple{
+        int64(s.Phase),
+        []byte(s.Cursor),
+        int64(s.Records),
+        int64(s.KeysWritten),
+        int64(s.KeysCleared),
+        s.Done,
+        s.StartedAt.UnixNano(),
+        s.UpdatedAt.UnixNano(),
+    }.Pack()
+}
+
+func unpackJobStatus(name string, b []byte) (*JobStatus, error) {
+    tpl, err := tuple.Unpack(b)
+    if err != nil {
+        return nil, err
+    }
+    if len(tpl) != 8 {
+        return nil, fmt.Errorf("job %s: malformed status", name)
+    }
+    phase, ok1 := tpl[0].(int64)
+    cursor, ok2 := tpl[1].([]byte)
+    records, ok3 := tpl[2].(int64)
+    written, ok4 := tpl[3].(int64)
+    cleared, ok5 := tpl[4].(int64)
+    done, ok6 := tpl[5].(bool)
+    started, ok7 := tpl[6].(int64)
+    updated, ok8 := tpl[7].(int64)
+    if !(ok1 && ok2 && ok3 && ok4 && ok5 && ok6 && ok7 && ok8) {
+        return nil, fmt.Errorf("job %s: malformed status", name)
+    }
+    return &JobStatus{
+        Name:        name,
+        Phase:       int(phase),
+        Cursor:      cursor,
+        Records:     int(records),
+        KeysWritten: int(written),
+        KeysCleared: int(cleared),
+        Done:        done,
+        StartedAt:   time.Unix(0, started),
+        UpdatedAt:   time.Unix(0, updated),
+    }, nil
+}
+
+// jobRun carries the state of a maintenance operation across its scans.
+type jobRun struct {
+    plan    *Plan
+    tracker *progressTracker
+    status  *JobStatus // nil if the run is not checkpointed
+    key     fdb.Key    // where status is checkpointed
+}
+
+// TestingT is the subset of testing.TB used by the test helpers, so that the
+// generated package does not import the testing package.
+type TestingT interface {
+    Helper()
+    Fatalf(format string, args ...interface{})
+    Cleanup(func())
+}
+
+// NewTestPrefix returns a unique directory prefix for a test and registers a
+// cleanup that removes everything stored under it. Pass the prefix to the
+// repository constructors to share it between several repositories; the
+// NewTest<Message>Repository helpers do this for a single repository.
+func NewTestPrefix(t TestingT, db fdb.Transactor) []string {
+    t.Helper()
+    id := make([]byte, 8)
+    if _, err := rand.Read(id); err != nil {
+        t.Fatalf("generating test prefix: %v", err)
+    }
+    prefix := []string{"_test", hex.EncodeToString(id)}
+    t.Cleanup(func() {
+        if err := RemovePrefix(db, prefix...); err != nil {
+            t.Fatalf("removing test prefix %v: %v", prefix, err)
+        }
+    })
+    return prefix
+}
+{{end}}`
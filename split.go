@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"path"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// messageFiles are the files split_files=true generates for a message
+// instead of its repository file, by the suffix of their names, with the
+// section of fdbTemplate each holds.
+var messageFiles = []struct{ suffix, template string }{
+	{"store", "messageStore"},
+	{"indexes", "messageIndexes"},
+	{"query", "messageQuery"},
+	{"admin", "messageAdmin"},
+}
+
+// executeMessageFile renders the header of msg followed by the section
+// section, without the imports that section does not use. It returns nil
+// if the section is empty for msg.
+func executeMessageFile(tmpl *template.Template, section string, msg Message) ([]byte, error) {
+	var body bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&body, section, msg); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(body.String()) == "" {
+		return nil, nil
+	}
+	var src bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&src, "header", msg); err != nil {
+		return nil, err
+	}
+	src.Write(body.Bytes())
+	return pruneImports(src.Bytes())
+}
+
+// pruneImports removes the imports that src does not reference. The header
+// imports what the whole repository file of a message needs, which is more
+// than each of its sections does.
+func pruneImports(src []byte) ([]byte, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	// Identifiers that are not declared in the file resolve to nothing;
+	// those selecting a member are package names
+	used := map[string]bool{}
+	ast.Inspect(file, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if ident, ok := sel.X.(*ast.Ident); ok && ident.Obj == nil {
+				used[ident.Name] = true
+			}
+		}
+		return true
+	})
+
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.IMPORT {
+			continue
+		}
+		specs := gen.Specs[:0]
+		for _, spec := range gen.Specs {
+			imp := spec.(*ast.ImportSpec)
+			importPath, err := strconv.Unquote(imp.Path.Value)
+			if err != nil {
+				return nil, err
+			}
+			name := path.Base(importPath)
+			if imp.Name != nil {
+				name = imp.Name.Name
+			}
+			if used[name] || name == "_" {
+				specs = append(specs, spec)
+			}
+		}
+		gen.Specs = specs
+	}
+	file.Imports = nil
+
+	var out bytes.Buffer
+	if err := format.Node(&out, fset, file); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
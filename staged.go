@@ -0,0 +1,164 @@
+package main
+
+// stagedTemplate generates SetStaged, which writes a record in one
+// transaction and its index entries in follow-up transactions. A marker
+// written with the record lists the index entries of the previous version to
+// clear and how far the new entries were written, so that RecoverStaged can
+// finish the work of calls interrupted by a crash.
+const stagedTemplate = `{{define "staged"}}{{if .SecondaryIndexes}}
+// {{lowerFirst .Name}}StagedChunk is the number of index entries SetStaged
+// writes per follow-up transaction.
+const {{lowerFirst .Name}}StagedChunk = 16
+
+// SetStaged is like Set, but for records whose index entries, change log
+// entry and record together could exceed the transaction limits: it writes
+// the record in one transaction and its index entries in follow-up
+// transactions of {{lowerFirst .Name}}StagedChunk entries. Until it returns, the record may
+// be missing from its indexes. If it is interrupted, RecoverStaged writes the
+// remaining entries.
+func (repo *{{.Name}}Repository) SetStaged(ctx context.Context, entity *pb.{{.Name}}) error {
+    _, err := transactContext(ctx, repo.db, func(tr fdb.Transaction) (interface{}, error) {
+        return nil, repo.set(ctx, tr, entity, true)
+    })
+    if err != nil {
+        return err
+    }
+    return repo.applyStaged(ctx, tuple.Tuple{ {{range .PrimaryKeyFields}} {{toTuple (printf "entity.%s" .Path) .}}, {{end}} })
+}
+
+// stageIndexes writes the marker of the record stored at key, whose previous
+// version was previous, adding the index entries of that version to the
+// entries still to clear.
+func (repo *{{.Name}}Repository) stageIndexes(tr fdb.Transaction, key fdb.Key, previous []byte) error {
+    pk, err := repo.recordPK(key)
+    if err != nil {
+        return err
+    }
+    marker := MetaSubspace(repo.dir, StagedSubspace).Pack(pk)
+    pending := tuple.Tuple{int64(0)}
+    existing, err := tr.Get(marker).Get()
+    if err != nil {
+        return err
+    }
+    if existing != nil {
+        tpl, err := tuple.Unpack(existing)
+        if err != nil {
+            return err
+        }
+        pending = append(pending, tpl[1:]...)
+    }
+    if previous != nil {
+        old := &pb.{{.Name}}{}
+        if err := repo.unmarshal(previous, old); err != nil {
+            return err
+        }
+        for _, indexKey := range repo.indexKeys(old) {
+            pending = append(pending, []byte(indexKey))
+        }
+    }
+    tr.Set(marker, pending.Pack())
+    return nil
+}
+
+// applyStaged writes the index entries of the record with primary key pk
+// listed in its marker, then clears the marker. Every transaction reads the
+// record, so the entries written are those of its current version.
+func (repo *{{.Name}}Repository) applyStaged(ctx context.Context, pk tuple.Tuple) error {
+    marker := MetaSubspace(repo.dir, StagedSubspace).Pack(pk)
+    for {
+        if err := ctx.Err(); err != nil {
+            return err
+        }
+        done := false
+        _, err := transactContext(ctx, repo.db, func(tr fdb.Transaction) (interface{}, error) {
+            done = false
+            value, err := tr.Get(marker).Get()
+            if err != nil || value == nil {
+                done = true
+                return nil, err
+            }
+            tpl, err := tuple.Unpack(value)
+            if err != nil {
+                return nil, err
+            }
+            next, ok := tpl[0].(int64)
+            if !ok {
+                return nil, fmt.Errorf("{{.Name}}: malformed staged marker %v", tpl)
+            }
+            record, err := tr.Get(repo.recordKey(pk)).Get()
+            if err != nil {
+                return nil, err
+            }
+            var current []fdb.Key
+            if record != nil {
+                entity := &pb.{{.Name}}{}
+                if err := repo.unmarshal(record, entity); err != nil {
+                    return nil, err
+                }
+                current = repo.indexKeys(entity)
+            }
+
+            if next == 0 {
+                // Clear the entries of earlier versions that no longer apply
+                for _, element := range tpl[1:] {
+                    oldKey, ok := element.([]byte)
+                    if !ok {
+                        return nil, fmt.Errorf("{{.Name}}: malformed staged marker %v", tpl)
+                    }
+                    stale := true
+                    for _, indexKey := range current {
+                        if bytes.Equal(indexKey, oldKey) {
+                            stale = false
+                        }
+                    }
+                    if stale {
+                        tr.Clear(fdb.Key(oldKey))
+                    }
+                }
+            }
+            end := int(next) + {{lowerFirst .Name}}StagedChunk
+            if end > len(current) {
+                end = len(current)
+            }
+            for i := int(next); i < end; i++ {
+                tr.Set(current[i], repo.indexValue(i, record))
+            }
+            if end == len(current) {
+                tr.Clear(marker)
+                done = true
+            } else {
+                tr.Set(marker, tuple.Tuple{int64(end)}.Pack())
+            }
+            return nil, nil
+        })
+        if err != nil || done {
+            return err
+        }
+    }
+}
+
+// RecoverStaged writes the remaining index entries of the records whose
+// SetStaged was interrupted. Run it at startup or periodically, for example
+// as a WorkerJob. It returns the number of records recovered.
+func (repo *{{.Name}}Repository) RecoverStaged(ctx context.Context) (int, error) {
+    staged := MetaSubspace(repo.dir, StagedSubspace)
+    result, err := readTransactContext(ctx, repo.db, func(tr fdb.ReadTransaction) (interface{}, error) {
+        return tr.GetRange(staged, fdb.RangeOptions{}).GetSliceWithError()
+    })
+    if err != nil {
+        return 0, err
+    }
+    recovered := 0
+    for _, kv := range result.([]fdb.KeyValue) {
+        pk, err := staged.Unpack(kv.Key)
+        if err != nil {
+            return recovered, err
+        }
+        if err := repo.applyStaged(ctx, pk); err != nil {
+            return recovered, err
+        }
+        recovered++
+    }
+    return recovered, nil
+}
+{{end}}{{end}}`
@@ -0,0 +1,244 @@
+package main
+
+// storesTemplate generates the per-message half of Stores, a repository
+// bound to the transaction run by WithStores, and of Store, whose methods run
+// their own retried transactions.
+const storesTemplate = `{{define "stores"}}
+// {{.Name}}Tx is a {{.Name}}Repository bound to one transaction, as exposed
+// by Stores. Its methods are those of the repository without the
+// transaction argument.
+type {{.Name}}Tx struct {
+    repo *{{.Name}}Repository
+    tr   fdb.Transaction
+}
+
+// new{{.Name}}Tx opens the {{.Name}} directories in tr and binds a repository
+// to it, opened like by New{{.Name}}Repository.
+func new{{.Name}}Tx(db fdb.Transactor, tr fdb.Transaction, prefix []string) (*{{.Name}}Tx, error) {
+    repo, err := open{{.Name}}Repository(db, tr, prefix)
+    if err != nil {
+        return nil, err
+    }
+    return &{{.Name}}Tx{repo: repo, tr: tr}, nil
+}
+
+func (tx *{{.Name}}Tx) Get(ctx context.Context, {{range $index, $element := .PrimaryKeyFields}}{{if $index}}, {{end}}{{.Name}} {{.Type}}{{end}}) (*pb.{{.Name}}, error) {
+    return tx.repo.Get(ctx, tx.tr, {{range $index, $element := .PrimaryKeyFields}}{{if $index}}, {{end}}{{.Name}}{{end}})
+}
+
+func (tx *{{.Name}}Tx) GetInto(ctx context.Context, {{range $index, $element := .PrimaryKeyFields}}{{if $index}}, {{end}}{{.Name}} {{.Type}}{{end}}, dst *pb.{{.Name}}) error {
+    return tx.repo.GetInto(ctx, tx.tr, {{range $index, $element := .PrimaryKeyFields}}{{if $index}}, {{end}}{{.Name}}{{end}}, dst)
+}
+
+func (tx *{{.Name}}Tx) Exists(ctx context.Context, {{range $index, $element := .PrimaryKeyFields}}{{if $index}}, {{end}}{{.Name}} {{.Type}}{{end}}) (bool, error) {
+    return tx.repo.Exists(ctx, tx.tr, {{range $index, $element := .PrimaryKeyFields}}{{if $index}}, {{end}}{{.Name}}{{end}})
+}
+
+func (tx *{{.Name}}Tx) Set(ctx context.Context, entity *pb.{{.Name}}) error {
+    return tx.repo.Set(ctx, tx.tr, entity)
+}
+
+func (tx *{{.Name}}Tx) Create(ctx context.Context, entity *pb.{{.Name}}) {{with .AutoUUIDField}}({{.Type}}, error){{else}}error{{end}} {
+    return tx.repo.Create(ctx, tx.tr, entity)
+}
+
+func (tx *{{.Name}}Tx) GetOrCreate(ctx context.Context, {{range $index, $element := .PrimaryKeyFields}}{{if $index}}, {{end}}{{.Name}} {{.Type}}{{end}}, factory func() *pb.{{.Name}}) (*pb.{{.Name}}, bool, error) {
+    return tx.repo.GetOrCreate(ctx, tx.tr, {{range $index, $element := .PrimaryKeyFields}}{{if $index}}, {{end}}{{.Name}}{{end}}, factory)
+}
+
+func (tx *{{.Name}}Tx) Update(ctx context.Context, entity *pb.{{.Name}}) error {
+    return tx.repo.Update(ctx, tx.tr, entity)
+}
+
+func (tx *{{.Name}}Tx) Upsert(ctx context.Context, entity *pb.{{.Name}}) error {
+    return tx.repo.Upsert(ctx, tx.tr, entity)
+}
+
+func (tx *{{.Name}}Tx) Delete(ctx context.Context, {{range $index, $element := .PrimaryKeyFields}}{{if $index}}, {{end}}{{.Name}} {{.Type}}{{end}}) error {
+    return tx.repo.Delete(ctx, tx.tr, {{range $index, $element := .PrimaryKeyFields}}{{if $index}}, {{end}}{{.Name}}{{end}})
+}
+
+func (tx *{{.Name}}Tx) RenameKey(ctx context.Context, oldKey, newKey {{.Name}}Key) error {
+    return tx.repo.RenameKey(ctx, tx.tr, oldKey, newKey)
+}
+
+func (tx *{{.Name}}Tx) MultiGet(ctx context.Context, keys []{{.Name}}Key) ([]*pb.{{.Name}}, error) {
+    return tx.repo.MultiGet(ctx, tx.tr, keys)
+}
+
+func (tx *{{.Name}}Tx) ListKeys(ctx context.Context, opts QueryOptions) ([]{{.Name}}Key, error) {
+    return tx.repo.ListKeys(ctx, tx.tr, opts)
+}
+{{range $idx := .SecondaryIndexes}}
+func (tx *{{$.Name}}Tx) GetBy{{$idx.Name}}(ctx context.Context, {{range $i, $f := $idx.Fields}}{{if $i}}, {{end}}{{$f.Name}} {{$f.Type}}{{end}}, opts ...QueryOptions) ([]*pb.{{$.Name}}, error) {
+    return tx.repo.GetBy{{$idx.Name}}(ctx, tx.tr, {{range $i, $f := $idx.Fields}}{{if $i}}, {{end}}{{$f.Name}}{{end}}, opts...)
+}
+
+func (tx *{{$.Name}}Tx) DeleteBy{{$idx.Name}}(ctx context.Context, {{range $i, $f := $idx.Fields}}{{if $i}}, {{end}}{{$f.Name}} {{$f.Type}}{{end}}) (int, error) {
+    return tx.repo.DeleteBy{{$idx.Name}}(ctx, tx.tr, {{range $i, $f := $idx.Fields}}{{if $i}}, {{end}}{{$f.Name}}{{end}})
+}
+{{end}}{{range $ei := .ElementIndexes}}
+func (tx *{{$.Name}}Tx) GetBy{{$ei.Name}}(ctx context.Context, {{$ei.Param}} {{$ei.Element.Type}}, opts ...QueryOptions) ([]*pb.{{$.Name}}, error) {
+    return tx.repo.GetBy{{$ei.Name}}(ctx, tx.tr, {{$ei.Param}}, opts...)
+}
+{{end}}{{range $prefix := .IndexPrefixes}}
+func (tx *{{$.Name}}Tx) GetBy{{$prefix.Name}}(ctx context.Context, {{range $i, $f := $prefix.Fields}}{{if $i}}, {{end}}{{$f.Name}} {{$f.Type}}{{end}}, opts ...QueryOptions) ([]*pb.{{$.Name}}, error) {
+    return tx.repo.GetBy{{$prefix.Name}}(ctx, tx.tr, {{range $i, $f := $prefix.Fields}}{{if $i}}, {{end}}{{$f.Name}}{{end}}, opts...)
+}
+{{end}}
+// Get{{.Name}} reads a {{.Name}} in its own retried transaction.
+func (s *Store) Get{{.Name}}(ctx context.Context, {{range $index, $element := .PrimaryKeyFields}}{{if $index}}, {{end}}{{.Name}} {{.Type}}{{end}}) (*pb.{{.Name}}, error) {
+    result, err := readTransactContext(ctx, s.db, func(tr fdb.ReadTransaction) (interface{}, error) {
+        return s.{{.Name}}.Get(ctx, tr, {{range $index, $element := .PrimaryKeyFields}}{{if $index}}, {{end}}{{.Name}}{{end}})
+    })
+    if err != nil {
+        return nil, err
+    }
+    return result.(*pb.{{.Name}}), nil
+}
+
+// Exists{{.Name}} reports whether a {{.Name}} exists in its own retried
+// transaction.
+func (s *Store) Exists{{.Name}}(ctx context.Context, {{range $index, $element := .PrimaryKeyFields}}{{if $index}}, {{end}}{{.Name}} {{.Type}}{{end}}) (bool, error) {
+    result, err := readTransactContext(ctx, s.db, func(tr fdb.ReadTransaction) (interface{}, error) {
+        return s.{{.Name}}.Exists(ctx, tr, {{range $index, $element := .PrimaryKeyFields}}{{if $index}}, {{end}}{{.Name}}{{end}})
+    })
+    if err != nil {
+        return false, err
+    }
+    return result.(bool), nil
+}
+
+// MultiGet{{.Name}} reads many {{.Name}} records by primary key in its own
+// retried transaction, like {{.Name}}Repository.MultiGet.
+func (s *Store) MultiGet{{.Name}}(ctx context.Context, keys []{{.Name}}Key) ([]*pb.{{.Name}}, error) {
+    result, err := readTransactContext(ctx, s.db, func(tr fdb.ReadTransaction) (interface{}, error) {
+        return s.{{.Name}}.MultiGet(ctx, tr, keys)
+    })
+    if err != nil {
+        return nil, err
+    }
+    return result.([]*pb.{{.Name}}), nil
+}
+
+// Set{{.Name}} writes a {{.Name}} in its own retried transaction.
+func (s *Store) Set{{.Name}}(ctx context.Context, entity *pb.{{.Name}}) error {
+    _, err := transactContext(ctx, s.db, func(tr fdb.Transaction) (interface{}, error) {
+        return nil, s.{{.Name}}.Set(ctx, tr, entity)
+    })
+    return err
+}
+
+{{with .AutoUUIDField}}// Create{{$.Name}} creates a {{$.Name}} in its own transaction, failing with
+// Err{{$.Name}}AlreadyExists if it exists. An empty {{.Name}} is first set to a
+// new random UUID. It returns the {{.Name}} of the record. The transaction is
+// committed at most once, so that a retry after commit_unknown_result does not
+// find the record it created.
+func (s *Store) Create{{$.Name}}(ctx context.Context, entity *pb.{{$.Name}}) ({{.Type}}, error) {
+    err := transactOnce(ctx, s.db, MetaSubspace(s.{{$.Name}}.dir, MarkersSubspace), func(tr fdb.Transaction) error {
+        _, err := s.{{$.Name}}.Create(ctx, tr, entity)
+        return err
+    })
+    return entity.{{.Name}}, err
+}{{else}}// Create{{.Name}} creates a {{.Name}} in its own transaction, failing with
+// Err{{.Name}}AlreadyExists if it exists. The transaction is committed at most
+// once, so that a retry after commit_unknown_result does not find the record
+// it created.
+func (s *Store) Create{{.Name}}(ctx context.Context, entity *pb.{{.Name}}) error {
+    return transactOnce(ctx, s.db, MetaSubspace(s.{{.Name}}.dir, MarkersSubspace), func(tr fdb.Transaction) error {
+        return s.{{.Name}}.Create(ctx, tr, entity)
+    })
+}{{end}}
+
+// GetOrCreate{{.Name}} returns a {{.Name}}, creating it from factory if it does
+// not exist, in its own transaction, committed at most once like in
+// Create{{.Name}}. factory may be called once per attempt.
+func (s *Store) GetOrCreate{{.Name}}(ctx context.Context, {{range $index, $element := .PrimaryKeyFields}}{{if $index}}, {{end}}{{.Name}} {{.Type}}{{end}}, factory func() *pb.{{.Name}}) (*pb.{{.Name}}, bool, error) {
+    var entity *pb.{{.Name}}
+    var created bool
+    err := transactOnce(ctx, s.db, MetaSubspace(s.{{.Name}}.dir, MarkersSubspace), func(tr fdb.Transaction) error {
+        var err error
+        entity, created, err = s.{{.Name}}.GetOrCreate(ctx, tr, {{range $index, $element := .PrimaryKeyFields}}{{if $index}}, {{end}}{{.Name}}{{end}}, factory)
+        return err
+    })
+    if err != nil {
+        return nil, false, err
+    }
+    return entity, created, nil
+}
+
+// Update{{.Name}} replaces a {{.Name}} in its own retried transaction, failing
+// with Err{{.Name}}NotFound if it does not exist.
+func (s *Store) Update{{.Name}}(ctx context.Context, entity *pb.{{.Name}}) error {
+    _, err := transactContext(ctx, s.db, func(tr fdb.Transaction) (interface{}, error) {
+        return nil, s.{{.Name}}.Update(ctx, tr, entity)
+    })
+    return err
+}
+
+// Upsert{{.Name}} writes a {{.Name}}, existing or not, in its own retried
+// transaction.
+func (s *Store) Upsert{{.Name}}(ctx context.Context, entity *pb.{{.Name}}) error {
+    _, err := transactContext(ctx, s.db, func(tr fdb.Transaction) (interface{}, error) {
+        return nil, s.{{.Name}}.Upsert(ctx, tr, entity)
+    })
+    return err
+}
+
+// Delete{{.Name}} deletes a {{.Name}} in its own retried transaction.
+func (s *Store) Delete{{.Name}}(ctx context.Context, {{range $index, $element := .PrimaryKeyFields}}{{if $index}}, {{end}}{{.Name}} {{.Type}}{{end}}) error {
+    _, err := transactContext(ctx, s.db, func(tr fdb.Transaction) (interface{}, error) {
+        return nil, s.{{.Name}}.Delete(ctx, tr, {{range $index, $element := .PrimaryKeyFields}}{{if $index}}, {{end}}{{.Name}}{{end}})
+    })
+    return err
+}
+
+// Rename{{.Name}}Key moves a {{.Name}} to another primary key in its own retried
+// transaction, like {{.Name}}Repository.RenameKey.
+func (s *Store) Rename{{.Name}}Key(ctx context.Context, oldKey, newKey {{.Name}}Key) error {
+    _, err := transactContext(ctx, s.db, func(tr fdb.Transaction) (interface{}, error) {
+        return nil, s.{{.Name}}.RenameKey(ctx, tr, oldKey, newKey)
+    })
+    return err
+}
+
+// List{{.Name}} reads a page of {{.Name}} records in its own retried
+// transaction, like {{.Name}}Repository.List.
+func (s *Store) List{{.Name}}(ctx context.Context, opts ListOptions) ([]*pb.{{.Name}}, Cursor, error) {
+    var cursor Cursor
+    result, err := readTransactContext(ctx, s.db, func(tr fdb.ReadTransaction) (interface{}, error) {
+        entities, next, err := s.{{.Name}}.List(ctx, tr, opts)
+        cursor = next
+        return entities, err
+    })
+    if err != nil {
+        return nil, nil, err
+    }
+    return result.([]*pb.{{.Name}}), cursor, nil
+}
+{{range $idx := .SecondaryIndexes}}
+// Get{{$.Name}}By{{$idx.Name}} reads the {{$.Name}} records of an index in its own
+// retried transaction.
+func (s *Store) Get{{$.Name}}By{{$idx.Name}}(ctx context.Context, {{range $i, $f := $idx.Fields}}{{if $i}}, {{end}}{{$f.Name}} {{$f.Type}}{{end}}, opts ...QueryOptions) ([]*pb.{{$.Name}}, error) {
+    result, err := readTransactContext(ctx, s.db, func(tr fdb.ReadTransaction) (interface{}, error) {
+        return s.{{$.Name}}.GetBy{{$idx.Name}}(ctx, tr, {{range $i, $f := $idx.Fields}}{{if $i}}, {{end}}{{$f.Name}}{{end}}, opts...)
+    })
+    if err != nil {
+        return nil, err
+    }
+    return result.([]*pb.{{$.Name}}), nil
+}
+
+// Delete{{$.Name}}By{{$idx.Name}} deletes the {{$.Name}} records of an index in its
+// own retried transaction and returns how many were deleted.
+func (s *Store) Delete{{$.Name}}By{{$idx.Name}}(ctx context.Context, {{range $i, $f := $idx.Fields}}{{if $i}}, {{end}}{{$f.Name}} {{$f.Type}}{{end}}) (int, error) {
+    result, err := transactContext(ctx, s.db, func(tr fdb.Transaction) (interface{}, error) {
+        return s.{{$.Name}}.DeleteBy{{$idx.Name}}(ctx, tr, {{range $i, $f := $idx.Fields}}{{if $i}}, {{end}}{{$f.Name}}{{end}})
+    })
+    if err != nil {
+        return 0, err
+    }
+    return result.(int), nil
+}
+{{end}}
+{{end}}`
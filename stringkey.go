@@ -0,0 +1,20 @@
+package main
+
+// stringKeyTemplate generates the validation of string key fields with the
+// string_key option, which Set runs before writing keys, so that input
+// cannot make unreadably long or malformed keys. Overlong values of fields
+// with hash set are not rejected: toTuple packs them with hashKeyString.
+const stringKeyTemplate = `{{define "stringKey"}}{{if .HasStringKeys}}
+// validate{{.Name}}StringKeys checks the string key fields of entity against
+// their string_key option.
+func validate{{.Name}}StringKeys(entity *pb.{{.Name}}) error {
+    {{range .StringKeyFields}}{{if .StringKey.RejectNull}}if strings.IndexByte(entity.{{.Path}}, 0) >= 0 {
+        return fmt.Errorf("{{$.Name}}: {{.Name}} holds a null byte: %w", ErrInvalidKey)
+    }
+    {{end}}{{if and .StringKey.MaxBytes (not .StringKey.Hash)}}if len(entity.{{.Path}}) > {{.StringKey.MaxBytes}} {
+        return fmt.Errorf("{{$.Name}}: {{.Name}} is longer than {{.StringKey.MaxBytes}} bytes: %w", ErrInvalidKey)
+    }
+    {{end}}{{end}}
+    return nil
+}
+{{end}}{{end}}`
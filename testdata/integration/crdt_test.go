@@ -0,0 +1,67 @@
+package repositories_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+
+	"example.com/fixtures/pb"
+	"example.com/fixtures/repositories"
+)
+
+// getLogins returns the logins counter of account 1.
+func getLogins(t *testing.T, repo *repositories.AccountRepository) int64 {
+	t.Helper()
+	var logins int64
+	transact(t, func(tr fdb.Transaction) error {
+		account, err := repo.Get(context.Background(), tr, 1)
+		logins = account.GetLogins()
+		return err
+	})
+	return logins
+}
+
+// TestSetKeepsConcurrentCounterChanges checks that Set of a record read
+// before a concurrent AddLogins does not undo it, and that Set initializes
+// the counter of new records.
+func TestSetKeepsConcurrentCounterChanges(t *testing.T) {
+	ctx := context.Background()
+	repo := repositories.NewTestAccountRepository(t, repositories.TestDB)
+	transact(t, func(tr fdb.Transaction) error {
+		return repo.Set(ctx, tr, &pb.Account{Id: 1, Region: "eu", Logins: 3})
+	})
+	if logins := getLogins(t, repo); logins != 3 {
+		t.Fatalf("Set of a new account stored %d logins, want 3", logins)
+	}
+
+	// The account is read, changed and written back while another client
+	// adds logins, such as by an API handler between two requests
+	var account *pb.Account
+	transact(t, func(tr fdb.Transaction) error {
+		var err error
+		account, err = repo.Get(ctx, tr, 1)
+		return err
+	})
+	transact(t, func(tr fdb.Transaction) error {
+		repo.AddLogins(ctx, tr, 1, 5)
+		return nil
+	})
+	account.Region = "us"
+	transact(t, func(tr fdb.Transaction) error {
+		return repo.Set(ctx, tr, account)
+	})
+	if logins := getLogins(t, repo); logins != 8 {
+		t.Errorf("Set after a concurrent AddLogins left %d logins, want 8", logins)
+	}
+
+	transact(t, func(tr fdb.Transaction) error {
+		if err := repo.Delete(ctx, tr, 1); err != nil {
+			return err
+		}
+		return repo.Create(ctx, tr, &pb.Account{Id: 1, Logins: 1})
+	})
+	if logins := getLogins(t, repo); logins != 1 {
+		t.Errorf("Create after Delete stored %d logins, want 1", logins)
+	}
+}
@@ -0,0 +1,57 @@
+package repositories_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+
+	"example.com/fixtures/pb"
+	"example.com/fixtures/repositories"
+)
+
+// TestETagChangesWithEveryWrite checks that SetIfMatch and DeleteIfMatch
+// reject an ETag read before a write storing the same record again.
+func TestETagChangesWithEveryWrite(t *testing.T) {
+	ctx := context.Background()
+	repo := repositories.NewTestAccountRepository(t, repositories.TestDB)
+	account := &pb.Account{Id: 1, Region: "eu"}
+	transact(t, func(tr fdb.Transaction) error {
+		return repo.Set(ctx, tr, account)
+	})
+
+	var etag string
+	transact(t, func(tr fdb.Transaction) error {
+		var err error
+		_, etag, err = repo.GetWithETag(ctx, tr, 1)
+		return err
+	})
+	transact(t, func(tr fdb.Transaction) error {
+		return repo.Set(ctx, tr, account)
+	})
+	transact(t, func(tr fdb.Transaction) error {
+		if err := repo.SetIfMatch(ctx, tr, account, etag); !errors.Is(err, repositories.ErrPreconditionFailed) {
+			t.Errorf("SetIfMatch with the ETag of an overwritten record returned %v, want ErrPreconditionFailed", err)
+		}
+		if err := repo.DeleteIfMatch(ctx, tr, 1, etag); !errors.Is(err, repositories.ErrPreconditionFailed) {
+			t.Errorf("DeleteIfMatch with the ETag of an overwritten record returned %v, want ErrPreconditionFailed", err)
+		}
+		return nil
+	})
+
+	transact(t, func(tr fdb.Transaction) error {
+		var err error
+		_, etag, err = repo.GetWithETag(ctx, tr, 1)
+		return err
+	})
+	transact(t, func(tr fdb.Transaction) error {
+		return repo.SetIfMatch(ctx, tr, &pb.Account{Id: 1, Region: "us"}, etag)
+	})
+	transact(t, func(tr fdb.Transaction) error {
+		if err := repo.DeleteIfMatch(ctx, tr, 1, etag); !errors.Is(err, repositories.ErrPreconditionFailed) {
+			t.Errorf("DeleteIfMatch with the ETag replaced by SetIfMatch returned %v, want ErrPreconditionFailed", err)
+		}
+		return repo.DeleteIfMatch(ctx, tr, 1, repositories.ETagAny)
+	})
+}
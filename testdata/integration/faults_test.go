@@ -0,0 +1,131 @@
+//go:build fdbfaults
+
+package repositories_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"example.com/fixtures/pb"
+	"example.com/fixtures/repositories"
+)
+
+// unknownCommits is the number of operations run by the tests of retries
+// after commit_unknown_result, enough for several of them to be retried.
+const unknownCommits = 20
+
+// newTestStore returns a Store of the repositories in a throwaway prefix.
+func newTestStore(t *testing.T) *repositories.Store {
+	t.Helper()
+	store, err := repositories.NewStore(repositories.TestDB, repositories.NewTestPrefix(t, repositories.TestDB)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+// withUnknownCommits makes half of the transactions run by the generated
+// code until the end of the test commit and then fail with
+// commit_unknown_result, so that they are retried.
+func withUnknownCommits(t *testing.T) {
+	repositories.SetFaults(repositories.FaultConfig{Seed: 1, CommitUnknownResult: 0.5})
+	t.Cleanup(repositories.ClearFaults)
+}
+
+// TestFaultStoreCreate checks that Store.Create succeeds when its commit is
+// reported unknown, instead of finding the record it created on a retry.
+func TestFaultStoreCreate(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	withUnknownCommits(t)
+	for id := int64(1); id <= unknownCommits; id++ {
+		if err := store.CreateProfile(ctx, &pb.Profile{Id: id}); err != nil {
+			t.Fatalf("CreateProfile(%d): %v", id, err)
+		}
+	}
+	repositories.ClearFaults()
+	if err := store.CreateProfile(ctx, &pb.Profile{Id: 1}); !errors.Is(err, repositories.ErrProfileAlreadyExists) {
+		t.Errorf("CreateProfile of an existing profile returned %v, want ErrProfileAlreadyExists", err)
+	}
+}
+
+// TestFaultStoreGetOrCreate checks that Store.GetOrCreate reports the records
+// it created when its commit is reported unknown.
+func TestFaultStoreGetOrCreate(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	withUnknownCommits(t)
+	for id := int64(1); id <= unknownCommits; id++ {
+		profile, created, err := store.GetOrCreateProfile(ctx, id, func() *pb.Profile {
+			return &pb.Profile{Id: id, Avatar: []byte("new")}
+		})
+		if err != nil || !created || profile.GetId() != id {
+			t.Fatalf("GetOrCreateProfile(%d) returned %v, %t, %v, want a created profile", id, profile, created, err)
+		}
+	}
+}
+
+// TestFaultStoreCreateUUID checks that Store.Create of a message with an
+// auto_uuid key succeeds when its commit is reported unknown, and stores the
+// record at the UUID it returns.
+func TestFaultStoreCreateUUID(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	withUnknownCommits(t)
+	ids := map[string]bool{}
+	for i := 0; i < unknownCommits; i++ {
+		id, err := store.CreateSession(ctx, &pb.Session{AccountId: 1})
+		if err != nil {
+			t.Fatalf("CreateSession: %v", err)
+		}
+		ids[id] = true
+	}
+	repositories.ClearFaults()
+	if len(ids) != unknownCommits {
+		t.Errorf("CreateSession returned %d distinct IDs, want %d", len(ids), unknownCommits)
+	}
+	for id := range ids {
+		if exists, err := store.ExistsSession(ctx, id); err != nil || !exists {
+			t.Errorf("ExistsSession(%s) returned %t, %v after CreateSession", id, exists, err)
+		}
+	}
+}
+
+// TestFaultApplyBatch checks that ApplyBatch applies Create operations when
+// their commits are reported unknown, instead of failing them on a retry.
+func TestFaultApplyBatch(t *testing.T) {
+	ctx := context.Background()
+	repo := repositories.NewTestProfileRepository(t, repositories.TestDB)
+	withUnknownCommits(t)
+	for id := int64(1); id <= unknownCommits; id++ {
+		if failed := repo.ApplyBatch(ctx, []repositories.ProfileOp{{Create: &pb.Profile{Id: id}}}); failed != nil {
+			t.Fatalf("ApplyBatch of a Create of profile %d failed: %v", id, failed)
+		}
+	}
+}
+
+// TestFaultImport checks that Import with ImportFailOnConflict does not
+// report the records it wrote as conflicts when its commits are reported
+// unknown.
+func TestFaultImport(t *testing.T) {
+	ctx := context.Background()
+	repo := repositories.NewTestProfileRepository(t, repositories.TestDB)
+	withUnknownCommits(t)
+	for id := int64(1); id <= unknownCommits; id++ {
+		profiles := []*pb.Profile{{Id: id}}
+		next := func() (*pb.Profile, error) {
+			if len(profiles) == 0 {
+				return nil, io.EOF
+			}
+			profile := profiles[0]
+			profiles = profiles[1:]
+			return profile, nil
+		}
+		stats, err := repo.Import(ctx, next, repositories.ImportFailOnConflict, nil)
+		if err != nil || stats.Written != 1 {
+			t.Fatalf("Import of profile %d returned %+v, %v, want 1 record written", id, stats, err)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package repositories_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+
+	"example.com/fixtures/pb"
+	"example.com/fixtures/repositories"
+)
+
+// TestStringKeyRejectsInvalidValues checks that Set rejects string key
+// values that are too long or hold null bytes, and stores the others.
+func TestStringKeyRejectsInvalidValues(t *testing.T) {
+	ctx := context.Background()
+	repo := repositories.NewTestAccountRepository(t, repositories.TestDB)
+	for _, email := range []string{strings.Repeat("a", 255), "a\x00b@example.com"} {
+		_, err := repositories.TestDB.Transact(func(tr fdb.Transaction) (interface{}, error) {
+			return nil, repo.Set(ctx, tr, &pb.Account{Id: 1, Email: email})
+		})
+		if !errors.Is(err, repositories.ErrInvalidKey) {
+			t.Errorf("Set of email %q returned %v, want ErrInvalidKey", email, err)
+		}
+	}
+	transact(t, func(tr fdb.Transaction) error {
+		return repo.Set(ctx, tr, &pb.Account{Id: 1, Email: strings.Repeat("a", 254)})
+	})
+}
+
+// TestUniqueIndexRejectsSecondOwner checks that Set of a record taking the
+// value of a unique index from another record fails with
+// ErrUniqueViolation, and that the value can be taken once it is released.
+func TestUniqueIndexRejectsSecondOwner(t *testing.T) {
+	ctx := context.Background()
+	repo := repositories.NewTestAccountRepository(t, repositories.TestDB)
+	transact(t, func(tr fdb.Transaction) error {
+		return repo.Set(ctx, tr, &pb.Account{Id: 1, Email: "a@example.com"})
+	})
+	_, err := repositories.TestDB.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		return nil, repo.Set(ctx, tr, &pb.Account{Id: 2, Email: "a@example.com"})
+	})
+	if !errors.Is(err, repositories.ErrUniqueViolation) {
+		t.Fatalf("Set of a second account with the same email returned %v, want ErrUniqueViolation", err)
+	}
+	transact(t, func(tr fdb.Transaction) error {
+		if err := repo.Set(ctx, tr, &pb.Account{Id: 1, Email: "b@example.com"}); err != nil {
+			return err
+		}
+		return repo.Set(ctx, tr, &pb.Account{Id: 2, Email: "a@example.com"})
+	})
+}
+
+// TestElementAndMapKeyIndexes checks that the indexes of a repeated field and
+// of map keys find records by each element and key, and follow their changes.
+func TestElementAndMapKeyIndexes(t *testing.T) {
+	ctx := context.Background()
+	repo := repositories.NewTestAccountRepository(t, repositories.TestDB)
+	transact(t, func(tr fdb.Transaction) error {
+		if err := repo.Set(ctx, tr, &pb.Account{Id: 1, Email: "a@example.com", Tags: []string{"a", "b"}, Labels: map[string]string{"team": "x"}}); err != nil {
+			return err
+		}
+		return repo.Set(ctx, tr, &pb.Account{Id: 2, Email: "b@example.com", Tags: []string{"b"}, Labels: map[string]string{"tier": "y"}})
+	})
+	transact(t, func(tr fdb.Transaction) error {
+		accounts, err := repo.GetByTags(ctx, tr, "b")
+		expectAccounts(t, "GetByTags(b)", accounts, err, 1, 2)
+		accounts, err = repo.GetByLabelsKey(ctx, tr, "team")
+		expectAccounts(t, "GetByLabelsKey(team)", accounts, err, 1)
+		return nil
+	})
+
+	transact(t, func(tr fdb.Transaction) error {
+		return repo.Set(ctx, tr, &pb.Account{Id: 1, Email: "a@example.com", Tags: []string{"a"}})
+	})
+	transact(t, func(tr fdb.Transaction) error {
+		accounts, err := repo.GetByTags(ctx, tr, "b")
+		expectAccounts(t, "GetByTags(b) after removing the tag", accounts, err, 2)
+		accounts, err = repo.GetByLabelsKey(ctx, tr, "team")
+		expectAccounts(t, "GetByLabelsKey(team) after removing the label", accounts, err)
+		return nil
+	})
+}
+
+// TestAutoUUIDCreate checks that Create assigns distinct UUIDs to records
+// without one and keeps the UUIDs that are given.
+func TestAutoUUIDCreate(t *testing.T) {
+	ctx := context.Background()
+	repo := repositories.NewTestSessionRepository(t, repositories.TestDB)
+	const given = "123e4567-e89b-12d3-a456-426614174000"
+	var ids []string
+	transact(t, func(tr fdb.Transaction) error {
+		ids = nil
+		for _, session := range []*pb.Session{{AccountId: 1}, {AccountId: 1}, {Id: given, AccountId: 2}} {
+			id, err := repo.Create(ctx, tr, session)
+			if err != nil {
+				return err
+			}
+			ids = append(ids, id)
+		}
+		return nil
+	})
+	if ids[0] == ids[1] || ids[2] != given {
+		t.Fatalf("Create returned the IDs %v, want two distinct ones and %s", ids, given)
+	}
+	transact(t, func(tr fdb.Transaction) error {
+		for _, id := range ids {
+			if session, err := repo.Get(ctx, tr, id); err != nil || session.GetId() != id {
+				t.Errorf("Get(%s) returned %v, %v", id, session, err)
+			}
+		}
+		return nil
+	})
+}
+
+// TestBucketsListInKeyOrder checks that List merges the buckets of a
+// message spread over them, returning its records in primary key order
+// across pages.
+func TestBucketsListInKeyOrder(t *testing.T) {
+	ctx := context.Background()
+	repo := repositories.NewTestReadingRepository(t, repositories.TestDB)
+	want := []string{}
+	transact(t, func(tr fdb.Transaction) error {
+		want = want[:0]
+		for _, sensor := range []string{"a", "b", "c"} {
+			for seq := uint64(1); seq <= 5; seq++ {
+				if err := repo.Set(ctx, tr, &pb.Reading{Sensor: sensor, Seq: seq, Kind: "t"}); err != nil {
+					return err
+				}
+				want = append(want, fmt.Sprintf("%s/%d", sensor, seq))
+			}
+		}
+		return nil
+	})
+
+	got := []string{}
+	var after repositories.Cursor
+	for {
+		var page []*pb.Reading
+		var next repositories.Cursor
+		transact(t, func(tr fdb.Transaction) error {
+			var err error
+			page, next, err = repo.List(ctx, tr, repositories.ListOptions{Limit: 4, After: after})
+			return err
+		})
+		for _, reading := range page {
+			got = append(got, fmt.Sprintf("%s/%d", reading.GetSensor(), reading.GetSeq()))
+		}
+		if next == nil {
+			break
+		}
+		after = next
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("List returned the readings\n%v\nwant\n%v", got, want)
+	}
+}
@@ -0,0 +1,15 @@
+// Integration tests of the code generated for the fixtures, copied into its
+// repositories package by the tests of the plugin. They run against the
+// cluster of FDB_CLUSTER_FILE.
+package repositories_test
+
+import (
+	"os"
+	"testing"
+
+	"example.com/fixtures/repositories"
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(repositories.RunIntegrationTests(m))
+}
@@ -0,0 +1,99 @@
+package repositories
+
+import (
+	"testing"
+	"time"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb/tuple"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"example.com/fixtures/pb"
+)
+
+// benchmarkAccount returns an account with every kind of field set, of a
+// typical size.
+func benchmarkAccount() *pb.Account {
+	return &pb.Account{
+		Id:        42,
+		Email:     "ada@example.com",
+		Region:    "eu-west",
+		CreatedAt: timestamppb.New(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)),
+		Tags:      []string{"admin", "beta", "billing"},
+		Labels:    map[string]string{"team": "core", "tier": "gold"},
+		Logins:    7,
+	}
+}
+
+// BenchmarkAccountMarshal measures marshal, which allocates the value of
+// each record written.
+func BenchmarkAccountMarshal(b *testing.B) {
+	repo := NewTestAccountRepository(b, TestDB)
+	entity := benchmarkAccount()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := repo.marshal(entity); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkAccountMarshalPooled measures the marshaling of the write paths,
+// into buffers reused through valueBuffers.
+func BenchmarkAccountMarshalPooled(b *testing.B) {
+	repo := NewTestAccountRepository(b, TestDB)
+	entity := benchmarkAccount()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf := getValueBuffer()
+		value, err := repo.marshalAppend((*buf)[:0], entity)
+		if err != nil {
+			b.Fatal(err)
+		}
+		*buf = value
+		putValueBuffer(buf)
+	}
+}
+
+func BenchmarkAccountUnmarshal(b *testing.B) {
+	repo := NewTestAccountRepository(b, TestDB)
+	value, err := repo.marshal(benchmarkAccount())
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		entity := &pb.Account{}
+		if err := repo.unmarshal(value, entity); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkAccountRecordKey(b *testing.B) {
+	repo := NewTestAccountRepository(b, TestDB)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		repo.recordKey(tuple.Tuple{int64(i)})
+	}
+}
+
+// BenchmarkAccountIndexKeys measures the packing of the entries of the
+// secondary indexes, including a timestamp and a global index.
+func BenchmarkAccountIndexKeys(b *testing.B) {
+	repo := NewTestAccountRepository(b, TestDB)
+	entity := benchmarkAccount()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		repo.indexKeys(entity)
+	}
+}
+
+// BenchmarkReadingRecordKey measures the packing of a key spread over
+// buckets, hashing the primary key.
+func BenchmarkReadingRecordKey(b *testing.B) {
+	repo := NewTestReadingRepository(b, TestDB)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		repo.recordKey(tuple.Tuple{"sensor-1", uint64(i)})
+	}
+}
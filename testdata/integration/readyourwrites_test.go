@@ -0,0 +1,233 @@
+package repositories_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"example.com/fixtures/pb"
+	"example.com/fixtures/repositories"
+)
+
+// readModes are the transactions index lookups are given: the transaction
+// that wrote the records, or its snapshot view.
+var readModes = []struct {
+	name string
+	read func(tr fdb.Transaction) fdb.ReadTransaction
+}{
+	{"transaction", func(tr fdb.Transaction) fdb.ReadTransaction { return tr }},
+	{"snapshot", func(tr fdb.Transaction) fdb.ReadTransaction { return tr.Snapshot() }},
+}
+
+// transact runs fn in a transaction of the test database, failing the test
+// if it returns an error.
+func transact(t *testing.T, fn func(tr fdb.Transaction) error) {
+	t.Helper()
+	_, err := repositories.TestDB.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		return nil, fn(tr)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// expectAccounts checks that a lookup succeeded and returned the accounts
+// with the given IDs, in order.
+func expectAccounts(t *testing.T, lookup string, got []*pb.Account, err error, want ...int64) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("%s: %v", lookup, err)
+	}
+	ids := []int64{}
+	for _, account := range got {
+		ids = append(ids, account.GetId())
+	}
+	if want == nil {
+		want = []int64{}
+	}
+	if !reflect.DeepEqual(ids, want) {
+		t.Errorf("%s returned accounts %v, want %v", lookup, ids, want)
+	}
+}
+
+func testAccount(email, region string, created time.Time, tag string) *pb.Account {
+	return &pb.Account{
+		Id:        1,
+		Email:     email,
+		Region:    region,
+		CreatedAt: timestamppb.New(created),
+		Tags:      []string{tag},
+		Labels:    map[string]string{tag: "true"},
+	}
+}
+
+// checkLookups checks that the lookups of every index of the accounts
+// repository find current, written earlier in tr, and that the values of
+// old, a previous version of it, no longer find it.
+func checkLookups(t *testing.T, ctx context.Context, repo *repositories.AccountRepository, tr fdb.ReadTransaction, current, old *pb.Account) {
+	t.Helper()
+	accounts, err := repo.GetByEmail(ctx, tr, current.Email)
+	expectAccounts(t, "GetByEmail", accounts, err, 1)
+	accounts, err = repo.GetByRegionCreated(ctx, tr, current.Region, current.CreatedAt)
+	expectAccounts(t, "GetByRegionCreated", accounts, err, 1)
+	// The covering index serves the copy of the record written with its entry
+	if len(accounts) == 1 && !proto.Equal(accounts[0], current) {
+		t.Errorf("GetByRegionCreated returned %v, want %v", accounts[0], current)
+	}
+	accounts, err = repo.GetByRegion(ctx, tr, current.Region)
+	expectAccounts(t, "GetByRegion", accounts, err, 1)
+	accounts, err = repo.GetByTags(ctx, tr, current.Tags[0])
+	expectAccounts(t, "GetByTags", accounts, err, 1)
+	accounts, err = repo.GetByLabelsKey(ctx, tr, current.Tags[0])
+	expectAccounts(t, "GetByLabelsKey", accounts, err, 1)
+	keys, err := repo.GetKeysByEmail(ctx, tr, current.Email)
+	if err != nil || len(keys) != 1 || keys[0].Id != 1 {
+		t.Errorf("GetKeysByEmail returned %v, %v, want the key of account 1", keys, err)
+	}
+
+	if old == nil {
+		return
+	}
+	accounts, err = repo.GetByEmail(ctx, tr, old.Email)
+	expectAccounts(t, "GetByEmail of the old email", accounts, err)
+	accounts, err = repo.GetByRegionCreated(ctx, tr, old.Region, old.CreatedAt)
+	expectAccounts(t, "GetByRegionCreated of the old values", accounts, err)
+	accounts, err = repo.GetByRegion(ctx, tr, old.Region)
+	expectAccounts(t, "GetByRegion of the old region", accounts, err)
+	accounts, err = repo.GetByTags(ctx, tr, old.Tags[0])
+	expectAccounts(t, "GetByTags of the old tag", accounts, err)
+	accounts, err = repo.GetByLabelsKey(ctx, tr, old.Tags[0])
+	expectAccounts(t, "GetByLabelsKey of the old label", accounts, err)
+}
+
+// checkNoLookups checks that no index of the accounts repository finds
+// deleted, deleted earlier in tr.
+func checkNoLookups(t *testing.T, ctx context.Context, repo *repositories.AccountRepository, tr fdb.ReadTransaction, deleted *pb.Account) {
+	t.Helper()
+	accounts, err := repo.GetByEmail(ctx, tr, deleted.Email)
+	expectAccounts(t, "GetByEmail after Delete", accounts, err)
+	accounts, err = repo.GetByRegionCreated(ctx, tr, deleted.Region, deleted.CreatedAt)
+	expectAccounts(t, "GetByRegionCreated after Delete", accounts, err)
+	accounts, err = repo.GetByTags(ctx, tr, deleted.Tags[0])
+	expectAccounts(t, "GetByTags after Delete", accounts, err)
+	accounts, err = repo.GetByLabelsKey(ctx, tr, deleted.Tags[0])
+	expectAccounts(t, "GetByLabelsKey after Delete", accounts, err)
+}
+
+// TestIndexLookupsSeeEarlierWrites checks that the index lookups of a
+// transaction, including those of a covering index and snapshot reads, see
+// the creation, update and deletion of a record earlier in the transaction.
+func TestIndexLookupsSeeEarlierWrites(t *testing.T) {
+	ctx := context.Background()
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for _, mode := range readModes {
+		t.Run(mode.name, func(t *testing.T) {
+			repo := repositories.NewTestAccountRepository(t, repositories.TestDB)
+			first := testAccount("ada@example.com", "eu", created, "red")
+			second := testAccount("grace@example.com", "us", created.Add(time.Hour), "blue")
+			transact(t, func(tr fdb.Transaction) error {
+				if err := repo.Set(ctx, tr, first); err != nil {
+					return err
+				}
+				checkLookups(t, ctx, repo, mode.read(tr), first, nil)
+
+				if err := repo.Set(ctx, tr, second); err != nil {
+					return err
+				}
+				checkLookups(t, ctx, repo, mode.read(tr), second, first)
+
+				if err := repo.Delete(ctx, tr, 1); err != nil {
+					return err
+				}
+				checkNoLookups(t, ctx, repo, mode.read(tr), second)
+				return nil
+			})
+		})
+	}
+}
+
+// TestIndexLookupsSeeChangesToCommittedRecords checks that the index lookups
+// of a transaction see the changes it made to a record committed before,
+// whose stored index entries no longer apply.
+func TestIndexLookupsSeeChangesToCommittedRecords(t *testing.T) {
+	ctx := context.Background()
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for _, mode := range readModes {
+		t.Run(mode.name, func(t *testing.T) {
+			repo := repositories.NewTestAccountRepository(t, repositories.TestDB)
+			first := testAccount("ada@example.com", "eu", created, "red")
+			second := testAccount("grace@example.com", "us", created.Add(time.Hour), "blue")
+			transact(t, func(tr fdb.Transaction) error {
+				return repo.Set(ctx, tr, first)
+			})
+
+			transact(t, func(tr fdb.Transaction) error {
+				if err := repo.Set(ctx, tr, second); err != nil {
+					return err
+				}
+				checkLookups(t, ctx, repo, mode.read(tr), second, first)
+				return nil
+			})
+			transact(t, func(tr fdb.Transaction) error {
+				if err := repo.Delete(ctx, tr, 1); err != nil {
+					return err
+				}
+				checkNoLookups(t, ctx, repo, mode.read(tr), second)
+				return nil
+			})
+		})
+	}
+}
+
+// TestOptionalIndexSeesEarlierWrites checks the lookups of an index of a
+// proto3 optional field, whose unset value is indexed as its zero value, and
+// of queries on a oneof member, after writes earlier in the transaction.
+func TestOptionalIndexSeesEarlierWrites(t *testing.T) {
+	ctx := context.Background()
+	repo := repositories.NewTestProfileRepository(t, repositories.TestDB)
+	profileIDs := func(lookup string, profiles []*pb.Profile, err error, want ...int64) {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("%s: %v", lookup, err)
+		}
+		ids := []int64{}
+		for _, profile := range profiles {
+			ids = append(ids, profile.GetId())
+		}
+		if want == nil {
+			want = []int64{}
+		}
+		if !reflect.DeepEqual(ids, want) {
+			t.Errorf("%s returned profiles %v, want %v", lookup, ids, want)
+		}
+	}
+	transact(t, func(tr fdb.Transaction) error {
+		profile := &pb.Profile{Id: 1, Nickname: proto.String("neo"), Contact: &pb.Profile_Phone{Phone: "555"}}
+		if err := repo.Set(ctx, tr, profile); err != nil {
+			return err
+		}
+		profiles, err := repo.GetByNickname(ctx, tr, "neo")
+		profileIDs(`GetByNickname("neo")`, profiles, err, 1)
+		profiles, err = repo.Query().WherePhone("555").Find(ctx, tr)
+		profileIDs(`WherePhone("555")`, profiles, err, 1)
+
+		profile = &pb.Profile{Id: 1, Contact: &pb.Profile_Handle{Handle: "@neo"}}
+		if err := repo.Set(ctx, tr, profile); err != nil {
+			return err
+		}
+		profiles, err = repo.GetByNickname(ctx, tr, "neo")
+		profileIDs(`GetByNickname("neo") after clearing it`, profiles, err)
+		profiles, err = repo.GetByNickname(ctx, tr, "")
+		profileIDs(`GetByNickname("")`, profiles, err, 1)
+		profiles, err = repo.Query().WherePhone("555").Find(ctx, tr)
+		profileIDs(`WherePhone("555") after setting the handle`, profiles, err)
+		profiles, err = repo.Query().WhereHandle("@neo").Find(ctx, tr)
+		profileIDs(`WhereHandle("@neo")`, profiles, err, 1)
+		return nil
+	})
+}
@@ -0,0 +1,184 @@
+package repositories_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/tuple"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+
+	"example.com/fixtures/pb"
+	"example.com/fixtures/repositories"
+)
+
+// TestRecordLayerKeys checks that the records and index entries of a message
+// type with the record_layer option are stored at the keys of a Record Layer
+// record store, and that writes clear the keys Record Layer services store
+// beside split records.
+func TestRecordLayerKeys(t *testing.T) {
+	ctx := context.Background()
+	repo := repositories.NewTestEntryRepository(t, repositories.TestDB)
+	dir := repo.Directory()
+	entry := &pb.Entry{Id: 1, Ref: "r-1", AccountId: 7, Amount: 100, Labels: []string{"fee"}}
+	transact(t, func(tr fdb.Transaction) error {
+		// The version of the record stored by a Record Layer service
+		tr.Set(dir.Pack(tuple.Tuple{1, 1, -1}), []byte{0})
+		return repo.Set(ctx, tr, entry)
+	})
+
+	transact(t, func(tr fdb.Transaction) error {
+		header, err := tr.Get(dir.Pack(tuple.Tuple{0})).Get()
+		if err != nil {
+			return err
+		}
+		if header == nil {
+			t.Error("no store header at (0)")
+		}
+
+		value, err := tr.Get(dir.Pack(tuple.Tuple{1, 1, 0})).Get()
+		if err != nil {
+			return err
+		}
+		num, typ, n := protowire.ConsumeTag(value)
+		if n < 0 || num != 1 || typ != protowire.BytesType {
+			t.Fatalf("record at (1, 1, 0) is not in field 1 of a RecordTypeUnion: %x", value)
+		}
+		record, n := protowire.ConsumeBytes(value[n:])
+		if n < 0 {
+			t.Fatalf("record at (1, 1, 0) is truncated: %x", value)
+		}
+		stored := &pb.Entry{}
+		if err := proto.Unmarshal(record, stored); err != nil {
+			return err
+		}
+		if !proto.Equal(stored, entry) {
+			t.Errorf("stored record %v, want %v", stored, entry)
+		}
+
+		version, err := tr.Get(dir.Pack(tuple.Tuple{1, 1, -1})).Get()
+		if err != nil {
+			return err
+		}
+		if version != nil {
+			t.Error("Set left the record version stored at (1, 1, -1)")
+		}
+
+		for _, key := range []tuple.Tuple{
+			{2, "Ref_index", "r-1", 1},
+			{2, "AccountIdAndAmount_index", 7, 100, 1},
+			{2, "Labels_index", "fee", 1},
+		} {
+			value, err := tr.Get(dir.Pack(key)).Get()
+			if err != nil {
+				return err
+			}
+			if value == nil {
+				t.Errorf("no index entry at %v", key)
+			}
+		}
+		return nil
+	})
+}
+
+// TestRecordLayerIndexStates checks that index reads fail while a Record
+// Layer service builds the index, and succeed again once it is readable.
+func TestRecordLayerIndexStates(t *testing.T) {
+	ctx := context.Background()
+	repo := repositories.NewTestEntryRepository(t, repositories.TestDB)
+	stateKey := repo.Directory().Pack(tuple.Tuple{5, "Ref_index"})
+	transact(t, func(tr fdb.Transaction) error {
+		return repo.Set(ctx, tr, &pb.Entry{Id: 1, Ref: "r-1"})
+	})
+
+	for _, tc := range []struct {
+		name     string
+		state    tuple.Tuple
+		readable bool
+	}{
+		{"write-only", tuple.Tuple{1}, false},
+		{"disabled", tuple.Tuple{2}, false},
+		{"readable unique pending", tuple.Tuple{3}, true},
+		{"readable", nil, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			transact(t, func(tr fdb.Transaction) error {
+				if tc.state == nil {
+					tr.Clear(stateKey)
+				} else {
+					tr.Set(stateKey, tc.state.Pack())
+				}
+				return nil
+			})
+			transact(t, func(tr fdb.Transaction) error {
+				entries, err := repo.GetByRef(ctx, tr, "r-1")
+				if tc.readable {
+					if err != nil || len(entries) != 1 {
+						t.Errorf("GetByRef returned %v, %v, want entry 1", entries, err)
+					}
+				} else if !errors.Is(err, repositories.ErrIndexNotReadable) {
+					t.Errorf("GetByRef returned %v, %v, want ErrIndexNotReadable", entries, err)
+				}
+				// Other indexes stay readable
+				_, err = repo.GetByAccountIdAndAmount(ctx, tr, 0, 0)
+				return err
+			})
+		})
+	}
+}
+
+// TestRecordLayerMetaDataVersion checks that repositories, including those of
+// WithStores, refuse to open a store whose header holds another metadata
+// version.
+func TestRecordLayerMetaDataVersion(t *testing.T) {
+	prefix := repositories.NewTestPrefix(t, repositories.TestDB)
+	repo, err := repositories.NewEntryRepository(repositories.TestDB, prefix...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	transact(t, func(tr fdb.Transaction) error {
+		var header []byte
+		header = protowire.AppendTag(header, 1, protowire.VarintType)
+		header = protowire.AppendVarint(header, 6)
+		header = protowire.AppendTag(header, 2, protowire.VarintType)
+		header = protowire.AppendVarint(header, 2)
+		tr.Set(repo.Directory().Pack(tuple.Tuple{0}), header)
+		return nil
+	})
+	if _, err := repositories.NewEntryRepository(repositories.TestDB, prefix...); !errors.Is(err, repositories.ErrRecordStore) {
+		t.Errorf("NewEntryRepository returned %v, want ErrRecordStore", err)
+	}
+	written := false
+	err = repositories.WithStores(repositories.TestDB, func(tx *repositories.Stores) error {
+		written = true
+		return tx.Entry.Set(context.Background(), &pb.Entry{Id: 1})
+	}, prefix...)
+	if !errors.Is(err, repositories.ErrRecordStore) || written {
+		t.Errorf("WithStores returned %v and ran its function: %t, want ErrRecordStore before it", err, written)
+	}
+}
+
+// TestRecordLayerHeaderWithStores checks that WithStores writes the header of
+// the Record Layer stores it creates.
+func TestRecordLayerHeaderWithStores(t *testing.T) {
+	prefix := repositories.NewTestPrefix(t, repositories.TestDB)
+	err := repositories.WithStores(repositories.TestDB, func(tx *repositories.Stores) error {
+		return tx.Entry.Set(context.Background(), &pb.Entry{Id: 1})
+	}, prefix...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := repositories.NewEntryRepository(repositories.TestDB, prefix...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	transact(t, func(tr fdb.Transaction) error {
+		header, err := tr.Get(repo.Directory().Pack(tuple.Tuple{0})).Get()
+		if err == nil && header == nil {
+			t.Error("WithStores wrote no store header at (0)")
+		}
+		return err
+	})
+}
@@ -0,0 +1,110 @@
+package repositories_test
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+
+	"example.com/fixtures/pb"
+	"example.com/fixtures/repositories"
+)
+
+// globalHits returns the prefixes of the accounts GlobalGetByEmail finds for
+// email.
+func globalHits(t *testing.T, repo *repositories.AccountRepository, email string) [][]string {
+	t.Helper()
+	prefixes := [][]string{}
+	_, err := repositories.TestDB.ReadTransact(func(tr fdb.ReadTransaction) (interface{}, error) {
+		hits, err := repo.GlobalGetByEmail(context.Background(), tr, email)
+		for _, hit := range hits {
+			prefixes = append(prefixes, hit.Prefix)
+		}
+		return nil, err
+	})
+	if err != nil {
+		t.Fatalf("GlobalGetByEmail: %v", err)
+	}
+	return prefixes
+}
+
+// TestWithStoresMaintainsGlobalIndexes checks that the repositories of
+// WithStores write and clear the global index entries of their records, with
+// the prefix they are opened with.
+func TestWithStoresMaintainsGlobalIndexes(t *testing.T) {
+	ctx := context.Background()
+	prefix := repositories.NewTestPrefix(t, repositories.TestDB)
+	// The global directory is shared by every test prefix
+	email := strings.Join(prefix, ".") + "@example.com"
+	account := &pb.Account{Id: 1, Email: email, Region: "eu"}
+	err := repositories.WithStores(repositories.TestDB, func(tx *repositories.Stores) error {
+		return tx.Account.Set(ctx, account)
+	}, prefix...)
+	if err != nil {
+		t.Fatalf("Set through WithStores: %v", err)
+	}
+
+	repo, err := repositories.NewAccountRepository(repositories.TestDB, prefix...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := globalHits(t, repo, email); !reflect.DeepEqual(got, [][]string{prefix}) {
+		t.Errorf("GlobalGetByEmail found accounts in %v, want one in %v", got, prefix)
+	}
+
+	err = repositories.WithStores(repositories.TestDB, func(tx *repositories.Stores) error {
+		return tx.Account.Delete(ctx, 1)
+	}, prefix...)
+	if err != nil {
+		t.Fatalf("Delete through WithStores: %v", err)
+	}
+	if got := globalHits(t, repo, email); len(got) != 0 {
+		t.Errorf("GlobalGetByEmail found accounts in %v after Delete", got)
+	}
+}
+
+// TestGlobalIndexAcrossPrefixes checks that GlobalGetByEmail finds the
+// records of every prefix with the email, and not those of a prefix whose
+// record changed its email.
+func TestGlobalIndexAcrossPrefixes(t *testing.T) {
+	ctx := context.Background()
+	prefixes := [][]string{
+		repositories.NewTestPrefix(t, repositories.TestDB),
+		repositories.NewTestPrefix(t, repositories.TestDB),
+	}
+	email := strings.Join(prefixes[0], ".") + "@example.com"
+	repos := []*repositories.AccountRepository{}
+	for _, prefix := range prefixes {
+		repo, err := repositories.NewAccountRepository(repositories.TestDB, prefix...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		transact(t, func(tr fdb.Transaction) error {
+			return repo.Set(ctx, tr, &pb.Account{Id: 1, Email: email})
+		})
+		repos = append(repos, repo)
+	}
+	got := globalHits(t, repos[0], email)
+	if len(got) != 2 || !containsPrefix(got, prefixes[0]) || !containsPrefix(got, prefixes[1]) {
+		t.Errorf("GlobalGetByEmail found accounts in %v, want one in each of %v", got, prefixes)
+	}
+
+	transact(t, func(tr fdb.Transaction) error {
+		return repos[1].Set(ctx, tr, &pb.Account{Id: 1, Email: "other." + email})
+	})
+	if got := globalHits(t, repos[0], email); !reflect.DeepEqual(got, [][]string{prefixes[0]}) {
+		t.Errorf("GlobalGetByEmail found accounts in %v after a change of email, want one in %v", got, prefixes[0])
+	}
+}
+
+// containsPrefix reports whether prefixes holds prefix.
+func containsPrefix(prefixes [][]string, prefix []string) bool {
+	for _, p := range prefixes {
+		if reflect.DeepEqual(p, prefix) {
+			return true
+		}
+	}
+	return false
+}
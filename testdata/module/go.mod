@@ -0,0 +1,13 @@
+// The module of the code generated for the fixtures by the tests, which add
+// a replace directive pointing github.com/romannikov/fdb-go-layer-plugin at
+// the checkout being tested.
+module example.com/fixtures
+
+go 1.23
+
+require (
+	github.com/apple/foundationdb/bindings/go v0.0.0-20221208173428-5c644f20e3c5
+	github.com/romannikov/fdb-go-layer-plugin v0.0.0
+	google.golang.org/grpc v1.68.1
+	google.golang.org/protobuf v1.35.1
+)
@@ -0,0 +1,139 @@
+package main
+
+// testHarnessTemplate renders testharness.go, a TestMain helper that provides
+// a FoundationDB database to integration tests. It is only emitted with the
+// testharness=true plugin option, and only compiled with the fdbtestharness
+// build tag under build_tags=true.
+const testHarnessTemplate = `{{define "testharness"}}// Code generated by fdb-go-layer-plugin {{pluginVersion}}. DO NOT EDIT.
+{{with buildTag "testharness"}}
+//go:build {{.}}
+{{end}}
+package repositories
+
+import (
+    "fmt"
+    "net"
+    "os"
+    "os/exec"
+    "strings"
+    "time"
+
+    "github.com/apple/foundationdb/bindings/go/src/fdb"
+)
+
+const (
+    // TestAPIVersion is the API version selected by RunIntegrationTests if
+    // none was selected yet.
+    TestAPIVersion = 710
+    // DefaultTestImage is the FoundationDB image started when neither
+    // FDB_CLUSTER_FILE nor FDB_TEST_IMAGE is set. Its version must be
+    // compatible with the installed client library.
+    DefaultTestImage = "foundationdb/foundationdb:7.1.61"
+)
+
+// TestDB is the database prepared by RunIntegrationTests.
+var TestDB fdb.Database
+
+// RunIntegrationTests prepares a database, runs the tests and cleans up. Call
+// it from TestMain:
+//
+//	func TestMain(m *testing.M) {
+//		os.Exit(repositories.RunIntegrationTests(m))
+//	}
+//
+// If FDB_CLUSTER_FILE is set the tests use that cluster. Otherwise a
+// single-node FoundationDB container (FDB_TEST_IMAGE, DefaultTestImage by
+// default) is started with the docker CLI and removed once the tests are
+// done. The directories of all message types are created with Init and the
+// database is exposed as TestDB; combine it with NewTestPrefix or the
+// NewTest<Message>Repository helpers to isolate tests from each other.
+func RunIntegrationTests(m interface{ Run() int }) int {
+    if !fdb.IsAPIVersionSelected() {
+        fdb.MustAPIVersion(TestAPIVersion)
+    }
+
+    clusterFile := os.Getenv("FDB_CLUSTER_FILE")
+    if clusterFile == "" {
+        file, stop, err := startTestContainer()
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "starting FoundationDB container: %v\n", err)
+            return 1
+        }
+        defer stop()
+        clusterFile = file
+    }
+
+    db, err := fdb.OpenDatabase(clusterFile)
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "opening FoundationDB: %v\n", err)
+        return 1
+    }
+    if err := Init(db); err != nil {
+        fmt.Fprintf(os.Stderr, "initializing directories: %v\n", err)
+        return 1
+    }
+    TestDB = db
+    return m.Run()
+}
+
+// startTestContainer starts a single-node FoundationDB container and returns
+// the path of a cluster file pointing to it, and a function removing both.
+func startTestContainer() (string, func(), error) {
+    image := os.Getenv("FDB_TEST_IMAGE")
+    if image == "" {
+        image = DefaultTestImage
+    }
+
+    // FoundationDB clients must reach the server on the address it
+    // advertises, so the container listens on the same port as the host.
+    l, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        return "", nil, err
+    }
+    port := l.Addr().(*net.TCPAddr).Port
+    l.Close()
+
+    out, err := exec.Command("docker", "run", "-d", "--rm",
+        "-p", fmt.Sprintf("127.0.0.1:%d:%d", port, port),
+        "-e", "FDB_NETWORKING_MODE=host",
+        "-e", fmt.Sprintf("FDB_PORT=%d", port),
+        image).Output()
+    if err != nil {
+        return "", nil, fmt.Errorf("docker run: %w", err)
+    }
+    id := strings.TrimSpace(string(out))
+    removeContainer := func() {
+        exec.Command("docker", "rm", "-f", id).Run()
+    }
+
+    // The server needs a moment before it accepts the configuration
+    deadline := time.Now().Add(time.Minute)
+    for {
+        err := exec.Command("docker", "exec", id, "fdbcli", "--exec", "configure new single memory").Run()
+        if err == nil {
+            break
+        }
+        if time.Now().After(deadline) {
+            removeContainer()
+            return "", nil, fmt.Errorf("configuring database: %w", err)
+        }
+        time.Sleep(time.Second)
+    }
+
+    f, err := os.CreateTemp("", "fdb-*.cluster")
+    if err != nil {
+        removeContainer()
+        return "", nil, err
+    }
+    defer f.Close()
+    if _, err := fmt.Fprintf(f, "docker:docker@127.0.0.1:%d\n", port); err != nil {
+        removeContainer()
+        os.Remove(f.Name())
+        return "", nil, err
+    }
+    return f.Name(), func() {
+        removeContainer()
+        os.Remove(f.Name())
+    }, nil
+}
+{{end}}`
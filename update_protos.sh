@@ -1 +1,2 @@
 protoc --go_out=. --go_opt=paths=source_relative fdb-layer/annotations.proto
+protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative fdb-layer/admin/admin.proto
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/pluginpb"
+)
+
+// failureRequestEnv names the file holding the request a subprocess of
+// TestGenerationFailures runs the plugin on.
+const failureRequestEnv = "FDB_PLUGIN_FAILURE_REQUEST"
+
+// generationFailures are messages and plugin parameters the plugin must
+// reject, with a part of the error it must report.
+var generationFailures = []struct {
+	name, messages, parameter, want string
+}{
+	{
+		name: "cdc=false with change_log",
+		messages: `message Event {
+  option (annotations.primary_key) = "id";
+  option (annotations.change_log) = true;
+  int64 id = 1;
+}`,
+		parameter: "cdc=false",
+		want:      "Message Event uses the change log",
+	},
+	{
+		name: "cdc=false with search_sync",
+		messages: `message Event {
+  option (annotations.primary_key) = "id";
+  option (annotations.search_sync) = true;
+  int64 id = 1;
+}`,
+		parameter: "cdc=false",
+		want:      "Message Event uses the change log",
+	},
+	{
+		name: "cdc=false with webhook",
+		messages: `message Event {
+  option (annotations.primary_key) = "id";
+  option (annotations.webhook) = "https://example.com/events/{id}";
+  int64 id = 1;
+}`,
+		parameter: "cdc=false",
+		want:      "Message Event uses the change log",
+	},
+	{
+		name: "index over a map field",
+		messages: `message Event {
+  option (annotations.primary_key) = "id";
+  option (annotations.secondary_index) = { fields: "labels" };
+  int64 id = 1;
+  map<string, string> labels = 2;
+}`,
+		want: "Secondary index field labels in message Event is a map",
+	},
+	{
+		name: "index_keys on a field that is not a map",
+		messages: `message Event {
+  option (annotations.primary_key) = "id";
+  int64 id = 1;
+  string kind = 2 [(annotations.index_keys) = true];
+}`,
+		want: "Field kind in message Event has index_keys but is not a map",
+	},
+	{
+		name: "unique index of a repeated field",
+		messages: `message Event {
+  option (annotations.primary_key) = "id";
+  option (annotations.secondary_index) = { fields: "tags", unique: true };
+  int64 id = 1;
+  repeated string tags = 2;
+}`,
+		want: "over the repeated field tags cannot be unique, covering or global",
+	},
+	{
+		name: "two indexes with the same name",
+		messages: `message Event {
+  option (annotations.primary_key) = "id";
+  option (annotations.secondary_index) = { fields: "kind" };
+  option (annotations.secondary_index) = { fields: "source", name: "Kind" };
+  int64 id = 1;
+  string kind = 2;
+  string source = 3;
+}`,
+		want: "Message Event has two secondary indexes named Kind_index",
+	},
+	{
+		name: "reserved directory name",
+		messages: `message Event {
+  option (annotations.primary_key) = "id";
+  option (annotations.directory) = "_hot";
+  int64 id = 1;
+}`,
+		want: `Directory path element "_hot" of message Event is a reserved subspace name`,
+	},
+	{
+		name: "directory of global indexes",
+		messages: `message Event {
+  option (annotations.primary_key) = "id";
+  option (annotations.directory) = "_global";
+  int64 id = 1;
+}`,
+		want: `Directory path of message Event starts with "_global"`,
+	},
+	{
+		name: "unknown profile",
+		messages: `message Event {
+  option (annotations.primary_key) = "id";
+  option (annotations.profile) = "large";
+  int64 id = 1;
+}`,
+		want: `Unknown profile "large" of message Event`,
+	},
+	{
+		name: "missing previous version",
+		messages: `message Event {
+  option (annotations.primary_key) = "id";
+  option (annotations.previous_version) = "EventV0";
+  int64 id = 1;
+}`,
+		want: "Previous version EventV0 of message Event not found",
+	},
+	{
+		name: "webhook of a field outside the primary key",
+		messages: `message Event {
+  option (annotations.primary_key) = "id";
+  option (annotations.webhook) = "https://example.com/events/{kind}";
+  int64 id = 1;
+  string kind = 2;
+}`,
+		want: "refers to {kind}, which is not a primary key field",
+	},
+	{
+		name: "archive time field of another type",
+		messages: `message Event {
+  option (annotations.primary_key) = "id";
+  option (annotations.archive) = { time_field: "kind" };
+  int64 id = 1;
+  string kind = 2;
+}`,
+		want: "Archive time field kind in message Event must be an int64 or a google.protobuf.Timestamp",
+	},
+	{
+		name: "invalid blob reference pattern",
+		messages: `message Event {
+  option (annotations.primary_key) = "id";
+  int64 id = 1;
+  string photo = 2 [(annotations.blob_ref) = { pattern: "(" }];
+}`,
+		want: "Invalid pattern of blob reference field photo in message Event",
+	},
+	{
+		name: "counter of a string field",
+		messages: `message Event {
+  option (annotations.primary_key) = "id";
+  int64 id = 1;
+  string hits = 2 [(annotations.counter) = true];
+}`,
+		want: "Counter field hits in message Event must be a singular integer",
+	},
+	{
+		name: "touch field in an int32",
+		messages: `message Event {
+  option (annotations.primary_key) = "id";
+  int64 id = 1;
+  int32 last_seen = 2 [(annotations.touch) = true];
+}`,
+		want: "Touch field last_seen in message Event must be a singular int64",
+	},
+	{
+		name: "index of a counter",
+		messages: `message Event {
+  option (annotations.primary_key) = "id";
+  option (annotations.secondary_index) = { fields: "hits" };
+  int64 id = 1;
+  int64 hits = 2 [(annotations.counter) = true];
+}`,
+		want: "Field hits in message Event is stored outside the record and cannot be part of a key or index",
+	},
+	{
+		name: "skip_unchanged_writes with a counter",
+		messages: `message Event {
+  option (annotations.primary_key) = "id";
+  option (annotations.skip_unchanged_writes) = true;
+  int64 id = 1;
+  int64 hits = 2 [(annotations.counter) = true];
+}`,
+		want: "Message Event cannot skip unchanged writes",
+	},
+	{
+		name: "auto_uuid of an integer",
+		messages: `message Event {
+  option (annotations.primary_key) = "id";
+  int64 id = 1 [(annotations.auto_uuid) = true];
+}`,
+		want: "Auto UUID field id in message Event must be a singular string or bytes",
+	},
+	{
+		name: "auto_uuid outside the primary key",
+		messages: `message Event {
+  option (annotations.primary_key) = "id";
+  int64 id = 1;
+  string token = 2 [(annotations.auto_uuid) = true];
+}`,
+		want: "Auto UUID field token in message Event must be a primary key field",
+	},
+	{
+		name: "string_key outside keys and indexes",
+		messages: `message Event {
+  option (annotations.primary_key) = "id";
+  int64 id = 1;
+  string kind = 2 [(annotations.string_key) = { max_bytes: 16 }];
+}`,
+		want: "Field kind in message Event has the string_key option but is neither a primary key nor a secondary index field",
+	},
+	{
+		name: "string_key hash with a short max_bytes",
+		messages: `message Event {
+  option (annotations.primary_key) = "id";
+  string id = 1 [(annotations.string_key) = { max_bytes: 64, hash: true }];
+}`,
+		want: "so its max_bytes must be more than 64",
+	},
+	{
+		name: "record_layer without a union field",
+		messages: `message Event {
+  option (annotations.primary_key) = "id";
+  option (annotations.record_layer) = { meta_data_version: 1 };
+  int64 id = 1;
+}`,
+		want: "Message Event has the record_layer option without a valid union_field",
+	},
+	{
+		name: "record_layer with buckets",
+		messages: `message Event {
+  option (annotations.primary_key) = "id";
+  option (annotations.buckets) = 8;
+  option (annotations.record_layer) = { union_field: 1, meta_data_version: 1 };
+  int64 id = 1;
+}`,
+		want: "cannot spread its records over buckets",
+	},
+	{
+		name: "record_layer with a change log",
+		messages: `message Event {
+  option (annotations.primary_key) = "id";
+  option (annotations.change_log) = true;
+  option (annotations.record_layer) = { union_field: 1, meta_data_version: 1 };
+  int64 id = 1;
+}`,
+		want: "Message Event with the record_layer option cannot have a change log",
+	},
+	{
+		name: "record_layer with a counter",
+		messages: `message Event {
+  option (annotations.primary_key) = "id";
+  option (annotations.record_layer) = { union_field: 1, meta_data_version: 1 };
+  int64 id = 1;
+  int64 hits = 2 [(annotations.counter) = true];
+}`,
+		want: "cannot have counter, element set, touch or side-stored fields",
+	},
+	{
+		name: "record_layer with a covering index",
+		messages: `message Event {
+  option (annotations.primary_key) = "id";
+  option (annotations.secondary_index) = { fields: "kind", covering: true };
+  option (annotations.record_layer) = { union_field: 1, meta_data_version: 1 };
+  int64 id = 1;
+  string kind = 2;
+}`,
+		want: "Secondary index Kind of message Event with the record_layer option cannot be covering",
+	},
+	{
+		name: "record_layer with a global index",
+		messages: `message Event {
+  option (annotations.primary_key) = "id";
+  option (annotations.secondary_index) = { fields: "kind", global: true };
+  option (annotations.record_layer) = { union_field: 1, meta_data_version: 1 };
+  int64 id = 1;
+  string kind = 2;
+}`,
+		want: "Secondary index Kind of message Event with the record_layer option cannot be global",
+	},
+	{
+		name: "record_layer with an unsigned key",
+		messages: `message Event {
+  option (annotations.primary_key) = "id";
+  option (annotations.record_layer) = { union_field: 1, meta_data_version: 1 };
+  uint64 id = 1;
+}`,
+		want: "cannot be an unsigned key or index field",
+	},
+	{
+		name: "record_layer with a timestamp index",
+		messages: `message Event {
+  option (annotations.primary_key) = "id";
+  option (annotations.secondary_index) = { fields: "created_at" };
+  option (annotations.record_layer) = { union_field: 1, meta_data_version: 1 };
+  int64 id = 1;
+  google.protobuf.Timestamp created_at = 2;
+}`,
+		want: "Field created_at of message Event with the record_layer option cannot be a key or index field",
+	},
+}
+
+// TestGenerationFailures checks that the plugin rejects invalid options.
+// It reports them with log.Fatalf, so each case runs the plugin in a
+// subprocess: this test binary, run again with failureRequestEnv set.
+func TestGenerationFailures(t *testing.T) {
+	if name := os.Getenv(failureRequestEnv); name != "" {
+		b, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := &pluginpb.CodeGeneratorRequest{}
+		if err := proto.Unmarshal(b, req); err != nil {
+			t.Fatal(err)
+		}
+		runPlugin(t, req)
+		return
+	}
+	for _, tc := range generationFailures {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFile(t, filepath.Join(dir, "case.proto"), `syntax = "proto3";
+
+package cases;
+
+option go_package = "example.com/cases/pb;pb";
+
+import "fdb-layer/annotations.proto";
+import "google/protobuf/timestamp.proto";
+
+`+tc.messages+"\n")
+			b, err := proto.Marshal(protoRequest(t, dir, []string{"case.proto"}, tc.parameter))
+			if err != nil {
+				t.Fatal(err)
+			}
+			name := filepath.Join(dir, "request.pb")
+			writeFile(t, name, string(b))
+
+			cmd := exec.Command(os.Args[0], "-test.run=^TestGenerationFailures$")
+			cmd.Env = append(os.Environ(), failureRequestEnv+"="+name)
+			out, err := cmd.CombinedOutput()
+			if err == nil {
+				t.Fatalf("generation succeeded, want it to fail with %q", tc.want)
+			}
+			if !strings.Contains(string(out), tc.want) {
+				t.Errorf("generation failed with\n%s\nwant %q", out, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+// PreviousVersion is an earlier message type of the records of a message,
+// declared with the previous_version option.
+type PreviousVersion struct {
+	Type    string // Go name of the message type
+	Version int
+}
+
+// Version returns the version the records of m are written with, following
+// its previous versions.
+func (m Message) Version() int {
+	return len(m.PreviousVersions) + 1
+}
+
+// versionsTemplate generates the converters of messages with previous
+// versions, which turn records stored as an earlier type into the current
+// one when they are read.
+const versionsTemplate = `{{define "versions"}}{{if .PreviousVersions}}
+var (
+    {{range .PreviousVersions}}// convert{{$.Name}}From{{.Type}} converts records stored as {{.Type}}.
+    convert{{$.Name}}From{{.Type}} func(*pb.{{.Type}}) (*pb.{{$.Name}}, error)
+    {{end}}
+)
+{{range .PreviousVersions}}
+// Register{{$.Name}}From{{.Type}} registers fn converting the records stored as
+// {{.Type}}, version {{.Version}} of {{$.Name}}, when they are read. Call it from an
+// init function, before any repository reads records. Converted records are
+// stored as {{$.Name}} when they are next written.
+func Register{{$.Name}}From{{.Type}}(fn func(old *pb.{{.Type}}) (*pb.{{$.Name}}, error)) {
+    convert{{$.Name}}From{{.Type}} = fn
+}
+{{end}}
+// unmarshalVersion decodes value, a record stored as an earlier version, as
+// the type of that version and converts it into entity.
+func (repo *{{.Name}}Repository) unmarshalVersion(version uint64, value []byte, entity *pb.{{.Name}}) error {
+    var converted *pb.{{.Name}}
+    switch version {
+    {{range .PreviousVersions}}case {{.Version}}:
+        if convert{{$.Name}}From{{.Type}} == nil {
+            return fmt.Errorf("{{$.Name}} version {{.Version}}, {{.Type}}: %w", ErrNoConverter)
+        }
+        old := &pb.{{.Type}}{}
+        {{if $.Serializer}}s, err := lookupSerializer("{{$.Serializer}}")
+        if err != nil {
+            return err
+        }
+        if err := s.Unmarshal(value, old); err != nil {
+            return err
+        }{{else}}if err := repo.unmarshalOpts.Unmarshal(value, old); err != nil {
+            return err
+        }{{end}}
+        c, err := convert{{$.Name}}From{{.Type}}(old)
+        if err != nil {
+            return fmt.Errorf("{{$.Name}}: converting from {{.Type}}: %w", err)
+        }
+        converted = c
+    {{end}}default:
+        return fmt.Errorf("{{.Name}}: unknown record version %d", version)
+    }
+    proto.Reset(entity)
+    proto.Merge(entity, converted)
+    return nil
+}
+{{end}}{{end}}`
@@ -0,0 +1,100 @@
+package main
+
+// watchTemplate generates WatchSet, which multiplexes FoundationDB watches
+// over several records onto one channel of change events.
+const watchTemplate = `{{define "watch"}}
+// WatchSet watches the records with the given keys and sends an event for
+// every change until ctx is done, when the channel is closed. The records as
+// stored when watching starts are the baseline and are not sent. Watches are
+// re-established after they fire or are reset, and the records are compared
+// with the last versions seen, so no change is lost, but a record changing
+// several times in a row may only be sent once, with its latest version.{{if .CRDTFields}}
+// Counters and element sets are not watched.{{end}}
+func (repo *{{.Name}}Repository) WatchSet(ctx context.Context, keys ...{{.Name}}Key) <-chan {{.Name}}WatchEvent {
+    events := make(chan {{.Name}}WatchEvent)
+    go func() {
+        defer close(events)
+        send := func(event {{.Name}}WatchEvent) bool {
+            select {
+            case events <- event:
+                return true
+            case <-ctx.Done():
+                return false
+            }
+        }
+
+        var last [][]byte
+        for ctx.Err() == nil {
+            var values [][]byte
+            var watches []fdb.FutureNil
+            _, err := transactContext(ctx, repo.db, func(tr fdb.Transaction) (interface{}, error) {
+                // Watches of a failed attempt never fire
+                cancelWatches(watches)
+                values = make([][]byte, len(keys))
+                watches = make([]fdb.FutureNil, len(keys))
+                futures := make([]fdb.FutureByteSlice, len(keys))
+                for i, key := range keys {
+                    futures[i] = tr.Get(repo.recordKey(key.toTuple()))
+                    watches[i] = tr.Watch(repo.recordKey(key.toTuple()))
+                }
+                for i, future := range futures {
+                    value, err := future.Get()
+                    if err != nil {
+                        return nil, err
+                    }
+                    values[i] = value
+                }
+                return nil, nil
+            })
+            if err != nil {
+                if ctx.Err() == nil {
+                    send({{.Name}}WatchEvent{Err: err})
+                }
+                return
+            }
+
+            if last != nil {
+                for i, value := range values {
+                    if (value == nil) == (last[i] == nil) && bytes.Equal(value, last[i]) {
+                        continue
+                    }
+                    event := {{.Name}}WatchEvent{Key: keys[i]}
+                    if value != nil {
+                        event.Record = &pb.{{.Name}}{}
+                        if err := repo.unmarshal(value, event.Record); err != nil {
+                            event.Record, event.Err = nil, err
+                        }
+                    }
+                    if !send(event) || event.Err != nil {
+                        cancelWatches(watches)
+                        return
+                    }
+                }
+            }
+            last = values
+
+            if err := waitWatches(ctx, watches); err != nil {
+                send({{.Name}}WatchEvent{Err: err})
+                return
+            }
+        }
+    }()
+    return events
+}
+{{end}}`
+
+// watchEventTemplate generates the event type shared by WatchSet and the
+// SubscribeByPrefix of messages with a change log.
+const watchEventTemplate = `{{define "watchEvent"}}
+// {{.Name}}WatchEvent is a change of a watched {{.Name}} record.
+type {{.Name}}WatchEvent struct {
+    Key {{.Name}}Key
+    // Record is the new version of the record, or nil if it was deleted.
+    Record *pb.{{.Name}}
+    // Cursor identifies the change log entry of the event. It is only set by
+    // SubscribeByPrefix.
+    Cursor fdb.Key
+    // Err is set on the last event sent if watching failed.
+    Err error
+}
+{{end}}`
@@ -0,0 +1,233 @@
+package main
+
+import "regexp"
+
+// webhookPlaceholder matches the {field} placeholders of webhook URL
+// templates.
+var webhookPlaceholder = regexp.MustCompile(`\{(\w+)\}`)
+
+// webhooksTemplate renders webhooks.go, the delivery of change events to
+// webhooks shared by all messages with the webhook option.
+const webhooksTemplate = `{{define "webhooks"}}// Code generated by fdb-go-layer-plugin {{pluginVersion}}. DO NOT EDIT.
+
+package repositories
+
+import (
+    "bytes"
+    "context"
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "time"
+
+    "github.com/apple/foundationdb/bindings/go/src/fdb/tuple"
+)
+
+// WebhookSignatureHeader is the header carrying the signature of a webhook
+// payload: "sha256=" followed by the hex HMAC-SHA256 of the body keyed with
+// the secret passed to DispatchWebhooks.
+const WebhookSignatureHeader = "X-Webhook-Signature"
+
+// WebhookEvent is the JSON payload POSTed to webhooks for every change.
+type WebhookEvent struct {
+    Type string ` + "`" + `json:"type"` + "`" + `
+    // Key holds the primary key fields by .proto name.
+    Key map[string]interface{} ` + "`" + `json:"key"` + "`" + `
+    // Version is the hex commit versionstamp of the change.
+    Version string ` + "`" + `json:"version"` + "`" + `
+    Deleted bool   ` + "`" + `json:"deleted"` + "`" + `
+    // Record is the new version of the record, encoded with
+    // JSONMarshalOptions, or null if it was deleted.
+    Record json.RawMessage ` + "`" + `json:"record"` + "`" + `
+}
+
+// WebhookDelivery is the delivery state of a webhook, persisted in
+// FoundationDB after every attempt.
+type WebhookDelivery struct {
+    // Cursor is the change log entry of the last delivered event.
+    Cursor []byte
+    // Attempts counts the failed attempts to deliver the next event.
+    Attempts    int
+    LastError   string
+    NextAttempt time.Time
+}
+
+func (d WebhookDelivery) pack() []byte {
+    return tuple.Tuple{d.Cursor, int64(d.Attempts), d.LastError, d.NextAttempt.UnixNano()}.Pack()
+}
+
+func unpackWebhookDelivery(b []byte) (WebhookDelivery, error) {
+    var d WebhookDelivery
+    if b == nil {
+        return d, nil
+    }
+    tpl, err := tuple.Unpack(b)
+    if err != nil {
+        return d, err
+    }
+    cursor, ok1 := tpl[0].([]byte)
+    attempts, ok2 := tpl[1].(int64)
+    lastError, ok3 := tpl[2].(string)
+    nextAttempt, ok4 := tpl[3].(int64)
+    if !ok1 || !ok2 || !ok3 || !ok4 {
+        return d, fmt.Errorf("malformed webhook delivery %v", tpl)
+    }
+    return WebhookDelivery{Cursor: cursor, Attempts: int(attempts), LastError: lastError, NextAttempt: time.Unix(0, nextAttempt)}, nil
+}
+
+// webhookBackoff returns the delay before the next attempt after the given
+// number of failed attempts: one second, doubling up to an hour.
+func webhookBackoff(attempts int) time.Duration {
+    backoff := time.Second
+    for i := 1; i < attempts && backoff < time.Hour; i++ {
+        backoff *= 2
+    }
+    if backoff > time.Hour {
+        backoff = time.Hour
+    }
+    return backoff
+}
+
+// postWebhook POSTs event to url, signed with secret. Responses other than
+// 2xx are errors.
+func postWebhook(ctx context.Context, client *http.Client, url string, secret []byte, event WebhookEvent) error {
+    body, err := json.Marshal(event)
+    if err != nil {
+        return err
+    }
+    mac := hmac.New(sha256.New, secret)
+    mac.Write(body)
+
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+    if err != nil {
+        return err
+    }
+    req.Header.Set("Content-Type", "application/json")
+    req.Header.Set(WebhookSignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+    resp, err := client.Do(req)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode < 200 || resp.StatusCode > 299 {
+        return fmt.Errorf("webhook %s: %s", url, resp.Status)
+    }
+    return nil
+}
+{{end}}`
+
+// webhookTemplate generates DispatchWebhooks for messages with the webhook
+// option.
+const webhookTemplate = `{{define "webhook"}}{{if .Webhooks}}
+// {{lowerFirst .Name}}Webhooks are the URL templates of the {{.Name}} webhooks.
+var {{lowerFirst .Name}}Webhooks = {{stringSlice .Webhooks}}
+
+// webhookURL expands the placeholders of a webhook URL template with the
+// path-escaped fields of k, bytes fields in hex and timestamps in RFC 3339.
+func (k {{.Name}}Key) webhookURL(urlTemplate string) string {
+    return strings.NewReplacer(
+        {{range .PrimaryKeyFields}}"{{"{"}}{{.ProtoName}}{{"}"}}", url.PathEscape({{if .Bytes}}fmt.Sprintf("%x", k.{{.Name}}){{else if .Timestamp}}k.{{.Name}}.AsTime().Format(time.RFC3339Nano){{else}}fmt.Sprint(k.{{.Name}}){{end}}),
+        {{end}}
+    ).Replace(urlTemplate)
+}
+
+// DispatchWebhooks POSTs a signed WebhookEvent to every {{.Name}} webhook for
+// each change log entry not delivered yet, in order. Each webhook has its
+// own delivery state, saved in FoundationDB after every attempt: a failed
+// delivery is retried by later calls with exponential backoff, and later
+// events wait for it. Run it periodically, for example as a WorkerJob. It
+// returns the number of events delivered.
+func (repo *{{.Name}}Repository) DispatchWebhooks(ctx context.Context, client *http.Client, secret []byte) (int, error) {
+    delivered := 0
+    for _, urlTemplate := range {{lowerFirst .Name}}Webhooks {
+        n, err := repo.dispatchWebhook(ctx, client, secret, urlTemplate)
+        delivered += n
+        if err != nil {
+            return delivered, err
+        }
+    }
+    return delivered, nil
+}
+
+// GetWebhookDelivery reads the delivery state of the webhook with the given
+// URL template.
+func (repo *{{.Name}}Repository) GetWebhookDelivery(ctx context.Context, tr fdb.ReadTransaction, urlTemplate string) (WebhookDelivery, error) {
+    value, err := tr.Get(repo.webhookKey(urlTemplate)).Get()
+    if err != nil {
+        return WebhookDelivery{}, err
+    }
+    return unpackWebhookDelivery(value)
+}
+
+// webhookKey returns the key holding the delivery state of a webhook.
+func (repo *{{.Name}}Repository) webhookKey(urlTemplate string) fdb.Key {
+    return MetaSubspace(repo.dir, CursorsSubspace).Pack(tuple.Tuple{"webhook", urlTemplate})
+}
+
+func (repo *{{.Name}}Repository) dispatchWebhook(ctx context.Context, client *http.Client, secret []byte, urlTemplate string) (int, error) {
+    key := repo.webhookKey(urlTemplate)
+    save := func(state WebhookDelivery) error {
+        _, err := transactContext(ctx, repo.db, func(tr fdb.Transaction) (interface{}, error) {
+            tr.Set(key, state.pack())
+            return nil, nil
+        })
+        return err
+    }
+
+    delivered := 0
+    for {
+        var state WebhookDelivery
+        result, err := readTransactContext(ctx, repo.db, func(tr fdb.ReadTransaction) (interface{}, error) {
+            var err error
+            if state, err = repo.GetWebhookDelivery(ctx, tr, urlTemplate); err != nil {
+                return nil, err
+            }
+            return repo.ReadChanges(ctx, tr, state.Cursor, {{lowerFirst .Name}}ScanBatch)
+        })
+        if err != nil {
+            return delivered, err
+        }
+        if time.Now().Before(state.NextAttempt) {
+            return delivered, nil
+        }
+        changes := result.([]{{.Name}}Change)
+        for _, change := range changes {
+            event := WebhookEvent{
+                Type: "{{.Name}}",
+                Key: map[string]interface{}{
+                    {{range .PrimaryKeyFields}}"{{.ProtoName}}": change.Key.{{.Name}},
+                    {{end}}
+                },
+                Version: fmt.Sprintf("%x", change.Version.Bytes()),
+                Deleted: change.Record == nil,
+                Record:  json.RawMessage("null"),
+            }
+            if change.Record != nil {
+                if event.Record, err = Marshal{{.Name}}JSON(change.Record); err != nil {
+                    return delivered, err
+                }
+            }
+            if err := postWebhook(ctx, client, change.Key.webhookURL(urlTemplate), secret, event); err != nil {
+                if ctx.Err() != nil {
+                    return delivered, ctx.Err()
+                }
+                state.Attempts++
+                state.LastError = err.Error()
+                state.NextAttempt = time.Now().Add(webhookBackoff(state.Attempts))
+                return delivered, save(state)
+            }
+            state = WebhookDelivery{Cursor: change.Cursor}
+            if err := save(state); err != nil {
+                return delivered, err
+            }
+            delivered++
+        }
+        if len(changes) < {{lowerFirst .Name}}ScanBatch {
+            return delivered, nil
+        }
+    }
+}
+{{end}}{{end}}`
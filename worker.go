@@ -0,0 +1,215 @@
+package main
+
+// workerTemplate renders worker.go, a runner for background jobs that uses
+// leases stored in FoundationDB to elect one instance per job across a fleet.
+const workerTemplate = `{{define "worker"}}// Code generated by fdb-go-layer-plugin {{pluginVersion}}. DO NOT EDIT.
+
+package repositories
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "sync"
+    "time"
+
+    "github.com/apple/foundationdb/bindings/go/src/fdb"
+    "github.com/apple/foundationdb/bindings/go/src/fdb/subspace"
+    "github.com/apple/foundationdb/bindings/go/src/fdb/tuple"
+)
+
+// DefaultLeaseTTL is the lease duration used when Worker.LeaseTTL is zero.
+const DefaultLeaseTTL = 30 * time.Second
+
+// WorkerJob is a background job run periodically by a Worker.
+type WorkerJob struct {
+    Name     string
+    Interval time.Duration
+    // Run performs one pass of the job. Its context is canceled when the
+    // worker stops or loses the job's lease.
+    Run func(ctx context.Context) error
+}
+
+// Worker runs background jobs (retention, GC, pollers, ...) on their
+// intervals. Every instance of a fleet can run a Worker with the same jobs:
+// a lease stored in FoundationDB ensures that each job runs on at most one
+// instance at a time. Leases expire based on the instances' clocks, so
+// LeaseTTL must be much larger than the expected clock skew.
+type Worker struct {
+    db     fdb.Transactor
+    leases subspace.Subspace
+    owner  string
+    jobs   []WorkerJob
+
+    // LeaseTTL is how long a lease stays valid without being renewed.
+    // Leases are renewed every LeaseTTL/3 while a job runs.
+    LeaseTTL time.Duration
+    // OnError, if set, is called with the errors of job runs and lease
+    // operations.
+    OnError func(job string, err error)
+}
+
+// NewWorker returns a Worker storing its leases in leases. owner must
+// uniquely identify this instance, e.g. a hostname or a random ID.
+func NewWorker(db fdb.Transactor, leases subspace.Subspace, owner string, jobs ...WorkerJob) *Worker {
+    return &Worker{db: db, leases: leases, owner: owner, jobs: jobs}
+}
+
+// Run runs the jobs until ctx is canceled, then releases the leases held by
+// this instance.
+func (w *Worker) Run(ctx context.Context) error {
+    for _, job := range w.jobs {
+        if job.Interval <= 0 {
+            return fmt.Errorf("worker job %s: interval must be positive", job.Name)
+        }
+    }
+    var wg sync.WaitGroup
+    for _, job := range w.jobs {
+        wg.Add(1)
+        go func(job WorkerJob) {
+            defer wg.Done()
+            w.loop(ctx, job)
+        }(job)
+    }
+    wg.Wait()
+    return ctx.Err()
+}
+
+func (w *Worker) loop(ctx context.Context, job WorkerJob) {
+    ticker := time.NewTicker(job.Interval)
+    defer ticker.Stop()
+    for {
+        w.runOnce(ctx, job)
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+        }
+    }
+}
+
+// runOnce runs job if this instance can acquire its lease, renewing the
+// lease for as long as the job runs.
+func (w *Worker) runOnce(ctx context.Context, job WorkerJob) {
+    acquired, err := w.acquire(job.Name)
+    if err != nil {
+        w.reportError(job.Name, err)
+        return
+    }
+    if !acquired {
+        return
+    }
+    defer func() {
+        if err := w.release(job.Name); err != nil {
+            w.reportError(job.Name, err)
+        }
+    }()
+
+    jobCtx, cancel := context.WithCancel(ctx)
+    defer cancel()
+    done := make(chan struct{})
+    go func() {
+        defer close(done)
+        ticker := time.NewTicker(w.leaseTTL() / 3)
+        defer ticker.Stop()
+        for {
+            select {
+            case <-jobCtx.Done():
+                return
+            case <-ticker.C:
+                acquired, err := w.acquire(job.Name)
+                if err == nil && !acquired {
+                    err = errors.New("lease lost")
+                }
+                if err != nil {
+                    w.reportError(job.Name, err)
+                    cancel()
+                    return
+                }
+            }
+        }
+    }()
+
+    if err := job.Run(jobCtx); err != nil {
+        w.reportError(job.Name, err)
+    }
+    cancel()
+    <-done
+}
+
+func (w *Worker) leaseTTL() time.Duration {
+    if w.LeaseTTL > 0 {
+        return w.LeaseTTL
+    }
+    return DefaultLeaseTTL
+}
+
+// acquire takes or renews the lease of the named job. It reports false if
+// another instance holds an unexpired lease.
+func (w *Worker) acquire(name string) (bool, error) {
+    acquired, err := transact(w.db, func(tr fdb.Transaction) (interface{}, error) {
+        key := w.leases.Pack(tuple.Tuple{name})
+        value, err := tr.Get(key).Get()
+        if err != nil {
+            return false, err
+        }
+        now := time.Now()
+        if value != nil {
+            owner, expires, err := unpackLease(value)
+            if err != nil {
+                return false, err
+            }
+            if owner != w.owner && now.Before(expires) {
+                return false, nil
+            }
+        }
+        tr.Set(key, tuple.Tuple{w.owner, now.Add(w.leaseTTL()).UnixNano()}.Pack())
+        return true, nil
+    })
+    if err != nil {
+        return false, err
+    }
+    return acquired.(bool), nil
+}
+
+// release gives up the lease of the named job if this instance holds it.
+func (w *Worker) release(name string) error {
+    _, err := transact(w.db, func(tr fdb.Transaction) (interface{}, error) {
+        key := w.leases.Pack(tuple.Tuple{name})
+        value, err := tr.Get(key).Get()
+        if err != nil || value == nil {
+            return nil, err
+        }
+        owner, _, err := unpackLease(value)
+        if err != nil {
+            return nil, err
+        }
+        if owner == w.owner {
+            tr.Clear(key)
+        }
+        return nil, nil
+    })
+    return err
+}
+
+func (w *Worker) reportError(job string, err error) {
+    if w.OnError != nil {
+        w.OnError(job, err)
+    }
+}
+
+func unpackLease(b []byte) (string, time.Time, error) {
+    tpl, err := tuple.Unpack(b)
+    if err != nil {
+        return "", time.Time{}, err
+    }
+    if len(tpl) == 2 {
+        owner, ok1 := tpl[0].(string)
+        expires, ok2 := tpl[1].(int64)
+        if ok1 && ok2 {
+            return owner, time.Unix(0, expires), nil
+        }
+    }
+    return "", time.Time{}, errors.New("malformed worker lease")
+}
+{{end}}`
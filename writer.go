@@ -0,0 +1,85 @@
+package main
+
+const writerTemplate = `{{define "writer"}}
+// {{.Name}}Writer buffers Set and Delete calls and applies them in batched
+// transactions, which is much faster than one transaction per record for bulk
+// ingestion. Entities passed to Set must not be modified until flushed.
+// A {{.Name}}Writer is not safe for concurrent use.
+type {{.Name}}Writer struct {
+    repo   *{{.Name}}Repository
+    ops    []{{.Name}}Op
+    bytes  int
+    closed bool
+}
+
+// NewWriter returns a {{.Name}}Writer that writes through repo.
+func (repo *{{.Name}}Repository) NewWriter() *{{.Name}}Writer {
+    return &{{.Name}}Writer{repo: repo}
+}
+
+// Set buffers a write of entity, flushing if the buffer is full.
+func (w *{{.Name}}Writer) Set(ctx context.Context, entity *pb.{{.Name}}) error {
+    return w.add(ctx, {{.Name}}Op{Set: entity})
+}
+
+// Delete buffers a delete of the record with the given primary key, flushing
+// if the buffer is full.
+func (w *{{.Name}}Writer) Delete(ctx context.Context, {{range $index, $element := .PrimaryKeyFields}}{{if $index}}, {{end}}{{.Name}} {{.Type}}{{end}}) error {
+    return w.add(ctx, {{.Name}}Op{Delete: &{{.Name}}Key{ {{range .PrimaryKeyFields}}{{.Name}}: {{.Name}}, {{end}} }})
+}
+
+func (w *{{.Name}}Writer) add(ctx context.Context, op {{.Name}}Op) error {
+    if w.closed {
+        return errors.New("{{.Name}}Writer is closed")
+    }
+    w.ops = append(w.ops, op)
+    w.bytes += op.size()
+    limits := w.repo.batchLimits.withDefaults()
+    if w.bytes >= limits.MaxBytes || len(w.ops) >= limits.MaxOps {
+        return w.Flush(ctx)
+    }
+    return nil
+}
+
+// Flush applies all buffered operations in order. Operations are grouped
+// into transactions by the batch limits; a batch rejected as too large or
+// too slow is split in half and retried. On error, operations that were not
+// committed stay buffered.
+func (w *{{.Name}}Writer) Flush(ctx context.Context) error {
+    limits := w.repo.batchLimits.withDefaults()
+    for len(w.ops) > 0 {
+        n := next{{.Name}}Chunk(limits, len(w.ops), func(i int) int { return w.ops[i].size() })
+        for {
+            err := w.repo.applyOps(ctx, w.ops[:n])
+            var fdbErr fdb.Error
+            tooLarge := errors.As(err, &fdbErr) && fdbErr.Code == 2101
+            if (tooLarge || errors.Is(err, err{{.Name}}BatchTooSlow)) && n > 1 {
+                n /= 2
+                continue
+            }
+            if err != nil {
+                return err
+            }
+            break
+        }
+        for _, op := range w.ops[:n] {
+            w.bytes -= op.size()
+        }
+        w.ops = w.ops[n:]
+    }
+    w.ops = nil
+    return nil
+}
+
+// Close flushes any buffered operations. The writer cannot be used afterwards.
+func (w *{{.Name}}Writer) Close(ctx context.Context) error {
+    if w.closed {
+        return nil
+    }
+    if err := w.Flush(ctx); err != nil {
+        return err
+    }
+    w.closed = true
+    return nil
+}
+{{end}}`